@@ -0,0 +1,231 @@
+package lib
+
+import (
+    "bufio"
+    "bytes"
+    "fmt"
+    "io"
+    "os"
+    "path/filepath"
+    "slices"
+    "sort"
+)
+
+// diskFPSetIndexStride is the number of on-disk fingerprints per sparse index
+// entry. A lookup that misses memory reads at most one stride from disk.
+const diskFPSetIndexStride = 256
+
+// DiskFPSet is a set of fixed-width fingerprints with a bounded in-memory
+// footprint, in the style of TLC's DiskFPSet. New fingerprints are kept in a
+// memory buffer; when the buffer reaches memLimit entries it is sorted and
+// merged into a single sorted file in dir. A sparse index holding every
+// diskFPSetIndexStride-th key of the file stays in memory, so checking a
+// fingerprint that is not in the buffer costs one small read and a binary
+// search.
+type DiskFPSet struct {
+    dir      string
+    width    int
+    memLimit int
+
+    mem map[string]struct{}
+
+    file       *os.File
+    fileCount  int64
+    index      [][]byte
+    generation int
+}
+
+// NewDiskFPSet returns an empty set of width-byte fingerprints that keeps up
+// to memLimit of them in memory before flushing to dir. dir is created if it
+// does not exist.
+func NewDiskFPSet(dir string, width int, memLimit int) (*DiskFPSet, error) {
+    if width <= 0 || memLimit <= 0 {
+        return nil, fmt.Errorf("invalid fingerprint set parameters: width=%d memLimit=%d", width, memLimit)
+    }
+    if err := os.MkdirAll(dir, 0755); err != nil {
+        return nil, err
+    }
+    return &DiskFPSet{
+        dir:      dir,
+        width:    width,
+        memLimit: memLimit,
+        mem:      make(map[string]struct{}),
+    }, nil
+}
+
+// Len returns the number of fingerprints in the set.
+func (s *DiskFPSet) Len() int {
+    return len(s.mem) + int(s.fileCount)
+}
+
+// Contains reports whether fp is in the set.
+func (s *DiskFPSet) Contains(fp []byte) (bool, error) {
+    if err := s.checkWidth(fp); err != nil {
+        return false, err
+    }
+    if _, ok := s.mem[string(fp)]; ok {
+        return true, nil
+    }
+    return s.containsOnDisk(fp)
+}
+
+// Put adds fp to the set, flushing the memory buffer to disk when full. It
+// reports whether fp was newly added.
+func (s *DiskFPSet) Put(fp []byte) (bool, error) {
+    found, err := s.Contains(fp)
+    if err != nil || found {
+        return false, err
+    }
+    s.mem[string(fp)] = struct{}{}
+    if len(s.mem) >= s.memLimit {
+        if err := s.flush(); err != nil {
+            return true, err
+        }
+    }
+    return true, nil
+}
+
+// ForEach calls fn with every fingerprint in the set, in no particular order.
+// fn must not modify the set or retain the slice.
+func (s *DiskFPSet) ForEach(fn func(fp []byte) error) error {
+    for k := range s.mem {
+        if err := fn([]byte(k)); err != nil {
+            return err
+        }
+    }
+    if s.file == nil {
+        return nil
+    }
+    r := bufio.NewReader(io.NewSectionReader(s.file, 0, s.fileCount*int64(s.width)))
+    fp := make([]byte, s.width)
+    for i := int64(0); i < s.fileCount; i++ {
+        if _, err := io.ReadFull(r, fp); err != nil {
+            return err
+        }
+        if err := fn(fp); err != nil {
+            return err
+        }
+    }
+    return nil
+}
+
+// Close releases the backing file and removes it from disk.
+func (s *DiskFPSet) Close() error {
+    if s.file == nil {
+        return nil
+    }
+    name := s.file.Name()
+    err := s.file.Close()
+    s.file = nil
+    if rmErr := os.Remove(name); err == nil {
+        err = rmErr
+    }
+    return err
+}
+
+func (s *DiskFPSet) checkWidth(fp []byte) error {
+    if len(fp) != s.width {
+        return fmt.Errorf("fingerprint has %d bytes, want %d", len(fp), s.width)
+    }
+    return nil
+}
+
+func (s *DiskFPSet) containsOnDisk(fp []byte) (bool, error) {
+    if s.fileCount == 0 {
+        return false, nil
+    }
+    // Find the last index block whose first key is <= fp.
+    block := sort.Search(len(s.index), func(i int) bool {
+        return bytes.Compare(s.index[i], fp) > 0
+    }) - 1
+    if block < 0 {
+        return false, nil
+    }
+    start := int64(block) * diskFPSetIndexStride
+    n := min(int64(diskFPSetIndexStride), s.fileCount-start)
+    buf := make([]byte, n*int64(s.width))
+    if _, err := s.file.ReadAt(buf, start*int64(s.width)); err != nil {
+        return false, err
+    }
+    i := sort.Search(int(n), func(i int) bool {
+        return bytes.Compare(buf[i*s.width:(i+1)*s.width], fp) >= 0
+    })
+    return i < int(n) && bytes.Equal(buf[i*s.width:(i+1)*s.width], fp), nil
+}
+
+// flush merges the sorted memory buffer with the current file into a new
+// sorted file, rebuilds the sparse index and empties the buffer.
+func (s *DiskFPSet) flush() error {
+    keys := make([][]byte, 0, len(s.mem))
+    for k := range s.mem {
+        keys = append(keys, []byte(k))
+    }
+    slices.SortFunc(keys, bytes.Compare)
+
+    s.generation++
+    name := filepath.Join(s.dir, fmt.Sprintf("fingerprints-%06d.fp", s.generation))
+    out, err := os.Create(name)
+    if err != nil {
+        return err
+    }
+    w := bufio.NewWriter(out)
+    index := make([][]byte, 0, (s.Len()+diskFPSetIndexStride-1)/diskFPSetIndexStride)
+    var written int64
+    write := func(fp []byte) error {
+        if written%diskFPSetIndexStride == 0 {
+            index = append(index, bytes.Clone(fp))
+        }
+        written++
+        _, err := w.Write(fp)
+        return err
+    }
+
+    var old *bufio.Reader
+    if s.file != nil {
+        if _, err := s.file.Seek(0, io.SeekStart); err != nil {
+            out.Close()
+            return err
+        }
+        old = bufio.NewReader(s.file)
+    }
+    oldFp := make([]byte, s.width)
+    nextOld := func() (bool, error) {
+        if old == nil {
+            return false, nil
+        }
+        _, err := io.ReadFull(old, oldFp)
+        if err == io.EOF {
+            return false, nil
+        }
+        return err == nil, err
+    }
+    hasOld, err := nextOld()
+    for err == nil && (hasOld || len(keys) > 0) {
+        if hasOld && (len(keys) == 0 || bytes.Compare(oldFp, keys[0]) < 0) {
+            if err = write(oldFp); err == nil {
+                hasOld, err = nextOld()
+            }
+        } else {
+            err = write(keys[0])
+            keys = keys[1:]
+        }
+    }
+    if err == nil {
+        err = w.Flush()
+    }
+    if err != nil {
+        out.Close()
+        os.Remove(name)
+        return err
+    }
+
+    if err := s.Close(); err != nil {
+        out.Close()
+        return err
+    }
+    s.file = out
+    s.fileCount = written
+    s.index = index
+    clear(s.mem)
+    return nil
+}
@@ -0,0 +1,38 @@
+package lib
+
+import (
+    "crypto/sha256"
+    "fmt"
+    "testing"
+
+    "github.com/stretchr/testify/assert"
+    "github.com/stretchr/testify/require"
+)
+
+func TestDiskFPSet(t *testing.T) {
+    s, err := NewDiskFPSet(t.TempDir(), sha256.Size, 7)
+    require.Nil(t, err)
+    defer s.Close()
+
+    fp := func(i int) []byte {
+        sum := sha256.Sum256([]byte(fmt.Sprint(i)))
+        return sum[:]
+    }
+    for i := 0; i < 1000; i++ {
+        added, err := s.Put(fp(i))
+        require.Nil(t, err)
+        assert.True(t, added)
+    }
+    assert.Equal(t, 1000, s.Len())
+    for i := 0; i < 1000; i++ {
+        added, err := s.Put(fp(i))
+        require.Nil(t, err)
+        assert.False(t, added)
+    }
+    for i := 1000; i < 1100; i++ {
+        found, err := s.Contains(fp(i))
+        require.Nil(t, err)
+        assert.False(t, found)
+    }
+    assert.Equal(t, 1000, s.Len())
+}
@@ -0,0 +1,303 @@
+package lib
+
+import (
+    "bufio"
+    "encoding/binary"
+    "fmt"
+    "io"
+    "os"
+    "path/filepath"
+)
+
+// Codec converts queue elements to and from bytes, so DiskQueue can spill
+// them to disk.
+type Codec[T any] interface {
+    Encode(T) ([]byte, error)
+    Decode([]byte) (T, error)
+}
+
+// DiskQueue is a FIFO LinearCollection that keeps at most about two segments
+// of elements in memory. Elements added while older ones are still queued are
+// buffered in a tail segment; once the tail is full, it is encoded and written
+// to a segment file in dir. Segment files are read back in order, one element
+// at a time, so the dequeue order is exactly the enqueue order.
+type DiskQueue[T any] struct {
+    dir         string
+    codec       Codec[T]
+    segmentSize int
+
+    // head holds the oldest elements, still in memory.
+    head []T
+    // segments are the spilled segment files, oldest first. The first one
+    // is open in reader once head is drained.
+    segments []string
+    reader   *segmentReader
+    // tail holds the newest elements, not yet spilled.
+    tail []T
+
+    count       int
+    nextSegment int
+}
+
+type segmentReader struct {
+    file *os.File
+    buf  *bufio.Reader
+    // offset is the number of bytes of file already consumed.
+    offset int64
+}
+
+// NewDiskQueue returns an empty queue that spills to segment files of
+// segmentSize elements in dir. dir is created if it does not exist.
+func NewDiskQueue[T any](dir string, segmentSize int, codec Codec[T]) (*DiskQueue[T], error) {
+    if segmentSize <= 0 {
+        return nil, fmt.Errorf("segment size must be positive, got %d", segmentSize)
+    }
+    if err := os.MkdirAll(dir, 0755); err != nil {
+        return nil, err
+    }
+    return &DiskQueue[T]{dir: dir, codec: codec, segmentSize: segmentSize}, nil
+}
+
+func (q *DiskQueue[T]) Len() int {
+    return q.count
+}
+
+func (q *DiskQueue[T]) Empty() bool {
+    return q.count == 0
+}
+
+func (q *DiskQueue[T]) Add(t T) {
+    q.tail = append(q.tail, t)
+    q.count++
+    if len(q.tail) < q.segmentSize {
+        return
+    }
+    if len(q.head) == 0 && len(q.segments) == 0 {
+        // Nothing older is waiting, so the tail can simply become the head.
+        q.head = q.tail
+        q.tail = make([]T, 0, q.segmentSize)
+        return
+    }
+    if err := q.spill(); err != nil {
+        panic(fmt.Errorf("spilling queue segment: %w", err))
+    }
+}
+
+func (q *DiskQueue[T]) Remove() (T, bool) {
+    var v T
+    if q.count == 0 {
+        return v, false
+    }
+    q.count--
+    if len(q.head) > 0 {
+        v = q.head[0]
+        var zero T
+        q.head[0] = zero
+        q.head = q.head[1:]
+        return v, true
+    }
+    if len(q.segments) > 0 {
+        v, err := q.readNext()
+        if err != nil {
+            panic(fmt.Errorf("reading queue segment: %w", err))
+        }
+        return v, true
+    }
+    v = q.tail[0]
+    q.head = q.tail[1:]
+    q.tail = make([]T, 0, q.segmentSize)
+    return v, true
+}
+
+func (q *DiskQueue[T]) Clear(int) {
+    //TODO implement me
+    panic("Clear not implemented.")
+}
+
+func (q *DiskQueue[T]) ClearAll() {
+    q.closeReader()
+    for _, name := range q.segments {
+        _ = os.Remove(name)
+    }
+    q.head = nil
+    q.segments = nil
+    q.tail = nil
+    q.count = 0
+}
+
+func (q *DiskQueue[T]) Retain(n int) {
+    //TODO implement me
+    panic("Retain not implemented")
+}
+
+// SpilledSegments returns the number of segment files currently on disk.
+func (q *DiskQueue[T]) SpilledSegments() int {
+    return len(q.segments)
+}
+
+// spill writes the tail to a new segment file. Each record is the uvarint
+// length of the encoded element followed by the encoded bytes.
+func (q *DiskQueue[T]) spill() error {
+    name := filepath.Join(q.dir, fmt.Sprintf("frontier-%06d.seg", q.nextSegment))
+    q.nextSegment++
+    f, err := os.Create(name)
+    if err != nil {
+        return err
+    }
+    w := bufio.NewWriter(f)
+    if err := q.encodeAll(w, q.tail); err != nil {
+        f.Close()
+        return err
+    }
+    if err := w.Flush(); err != nil {
+        f.Close()
+        return err
+    }
+    if err := f.Close(); err != nil {
+        return err
+    }
+    q.segments = append(q.segments, name)
+    clear(q.tail)
+    q.tail = q.tail[:0]
+    return nil
+}
+
+func (q *DiskQueue[T]) readNext() (T, error) {
+    var v T
+    for {
+        if q.reader == nil {
+            f, err := os.Open(q.segments[0])
+            if err != nil {
+                return v, err
+            }
+            q.reader = &segmentReader{file: f, buf: bufio.NewReader(f)}
+        }
+        data, err := ReadRecord(q.reader.buf)
+        if err == io.EOF {
+            // Segment exhausted, move on to the next one.
+            q.closeReader()
+            _ = os.Remove(q.segments[0])
+            q.segments = q.segments[1:]
+            if len(q.segments) == 0 {
+                return v, io.ErrUnexpectedEOF
+            }
+            continue
+        }
+        if err != nil {
+            return v, err
+        }
+        q.reader.offset += recordSize(data)
+        v, err = q.codec.Decode(data)
+        if err != nil {
+            return v, err
+        }
+        if _, err := q.reader.buf.Peek(1); err == io.EOF {
+            q.closeReader()
+            _ = os.Remove(q.segments[0])
+            q.segments = q.segments[1:]
+        }
+        return v, nil
+    }
+}
+
+// WriteTo writes every queued element, oldest first, as a sequence of records
+// (see WriteRecord), without removing them. Spilled segments are copied as
+// they are, so nothing is decoded.
+func (q *DiskQueue[T]) WriteTo(w io.Writer) (int64, error) {
+    cw := &countingWriter{w: w}
+    if err := q.encodeAll(cw, q.head); err != nil {
+        return cw.n, err
+    }
+    for i, name := range q.segments {
+        var offset int64
+        if i == 0 && q.reader != nil {
+            offset = q.reader.offset
+        }
+        if err := copyFrom(cw, name, offset); err != nil {
+            return cw.n, err
+        }
+    }
+    err := q.encodeAll(cw, q.tail)
+    return cw.n, err
+}
+
+func (q *DiskQueue[T]) encodeAll(w io.Writer, elements []T) error {
+    for _, t := range elements {
+        data, err := q.codec.Encode(t)
+        if err != nil {
+            return err
+        }
+        if err := WriteRecord(w, data); err != nil {
+            return err
+        }
+    }
+    return nil
+}
+
+func copyFrom(w io.Writer, name string, offset int64) error {
+    f, err := os.Open(name)
+    if err != nil {
+        return err
+    }
+    defer f.Close()
+    if _, err := f.Seek(offset, io.SeekStart); err != nil {
+        return err
+    }
+    _, err = io.Copy(w, f)
+    return err
+}
+
+type countingWriter struct {
+    w io.Writer
+    n int64
+}
+
+func (c *countingWriter) Write(b []byte) (int, error) {
+    n, err := c.w.Write(b)
+    c.n += int64(n)
+    return n, err
+}
+
+// WriteRecord writes data as one record: its uvarint length followed by the
+// bytes. DiskQueue segments are sequences of records.
+func WriteRecord(w io.Writer, data []byte) error {
+    var lenBuf [binary.MaxVarintLen64]byte
+    n := binary.PutUvarint(lenBuf[:], uint64(len(data)))
+    if _, err := w.Write(lenBuf[:n]); err != nil {
+        return err
+    }
+    _, err := w.Write(data)
+    return err
+}
+
+// ReadRecord reads one record written by WriteRecord. It returns io.EOF only
+// when r is exhausted at a record boundary.
+func ReadRecord(r *bufio.Reader) ([]byte, error) {
+    size, err := binary.ReadUvarint(r)
+    if err != nil {
+        return nil, err
+    }
+    data := make([]byte, size)
+    if _, err := io.ReadFull(r, data); err != nil {
+        if err == io.EOF {
+            err = io.ErrUnexpectedEOF
+        }
+        return nil, err
+    }
+    return data, nil
+}
+
+func recordSize(data []byte) int64 {
+    var lenBuf [binary.MaxVarintLen64]byte
+    return int64(binary.PutUvarint(lenBuf[:], uint64(len(data))) + len(data))
+}
+
+func (q *DiskQueue[T]) closeReader() {
+    if q.reader != nil {
+        q.reader.file.Close()
+        q.reader = nil
+    }
+}
+
+// Ensures DiskQueue implements LinearCollection
+var _ LinearCollection[interface{}] = (*(DiskQueue[interface{}]))(nil)
@@ -0,0 +1,51 @@
+package lib
+
+import (
+    "fmt"
+    "testing"
+
+    "github.com/stretchr/testify/assert"
+    "github.com/stretchr/testify/require"
+)
+
+type intCodec struct{}
+
+func (intCodec) Encode(i int) ([]byte, error) {
+    return []byte(fmt.Sprint(i)), nil
+}
+
+func (intCodec) Decode(b []byte) (int, error) {
+    var i int
+    _, err := fmt.Sscan(string(b), &i)
+    return i, err
+}
+
+func TestDiskQueue(t *testing.T) {
+    q, err := NewDiskQueue[int](t.TempDir(), 3, intCodec{})
+    require.Nil(t, err)
+
+    // Interleave adds and removes so elements move through the head, the
+    // spilled segments and the tail.
+    next, expected := 0, 0
+    for round := 0; round < 20; round++ {
+        for i := 0; i < 7; i++ {
+            q.Add(next)
+            next++
+        }
+        for i := 0; i < 5; i++ {
+            v, ok := q.Remove()
+            require.True(t, ok)
+            assert.Equal(t, expected, v)
+            expected++
+        }
+    }
+    for !q.Empty() {
+        v, ok := q.Remove()
+        require.True(t, ok)
+        assert.Equal(t, expected, v)
+        expected++
+    }
+    assert.Equal(t, next, expected)
+    _, ok := q.Remove()
+    assert.False(t, ok)
+}
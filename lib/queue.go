@@ -86,6 +86,19 @@ func (q *Queue[T]) Dequeue() (T, bool) {
     return res, true
 }
 
+// PeekN returns up to n elements from the front of the queue, in dequeue
+// order, without removing them.
+func (q *Queue[T]) PeekN(n int) []T {
+    q.lock.Lock()
+    defer q.lock.Unlock()
+    res := make([]T, 0, min(n, q.count))
+    for e := q.list.Front(); e != nil && len(res) < n; e = e.Next() {
+        batch := e.Value.([]T)
+        res = append(res, batch[:min(len(batch), n-len(res))]...)
+    }
+    return res
+}
+
 func (q *Queue[T]) Count() int {
     q.lock.Lock()
     defer q.lock.Unlock()
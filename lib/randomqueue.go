@@ -32,6 +32,36 @@ func (r *RandomQueue[T]) Remove() (T, bool) {
     return v, true
 }
 
+// RemoveWeighted removes an element chosen with probability proportional
+// to its weight. weights gets the elements and returns a weight for each.
+// Elements with a weight <= 0 are only chosen when no element has a
+// positive weight.
+func (r *RandomQueue[T]) RemoveWeighted(weights func(items []T) []float64) (T, bool) {
+    r.lock.Lock()
+    defer r.lock.Unlock()
+    var v T
+    n := len(r.arr)
+    if n == 0 {
+        return v, false
+    }
+    w := weights(r.arr)
+    total := 0.0
+    for i := range w {
+        w[i] = max(0, w[i])
+        total += w[i]
+    }
+    idx := r.rand.Intn(n)
+    if total > 0 {
+        x := r.rand.Float64() * total
+        for idx = 0; idx < n-1 && x >= w[idx]; idx++ {
+            x -= w[idx]
+        }
+    }
+    v = r.arr[idx]
+    r.arr = append(r.arr[:idx], r.arr[idx+1:]...)
+    return v, true
+}
+
 func (r *RandomQueue[T]) Clear(n int) {
     // Remove the first n elements
     r.lock.Lock()
@@ -5,14 +5,6 @@ import (
     "go.starlark.net/starlark"
 )
 
-var (
-    nextChannelId = 0
-)
-
-func ClearChannelRefs() {
-    nextChannelId = 0
-}
-
 // Channel represents a custom Starlark object
 type Channel struct {
     Id       int    `json:"id"`
@@ -80,7 +72,7 @@ func (c *Channel) AttrNames() []string {
     return []string{"ordering", "delivery", "blocking", "stub"}
 }
 
-func CreateChannelBuiltin(channels map[int]*Channel) *starlark.Builtin {
+func CreateChannelBuiltin(channels map[int]*Channel, counters *RefCounters) *starlark.Builtin {
     return starlark.NewBuiltin("Channel", func(t *starlark.Thread, b *starlark.Builtin,
         args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
         var ordering, delivery, blocking string
@@ -96,9 +88,10 @@ func CreateChannelBuiltin(channels map[int]*Channel) *starlark.Builtin {
             return nil, fmt.Errorf("unsupported channel configuration: ordering=%q, delivery=%q, blocking=%q."+
                 " Only (unordered, exactly_once, fire_and_forget) channel is supported at this moment", ordering, delivery, blocking)
         }
-        newChannel := &Channel{Id: nextChannelId, ordering: ordering, delivery: delivery, blocking: blocking}
-        channels[nextChannelId] = newChannel
-        nextChannelId++
+        id := counters.NextChannelId
+        newChannel := &Channel{Id: id, ordering: ordering, delivery: delivery, blocking: blocking}
+        channels[id] = newChannel
+        counters.NextChannelId++
         return newChannel, nil
     })
 }
@@ -14,36 +14,35 @@ var (
 	}
 )
 
-var (
-	roleRefs = map[string]int64{}
-)
-
-func ClearRoleRefs() {
-	roleRefs = map[string]int64{}
-}
-
-// GlobalRefsSnapshot captures the package-level allocation counters that
-// action execution mutates as a side effect (role refs, channel ids).
-// Speculative execution that will be discarded (e.g. the next_states()
-// assertion probe) must snapshot before executing and restore after, so the
-// discarded runs don't shift the ref numbering of subsequent real
-// exploration.
-type GlobalRefsSnapshot struct {
-	roleRefs      map[string]int64
-	nextChannelId int
-}
-
-func SnapshotGlobalRefs() GlobalRefsSnapshot {
-	copied := make(map[string]int64, len(roleRefs))
-	for k, v := range roleRefs {
+// RefCounters holds the allocation counters that action execution advances
+// as a side effect: the next ref per role name and the next channel id.
+// Each Process owns its own copy (cloned on Fork), so the numbering depends
+// only on the path that led to a state, never on the order in which the
+// model checker happened to explore states. That keeps the numbering
+// deterministic and lets independent processes execute concurrently.
+//
+// This changes the refs in traces from when the counters were global: a
+// role created on a path is numbered by the roles of its name created
+// earlier on that path, not by all those created anywhere before it in the
+// exploration. States that differed only in such refs now hash the same.
+type RefCounters struct {
+	RoleRefs      map[string]int64
+	NextChannelId int
+}
+
+func NewRefCounters() *RefCounters {
+	return &RefCounters{RoleRefs: map[string]int64{}}
+}
+
+func (c *RefCounters) Clone() *RefCounters {
+	if c == nil {
+		return NewRefCounters()
+	}
+	copied := make(map[string]int64, len(c.RoleRefs))
+	for k, v := range c.RoleRefs {
 		copied[k] = v
 	}
-	return GlobalRefsSnapshot{roleRefs: copied, nextChannelId: nextChannelId}
-}
-
-func RestoreGlobalRefs(s GlobalRefsSnapshot) {
-	roleRefs = s.roleRefs
-	nextChannelId = s.nextChannelId
+	return &RefCounters{RoleRefs: copied, NextChannelId: c.NextChannelId}
 }
 
 type Role struct {
@@ -199,17 +198,13 @@ var _ starlark.HasAttrs = (*Role)(nil)
 var _ starlark.HasSetField = (*Role)(nil)
 var _ starlark.Value = (*Role)(nil)
 
-func CreateRoleBuiltin(astRole *ast.Role, symmetric bool, roles *[]*Role) *starlark.Builtin {
+func CreateRoleBuiltin(astRole *ast.Role, symmetric bool, roles *[]*Role, counters *RefCounters) *starlark.Builtin {
 	name := astRole.Name
 	return starlark.NewBuiltin(name, func(t *starlark.Thread, b *starlark.Builtin,
 		args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
 		params := FromKeywords(starlark.String("params"), kwargs)
-		nextRef := roleRefs[name]
-		if roleRefs[name] > 0 {
-			roleRefs[name]++
-		} else {
-			roleRefs[name] = 1
-		}
+		nextRef := counters.RoleRefs[name]
+		counters.RoleRefs[name] = nextRef + 1
 		fields := FromStringDict(starlark.String("fields"), starlark.StringDict{})
 		initValues := FromStringDict(starlark.String("init_values"), starlark.StringDict{})
 		roleMethods := make(map[string]*starlark.Builtin)
@@ -10,12 +10,14 @@ import (
 	"github.com/fizzbee-io/fizzbee/modelchecker"
 	"google.golang.org/protobuf/encoding/protojson"
 	"google.golang.org/protobuf/proto"
+	"io"
 	"os"
 	"os/exec"
 	"os/signal"
 	"path/filepath"
 	"runtime/pprof"
 	"slices"
+	"strconv"
 	"strings"
 	"sync/atomic"
 	"syscall"
@@ -43,6 +45,36 @@ var experimentalProcessedQueue bool
 var experimentalNoGraph bool
 var experimentalNoStateReturns bool
 var noSymmetryReduction bool
+var workers int
+var diskSpill bool
+var diskSpillMemStates int
+var fingerprintBits int
+var paranoidHashes bool
+var checkpointInterval time.Duration
+var resumeDir string
+var maxTime time.Duration
+var maxMemory string
+var maxMemoryBytes uint64
+var progressFormat string
+var progressFile string
+var progressInterval time.Duration
+var progressReporter *modelchecker.ProgressReporter
+var partialOrderReduction bool
+var swarm int
+var simWorkers int
+var simMasterSeed int64
+var simGuided bool
+var smc bool
+var smcConfidence float64
+var smcError float64
+var smcThreshold float64
+var smcIndifference float64
+var perfModelFile string
+var perfMethod string
+var perfSamples int
+var queriesFile string
+var prismExport bool
+var onTheFlyLiveness bool
 
 func main() {
 	args := parseFlags()
@@ -60,20 +92,72 @@ func main() {
 		experimentalProcessedQueue = true
 	}
 
+	if partialOrderReduction {
+		if simulation {
+			fmt.Println("--partial_order_reduction applies only to exhaustive model checking, not --simulation.")
+			os.Exit(1)
+		}
+		if !experimentalProcessedQueue {
+			fmt.Println("Note: --partial_order_reduction auto-enables --experimental_processed_queue.")
+			experimentalProcessedQueue = true
+		}
+	}
+
+	// --disk_spill replaces the hash-only visited set of the no-graph mode
+	// and relies on the fixed bfs order to rebuild spilled states.
+	if diskSpill {
+		if !experimentalNoGraph {
+			fmt.Println("--disk_spill requires --experimental_no_graph.")
+			os.Exit(1)
+		}
+		if simulation || explorationStrategy != "bfs" || traceFile != "" || trace != "" || traceExtend > 0 {
+			fmt.Println("--disk_spill supports only exhaustive bfs exploration without a guided trace.")
+			os.Exit(1)
+		}
+	}
+
+	// Checkpoints store the processed queue, so they share the constraints
+	// of --disk_spill.
+	if checkpointInterval > 0 || resumeDir != "" {
+		if !experimentalNoGraph {
+			fmt.Println("--checkpoint_interval and --resume require --experimental_no_graph.")
+			os.Exit(1)
+		}
+		if simulation || explorationStrategy != "bfs" || traceFile != "" || trace != "" || traceExtend > 0 {
+			fmt.Println("--checkpoint_interval and --resume support only exhaustive bfs exploration without a guided trace.")
+			os.Exit(1)
+		}
+	}
+
+	// The swarm plans its own dfs and random searches, each of which keeps
+	// the graph for the deadlock check.
+	if swarm > 0 && (simulation || experimentalProcessedQueue || traceFile != "" || trace != "" || traceExtend > 0) {
+		fmt.Println("--swarm supports only exhaustive model checking without --experimental_processed_queue (or the flags that enable it) and without a guided trace.")
+		os.Exit(1)
+	}
+
+	// The on-the-fly liveness check searches the graph the default
+	// exploration keeps.
+	if onTheFlyLiveness && (simulation || experimentalProcessedQueue || swarm > 0 || traceFile != "" || trace != "" || traceExtend > 0) {
+		fmt.Println("--on_the_fly_liveness supports only exhaustive model checking without --experimental_processed_queue (or the flags that enable it), --swarm or a guided trace.")
+		os.Exit(1)
+	}
+
 	// Get the input JSON file name from command line argument
 	jsonFilename := args[0]
 	dirPath := filepath.Dir(jsonFilename)
 
 	f := loadInputJSON(jsonFilename)
 
-	// --experimental_no_graph cannot support liveness checks (no graph to
-	// run SCC/cycle detection on). Refuse upfront if the spec declares any
-	// always-eventually / eventually-always / eventually invariants.
-	if experimentalNoGraph {
+	// --experimental_no_graph checks liveness on the fingerprint graph it
+	// records in memory, which disk spill and checkpoints do not keep.
+	// Refuse upfront if the spec declares any always-eventually /
+	// eventually-always / eventually invariants.
+	if experimentalNoGraph && (diskSpill || checkpointInterval > 0 || resumeDir != "") {
 		for _, inv := range f.Invariants {
 			for _, op := range inv.TemporalOperators {
 				if op == "eventually" || op == "always-eventually" || op == "eventually-always" {
-					fmt.Printf("--experimental_no_graph refused: spec declares liveness invariant '%s' (operator '%s'). The no-graph mode keeps no state graph, so cycle-based liveness checks cannot run.\n", inv.Name, op)
+					fmt.Printf("--disk_spill, --checkpoint_interval and --resume refused: spec declares liveness invariant '%s' (operator '%s'). The no-graph mode checks liveness on a state graph kept in memory, which they do not save.\n", inv.Name, op)
 					os.Exit(1)
 				}
 			}
@@ -92,6 +176,14 @@ func main() {
 		applyDefaultStateOptions(stateConfig)
 	}
 
+	// The ltl and leads_to properties are checked on the complete state
+	// graph, which these modes do not keep; refuse rather than report them
+	// as passed.
+	if (len(stateConfig.GetLtl()) > 0 || len(stateConfig.GetLeadsTo()) > 0) && (experimentalNoGraph || swarm > 0 || smc) {
+		fmt.Println("--experimental_no_graph, --swarm and --smc refused: the options declare ltl or leads_to properties, which are checked on the complete state graph that these modes do not keep.")
+		os.Exit(exitError)
+	}
+
 	// no_graph mode cannot drive crash simulation (the crash variants
 	// rely on the in-memory graph: Attach/visited/Inbound). Warn loudly
 	// when crash_on_yield is on; the per-yield-point crashProcess /
@@ -102,12 +194,25 @@ func main() {
 
 	outDir, err := createOutputDir(dirPath, isTest)
 	if err != nil {
-		return
+		os.Exit(exitError)
 	}
 	err = dumpStateSpaceOptions(stateConfig, outDir)
 	if err != nil {
 		fmt.Printf("Error writing state space options: %v\n", err)
-		return
+		os.Exit(exitError)
+	}
+
+	if progressFormat == "jsonl" {
+		w := io.Writer(os.Stderr)
+		if progressFile != "" {
+			pf, err := os.Create(progressFile)
+			if err != nil {
+				fmt.Println("Error creating progress file:", err)
+				os.Exit(exitError)
+			}
+			w = pf
+		}
+		progressReporter = modelchecker.NewProgressReporter(w, progressInterval)
 	}
 
 	if f.Composition != nil {
@@ -115,7 +220,7 @@ func main() {
 	} else if len(f.Refinements) > 0 {
 		if len(f.Refinements) > 1 {
 			fmt.Println("Multiple refinements found. Only single refinement is supported currently. Contact us if you need support for multiple refinements.")
-			return
+			os.Exit(exitError)
 		}
 		runRefinementModelChecking(f, dirPath, outDir, jsonFilename)
 	} else {
@@ -124,11 +229,12 @@ func main() {
 			err = copyAstToOutputDir(jsonFilename, outDir)
 			if err != nil {
 				fmt.Printf("Error copying AST file: %v\n", err)
-				return
+				os.Exit(exitError)
 			}
 		}
 		modelCheckSingleSpec(f, stateConfig, dirPath, outDir, sourceFileName, jsonFilename, nil)
 	}
+	os.Exit(exitCode)
 }
 
 func dumpStateSpaceOptions(stateConfig *ast.StateSpaceOptions, outDir string) error {
@@ -162,8 +268,11 @@ func copyAstToOutputDir(jsonFilename string, outDir string) error {
 }
 
 func runCompositionalModelChecking(f *ast.File, dirPath string, outDir string) {
+	result := newRunResult(filepath.Join(dirPath, f.SourceInfo.GetFileName()))
+	defer result.finish(outDir)
 	if simulation {
 		fmt.Println("Simulation mode not supported for composition")
+		result.setError("simulation mode not supported for composition")
 		return
 	}
 	roots := make(map[string]*modelchecker.Node)
@@ -176,9 +285,11 @@ func runCompositionalModelChecking(f *ast.File, dirPath string, outDir string) {
 		fileRef, fnRef, err := ParseFunctionRef(spec.Expr.GetPyExpr())
 		if err != nil {
 			fmt.Println("Error parsing function reference:", err)
+			result.setError(fmt.Sprintf("parsing function reference: %v", err))
 			return
 		} else if fileRef != spec.Name {
 			fmt.Println("File reference does not match spec name:", fileRef, "!=", spec.Name)
+			result.setError(fmt.Sprintf("file reference does not match spec name: %s != %s", fileRef, spec.Name))
 			return
 		}
 		// Get the new json file name as dirPath + "/" + name + ".json"
@@ -190,24 +301,28 @@ func runCompositionalModelChecking(f *ast.File, dirPath string, outDir string) {
 		composedOutDir := filepath.Join(outDir, spec.Name)
 		if err := os.MkdirAll(composedOutDir, 0755); err != nil {
 			fmt.Println("Error creating directory:", err)
+			result.setError(fmt.Sprintf("creating directory: %v", err))
 			return
 		}
 		if copyAst {
 			err = copyAstToOutputDir(composedJsonFileName, composedOutDir)
 			if err != nil {
 				fmt.Printf("Error copying AST file: %v\n", err)
+				result.setError(fmt.Sprintf("copying AST file: %v", err))
 				return
 			}
 		}
 		err = dumpStateSpaceOptions(composedStateConfig, composedOutDir)
 		if err != nil {
 			fmt.Printf("Error writing state space options: %v\n", err)
+			result.setError(fmt.Sprintf("writing state space options: %v", err))
 			return
 		}
 		fmt.Println("Model checking composed spec:", composedSourceFileName)
 		root := modelCheckSingleSpec(composedFile, composedStateConfig, dirPath, composedOutDir, composedSourceFileName, composedJsonFileName, nil)
 		if root == nil {
 			fmt.Println("Error in model checking composed spec:", spec.Name, "Aborting")
+			result.failSpec(spec.Name)
 			return
 		}
 		roots[spec.Name] = root
@@ -215,22 +330,29 @@ func runCompositionalModelChecking(f *ast.File, dirPath string, outDir string) {
 		populateJoinHashes(joinHashes, i, root, fileRef, fnRef)
 	}
 
-	err := ComposeTransitions(f, joinHashes, rootsList, outDir)
+	err := ComposeTransitions(f, joinHashes, rootsList, outDir, result)
 	if err != nil {
 		fmt.Println("Error composing transitions:", err)
+		if result.Failure == nil {
+			result.setError(fmt.Sprintf("composing transitions: %v", err))
+		}
 		return
 	}
-	return
+	result.pass()
 }
 
 func runRefinementModelChecking(f *ast.File, dirPath string, outDir string, jsonFilename string) {
+	result := newRunResult(filepath.Join(dirPath, f.SourceInfo.GetFileName()))
+	defer result.finish(outDir)
 	if simulation {
 		fmt.Println("Simulation mode not supported for refinement")
+		result.setError("simulation mode not supported for refinement")
 		return
 	}
 
 	if len(f.Refinements) == 0 {
 		fmt.Println("No refinement specification found")
+		result.setError("no refinement specification found")
 		return
 	}
 
@@ -255,9 +377,11 @@ func runRefinementModelChecking(f *ast.File, dirPath string, outDir string, json
 		fileRef, fnRef, err := ParseFunctionRef(spec.Expr.GetPyExpr())
 		if err != nil {
 			fmt.Println("Error parsing function reference:", err)
+			result.setError(fmt.Sprintf("parsing function reference: %v", err))
 			return
 		} else if fileRef != spec.Name {
 			fmt.Println("File reference does not match spec name:", fileRef, "!=", spec.Name)
+			result.setError(fmt.Sprintf("file reference does not match spec name: %s != %s", fileRef, spec.Name))
 			return
 		}
 
@@ -271,18 +395,21 @@ func runRefinementModelChecking(f *ast.File, dirPath string, outDir string, json
 		abstractOutDir := filepath.Join(outDir, spec.Name)
 		if err := os.MkdirAll(abstractOutDir, 0755); err != nil {
 			fmt.Println("Error creating directory:", err)
+			result.setError(fmt.Sprintf("creating directory: %v", err))
 			return
 		}
 		if copyAst {
 			err = copyAstToOutputDir(abstractJsonFile, abstractOutDir)
 			if err != nil {
 				fmt.Printf("Error copying AST file: %v\n", err)
+				result.setError(fmt.Sprintf("copying AST file: %v", err))
 				return
 			}
 		}
 		err = dumpStateSpaceOptions(stateConfig, abstractOutDir)
 		if err != nil {
 			fmt.Printf("Error writing state space options: %v\n", err)
+			result.setError(fmt.Sprintf("writing state space options: %v", err))
 			return
 		}
 
@@ -290,6 +417,7 @@ func runRefinementModelChecking(f *ast.File, dirPath string, outDir string, json
 		root := modelCheckSingleSpec(abstractFile, stateConfig, dirPath, abstractOutDir, abstractSourceFile, abstractJsonFile, nil)
 		if root == nil {
 			fmt.Println("Error in model checking abstract spec:", spec.Name)
+			result.failSpec(spec.Name)
 			return
 		}
 
@@ -300,6 +428,7 @@ func runRefinementModelChecking(f *ast.File, dirPath string, outDir string, json
 
 	if implSpecIndex == -1 {
 		fmt.Println("Error: no implementation (_) spec found in refinement block")
+		result.setError("no implementation (_) spec found in refinement block")
 		return
 	}
 
@@ -307,6 +436,7 @@ func runRefinementModelChecking(f *ast.File, dirPath string, outDir string, json
 	implOutDir := filepath.Join(outDir, "_")
 	if err := os.MkdirAll(implOutDir, 0755); err != nil {
 		fmt.Println("Error creating directory:", err)
+		result.setError(fmt.Sprintf("creating directory: %v", err))
 		return
 	}
 
@@ -314,6 +444,7 @@ func runRefinementModelChecking(f *ast.File, dirPath string, outDir string, json
 		err := copyAstToOutputDir(jsonFilename, implOutDir)
 		if err != nil {
 			fmt.Printf("Error copying AST file: %v\n", err)
+			result.setError(fmt.Sprintf("copying AST file: %v", err))
 			return
 		}
 	}
@@ -324,16 +455,17 @@ func runRefinementModelChecking(f *ast.File, dirPath string, outDir string, json
 	err := dumpStateSpaceOptions(stateConfig, implOutDir)
 	if err != nil {
 		fmt.Printf("Error writing state space options: %v\n", err)
+		result.setError(fmt.Sprintf("writing state space options: %v", err))
 		return
 	}
 
 	root := modelCheckSingleSpec(f, stateConfig, dirPath, implOutDir, f.SourceInfo.GetFileName(), jsonFilename, joinHashes)
 	if root == nil {
 		fmt.Println("Error in model checking implementation spec")
+		result.failSpec("_")
 		return
 	}
-
-	return
+	result.pass()
 }
 
 type ComposedNode = struct {
@@ -373,7 +505,10 @@ func cartesianProduct(sets []modelchecker.TransitionSet, handler func(ts []lib.P
 	return failedNode, failedTransition
 }
 
-func ComposeTransitions(f *ast.File, joinHashes modelchecker.JoinHashes, roots []*modelchecker.Node, outDir string) error {
+// ComposeTransitions checks the assertions of the composition on the joined
+// states and transitions of the composed specs, and records a failure in
+// result.
+func ComposeTransitions(f *ast.File, joinHashes modelchecker.JoinHashes, roots []*modelchecker.Node, outDir string, result *runResult) error {
 	hasTransitionInvariant := false
 	for _, invariant := range f.Invariants {
 		if invariant.Block != nil && slices.Contains(invariant.TemporalOperators, "transition") {
@@ -452,9 +587,11 @@ func ComposeTransitions(f *ast.File, joinHashes modelchecker.JoinHashes, roots [
 				fmt.Println("Failed Composed Node:", failedTransition)
 				printComposedTransition(failedTransition)
 				dumpComposedFailedTransition(failedTransition, f.Composition, roots, outDir)
+				result.fail(failureTransition, f.Invariants[failedTransition.To.Inbound[0].FailedInvariants[0][0]], nil)
 			} else /*if failedNode != nil*/ {
 				fmt.Println("Failed Composed Node:", failedNode.Nodes)
 				dumpComposedFailedNode(failedNode, f.Composition, roots, outDir)
+				result.failInvariant(f.Invariants[failedNode.Process.FailedInvariants[0][0]], nil)
 			}
 			return fmt.Errorf("failed to compose transitions for key %s", key)
 		}
@@ -553,13 +690,19 @@ func addToJoinHashes(joinHashes modelchecker.JoinHashes, i int, from, to *modelc
 // graph) so the standard error-report machinery prints the per-step
 // state — converting the lightweight no_graph trace into the full
 // rich output that the user would have seen without --experimental_no_graph.
+// For a liveness lasso, cycleStart is the index of the first step of the
+// cycle, marked in the trace file; it is -1 otherwise.
 // Best-effort: failures to write/exec just print a fallback command.
-func replayTraceWithFullState(path []string, outDir, jsonFilename string) {
+func replayTraceWithFullState(path []string, cycleStart int, outDir, jsonFilename string) {
 	if len(path) == 0 || jsonFilename == "" {
 		return
 	}
 	traceFile := filepath.Join(outDir, "trace.txt")
-	body := strings.Join(path, "\n") + "\n"
+	lines := path
+	if cycleStart >= 0 {
+		lines = slices.Concat(path[:cycleStart], []string{modelchecker.TraceCycleMarker}, path[cycleStart:])
+	}
+	body := strings.Join(lines, "\n") + "\n"
 	if err := os.WriteFile(traceFile, []byte(body), 0644); err != nil {
 		fmt.Printf("(replay skipped: %v)\n", err)
 		return
@@ -591,6 +734,9 @@ func replayTraceWithFullState(path []string, outDir, jsonFilename string) {
 }
 
 func modelCheckSingleSpec(f *ast.File, stateConfig *ast.StateSpaceOptions, dirPath string, outDir string, sourceFileName string, jsonFilename string, hashes modelchecker.JoinHashes) *modelchecker.Node {
+	result := newRunResult(sourceFileName)
+	defer result.finish(outDir)
+
 	// Parse trace if provided (either from file or string)
 	var guidedTrace *modelchecker.GuidedTrace
 	if traceFile != "" {
@@ -598,6 +744,7 @@ func modelCheckSingleSpec(f *ast.File, stateConfig *ast.StateSpaceOptions, dirPa
 		guidedTrace, err = modelchecker.ParseTraceFile(traceFile)
 		if err != nil {
 			fmt.Printf("Error parsing trace file: %v\n", err)
+			result.setError(fmt.Sprintf("parsing trace file: %v", err))
 			return nil
 		}
 		fmt.Printf("Loaded trace with %d links\n", len(guidedTrace.LinkNames))
@@ -605,6 +752,7 @@ func modelCheckSingleSpec(f *ast.File, stateConfig *ast.StateSpaceOptions, dirPa
 		// Trace mode is incompatible with simulation
 		if simulation {
 			fmt.Println("Error: --trace-file and --simulation cannot be used together")
+			result.setError("--trace-file and --simulation cannot be used together")
 			return nil
 		}
 	} else if trace != "" {
@@ -612,6 +760,7 @@ func modelCheckSingleSpec(f *ast.File, stateConfig *ast.StateSpaceOptions, dirPa
 		guidedTrace, err = modelchecker.ParseTraceString(trace)
 		if err != nil {
 			fmt.Printf("Error parsing trace string: %v\n", err)
+			result.setError(fmt.Sprintf("parsing trace string: %v", err))
 			return nil
 		}
 		fmt.Printf("Loaded trace with %d links\n", len(guidedTrace.LinkNames))
@@ -619,6 +768,7 @@ func modelCheckSingleSpec(f *ast.File, stateConfig *ast.StateSpaceOptions, dirPa
 		// Trace mode is incompatible with simulation
 		if simulation {
 			fmt.Println("Error: --trace and --simulation cannot be used together")
+			result.setError("--trace and --simulation cannot be used together")
 			return nil
 		}
 	} else if traceExtend > 0 {
@@ -627,6 +777,7 @@ func modelCheckSingleSpec(f *ast.File, stateConfig *ast.StateSpaceOptions, dirPa
 		// ExtendDepth > 0 signals "explore N steps from Init" to ShouldScheduleNode.
 		if simulation {
 			fmt.Println("Error: --trace-extend and --simulation cannot be used together")
+			result.setError("--trace-extend and --simulation cannot be used together")
 			return nil
 		}
 		guidedTrace = &modelchecker.GuidedTrace{}
@@ -644,6 +795,7 @@ func modelCheckSingleSpec(f *ast.File, stateConfig *ast.StateSpaceOptions, dirPa
 		content, err := os.ReadFile(preinitHookFile)
 		if err != nil {
 			fmt.Printf("Error reading preinit hook file: %v\n", err)
+			result.setError(fmt.Sprintf("reading preinit hook file: %v", err))
 			return nil
 		}
 		preinitHookContentResolved = string(content)
@@ -651,6 +803,13 @@ func modelCheckSingleSpec(f *ast.File, stateConfig *ast.StateSpaceOptions, dirPa
 		preinitHookContentResolved = preinitHook
 	}
 
+	if smc {
+		return modelCheckStatistical(f, stateConfig, dirPath, outDir, sourceFileName, hashes, preinitHookContentResolved, result)
+	}
+	if swarm > 0 {
+		return modelCheckSwarm(f, stateConfig, dirPath, outDir, sourceFileName, hashes, preinitHookContentResolved, result)
+	}
+
 	//maxRuns := 10000
 	if !simulation || seed != 0 {
 		maxRuns = 1
@@ -663,21 +822,25 @@ func modelCheckSingleSpec(f *ast.File, stateConfig *ast.StateSpaceOptions, dirPa
 	}
 	stopped := false
 	runs := 0
+	var budget *modelchecker.Budget
+	if maxTime > 0 || maxMemoryBytes > 0 {
+		budget = modelchecker.NewBudget(maxTime, maxMemoryBytes)
+	}
 	var p1 *modelchecker.Processor
 	var holder atomic.Pointer[modelchecker.Processor]
 	var lastRootNode *modelchecker.Node
-
-	setupSignalHandler(&holder, &stopped)
+	defer func() { progressReporter.Finish(p1) }()
 
 	// Periodic simulation progress: print "\rSimulated N runs" to stderr
 	// every 100 runs when stderr is a TTY. Silent otherwise so log files,
 	// pipes, and parallel-worker captures stay clean. simProgressEmitted
 	// tracks whether we ever wrote a \r line; if so, callers below must
 	// emit \n to stderr before any non-progress output so the next message
-	// doesn't append to the progress line.
+	// doesn't append to the progress line. A jsonl progress stream on
+	// stderr replaces it.
 	simProgressOnTty := false
 	simProgressEmitted := false
-	if simulation {
+	if simulation && (progressReporter == nil || progressFile != "") {
 		if fi, err := os.Stderr.Stat(); err == nil && (fi.Mode()&os.ModeCharDevice) != 0 {
 			simProgressOnTty = true
 		}
@@ -689,19 +852,99 @@ func modelCheckSingleSpec(f *ast.File, stateConfig *ast.StateSpaceOptions, dirPa
 		}
 	}
 
+	// With --sim_guided, all the runs share one guide, so later runs steer
+	// toward states and actions the earlier ones missed.
+	var guide *modelchecker.SimulationGuide
+	if simulation && simGuided && maxRuns != 1 {
+		guide = modelchecker.NewSimulationGuide()
+	}
+
+	newProcessor := func(seed int64) *modelchecker.Processor {
+		p := modelchecker.NewProcessor([]*ast.File{f}, stateConfig, simulation, seed, dirPath, explorationStrategy, isTest, hashes, guidedTrace, preinitHookContentResolved)
+		p.SetExperimentalProcessedQueue(experimentalProcessedQueue)
+		p.SetExperimentalNoGraph(experimentalNoGraph)
+		p.SetNoGraphLiveness(experimentalNoGraph && livenessChecked(stateConfig.GetLiveness()))
+		p.SetOnTheFlyLiveness(onTheFlyLiveness && livenessChecked(stateConfig.GetLiveness()))
+		p.SetExperimentalNoStateReturns(experimentalNoStateReturns)
+		p.SetDisableSymmetryReduction(noSymmetryReduction)
+		p.SetWorkers(workers)
+		if err := p.SetFingerprintBits(fingerprintBits); err != nil {
+			fmt.Println("Error:", err)
+			os.Exit(1)
+		}
+		if diskSpill {
+			p.SetDiskSpill(modelchecker.SpillDir(outDir), diskSpillMemStates)
+		}
+		if checkpointInterval > 0 || resumeDir != "" {
+			p.SetCheckpoint(modelchecker.CheckpointDir(outDir), checkpointInterval)
+		}
+		if resumeDir != "" {
+			p.SetResume(resumeDir)
+		}
+		if guide != nil {
+			p.SetSimulationGuide(guide)
+		}
+		return p
+	}
+
+	// With --sim_workers, runs execute ahead on a pool and are consumed
+	// below in run order, one per iteration.
+	var pool *modelchecker.SimulationPool
+	if simulation && simWorkers > 1 && maxRuns != 1 {
+		masterSeed := simMasterSeed
+		if masterSeed == 0 {
+			masterSeed = time.Now().UnixMicro()
+		}
+		fmt.Printf("Simulating on %d workers. Master seed: %d\n", simWorkers, masterSeed)
+		pool = modelchecker.NewSimulationPool(simWorkers, maxRuns, masterSeed, newProcessor)
+		defer pool.Stop()
+	}
+
+	setupSignalHandler(func() {
+		stopped = true
+		if pool != nil {
+			pool.Stop()
+		}
+		if p1 := holder.Load(); p1 != nil {
+			p1.Stop()
+		}
+	})
+
 	i := 0
-	for !stopped && (maxRuns <= 0 || i < maxRuns) {
+	for !stopped && (i == 0 || budget.Exceeded() == "") && (maxRuns <= 0 || i < maxRuns) {
 		i++
 
-		p1 = modelchecker.NewProcessor([]*ast.File{f}, stateConfig, simulation, seed, dirPath, explorationStrategy, isTest, hashes, guidedTrace, preinitHookContentResolved)
-		p1.SetExperimentalProcessedQueue(experimentalProcessedQueue)
-		p1.SetExperimentalNoGraph(experimentalNoGraph)
-		p1.SetExperimentalNoStateReturns(experimentalNoStateReturns)
-		p1.SetDisableSymmetryReduction(noSymmetryReduction)
-		holder.Store(p1)
+		var rootNode, failedNode *modelchecker.Node
+		var endTime time.Time
+		var err error
+		if pool != nil {
+			run := pool.Next(budget)
+			if run == nil {
+				break
+			}
+			p1 = run.Processor
+			rootNode, failedNode, endTime, err = run.Root, run.Failed, time.Now(), run.Err
+		} else {
+			p1 = newProcessor(seed)
+			p1.SetBudget(budget)
+			if partialOrderReduction {
+				if err := p1.SetPartialOrderReduction(); err != nil {
+					fmt.Println("Error:", err)
+					os.Exit(1)
+				}
+				for _, note := range p1.PartialOrderNotes() {
+					fmt.Println("Partial-order reduction:", note)
+				}
+			}
+			p1.SetProgress(progressReporter)
+			holder.Store(p1)
 
-		rootNode, failedNode, endTime, err := startModelChecker(p1)
+			rootNode, failedNode, endTime, err = startModelChecker(p1)
+		}
 		runs++
+		if simulation {
+			progressReporter.SimulationRunDone(p1)
+		}
 		lastRootNode = rootNode
 
 		if simProgressOnTty && runs%100 == 0 {
@@ -725,21 +968,26 @@ func modelCheckSingleSpec(f *ast.File, stateConfig *ast.StateSpaceOptions, dirPa
 		if earlyDead := p1.GetEarlyDeadlock(); earlyDead != nil && !simulation {
 			fmt.Println("DEADLOCK detected (early)")
 			fmt.Println("FAILED: Model checker failed")
+			result.setStats(p1, runs)
 			if experimentalNoGraph {
 				path := earlyDead.PathNames()
+				result.fail(failureDeadlock, nil, path)
 				fmt.Printf("Trace (%d steps):\n", len(path))
 				for _, step := range path {
 					fmt.Printf("  %s\n", step)
 				}
-				replayTraceWithFullState(path, outDir, jsonFilename)
+				printDeadlockExplanation(p1.ExplainDeadlock(earlyDead))
+				replayTraceWithFullState(path, -1, outDir, jsonFilename)
 			} else {
-				dumpFailedNode(sourceFileName, earlyDead, rootNode, outDir)
+				result.fail(failureDeadlock, nil, linkNames(modelchecker.ExtractFailurePath(earlyDead, rootNode)))
+				dumpFailedNode(sourceFileName, earlyDead, rootNode, p1.ExplainDeadlock(earlyDead), outDir)
 			}
 			return nil
 		}
 
 		if !simulation && !experimentalNoGraph {
 			if writeDotFileIfNeeded(p1, rootNode, outDir, "graph.dot") {
+				result.setError("writing graph.dot")
 				return nil
 			}
 		} else if i <= simFirstTraces {
@@ -752,7 +1000,10 @@ func modelCheckSingleSpec(f *ast.File, stateConfig *ast.StateSpaceOptions, dirPa
 		}
 
 		if err != nil {
-			printTraceAndExit(err)
+			result.setStats(p1, runs)
+			result.setRunError(err)
+			printTrace(err)
+			return nil
 		}
 
 		// In no-graph mode there's no in-memory state graph to walk for
@@ -761,26 +1012,52 @@ func modelCheckSingleSpec(f *ast.File, stateConfig *ast.StateSpaceOptions, dirPa
 		// (Liveness was already refused at startup; deadlock detection in
 		// no-graph mode happens at expansion time inside startProcessedQueue.)
 		if experimentalNoGraph {
+			result.setStats(p1, runs)
 			if failedNode != nil {
+				var invariant *ast.Invariant
 				if failedNode.FailedInvariants != nil && len(failedNode.FailedInvariants) > 0 && len(failedNode.FailedInvariants[0]) > 0 {
-					fmt.Println("FAILED: Model checker failed. Invariant:", f.Invariants[failedNode.FailedInvariants[0][0]].Name)
+					invariant = f.Invariants[failedNode.FailedInvariants[0][0]]
+					fmt.Println("FAILED: Model checker failed. Invariant:", invariant.Name)
 				} else {
 					fmt.Println("FAILED: Model checker failed")
 				}
 				path := failedNode.PathNames()
+				result.failInvariant(invariant, path)
 				fmt.Printf("Trace (%d steps):\n", len(path))
 				for _, step := range path {
 					fmt.Printf("  %s\n", step)
 				}
-				replayTraceWithFullState(path, outDir, jsonFilename)
+				replayTraceWithFullState(path, -1, outDir, jsonFilename)
 				return nil
 			}
 			fmt.Printf("Visited entries: %d  Unique states: %d\n", p1.GetVisitedNodesCount(), p1.GetUniqueYieldCount())
+			printCollisionProbability(p1)
 			if p1.Stopped() {
 				fmt.Println("Model checker stopped")
+				result.stop(reportPartialResult(p1, outDir))
+				return nil
+			}
+			if lasso := p1.CheckNoGraphLiveness(); lasso != nil {
+				invariant := f.Invariants[lasso.Invariant.InvariantIndex]
+				fmt.Println("IsLive: false")
+				fmt.Println("FAILED: Liveness check failed")
+				fmt.Printf("Invariant: %s\n", invariant.Name)
+				result.fail(failureLiveness, invariant, lasso.Path)
+				fmt.Printf("Trace (%d steps):\n", len(lasso.Path))
+				for k, step := range lasso.Path {
+					if k == lasso.CycleStart {
+						fmt.Println("  -- the steps below repeat forever --")
+					}
+					fmt.Printf("  %s\n", step)
+				}
+				if lasso.CycleStart == len(lasso.Path) {
+					fmt.Println("  -- stuttering: no fair action is enabled --")
+				}
+				replayTraceWithFullState(lasso.Path, lasso.CycleStart, outDir, jsonFilename)
 				return nil
 			}
 			fmt.Println("PASSED: Model checker completed successfully")
+			result.pass()
 			return rootNode
 		}
 
@@ -789,39 +1066,53 @@ func modelCheckSingleSpec(f *ast.File, stateConfig *ast.StateSpaceOptions, dirPa
 			fmt.Printf("WARNING: Trace execution incomplete. Expected %d links, executed %d links.\n",
 				len(guidedTrace.LinkNames), guidedTrace.GetCurrentIndex())
 			fmt.Println("The trace may contain links that don't match the model or are unreachable.")
+			result.setError("trace execution incomplete")
 			return nil
 		}
 
 		//fmt.Println("root", root)
 		if failedNode == nil {
-			var failurePath []*modelchecker.Link
-			var failedInvariant *modelchecker.InvariantPosition
-			nodes, messages, deadlock, yieldsCount := modelchecker.GetAllNodes(rootNode, stateConfig.GetOptions().GetMaxActions())
+			// A liveness failure found on the fly stops the exploration, so
+			// the graph is partial, and the checks that need all of it are
+			// skipped.
+			failurePath, failedInvariant := p1.OnTheFlyLivenessFailure()
+			cycleStart := -1
+			nodes, messages, deadlock, yieldsCount, terminalErr := modelchecker.GetAllNodesWithTerminalStates(rootNode, stateConfig.GetOptions().GetMaxActions(), p1.IsTerminalState)
+			result.setStats(p1, runs)
+			if terminalErr != nil && stateConfig.GetDeadlockDetection() {
+				result.setRunError(terminalErr)
+				printTrace(terminalErr)
+				return nil
+			}
 
 			if writeCommunicationFileIfNeeded(messages, outDir) {
+				result.setError("writing communication.dot")
 				return nil
 			}
 
-			if deadlock != nil && stateConfig.GetDeadlockDetection() && !p1.Stopped() && !simulation {
+			if deadlock != nil && stateConfig.GetDeadlockDetection() && !p1.Stopped() && !simulation && failedInvariant == nil {
 				fmt.Println("DEADLOCK detected")
 				fmt.Println("FAILED: Model checker failed")
 				if simulation {
 					fmt.Println("seed:", p1.Seed)
 				}
-				dumpFailedNode(sourceFileName, deadlock, rootNode, outDir)
+				result.fail(failureDeadlock, nil, linkNames(modelchecker.ExtractFailurePath(deadlock, rootNode)))
+				dumpFailedNode(sourceFileName, deadlock, rootNode, p1.ExplainDeadlock(deadlock), outDir)
 				return nil
 			}
 			if !simulation {
 				fmt.Println("Valid Nodes:", len(nodes), "Unique states:", yieldsCount)
+				printCollisionProbability(p1)
 				// Skip the exists-witness check in trace mode: a guided trace
 				// only explores a slice of the state space, so `exists`
 				// invariants legitimately can't be satisfied yet. Letting the
 				// failure short-circuit here would also skip writing the
 				// nodes/links pb files, which the trace consumer needs.
-				if guidedTrace == nil {
+				if guidedTrace == nil && !p1.Stopped() && failedInvariant == nil {
 					invariants := modelchecker.CheckSimpleExistsWitness(nodes)
 					if len(invariants) > 0 {
 						fmt.Println("\nFAILED: Expected states never reached")
+						result.fail(failureExistsWitness, f.Invariants[invariants[0].InvariantIndex], nil)
 						for i2, invariant := range invariants {
 							fmt.Printf("Invariant %d: %s\n", i2, f.Invariants[invariant.InvariantIndex].Name)
 						}
@@ -832,8 +1123,17 @@ func modelCheckSingleSpec(f *ast.File, stateConfig *ast.StateSpaceOptions, dirPa
 					}
 				}
 			}
-			if !simulation && !p1.Stopped() && guidedTrace == nil {
-				if stateConfig.GetLiveness() == "" || stateConfig.GetLiveness() == "enabled" || stateConfig.GetLiveness() == "true" || stateConfig.GetLiveness() == "strict" || stateConfig.GetLiveness() == "strict/bfs" {
+			if guidedTrace != nil && guidedTrace.HasCycle && guidedTrace.IsExhausted() {
+				// A lasso from a no-graph liveness failure: show the cycle the
+				// trace closes, with the assertion it violates.
+				failurePath, cycleStart, failedInvariant = p1.TraceLasso()
+				if failedInvariant != nil {
+					fmt.Printf("The last %d steps repeat forever.\n", len(failurePath)-cycleStart)
+				}
+			} else if !simulation && !p1.Stopped() && guidedTrace == nil {
+				if failedInvariant != nil {
+					fmt.Println("Liveness failure found during exploration")
+				} else if stateConfig.GetLiveness() == "" || stateConfig.GetLiveness() == "enabled" || stateConfig.GetLiveness() == "true" || stateConfig.GetLiveness() == "strict" || stateConfig.GetLiveness() == "strict/bfs" {
 					failurePath, failedInvariant = modelchecker.CheckStrictLiveness(rootNode, nodes)
 				} else if stateConfig.GetLiveness() == "eventual" || stateConfig.GetLiveness() == "nondeterministic" {
 					failurePath, failedInvariant = modelchecker.CheckFastLiveness(nodes)
@@ -842,14 +1142,75 @@ func modelCheckSingleSpec(f *ast.File, stateConfig *ast.StateSpaceOptions, dirPa
 				if !isTest {
 					fmt.Printf("Time taken to check liveness: %v\n", time.Now().Sub(endTime))
 				}
+				if failedInvariant == nil && len(stateConfig.GetLtl()) > 0 {
+					results, err := modelchecker.CheckLtlProperties(rootNode, nodes, stateConfig)
+					for _, ltlResult := range results {
+						fmt.Printf("LTL %s: %t\n", ltlResult.Name, ltlResult.Holds)
+					}
+					if err != nil {
+						fmt.Println("Error checking LTL properties:", err)
+						result.setError(err.Error())
+						return nil
+					}
+					if len(results) > 0 && !results[len(results)-1].Holds {
+						failed := results[len(results)-1]
+						fmt.Println("FAILED: LTL property failed")
+						fmt.Printf("Property: %s\nFormula: %s\n", failed.Name, failed.Formula)
+						result.fail(failureLiveness, nil, linkNames(failed.Path))
+						result.Failure.Invariant = failed.Name
+						GenerateFailurePath(sourceFileName, failed.Path, failed.CycleStart, nil, outDir)
+						fmt.Printf("The last %d steps repeat forever.\n", len(failed.Path)-failed.CycleStart)
+						if _, _, err := modelchecker.GenerateErrorPathProtoOfJson(failed.Path, failed.CycleStart, nil, outDir+"/"); err != nil {
+							fmt.Println("Error writing files", err)
+						}
+						return nil
+					}
+				}
+				if failedInvariant == nil && len(stateConfig.GetLeadsTo()) > 0 {
+					results, err := modelchecker.CheckLeadsToProperties(rootNode, nodes, stateConfig)
+					for _, leadsToResult := range results {
+						fmt.Printf("Leads-to %s: %t\n", leadsToResult.Name, leadsToResult.Holds)
+					}
+					if err != nil {
+						fmt.Println("Error checking leads-to properties:", err)
+						result.setError(err.Error())
+						return nil
+					}
+					if len(results) > 0 && !results[len(results)-1].Holds {
+						failed := results[len(results)-1]
+						fmt.Println("FAILED: Leads-to property failed")
+						fmt.Printf("Property: %s\nP: %s\nQ: %s\n", failed.Name, failed.P, failed.Q)
+						fmt.Println("Triggered at:", failed.Path[failed.Trigger].Node.Heap.String())
+						result.fail(failureLiveness, nil, linkNames(failed.Path))
+						result.Failure.Invariant = failed.Name
+						cycleStart = modelchecker.LassoCycleStart(failed.Path, failed.Trigger)
+						GenerateFailurePath(sourceFileName, failed.Path, cycleStart, nil, outDir)
+						if _, _, err := modelchecker.GenerateErrorPathProtoOfJson(failed.Path, cycleStart, nil, outDir+"/"); err != nil {
+							fmt.Println("Error writing files", err)
+						}
+						return nil
+					}
+				}
 			}
 
 			if failedInvariant == nil && !simulation {
 				if p1.Stopped() {
 					fmt.Println("Model checker stopped")
+					result.stop(reportPartialResult(p1, outDir))
 					return nil
 				}
 				fmt.Println("PASSED: Model checker completed successfully")
+				result.pass()
+				if perfModelFile != "" {
+					if err := analyzePerformance(f, nodes, yieldsCount, outDir); err != nil {
+						fmt.Println("Error in performance analysis:", err)
+					}
+				}
+				if queriesFile != "" {
+					if err := evaluateQueries(nodes, outDir); err != nil {
+						fmt.Println("Error in queries:", err)
+					}
+				}
 				//Nodes, _, _ := modelchecker.GetAllNodes(rootNode)
 				if saveStates || !isPlayground {
 					nodeFiles, linkFileNames, err := modelchecker.GenerateProtoOfJson(nodes, outDir+"/")
@@ -859,16 +1220,26 @@ func modelCheckSingleSpec(f *ast.File, stateConfig *ast.StateSpaceOptions, dirPa
 					}
 					fmt.Printf("Writen %d node files and %d link files to dir %s\n", len(nodeFiles), len(linkFileNames), outDir)
 				}
+				if prismExport {
+					if err := exportPrism(f, nodes, outDir); err != nil {
+						fmt.Println("Error exporting to PRISM:", err)
+					}
+				}
 				return rootNode
 			} else if failedInvariant != nil {
 				fmt.Println("FAILED: Liveness check failed")
 				if failedInvariant.FileIndex > 0 {
 					fmt.Printf("Only one file expected. Got %d\n", failedInvariant.FileIndex)
+					result.fail(failureLiveness, nil, linkNames(failurePath))
 				} else {
 					fmt.Printf("Invariant: %s\n", f.Invariants[failedInvariant.InvariantIndex].Name)
+					result.fail(failureLiveness, f.Invariants[failedInvariant.InvariantIndex], linkNames(failurePath))
+				}
+				if cycleStart < 0 {
+					cycleStart = modelchecker.LassoCycleStart(failurePath, 0)
 				}
-				GenerateFailurePath(sourceFileName, failurePath, failedInvariant, outDir)
-				_, _, err = modelchecker.GenerateErrorPathProtoOfJson(failurePath, outDir+"/")
+				GenerateFailurePath(sourceFileName, failurePath, cycleStart, failedInvariant, outDir)
+				_, _, err = modelchecker.GenerateErrorPathProtoOfJson(failurePath, cycleStart, nil, outDir+"/")
 				if err != nil {
 					fmt.Println("Error writing files", err)
 				}
@@ -877,6 +1248,9 @@ func modelCheckSingleSpec(f *ast.File, stateConfig *ast.StateSpaceOptions, dirPa
 
 		} else if failedNode != nil {
 			clearProgressLine()
+			result.setStats(p1, runs)
+			trace := linkNames(modelchecker.ExtractFailurePath(failedNode, rootNode))
+			var deadlock []*modelchecker.DisabledAction
 			// Always-assertion failures live on the node's Process.FailedInvariants.
 			// Transition-assertion failures live on the *inbound link* — see
 			// processor.go where CheckTransitionInvariants writes to
@@ -886,22 +1260,58 @@ func modelCheckSingleSpec(f *ast.File, stateConfig *ast.StateSpaceOptions, dirPa
 			// mode nothing about the failure is printed at all.
 			if failedNode.FailedInvariants != nil && len(failedNode.FailedInvariants) > 0 && len(failedNode.FailedInvariants[0]) > 0 {
 				fmt.Println("FAILED: Model checker failed. Invariant: ", f.Invariants[failedNode.FailedInvariants[0][0]].Name)
+				result.failInvariant(f.Invariants[failedNode.FailedInvariants[0][0]], trace)
 			} else if len(failedNode.Inbound) > 0 && failedNode.Inbound[0].FailedInvariants != nil && len(failedNode.Inbound[0].FailedInvariants[0]) > 0 {
 				fmt.Println("FAILED: Model checker failed. Transition Invariant:", f.Invariants[failedNode.Inbound[0].FailedInvariants[0][0]].Name)
+				result.fail(failureTransition, f.Invariants[failedNode.Inbound[0].FailedInvariants[0][0]], trace)
 			} else if simulation {
 				fmt.Println("FAILED: Model checker failed. Deadlock/stuttering detected")
+				result.fail(failureDeadlock, nil, trace)
+				deadlock = p1.ExplainDeadlock(failedNode)
 			} else {
 				fmt.Println("FAILED: Model checker failed (no failed-invariant metadata on the failing node; see trace below).")
+				result.failInvariant(nil, trace)
 			}
 			if simulation {
 				fmt.Println("seed:", p1.Seed)
+				result.Failure.Seed = p1.Seed
+			}
+			if guide != nil && runs > 1 {
+				// The run depends on the guide state the earlier runs left
+				// behind, so save its path for --trace-file instead. The
+				// trace file starts after Init.
+				guide.PrintReport()
+				steps := trace
+				if len(steps) > 0 && steps[0] == "Init" {
+					steps = steps[1:]
+				}
+				traceFile := filepath.Join(outDir, "trace.txt")
+				if err := os.WriteFile(traceFile, []byte(strings.Join(steps, "\n")+"\n"), 0644); err == nil {
+					fmt.Printf("This run was guided by the %d runs before it, so --seed alone does not replay it. Replay it with:\n  fizz --trace-file %s <spec.fizz>\n", runs-1, traceFile)
+				}
 			}
-			dumpFailedNode(sourceFileName, failedNode, rootNode, outDir)
+			dumpFailedNode(sourceFileName, failedNode, rootNode, deadlock, outDir)
 			return nil
 		}
 	}
 	clearProgressLine()
 	fmt.Println("Stopped after", runs, "runs at ", time.Now())
+	if guide != nil {
+		guide.PrintReport()
+	}
+	if reason := budget.Exceeded(); reason != "" {
+		fmt.Println("Stopped:", reason)
+	}
+	if p1 != nil {
+		result.setStats(p1, runs)
+	}
+	if stopped {
+		// Interrupted with Ctrl-C. Simulation runs are independent, so
+		// there is no partial exploration to report.
+		result.stop(nil)
+	} else {
+		result.pass()
+	}
 	if simulation && p1 != nil {
 		if runs-simFirstTraces > 1 {
 			fmt.Println("Not printing intermediate traces (only the last trace is shown)")
@@ -934,7 +1344,7 @@ func writeCommunicationFileIfNeeded(messages []string, outDir string) bool {
 	return false
 }
 
-func printTraceAndExit(err error) {
+func printTrace(err error) {
 	var modelErr *modelchecker.ModelError
 	if errors.As(err, &modelErr) {
 		fmt.Println("Stack Trace:")
@@ -942,7 +1352,6 @@ func printTraceAndExit(err error) {
 	} else {
 		fmt.Println("Error:", err)
 	}
-	os.Exit(1)
 }
 
 // writeDotFileIfNeeded writes the graph .dot file for the given root node
@@ -970,17 +1379,14 @@ func writeDotFileIfNeeded(p1 *modelchecker.Processor, rootNode *modelchecker.Nod
 	return false
 }
 
-func setupSignalHandler(holder *atomic.Pointer[modelchecker.Processor], stopped *bool) {
+// setupSignalHandler calls stop on the first Ctrl-C or SIGTERM.
+func setupSignalHandler(stop func()) {
 	c := make(chan os.Signal)
 	signal.Notify(c, os.Interrupt, syscall.SIGTERM)
 	go func() {
 		<-c
 		fmt.Println("\nInterrupted. Stopping state exploration")
-		*stopped = true
-		p1 := holder.Load()
-		if p1 != nil {
-			p1.Stop()
-		}
+		stop()
 	}()
 }
 
@@ -1048,6 +1454,16 @@ func getStateConfigForTraceChecking(stateConfig *ast.StateSpaceOptions) *ast.Sta
 	return stateConfig
 }
 
+// livenessChecked tells whether the liveness option enables a liveness
+// check, strict or eventual.
+func livenessChecked(liveness string) bool {
+	switch liveness {
+	case "", "enabled", "true", "strict", "strict/bfs", "eventual", "nondeterministic":
+		return true
+	}
+	return false
+}
+
 func loadInputJSON(jsonFilename string) *ast.File {
 	// Read the content of the JSON file
 	jsonContent, err := os.ReadFile(jsonFilename)
@@ -1082,11 +1498,69 @@ func parseFlags() []string {
 	flag.StringVar(&preinitHook, "preinit-hook", "", "Starlark code as a string to execute after preinit but before freezing globals (multiline supported)")
 	flag.BoolVar(&isTest, "test", false, "Testing mode (prevents printing timestamps and other non-deterministic behavior. Default=false")
 	flag.BoolVar(&experimentalProcessedQueue, "experimental_processed_queue", false, "EXPERIMENTAL: queue holds processed (yield-point) nodes instead of unprocessed action-starts. Dedupes successors before they enter the queue, reducing peak queue memory (~10x on BFS, ~3x on DFS). State space and assertion outcomes are identical under BFS. Under DFS/Random combined with max_actions, the changed exploration order may prune a different subset of states than the default path within the bound — raise max_actions above the spec's natural diameter to avoid the divergence. Default=false.")
-	flag.BoolVar(&experimentalNoGraph, "experimental_no_graph", false, "EXPERIMENTAL: drops the in-memory state graph after processing each yield-point. Keeps symmetry reduction, dedup, unique-state count, and safety/transition assertions. Does NOT support liveness assertions — refuses to run if any are present. Auto-enables --experimental_processed_queue. Massive RSS reduction at the cost of trace replayability (only a lightweight action-name chain is kept for failure reporting). Default=false.")
+	flag.BoolVar(&experimentalNoGraph, "experimental_no_graph", false, "EXPERIMENTAL: drops the in-memory state graph after processing each yield-point. Keeps symmetry reduction, dedup, unique-state count, and safety/transition assertions. Liveness assertions are checked on a compact fingerprint graph, and a failure is reported as a lasso trace; not supported with --disk_spill or --checkpoint_interval. Auto-enables --experimental_processed_queue. Massive RSS reduction at the cost of trace replayability (only a lightweight action-name chain is kept for failure reporting). Default=false.")
 	flag.BoolVar(&experimentalNoStateReturns, "experimental_no_state_returns", false, "EXPERIMENTAL: omit Process.Returns from HashCode, JSON state, and dot-file state labels. Returns remain available on Link.Returns (the per-transition field). Use this to verify downstream consumers (graph, MBT, explorer) have migrated to reading return values from links. Planned to become the default. Default=false.")
 	flag.BoolVar(&noSymmetryReduction, "no-symmetry-reduction", false, "Disable symmetry reduction: dedup uses only the plain state hash, so every persisted state keeps its concrete symmetric values/role identities (no canonical renaming). Larger state space. Required when generating state graphs for MBT replay from specs that use symmetric roles or symmetry values. Default=false.")
+	flag.IntVar(&workers, "workers", 1, "Number of goroutines that prefetch action-starts during exhaustive BFS model checking: the action-starts at the head of the queue are executed to their next yield or fork and hashed ahead of their turn. The frontier and the visited set stay on one goroutine, which dedupes, links the graph and checks the assertions in the single-threaded order, so the speedup is bounded by the share of time spent executing actions. State count, graph and counterexamples are identical to the single-threaded run. Ignored in simulation mode and for dfs/random exploration strategies. Default=1.")
+	flag.BoolVar(&diskSpill, "disk_spill", false, "Keep the visited state fingerprints and the BFS frontier on disk (under OUTPUT_DIR/spill) instead of in memory, so state spaces larger than RAM can be checked. Exploration order is unchanged, so traces are still the shortest. Requires --experimental_no_graph and bfs. Default=false.")
+	flag.IntVar(&diskSpillMemStates, "disk_spill_memory_states", 1000000, "With --disk_spill, the number of state fingerprints and frontier states kept in memory before spilling to disk. Default=1000000.")
+	flag.IntVar(&fingerprintBits, "fingerprint_bits", modelchecker.DefaultFingerprintBits, "Number of bits of each state hash kept in the visited set: 64 or 128. Smaller fingerprints use less memory at a higher chance that two distinct states collide; the run summary reports an upper bound on that probability. Default=128.")
+	flag.BoolVar(&paranoidHashes, "paranoid_hashes", false, "Key the visited set by the full SHA-256 state hash instead of a truncated fingerprint. Uses more memory per state. Overrides --fingerprint_bits. Default=false.")
+	flag.DurationVar(&checkpointInterval, "checkpoint_interval", 0, "Write a checkpoint of the BFS frontier, the visited fingerprints and the run stats to OUTPUT_DIR/checkpoint at this interval (e.g. 10m), and once more on Ctrl-C. Continue with --resume. Requires --experimental_no_graph and bfs. Default=0 (no checkpoints).")
+	flag.StringVar(&resumeDir, "resume", "", "Continue a run from the checkpoint in this directory, written by --checkpoint_interval. The spec, options and --fingerprint_bits must match the checkpointed run; the result is the same as an uninterrupted run. Requires --experimental_no_graph and bfs.")
+	flag.DurationVar(&maxTime, "max_time", 0, "Stop exploring after this much wall-clock time (e.g. 2h) and print and save a partial report (OUTPUT_DIR/partial_report.json) of what was explored. In simulation mode, no new runs start once the time is up. Default=0 (no limit).")
+	flag.StringVar(&maxMemory, "max_memory", "", "Stop exploring once the process uses this much memory (e.g. 16GiB, 512MB) and print and save a partial report (OUTPUT_DIR/partial_report.json) of what was explored. Default=no limit.")
+	flag.StringVar(&progressFormat, "progress_format", "text", "Format of the progress reports. Options: text (default), jsonl. With jsonl, a JSON object with the elapsed time, states, unique states, queue length, depth, states/sec and peak queue length is written every --progress_interval to stderr or --progress_file, plus a final one with \"done\": true.")
+	flag.StringVar(&progressFile, "progress_file", "", "With --progress_format=jsonl, the file to write the progress stream to. Default=stderr.")
+	flag.DurationVar(&progressInterval, "progress_interval", time.Second, "With --progress_format=jsonl, the interval between progress objects. Default=1s.")
+	flag.BoolVar(&partialOrderReduction, "partial_order_reduction", false, "Skip interleavings of role actions that commute: where a role's actions touch only its own fields, which no other code and no assertion reads, only one role instance's actions are explored from each state. Safety assertions and deadlock detection are preserved; liveness is not, so specs with liveness assertions, ltl or leads_to properties are refused. Applies only to specs whose actions and functions are all atomic; prints which roles it applies to. Auto-enables --experimental_processed_queue. As with that flag, raise max_actions above the spec's natural diameter, since the reduced paths may be cut off at a different depth. Default=false.")
+	flag.IntVar(&swarm, "swarm", 0, "Run N diversified searches in parallel, for specs too big to check exhaustively. Each worker has its own seed drawn from --seed, alternates between the random and dfs exploration strategies, tries actions in its own order, and gets its own max_actions bound, spread from max_actions down to half of it. The first violation found stops all workers. Prints each worker's coverage and the distinct states covered together. Checks safety and transition assertions and deadlocks, but not liveness or exists assertions. Overrides --exploration_strategy. Default=0 (off).")
+	flag.IntVar(&simWorkers, "sim_workers", 1, "Number of simulation runs to execute concurrently with --simulation. The seed of each run is derived from --sim_master_seed and the run's number, and the first failing run in run order is reported with its seed, so it can be replayed alone with --seed. Default=1.")
+	flag.Int64Var(&simMasterSeed, "sim_master_seed", 0, "With --sim_workers, the seed the seeds of the runs are derived from. The same master seed repeats the same runs. Default=0 (time-based, and printed).")
+	flag.BoolVar(&simGuided, "sim_guided", false, "With --simulation, steer each run toward states and actions the earlier runs of the session missed: successors are picked in proportion to how often their action reached new states and how rarely the runs visited the state it led to last time, instead of uniformly. Prints how the distinct states covered grew over the runs. A guided run depends on the runs before it, so a failure is replayed with its trace rather than its seed. Runs on one worker; cannot be combined with --sim_workers above 1. Default=false.")
+	flag.BoolVar(&smc, "smc", false, "Statistical model checking: estimate from independent simulation runs the probability that a run satisfies each assertion, for specs too big to check exhaustively. A run is bounded by max_actions; always and transition assertions must hold on the whole run, eventually and exists assertions are reachability goals, and always-eventually and eventually-always assertions must hold at the last state. Without --smc_threshold, runs until each estimate is within --smc_error with --smc_confidence (Chernoff-Hoeffding bound). Choices follow the probabilities of --perf_model when given, and are uniform otherwise. Implies --simulation; runs on --sim_workers workers with seeds derived from --sim_master_seed. Default=false.")
+	flag.Float64Var(&smcConfidence, "smc_confidence", 0.95, "With --smc, the confidence of the intervals and decisions. Default=0.95.")
+	flag.Float64Var(&smcError, "smc_error", 0.01, "With --smc, the half-width of the interval around each estimate. Default=0.01.")
+	flag.Float64Var(&smcThreshold, "smc_threshold", 0, "With --smc, test whether each probability is at least this value with the sequential probability ratio test (SPRT), stopping as soon as every assertion is decided, instead of estimating to --smc_error. Fails if any is decided to be below it. Default=0 (estimate).")
+	flag.Float64Var(&smcIndifference, "smc_indifference", 0.01, "With --smc_threshold, the half-width of the region around the threshold in which the SPRT may decide either way. Smaller needs more runs. Default=0.01.")
+	flag.StringVar(&perfModelFile, "perf_model", "", "Path to a performance model yaml (e.g. perf_model.yaml) giving the probabilities and counters of labeled branches; unlabeled branches share the rest of the probability evenly. After a passing model check, runs the steady-state and absorption-cost analysis of the state graph and writes performance.json and performance_histogram.csv to the output dir. With --smc, simulation choices follow the probabilities instead.")
+	flag.StringVar(&perfMethod, "perf_method", modelchecker.PerfMethodPower, "With --perf_model, how to find the steady state: power (iterate from the initial state; the only method that gives the counter histogram), gauss-seidel or jacobi (solve for the absorption probabilities and the stationary distribution of each bottom strongly connected component; also converge on periodic chains). Default=power.")
+	flag.IntVar(&perfSamples, "perf_samples", 10000, "With --perf_model, the number of Monte Carlo walks over the chain that estimate the percentiles of each counter, drawing the counter values from their distributions. 0 reports only the means. Default=10000.")
+	flag.StringVar(&queriesFile, "queries", "", "Path to a file of probabilistic queries, one per line, such as P=? [ F<=10 {leader != None} ] or R{latency}=? [ F {done} ] (lines starting with # are comments). After a passing model check, evaluates them from the initial state on the state graph, with the probabilities and counters of --perf_model or uniform branches, prints the results and writes queries.json to the output dir.")
+	flag.BoolVar(&onTheFlyLiveness, "on_the_fly_liveness", false, "Also search for liveness failures while exploring, and stop at the first fair cycle found that violates a liveness assertion instead of exploring the whole state space first. The search runs on the part of the graph whose successors are all explored, so it finds cycles soonest with --exploration_strategy=dfs. Passing specs are still checked in full after the exploration. Not supported with --simulation, --experimental_processed_queue or a guided trace. Default=false.")
+	flag.BoolVar(&prismExport, "prism_export", false, "After a passing model check, write the state graph as a Markov chain in the PRISM explicit-model format (model.tra, model.sta, model.lab and a model_<counter>.trew per counter) to the prism dir of the output dir, with the probabilities and counters of --perf_model or uniform branches, to check it with PRISM or Storm. Default=false.")
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "Usage: %s [flags] <json_file>\n", os.Args[0])
+		flag.PrintDefaults()
+		fmt.Fprint(flag.CommandLine.Output(), "\nThe outcome is also written to OUTPUT_DIR/result.json.\n"+exitCodesHelp)
+	}
 	flag.Parse()
 
+	if maxMemory != "" {
+		var err error
+		maxMemoryBytes, err = parseByteSize(maxMemory)
+		if err != nil {
+			fmt.Println("Error: invalid --max_memory:", err)
+			os.Exit(1)
+		}
+	}
+
+	switch progressFormat {
+	case "text":
+		if progressFile != "" {
+			fmt.Println("Error: --progress_file requires --progress_format=jsonl")
+			os.Exit(1)
+		}
+	case "jsonl":
+		if progressInterval <= 0 {
+			fmt.Println("Error: --progress_interval must be positive")
+			os.Exit(1)
+		}
+	default:
+		fmt.Printf("Error: invalid --progress_format %q: must be text or jsonl\n", progressFormat)
+		os.Exit(1)
+	}
+
 	// Validate that both file and string versions are not provided
 	if traceFile != "" && trace != "" {
 		fmt.Println("Error: cannot specify both --trace-file and --trace")
@@ -1096,14 +1570,138 @@ func parseFlags() []string {
 		fmt.Println("Error: cannot specify both --preinit-hook-file and --preinit-hook")
 		os.Exit(1)
 	}
+	if paranoidHashes {
+		fingerprintBits = modelchecker.FullHashBits
+	} else if fingerprintBits != 64 && fingerprintBits != 128 {
+		fmt.Println("Error: --fingerprint_bits must be 64 or 128")
+		os.Exit(1)
+	}
+	if workers > 1 && (simulation || explorationStrategy != "bfs") {
+		fmt.Println("Note: --workers applies only to exhaustive bfs exploration; running single-threaded.")
+	}
+	if simWorkers < 1 {
+		fmt.Println("Error: --sim_workers must be at least 1")
+		os.Exit(1)
+	}
+	if simWorkers > 1 && !simulation {
+		fmt.Println("Note: --sim_workers applies only to --simulation; ignoring it.")
+	}
+	if smc {
+		if simGuided || swarm > 0 || traceFile != "" || trace != "" || traceExtend > 0 {
+			fmt.Println("Error: --smc cannot be combined with --sim_guided, --swarm or a guided trace, which would bias the runs.")
+			os.Exit(1)
+		}
+		simulation = true
+	}
+	if perfMethod != modelchecker.PerfMethodPower && perfMethod != modelchecker.PerfMethodGaussSeidel && perfMethod != modelchecker.PerfMethodJacobi {
+		fmt.Println("Error: --perf_method must be power, gauss-seidel or jacobi")
+		os.Exit(1)
+	}
+	if perfSamples < 0 {
+		fmt.Println("Error: --perf_samples must not be negative")
+		os.Exit(1)
+	}
+	if perfModelFile != "" && simulation && !smc {
+		fmt.Println("Note: --perf_model applies only to exhaustive model checking and --smc; ignoring it.")
+	}
+	if queriesFile != "" && simulation {
+		fmt.Println("Note: --queries applies only to exhaustive model checking; ignoring it.")
+	}
+	if prismExport && simulation {
+		fmt.Println("Note: --prism_export applies only to exhaustive model checking; ignoring it.")
+	}
+	if simGuided && !simulation {
+		fmt.Println("Note: --sim_guided applies only to --simulation; ignoring it.")
+	}
+	if simGuided && simulation && simWorkers > 1 {
+		fmt.Println("Error: --sim_guided cannot be combined with --sim_workers above 1: concurrent runs would update the guide in the order they finish, so the same seed would not repeat the same runs.")
+		os.Exit(1)
+	}
+	if swarm < 0 {
+		fmt.Println("Error: --swarm must not be negative")
+		os.Exit(1)
+	}
 
 	args := flag.Args()
 	return args
 }
 
-func startModelChecker(p1 *modelchecker.Processor) (*modelchecker.Node, *modelchecker.Node, time.Time, error) {
+// printCollisionProbability reports the bound on the chance that a hash
+// collision made the checker skip a distinct state, like TLC's fingerprint
+// collision estimate.
+func printCollisionProbability(p *modelchecker.Processor) {
+	bits := p.FingerprintBits()
+	kind := fmt.Sprintf("%d-bit fingerprints", bits)
+	if bits == modelchecker.FullHashBits {
+		kind = "full SHA-256 hashes"
+	}
+	fmt.Printf("Hash collision probability: at most %.3g (%s)\n", p.CollisionProbability(), kind)
+}
+
+// reportPartialResult prints what a stopped run explored and saves it as
+// partial_report.json, so a run cut short by a budget or Ctrl-C still
+// leaves its stats behind.
+func reportPartialResult(p *modelchecker.Processor, outDir string) *modelchecker.PartialReport {
+	report := p.PartialReport()
+	fmt.Print(report)
+	data, err := json.MarshalIndent(report, "", "  ")
+	if err != nil {
+		fmt.Println("Error encoding partial report:", err)
+		return report
+	}
+	fileName := filepath.Join(outDir, "partial_report.json")
+	if err := os.WriteFile(fileName, data, 0644); err != nil {
+		fmt.Println("Error writing partial report:", err)
+		return report
+	}
+	fmt.Println("Partial report written to", fileName)
+	return report
+}
+
+// parseByteSize parses a size such as 16GiB, 16G, 500MB or 1048576. K, M, G
+// and T are binary units with or without the "iB" suffix; KB, MB, GB and TB
+// are decimal.
+func parseByteSize(s string) (uint64, error) {
+	units := []struct {
+		suffix string
+		scale  uint64
+	}{
+		{"KiB", 1 << 10}, {"MiB", 1 << 20}, {"GiB", 1 << 30}, {"TiB", 1 << 40},
+		{"KB", 1e3}, {"MB", 1e6}, {"GB", 1e9}, {"TB", 1e12},
+		{"K", 1 << 10}, {"M", 1 << 20}, {"G", 1 << 30}, {"T", 1 << 40},
+		{"B", 1},
+	}
+	s = strings.TrimSpace(s)
+	scale := uint64(1)
+	for _, u := range units {
+		if strings.HasSuffix(strings.ToUpper(s), strings.ToUpper(u.suffix)) {
+			s = strings.TrimSpace(s[:len(s)-len(u.suffix)])
+			scale = u.scale
+			break
+		}
+	}
+	n, err := strconv.ParseFloat(s, 64)
+	if err != nil || n <= 0 {
+		return 0, fmt.Errorf("%q is not a positive size", s)
+	}
+	return uint64(n * float64(scale)), nil
+}
+
+func startModelChecker(p1 *modelchecker.Processor) (rootNode *modelchecker.Node, failedNode *modelchecker.Node, endTime time.Time, err error) {
+	// Errors raised by the spec surface as ModelError panics; report them
+	// as a runtime error instead of crashing.
+	defer func() {
+		if r := recover(); r != nil {
+			modelErr, ok := r.(*modelchecker.ModelError)
+			if !ok {
+				panic(r)
+			}
+			// The graph explored up to the error is still written out.
+			rootNode, failedNode, endTime, err = p1.Init, nil, time.Now(), modelErr
+		}
+	}()
 	if simulation {
-		rootNode, failedNode, _ := p1.Start()
+		rootNode, failedNode, _ = p1.Start()
 		return rootNode, failedNode, time.Now(), nil
 	}
 	if internalProfile {
@@ -1111,8 +1709,8 @@ func startModelChecker(p1 *modelchecker.Processor) (*modelchecker.Node, *modelch
 		defer pprof.StopCPUProfile()
 	}
 	startTime := time.Now()
-	rootNode, failedNode, err := p1.Start()
-	endTime := time.Now()
+	rootNode, failedNode, err = p1.Start()
+	endTime = time.Now()
 	if !isTest {
 		fmt.Printf("Time taken for model checking: %v\n", endTime.Sub(startTime))
 	}
@@ -1145,16 +1743,31 @@ func startHeapProfile() {
 	}
 }
 
-func dumpFailedNode(srcFileName string, failedNode *modelchecker.Node, rootNode *modelchecker.Node, outDir string) {
+// dumpFailedNode prints and writes the path to the failed node. For a
+// deadlock, deadlock explains why nothing is enabled at it.
+func dumpFailedNode(srcFileName string, failedNode *modelchecker.Node, rootNode *modelchecker.Node, deadlock []*modelchecker.DisabledAction, outDir string) {
 
 	failurePath := modelchecker.ExtractFailurePath(failedNode, rootNode)
-	GenerateFailurePath(srcFileName, failurePath, nil, outDir)
-	_, _, err := modelchecker.GenerateErrorPathProtoOfJson(failurePath, outDir+"/")
+	GenerateFailurePath(srcFileName, failurePath, -1, nil, outDir)
+	printDeadlockExplanation(deadlock)
+	_, _, err := modelchecker.GenerateErrorPathProtoOfJson(failurePath, -1, deadlock, outDir+"/")
 	if err != nil {
 		fmt.Println("Error writing files", err)
 	}
 }
 
+// printDeadlockExplanation prints why each action, and each thread in
+// progress, is disabled in the stuck state of a deadlock.
+func printDeadlockExplanation(deadlock []*modelchecker.DisabledAction) {
+	if len(deadlock) == 0 {
+		return
+	}
+	fmt.Println("Why nothing is enabled in the last state:")
+	for _, d := range deadlock {
+		fmt.Printf("  %s\n", d)
+	}
+}
+
 func GenerateComposedFailurePath(failed *ComposedNode, composition *ast.Composition, roots []*modelchecker.Node, outDir string) {
 	// Collect failure paths from each composing spec
 	componentPaths := make([][]*modelchecker.Link, len(failed.Nodes))
@@ -1167,7 +1780,7 @@ func GenerateComposedFailurePath(failed *ComposedNode, composition *ast.Composit
 	for i, node := range failed.Nodes {
 		specName := composition.GetSpecs()[i].GetName()
 		componentPaths[i] = modelchecker.ExtractFailurePath(node, roots[i])
-		subgraph := modelchecker.GenerateFailurePath(componentPaths[i], specName, nil)
+		subgraph := modelchecker.GenerateFailurePath(componentPaths[i], -1, specName, nil)
 		subgraphs[i] = subgraph
 		builder.WriteString(subgraph)
 
@@ -1219,7 +1832,7 @@ func GenerateTransitionFailurePath(from, to *ComposedNode, composition *ast.Comp
 			// Add stutter node manually
 			lastFromNodeIDs[i] = fmt.Sprintf("\"%s_%d\"", specName, lastFromIndex)
 			lastToNodeIDs[i] = lastFromNodeIDs[i]
-			builder.WriteString(modelchecker.GenerateFailurePath(path, specName, nil))
+			builder.WriteString(modelchecker.GenerateFailurePath(path, -1, specName, nil))
 			builder.WriteString(fmt.Sprintf("  %s -> %s [label=\"stutter\", color=\"red\", style=dashed];\n", lastFromNodeIDs[i], lastToNodeIDs[i]))
 			continue
 		}
@@ -1232,7 +1845,7 @@ func GenerateTransitionFailurePath(from, to *ComposedNode, composition *ast.Comp
 		path = append(path, transition...)
 
 		// Generate full path subgraph
-		builder.WriteString(modelchecker.GenerateFailurePath(path, specName, nil))
+		builder.WriteString(modelchecker.GenerateFailurePath(path, -1, specName, nil))
 
 		// Set FROM node id (before transition path)
 		lastFromNodeIDs[i] = fmt.Sprintf("\"%s_%d\"", specName, lastFromIndex)
@@ -1313,11 +1926,18 @@ func extractTransitionPath(from *modelchecker.Node, to *modelchecker.Node) []*mo
 	return []*modelchecker.Link{}
 }
 
-func GenerateFailurePath(srcFileName string, failurePath []*modelchecker.Link, invariant *modelchecker.InvariantPosition, outDir string) {
-	for _, link := range failurePath {
+// GenerateFailurePath prints the failure path and writes it as json, dot
+// and html. For a liveness failure, cycleStart is the index of the first
+// step of the cycle that repeats forever, and -1 for other failures.
+func GenerateFailurePath(srcFileName string, failurePath []*modelchecker.Link, cycleStart int, invariant *modelchecker.InvariantPosition, outDir string) {
+	for k, link := range failurePath {
 		node := link.Node
 		stepName := link.Name
 
+		if k == cycleStart {
+			fmt.Println("------\n-- the steps below repeat forever --")
+		}
+
 		fmt.Printf("------\n%s\n", stepName)
 
 		nodeStr := node.Heap.ToJson()
@@ -1348,7 +1968,7 @@ func GenerateFailurePath(srcFileName string, failurePath []*modelchecker.Link, i
 		fmt.Printf("Writen graph json: %s\n", errJsonFileName)
 	}
 
-	dotStr := modelchecker.GenerateFailurePath(failurePath, "", invariant)
+	dotStr := modelchecker.GenerateFailurePath(failurePath, cycleStart, "", invariant)
 	err := writeErrorDotFile(outDir, dotStr)
 	if err != nil {
 		return
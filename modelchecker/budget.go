@@ -0,0 +1,242 @@
+package modelchecker
+
+import (
+	ast "fizz/proto"
+	"fmt"
+	"runtime/metrics"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/fizzbee-io/fizzbee/lib"
+)
+
+// Budget bounds the wall-clock time and memory a run may use. A run that
+// exceeds its budget stops the same way Stop does, and the caller can
+// report what was explored with PartialReport. One Budget may be shared by
+// the processors of consecutive simulation runs.
+type Budget struct {
+	// MaxTime is the wall-clock limit, counted from NewBudget. 0 = none.
+	MaxTime time.Duration
+	// MaxMemory is the limit on memory obtained from the OS, in bytes,
+	// excluding memory already returned to it. 0 = none.
+	MaxMemory uint64
+
+	start    time.Time
+	exceeded string
+}
+
+// NewBudget returns a budget whose clock starts now.
+func NewBudget(maxTime time.Duration, maxMemory uint64) *Budget {
+	return &Budget{MaxTime: maxTime, MaxMemory: maxMemory, start: time.Now()}
+}
+
+// Exceeded returns why the budget is exhausted, or "" if it is not. Once
+// exhausted, the budget stays exhausted.
+func (b *Budget) Exceeded() string {
+	if b == nil {
+		return ""
+	}
+	if b.exceeded != "" {
+		return b.exceeded
+	}
+	if b.MaxTime > 0 && time.Since(b.start) >= b.MaxTime {
+		b.exceeded = fmt.Sprintf("time budget of %s exceeded", b.MaxTime)
+	} else if b.MaxMemory > 0 {
+		if used := memoryInUse(); used >= b.MaxMemory {
+			b.exceeded = fmt.Sprintf("memory budget of %s exceeded (%s in use)", FormatBytes(b.MaxMemory), FormatBytes(used))
+		}
+	}
+	return b.exceeded
+}
+
+var memorySamples = []metrics.Sample{
+	{Name: "/memory/classes/total:bytes"},
+	{Name: "/memory/classes/heap/released:bytes"},
+}
+
+// memoryInUse approximates the resident memory of the Go runtime. Unlike
+// runtime.ReadMemStats it does not stop the world, so it is cheap enough to
+// call once per expansion.
+func memoryInUse() uint64 {
+	metrics.Read(memorySamples)
+	return memorySamples[0].Value.Uint64() - memorySamples[1].Value.Uint64()
+}
+
+// FormatBytes formats n with a binary unit, e.g. 1.5GiB.
+func FormatBytes(n uint64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%dB", n)
+	}
+	div, exp := uint64(unit), 0
+	for m := n / unit; m >= unit && exp < 4; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.3g%ciB", float64(n)/float64(div), "KMGTP"[exp])
+}
+
+// SetBudget stops the run once b is exceeded. Must be called before Start.
+func (p *Processor) SetBudget(b *Budget) {
+	p.budget = b
+}
+
+// budgetExceeded stops the run if the budget is exhausted. Called between
+// expansions by the exploration loops.
+func (p *Processor) budgetExceeded() bool {
+	if reason := p.budget.Exceeded(); reason != "" {
+		// The first of the exceeded budget and Stop records the reason; the
+		// prefetch workers and the interrupt handler may read it concurrently.
+		p.stopReason.CompareAndSwap(nil, &reason)
+		p.stopped.Store(true)
+		return true
+	}
+	return false
+}
+
+// StopReason returns why a stopped run stopped: the exceeded budget, or
+// "interrupted" when Stop was called. Empty if the run was not stopped.
+func (p *Processor) StopReason() string {
+	if !p.stopped.Load() {
+		return ""
+	}
+	return *p.stopReason.Load()
+}
+
+// Assertion statuses in a PartialReport.
+const (
+	// AssertionHeld means the assertion held in every explored state or
+	// transition.
+	AssertionHeld = "held"
+	// AssertionNotChecked means the assertion needs the complete state
+	// space (liveness, exists, and the ltl and leads_to properties), so a
+	// stopped run cannot check it.
+	AssertionNotChecked = "not_checked"
+)
+
+// AssertionStatus is the outcome of one assertion in a stopped run.
+type AssertionStatus struct {
+	Name      string   `json:"name"`
+	Operators []string `json:"operators"`
+	Status    string   `json:"status"`
+}
+
+// PartialReport summarizes a run that stopped before exploring the whole
+// state space.
+type PartialReport struct {
+	Reason         string  `json:"reason"`
+	ElapsedSeconds float64 `json:"elapsed_seconds"`
+	// StatesExplored is the number of distinct states visited.
+	StatesExplored int `json:"states_explored"`
+	UniqueStates   int `json:"unique_states"`
+	// DepthReached is the largest number of actions from Init of any
+	// explored state.
+	DepthReached int `json:"depth_reached"`
+	// CompleteDepth is the depth up to which every reachable state was
+	// explored, so the assertions that held, held up to that depth. Only
+	// breadth-first exploration explores by depth; otherwise it is -1.
+	CompleteDepth int               `json:"complete_depth"`
+	FrontierSize  int               `json:"frontier_size"`
+	Assertions    []AssertionStatus `json:"assertions"`
+}
+
+// PartialReport describes what a stopped run explored. Only meaningful when
+// the run stopped without finding a failure.
+func (p *Processor) PartialReport() *PartialReport {
+	r := &PartialReport{
+		Reason:         p.StopReason(),
+		StatesExplored: p.visitedCount(),
+		UniqueStates:   p.uniqueYieldCount,
+		DepthReached:   p.depthReached,
+		CompleteDepth:  -1,
+		FrontierSize:   p.queue.Len() + len(p.pendingActionStarts),
+	}
+	if !p.startTime.IsZero() {
+		r.ElapsedSeconds = time.Since(p.startTime).Seconds()
+	}
+	switch p.queue.(type) {
+	case *lib.Queue[*Node], *lib.DiskQueue[*Node]:
+		if !p.simulation && r.StatesExplored > 0 {
+			r.CompleteDepth = max(0, p.depthReached-1)
+		}
+	}
+	for _, file := range p.Files {
+		for _, invariant := range file.Invariants {
+			operators := invariantOperators(invariant)
+			status := AssertionHeld
+			if slices.Contains(operators, "eventually") || slices.Contains(operators, "exists") {
+				status = AssertionNotChecked
+			}
+			name := invariant.Name
+			if name == "" {
+				name = invariant.PyExpr
+			}
+			r.Assertions = append(r.Assertions, AssertionStatus{
+				Name:      name,
+				Operators: operators,
+				Status:    status,
+			})
+		}
+	}
+	for _, property := range p.config.GetLtl() {
+		r.Assertions = append(r.Assertions, AssertionStatus{
+			Name:      ltlName(property),
+			Operators: []string{"ltl"},
+			Status:    AssertionNotChecked,
+		})
+	}
+	for _, property := range p.config.GetLeadsTo() {
+		r.Assertions = append(r.Assertions, AssertionStatus{
+			Name:      leadsToName(property),
+			Operators: []string{"leads_to"},
+			Status:    AssertionNotChecked,
+		})
+	}
+	return r
+}
+
+// invariantOperators returns the temporal operators of an invariant,
+// including the deprecated always/eventually flags of expression invariants.
+func invariantOperators(invariant *ast.Invariant) []string {
+	if len(invariant.TemporalOperators) > 0 {
+		return invariant.TemporalOperators
+	}
+	var operators []string
+	for inv := invariant; inv != nil; inv = inv.Nested {
+		if inv.Always {
+			operators = append(operators, "always")
+		}
+		if inv.Eventually {
+			operators = append(operators, "eventually")
+		}
+	}
+	return operators
+}
+
+// String formats the report for the console.
+func (r *PartialReport) String() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "Stopped: %s\n", r.Reason)
+	fmt.Fprintf(&b, "States explored: %d  Unique states: %d  Frontier: %d\n", r.StatesExplored, r.UniqueStates, r.FrontierSize)
+	if r.CompleteDepth >= 0 {
+		fmt.Fprintf(&b, "Depth reached: %d (complete up to depth %d)\n", r.DepthReached, r.CompleteDepth)
+	} else {
+		fmt.Fprintf(&b, "Depth reached: %d\n", r.DepthReached)
+	}
+	var held, notChecked []string
+	for _, a := range r.Assertions {
+		if a.Status == AssertionHeld {
+			held = append(held, a.Name)
+		} else {
+			notChecked = append(notChecked, a.Name)
+		}
+	}
+	if len(held) > 0 {
+		fmt.Fprintf(&b, "Assertions held in all explored states: %s\n", strings.Join(held, ", "))
+	}
+	if len(notChecked) > 0 {
+		fmt.Fprintf(&b, "Assertions not checked (need the complete state space): %s\n", strings.Join(notChecked, ", "))
+	}
+	return b.String()
+}
@@ -0,0 +1,337 @@
+package modelchecker
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/fizzbee-io/fizzbee/lib"
+	"google.golang.org/protobuf/proto"
+)
+
+// A checkpoint is a directory holding everything the processed-queue loop
+// needs to continue between two yield-point expansions:
+//
+//   - checkpoint.json: the run stats and the parameters the run depends on.
+//   - visited.fp: the visited fingerprints, fixed-width, in no order.
+//   - frontier.rec: the processed queue in order, one recipe per record
+//     (see recipe.go), in the same record format as DiskQueue segments.
+//
+// Resuming replays the frontier recipes from a fresh Init, so the rest of the
+// run is exactly the uninterrupted run: same unique state count, same
+// (shortest) counterexample.
+
+const (
+	checkpointVersion  = 1
+	checkpointMetaFile = "checkpoint.json"
+	checkpointVisited  = "visited.fp"
+	checkpointFrontier = "frontier.rec"
+)
+
+type checkpointMeta struct {
+	Version int `json:"version"`
+	// SpecHash identifies the spec and state space options; resuming
+	// against anything else is refused.
+	SpecHash        string `json:"spec_hash"`
+	FingerprintBits int    `json:"fingerprint_bits"`
+	// PartialOrderReduction: the frontier of a reduced run only covers the
+	// reduced state space, so the setting must match.
+	PartialOrderReduction bool `json:"partial_order_reduction,omitempty"`
+
+	UniqueYieldCount        int    `json:"unique_yield_count"`
+	PeakQueueLen            int    `json:"peak_queue_len"`
+	PeakPendingActionStarts int    `json:"peak_pending_action_starts"`
+	VisitedCount            int    `json:"visited_count"`
+	FrontierCount           int    `json:"frontier_count"`
+	DepthReached            int    `json:"depth_reached"`
+	ElapsedNanos            int64  `json:"elapsed_ns"`
+	Time                    string `json:"time,omitempty"`
+}
+
+type checkpointer struct {
+	dir       string
+	interval  time.Duration
+	resumeDir string
+	last      time.Time
+	// elapsed is the exploration time of earlier runs this run resumed.
+	elapsed time.Duration
+}
+
+// SetCheckpoint writes a checkpoint to dir every interval, and once more when
+// the run is stopped. Must be called before Start; only supported with the
+// no-graph mode and the bfs strategy.
+func (p *Processor) SetCheckpoint(dir string, interval time.Duration) {
+	if p.checkpoint == nil {
+		p.checkpoint = &checkpointer{}
+	}
+	p.checkpoint.dir = dir
+	p.checkpoint.interval = interval
+}
+
+// SetResume continues the run from the checkpoint in dir instead of starting
+// from Init. Must be called before Start, with the same spec, options and
+// fingerprint size as the run that wrote the checkpoint.
+func (p *Processor) SetResume(dir string) {
+	if p.checkpoint == nil {
+		p.checkpoint = &checkpointer{}
+	}
+	p.checkpoint.resumeDir = dir
+}
+
+// CheckpointDir returns the directory checkpoints are written to under outDir.
+func CheckpointDir(outDir string) string {
+	return filepath.Join(outDir, "checkpoint")
+}
+
+func (p *Processor) checkCheckpointSupported() error {
+	if !p.experimentalNoGraph || p.simulation {
+		return fmt.Errorf("checkpoints require the no-graph mode and exhaustive search")
+	}
+	switch p.queue.(type) {
+	case *lib.Queue[*Node], *lib.DiskQueue[*Node]:
+	default:
+		return fmt.Errorf("checkpoints require the bfs exploration strategy")
+	}
+	if p.guidedTrace != nil {
+		return fmt.Errorf("checkpoints do not support guided traces")
+	}
+	return nil
+}
+
+// specHash fingerprints the spec and options a checkpoint belongs to.
+func (p *Processor) specHash() (string, error) {
+	h := sha256.New()
+	opts := proto.MarshalOptions{Deterministic: true}
+	for _, file := range p.Files {
+		b, err := opts.Marshal(file)
+		if err != nil {
+			return "", err
+		}
+		h.Write(b)
+	}
+	b, err := opts.Marshal(p.config)
+	if err != nil {
+		return "", err
+	}
+	h.Write(b)
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// maybeCheckpoint writes a checkpoint if the interval has passed since the
+// last one. Must only be called between yield-point expansions.
+func (p *Processor) maybeCheckpoint(startTime time.Time) {
+	c := p.checkpoint
+	if c == nil || c.interval <= 0 {
+		return
+	}
+	if c.last.IsZero() {
+		c.last = startTime
+	}
+	if time.Since(c.last) < c.interval {
+		return
+	}
+	p.writeCheckpointOrWarn(startTime)
+}
+
+func (p *Processor) writeCheckpointOrWarn(startTime time.Time) {
+	if err := p.writeCheckpoint(startTime); err != nil {
+		fmt.Fprintln(os.Stderr, "Error writing checkpoint:", err)
+		return
+	}
+	fmt.Printf("Checkpoint written to %s\n", p.checkpoint.dir)
+}
+
+// writeCheckpoint writes the checkpoint to a temporary directory and then
+// swaps it in, so a kill mid-write leaves the previous checkpoint intact.
+func (p *Processor) writeCheckpoint(startTime time.Time) error {
+	c := p.checkpoint
+	c.last = time.Now()
+	specHash, err := p.specHash()
+	if err != nil {
+		return err
+	}
+	tmp := c.dir + ".tmp"
+	if err := os.RemoveAll(tmp); err != nil {
+		return err
+	}
+	if err := os.MkdirAll(tmp, 0755); err != nil {
+		return err
+	}
+
+	frontier := 0
+	err = writeFileBuffered(filepath.Join(tmp, checkpointFrontier), func(w io.Writer) error {
+		frontier = p.queue.Len()
+		switch q := p.queue.(type) {
+		case *lib.DiskQueue[*Node]:
+			_, err := q.WriteTo(w)
+			return err
+		case *lib.Queue[*Node]:
+			codec := &frontierCodec{p: p}
+			for _, node := range q.PeekN(q.Len()) {
+				data, err := codec.Encode(node)
+				if err != nil {
+					return err
+				}
+				if err := lib.WriteRecord(w, data); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	err = writeFileBuffered(filepath.Join(tmp, checkpointVisited), func(w io.Writer) error {
+		write := func(key []byte) error {
+			_, err := w.Write(key)
+			return err
+		}
+		if p.spill != nil && p.spill.visited != nil {
+			return p.spill.visited.ForEach(write)
+		}
+		return p.visited.ForEachKey(write)
+	})
+	if err != nil {
+		return err
+	}
+	meta := checkpointMeta{
+		Version:                 checkpointVersion,
+		SpecHash:                specHash,
+		FingerprintBits:         p.visited.bits,
+		PartialOrderReduction:   p.por != nil,
+		UniqueYieldCount:        p.uniqueYieldCount,
+		PeakQueueLen:            p.peakQueueLen,
+		PeakPendingActionStarts: p.peakPendingActionStarts,
+		VisitedCount:            p.visitedCount(),
+		FrontierCount:           frontier,
+		DepthReached:            p.depthReached,
+		ElapsedNanos:            int64(c.elapsed + time.Since(startTime)),
+	}
+	if !p.isTest {
+		meta.Time = time.Now().Format(time.RFC3339)
+	}
+	b, err := json.MarshalIndent(meta, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(filepath.Join(tmp, checkpointMetaFile), b, 0644); err != nil {
+		return err
+	}
+	if err := os.RemoveAll(c.dir); err != nil {
+		return err
+	}
+	return os.Rename(tmp, c.dir)
+}
+
+func writeFileBuffered(name string, write func(w io.Writer) error) error {
+	f, err := os.Create(name)
+	if err != nil {
+		return err
+	}
+	w := bufio.NewWriter(f)
+	if err := write(w); err != nil {
+		f.Close()
+		return err
+	}
+	if err := w.Flush(); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// loadCheckpoint restores the visited set, the processed queue and the run
+// stats from c.resumeDir. Init must already exist and recipes be enabled.
+func (p *Processor) loadCheckpoint() error {
+	c := p.checkpoint
+	b, err := os.ReadFile(filepath.Join(c.resumeDir, checkpointMetaFile))
+	if err != nil {
+		return err
+	}
+	var meta checkpointMeta
+	if err := json.Unmarshal(b, &meta); err != nil {
+		return fmt.Errorf("reading %s: %w", checkpointMetaFile, err)
+	}
+	if meta.Version != checkpointVersion {
+		return fmt.Errorf("unsupported checkpoint version %d", meta.Version)
+	}
+	specHash, err := p.specHash()
+	if err != nil {
+		return err
+	}
+	if meta.SpecHash != specHash {
+		return fmt.Errorf("checkpoint was written for a different spec or state space options")
+	}
+	if meta.FingerprintBits != p.visited.bits {
+		return fmt.Errorf("checkpoint uses %d-bit fingerprints, this run uses %d", meta.FingerprintBits, p.visited.bits)
+	}
+	if meta.PartialOrderReduction != (p.por != nil) {
+		return fmt.Errorf("checkpoint and this run differ in partial-order reduction")
+	}
+
+	visited, err := os.Open(filepath.Join(c.resumeDir, checkpointVisited))
+	if err != nil {
+		return err
+	}
+	defer visited.Close()
+	r := bufio.NewReader(visited)
+	key := make([]byte, p.visited.bits/8)
+	for {
+		if _, err := io.ReadFull(r, key); err == io.EOF {
+			break
+		} else if err != nil {
+			return fmt.Errorf("reading %s: %w", checkpointVisited, err)
+		}
+		if p.spill != nil && p.spill.visited != nil {
+			_, err = p.spill.visited.Put(key)
+		} else {
+			err = p.visited.PutKey(key)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	if p.visitedCount() != meta.VisitedCount {
+		return fmt.Errorf("checkpoint has %d visited fingerprints, expected %d", p.visitedCount(), meta.VisitedCount)
+	}
+
+	frontier, err := os.Open(filepath.Join(c.resumeDir, checkpointFrontier))
+	if err != nil {
+		return err
+	}
+	defer frontier.Close()
+	r = bufio.NewReader(frontier)
+	codec := &frontierCodec{p: p}
+	for {
+		data, err := lib.ReadRecord(r)
+		if errors.Is(err, io.EOF) {
+			break
+		} else if err != nil {
+			return fmt.Errorf("reading %s: %w", checkpointFrontier, err)
+		}
+		yp, err := codec.Decode(data)
+		if err != nil {
+			return fmt.Errorf("restoring frontier: %w", err)
+		}
+		p.queue.Add(yp)
+	}
+	if p.queue.Len() != meta.FrontierCount {
+		return fmt.Errorf("checkpoint has %d frontier states, expected %d", p.queue.Len(), meta.FrontierCount)
+	}
+
+	p.uniqueYieldCount = meta.UniqueYieldCount
+	p.peakQueueLen = max(meta.PeakQueueLen, p.queue.Len())
+	p.peakPendingActionStarts = meta.PeakPendingActionStarts
+	p.depthReached = meta.DepthReached
+	c.elapsed = time.Duration(meta.ElapsedNanos)
+	fmt.Printf("Resumed from %s: %d visited, %d queued\n", c.resumeDir, p.visitedCount(), p.queue.Len())
+	return nil
+}
@@ -0,0 +1,297 @@
+package modelchecker
+
+import (
+	ast "fizz/proto"
+	"fmt"
+	"github.com/fizzbee-io/fizzbee/lib"
+	"go.starlark.net/starlark"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+// A deadlock is a state where no action, and no thread in progress, leads to
+// another state. The path to it rarely says why, so ExplainDeadlock runs each
+// of them again from the stuck state, as the exploration did, and records
+// where each stopped.
+
+// Why an action, or a thread in progress, has no successor.
+const (
+	// A require statement, or a wait in a thread in progress, is false.
+	DisabledRequire = "require"
+	// Another statement disabled the transition, such as an any statement
+	// with no choices.
+	DisabledStatement = "disabled"
+	// The action ran to the end without changing the state.
+	DisabledNoEffect = "no_effect"
+	// A limit of action_options for the action.
+	DisabledActionLimit = "action_limit"
+	// max_concurrent_actions threads are already in progress.
+	DisabledMaxConcurrentActions = "max_concurrent_actions"
+	// The path already has max_actions actions.
+	DisabledMaxActions = "max_actions"
+	// The action leads to a state after all, such as when the deadlock was
+	// found with a partial view of the graph.
+	DisabledNone = "enabled"
+)
+
+// DisabledAction explains why an action, or a thread in progress, has no
+// successor in a stuck state.
+type DisabledAction struct {
+	// Name is the action, as Role#0.Action for a role action, or the action
+	// a thread in progress runs.
+	Name string
+	// Thread is the index of the thread in progress, or -1 for an action.
+	Thread int
+	// Reason is one of the Disabled constants.
+	Reason string
+	// Detail is the limit for a limit reason, and the statement for a
+	// statement reason.
+	Detail string
+	// SourceInfo locates the statement.
+	SourceInfo *ast.SourceInfo
+	// Values are the values of the names the require condition uses, where
+	// it was false.
+	Values []*lib.Pair[string, string]
+}
+
+// String returns the explanation as a line of the text output.
+func (d *DisabledAction) String() string {
+	b := strings.Builder{}
+	name := strings.ReplaceAll(d.Name, lib.SymmetryPrefix, "")
+	if d.Thread >= 0 {
+		b.WriteString(fmt.Sprintf("thread-%d (%s): ", d.Thread, name))
+	} else {
+		b.WriteString(fmt.Sprintf("%s: ", name))
+	}
+	switch d.Reason {
+	case DisabledRequire:
+		b.WriteString(fmt.Sprintf("require %s is false", d.Detail))
+	case DisabledStatement:
+		b.WriteString(fmt.Sprintf("disabled by %s", d.Detail))
+	case DisabledNoEffect:
+		b.WriteString("runs without changing the state")
+	case DisabledActionLimit, DisabledMaxConcurrentActions, DisabledMaxActions:
+		b.WriteString(fmt.Sprintf("limited by %s", d.Detail))
+	default:
+		b.WriteString("is enabled")
+	}
+	if line := d.SourceInfo.GetStart().GetLine(); line > 0 {
+		b.WriteString(fmt.Sprintf(" (line %d)", line))
+	}
+	for i, value := range d.Values {
+		if i == 0 {
+			b.WriteString(", with ")
+		} else {
+			b.WriteString(", ")
+		}
+		b.WriteString(fmt.Sprintf("%s = %s", value.First, value.Second))
+	}
+	return b.String()
+}
+
+// maxExplainedForks bounds the branches of an action run again to explain
+// it, for actions that choose from large sets.
+const maxExplainedForks = 1000
+
+// ExplainDeadlock returns why each thread in progress, and each action and
+// role action, has no successor at the stuck node: the threads first, in
+// order, then the actions in the order of the spec. An action whose
+// branches stop at different statements has an entry for each.
+func (p *Processor) ExplainDeadlock(node *Node) []*DisabledAction {
+	if node == nil || node.Process == nil || node.Process.Heap == nil {
+		return nil
+	}
+	var explanation []*DisabledAction
+	for i, thread := range node.Threads {
+		if thread == nil || thread.currentPc() == "" {
+			continue
+		}
+		fork := node.Process.Fork()
+		fork.Current = i
+		fork.ThreadProgress = true
+		for _, d := range explainRun(fork) {
+			d.Name = thread.Stack.RawArray()[0].Name
+			if obj := thread.Stack.RawArray()[0].obj; obj != nil {
+				d.Name = obj.RefStringShort() + "." + strings.TrimPrefix(d.Name, obj.Name+".")
+			}
+			d.Thread = i
+			explanation = append(explanation, d)
+		}
+	}
+
+	explain := func(role *lib.Role, roleIndex int, actions []*ast.Action) {
+		for i, action := range actions {
+			if action.Name == "Init" {
+				continue
+			}
+			name := action.Name
+			if role != nil {
+				name = role.RefStringShort() + "." + action.Name
+			}
+			limited := func(reason string, detail string) {
+				explanation = append(explanation, &DisabledAction{Name: name, Thread: -1, Reason: reason, Detail: detail})
+			}
+			if node.actionDepth >= int(p.config.Options.MaxActions) {
+				limited(DisabledMaxActions, fmt.Sprintf("max_actions: %d", p.config.Options.MaxActions))
+				continue
+			}
+			if node.GetThreadsCount() >= int(p.config.Options.MaxConcurrentActions) {
+				limited(DisabledMaxConcurrentActions, fmt.Sprintf("max_concurrent_actions: %d", p.config.Options.MaxConcurrentActions))
+				continue
+			}
+			if limit := p.actionCountLimit(action, node.Process, role); limit != "" {
+				limited(DisabledActionLimit, limit)
+				continue
+			}
+			fork := newActionFork(node, nil, role, roleIndex, action, i)
+			if fork == nil {
+				continue
+			}
+			for _, d := range explainRun(fork.Process) {
+				d.Name = name
+				explanation = append(explanation, d)
+			}
+		}
+	}
+	explain(nil, 0, p.Files[0].Actions)
+	for _, role := range node.Roles {
+		if role == nil {
+			continue
+		}
+		for i, roleAst := range p.Files[0].Roles {
+			if roleAst.Name == role.Name {
+				explain(role, i, roleAst.Actions)
+				break
+			}
+		}
+	}
+	return explanation
+}
+
+// explainRun runs the current thread of the process, and the branches it
+// forks, as processNode does, until each branch is disabled or yields.
+// Returns where the branches stopped, once per statement, or a single
+// DisabledNone if one of them yields.
+func explainRun(process *Process) []*DisabledAction {
+	var stopped []*DisabledAction
+	seen := make(map[string]bool)
+	queue := []*Process{process}
+	for i := 0; i < len(queue) && i < maxExplainedForks; i++ {
+		proc := queue[i]
+		thread := proc.currentThread()
+		forks, yield := thread.Execute()
+		if len(forks) == 0 && !proc.Enabled && !proc.ThreadProgress {
+			pc := ""
+			if thread.Stack.Len() > 0 {
+				pc = thread.currentPc()
+			}
+			if !seen[pc] {
+				seen[pc] = true
+				stopped = append(stopped, explainStop(thread))
+			}
+			continue
+		}
+		if yield {
+			return []*DisabledAction{{Thread: -1, Reason: DisabledNone}}
+		}
+		queue = append(queue, forks...)
+	}
+	return stopped
+}
+
+// explainStop returns why the thread was disabled, from the statement it
+// stopped at.
+func explainStop(thread *Thread) *DisabledAction {
+	d := &DisabledAction{Thread: -1, Reason: DisabledNoEffect}
+	if thread.Stack.Len() == 0 || thread.currentPc() == "" {
+		return d
+	}
+	stmt, ok := GetProtoFieldByPath(thread.currentFileAst(), thread.currentPc()).(*ast.Statement)
+	if !ok {
+		return d
+	}
+	switch {
+	case stmt.RequireStmt != nil:
+		d.Reason = DisabledRequire
+		d.Detail = stmt.RequireStmt.GetCondition()
+		d.SourceInfo = stmt.RequireStmt.GetSourceInfo()
+		d.Values = conditionValues(thread.Process, d.Detail)
+	case stmt.AnyStmt != nil:
+		d.Reason = DisabledStatement
+		d.Detail = "any with no choices"
+		d.SourceInfo = stmt.AnyStmt.GetSourceInfo()
+	case stmt.IfStmt != nil:
+		d.Reason = DisabledStatement
+		d.Detail = "if condition"
+		d.SourceInfo = stmt.IfStmt.GetSourceInfo()
+	case stmt.CallStmt != nil:
+		d.Reason = DisabledStatement
+		d.Detail = "call to " + stmt.CallStmt.GetName()
+		d.SourceInfo = stmt.CallStmt.GetSourceInfo()
+	case stmt.PyStmt != nil:
+		d.Reason = DisabledStatement
+		d.Detail = stmt.PyStmt.GetCode()
+		d.SourceInfo = stmt.PyStmt.GetSourceInfo()
+	default:
+		d.Reason = DisabledStatement
+		d.Detail = "statement"
+	}
+	if d.SourceInfo == nil {
+		d.SourceInfo = stmt.GetSourceInfo()
+	}
+	return d
+}
+
+// conditionName matches the names, and the attributes of names, a condition
+// uses, and conditionString the string literals that may look like them.
+var conditionName = regexp.MustCompile(`[A-Za-z_]\w*(\.[A-Za-z_]\w*)*(\s*\()?`)
+var conditionString = regexp.MustCompile(`"[^"]*"|'[^']*'`)
+
+var conditionKeywords = []string{"and", "or", "not", "in", "is", "if", "else", "for", "lambda", "True", "False", "None"}
+
+// conditionValues returns the values of the names the condition uses in the
+// process, as the names and the values as the spec prints them. Functions,
+// and names that do not evaluate, are skipped.
+func conditionValues(process *Process, condition string) []*lib.Pair[string, string] {
+	condition = conditionString.ReplaceAllStringFunc(condition, func(s string) string {
+		return strings.Repeat(" ", len(s))
+	})
+	vars := process.GetAllVariables()
+	fileName := process.Files[0].GetSourceInfo().GetFileName()
+	var values []*lib.Pair[string, string]
+	var names []string
+	for _, match := range conditionName.FindAllStringIndex(condition, -1) {
+		if match[0] > 0 && (condition[match[0]-1] == '.' || isDigit(condition[match[0]-1])) {
+			continue
+		}
+		name := condition[match[0]:match[1]]
+		if strings.HasSuffix(name, "(") {
+			// A call: the receiver of a method is a value, the function is not.
+			name = strings.TrimSpace(strings.TrimSuffix(name, "("))
+			dot := strings.LastIndex(name, ".")
+			if dot < 0 {
+				continue
+			}
+			name = name[:dot]
+		}
+		if slices.Contains(conditionKeywords, name) || slices.Contains(names, name) {
+			continue
+		}
+		names = append(names, name)
+		value, err := process.Evaluator.EvalPyExprWithContext(fileName, name, vars, process.createSymmetryContext())
+		if err != nil {
+			continue
+		}
+		if _, ok := value.(starlark.Callable); ok {
+			continue
+		}
+		pair := lib.NewPair(name, value.String())
+		values = append(values, &pair)
+	}
+	return values
+}
+
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
@@ -0,0 +1,112 @@
+package modelchecker
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/fizzbee-io/fizzbee/lib"
+)
+
+// Disk spilling keeps the visited fingerprints and the BFS frontier on disk so
+// no_graph runs can explore state spaces larger than memory.
+//
+// The visited set is a lib.DiskFPSet of the same fingerprints the in-memory
+// visited set would hold (see SetFingerprintBits). The frontier is a
+// lib.DiskQueue of yield-points, each spilled as its recipe (see recipe.go).
+
+type diskSpill struct {
+	dir       string
+	memStates int
+
+	visited *lib.DiskFPSet
+	queue   *lib.DiskQueue[*Node]
+}
+
+// SetDiskSpill keeps the visited set and the BFS frontier on disk under dir,
+// holding about memStates fingerprints and frontier states in memory. Must be
+// called before Start, and only together with the no-graph mode and the bfs
+// strategy. Exploration order is unchanged, so traces are still the shortest.
+func (p *Processor) SetDiskSpill(dir string, memStates int) {
+	p.spill = &diskSpill{dir: dir, memStates: memStates}
+}
+
+// initDiskSpill swaps in the disk-backed visited set and frontier. Called
+// once the Init node exists and before anything runs.
+func (p *Processor) initDiskSpill() error {
+	s := p.spill
+	if !p.experimentalNoGraph || p.simulation {
+		return fmt.Errorf("disk spill requires the no-graph mode and exhaustive search")
+	}
+	if _, fifo := p.queue.(*lib.Queue[*Node]); !fifo {
+		return fmt.Errorf("disk spill requires the bfs exploration strategy")
+	}
+	if p.guidedTrace != nil {
+		return fmt.Errorf("disk spill does not support guided traces")
+	}
+	var err error
+	s.visited, err = lib.NewDiskFPSet(s.dir, p.visited.bits/8, s.memStates)
+	if err != nil {
+		return err
+	}
+	// Half the budget goes to each in-memory end of the frontier.
+	s.queue, err = lib.NewDiskQueue[*Node](s.dir, max(1, s.memStates/2), &frontierCodec{p: p})
+	if err != nil {
+		return err
+	}
+	p.queue = s.queue
+	return nil
+}
+
+// closeDiskSpill removes the spill files once the run is over.
+func (p *Processor) closeDiskSpill() {
+	s := p.spill
+	if s == nil || s.visited == nil {
+		return
+	}
+	s.queue.ClearAll()
+	if err := s.visited.Close(); err != nil {
+		fmt.Fprintln(os.Stderr, "Error removing spilled fingerprints:", err)
+	}
+	// Only succeeds once the directory is empty; other files are left alone.
+	_ = os.Remove(s.dir)
+}
+
+// lookupVisited returns the visited entry for a canonical hash. With disk
+// spill only presence is tracked, so the node is always nil.
+func (p *Processor) lookupVisited(hash string) (*Node, bool) {
+	if p.spill != nil && p.spill.visited != nil {
+		found, err := p.spill.visited.Contains(fingerprintBytes(hash, p.visited.bits/8))
+		if err != nil {
+			panic(fmt.Errorf("reading spilled fingerprints: %w", err))
+		}
+		return nil, found
+	}
+	return p.visited.Get(hash)
+}
+
+// markVisited records a canonical hash in no-graph mode.
+func (p *Processor) markVisited(hash string) {
+	if p.spill != nil && p.spill.visited != nil {
+		if _, err := p.spill.visited.Put(fingerprintBytes(hash, p.visited.bits/8)); err != nil {
+			panic(fmt.Errorf("spilling fingerprints: %w", err))
+		}
+		return
+	}
+	p.visited.Put(hash, nil)
+}
+
+func (p *Processor) visitedCount() int {
+	if p.spill != nil && p.spill.visited != nil {
+		return p.spill.visited.Len()
+	}
+	return p.visited.Len()
+}
+
+// spillDirName is the directory under the output dir that holds spill files.
+const spillDirName = "spill"
+
+// SpillDir returns the directory used for spill files under outDir.
+func SpillDir(outDir string) string {
+	return filepath.Join(outDir, spillDirName)
+}
@@ -0,0 +1,168 @@
+package modelchecker
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"math"
+)
+
+// DefaultFingerprintBits is the fingerprint size the visited set uses unless
+// SetFingerprintBits says otherwise.
+const DefaultFingerprintBits = 128
+
+// FullHashBits selects the paranoid mode: the visited set is keyed by the
+// full hex SHA-256 state hash, as before fingerprints were introduced.
+const FullHashBits = 256
+
+// Fingerprint is a compact visited-set key: the leading 64 or 128 bits of a
+// state's canonical SHA-256 hash. A 64-bit fingerprint leaves Hi zero.
+type Fingerprint struct {
+	Hi uint64
+	Lo uint64
+}
+
+// visitedSet maps canonical state hashes to the node first seen with that
+// state. In fingerprint mode only the truncated hash is stored, which is 16
+// bytes per key instead of a 64-character string.
+type visitedSet struct {
+	bits  int
+	nodes map[Fingerprint]*Node
+	full  map[string]*Node
+}
+
+func newVisitedSet(bits int) *visitedSet {
+	v := &visitedSet{bits: bits}
+	v.Clear()
+	return v
+}
+
+func (v *visitedSet) Get(hash string) (*Node, bool) {
+	if v.full != nil {
+		n, ok := v.full[hash]
+		return n, ok
+	}
+	n, ok := v.nodes[toFingerprint(hash, v.bits)]
+	return n, ok
+}
+
+func (v *visitedSet) Put(hash string, node *Node) {
+	if v.full != nil {
+		v.full[hash] = node
+		return
+	}
+	v.nodes[toFingerprint(hash, v.bits)] = node
+}
+
+func (v *visitedSet) Len() int {
+	if v.full != nil {
+		return len(v.full)
+	}
+	return len(v.nodes)
+}
+
+// ForEachKey calls fn with the raw bytes of every key: bits/8 bytes, the
+// same encoding fingerprintBytes produces. fn must not retain the slice.
+func (v *visitedSet) ForEachKey(fn func(key []byte) error) error {
+	if v.full != nil {
+		for hash := range v.full {
+			if err := fn(fingerprintBytes(hash, sha256.Size)); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	buf := make([]byte, 16)
+	for fp := range v.nodes {
+		key := buf[:0]
+		if v.bits > 64 {
+			key = binary.BigEndian.AppendUint64(key, fp.Hi)
+		}
+		key = binary.BigEndian.AppendUint64(key, fp.Lo)
+		if err := fn(key); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// PutKey adds a key in the encoding ForEachKey produces, with no node.
+func (v *visitedSet) PutKey(key []byte) error {
+	if len(key) != v.bits/8 {
+		return fmt.Errorf("visited key has %d bytes, want %d", len(key), v.bits/8)
+	}
+	if v.full != nil {
+		v.full[hex.EncodeToString(key)] = nil
+		return nil
+	}
+	var fp Fingerprint
+	if v.bits > 64 {
+		fp.Hi = binary.BigEndian.Uint64(key[:8])
+		key = key[8:]
+	}
+	fp.Lo = binary.BigEndian.Uint64(key)
+	v.nodes[fp] = nil
+	return nil
+}
+
+// Clear removes every entry, keeping the mode.
+func (v *visitedSet) Clear() {
+	if v.bits == FullHashBits {
+		v.full = make(map[string]*Node)
+	} else {
+		v.nodes = make(map[Fingerprint]*Node)
+	}
+}
+
+// SetFingerprintBits sets how many bits of each canonical state hash the
+// visited set keeps: 64 or 128, or FullHashBits to keep the full hash
+// (paranoid mode). Must be called before Start.
+func (p *Processor) SetFingerprintBits(bits int) error {
+	if bits != 64 && bits != 128 && bits != FullHashBits {
+		return fmt.Errorf("unsupported fingerprint size %d, want 64, 128 or %d", bits, FullHashBits)
+	}
+	p.visited = newVisitedSet(bits)
+	return nil
+}
+
+// FingerprintBits returns the number of hash bits the visited set keeps.
+func (p *Processor) FingerprintBits() int {
+	return p.visited.bits
+}
+
+// CollisionProbability returns an upper bound on the probability that two
+// distinct states explored so far share a fingerprint, so one was wrongly
+// treated as already visited. It is the birthday bound n(n-1)/2^(b+1) for n
+// stored fingerprints of b bits, assuming the hash is uniformly distributed.
+func (p *Processor) CollisionProbability() float64 {
+	n := float64(p.visitedCount())
+	if n < 2 {
+		return 0
+	}
+	return min(1, n*(n-1)/math.Exp2(float64(p.visited.bits+1)))
+}
+
+// toFingerprint truncates a hex SHA-256 state hash to bits. Hashes in any
+// other format are hashed first.
+func toFingerprint(hash string, bits int) Fingerprint {
+	b := fingerprintBytes(hash, 16)
+	fp := Fingerprint{Lo: binary.BigEndian.Uint64(b[:8])}
+	if bits > 64 {
+		fp.Hi = fp.Lo
+		fp.Lo = binary.BigEndian.Uint64(b[8:16])
+	}
+	return fp
+}
+
+// fingerprintBytes returns the leading width bytes of the raw SHA-256 digest
+// behind a hex state hash. width is at most sha256.Size.
+func fingerprintBytes(hash string, width int) []byte {
+	if len(hash) == hex.EncodedLen(sha256.Size) {
+		if b, err := hex.DecodeString(hash[:2*width]); err == nil {
+			return b
+		}
+	}
+	sum := sha256.Sum256([]byte(hash))
+	return sum[:width]
+}
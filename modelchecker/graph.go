@@ -140,7 +140,12 @@ func GenerateProtoOfJson(nodes []*Node, pathPrefix string) ([]string, []string,
 	return jsonFileNames, linksFileNames, nil
 }
 
-func GenerateErrorPathProtoOfJson(errorPath []*Link, pathPrefix string) ([]string, []string, error) {
+// GenerateErrorPathProtoOfJson writes the nodes and links of an error path.
+// For a liveness failure, cycleStart is the index of the first link of the
+// cycle the path ends with, as LassoCycleStart returns, and the links carry
+// the lasso; it is -1 for other failures. For a deadlock, the links carry
+// deadlock, the explanation ExplainDeadlock returns.
+func GenerateErrorPathProtoOfJson(errorPath []*Link, cycleStart int, deadlock []*DisabledAction, pathPrefix string) ([]string, []string, error) {
 	dir := filepath.Dir(pathPrefix)
 	err := os.MkdirAll(dir, os.ModePerm)
 	if err != nil {
@@ -188,7 +193,12 @@ func GenerateErrorPathProtoOfJson(errorPath []*Link, pathPrefix string) ([]strin
 
 	}
 	if len(links) > 0 {
-		err := writeProtoMsgToFile(&proto.Links{TotalNodes: int64(len(errorPath)), Links: links}, adjListFileName)
+		err := writeProtoMsgToFile(&proto.Links{
+			TotalNodes: int64(len(errorPath)),
+			Links:      links,
+			Lasso:      lassoProto(errorPath, cycleStart),
+			Deadlock:   deadlockProto(deadlock),
+		}, adjListFileName)
 		if err != nil {
 			return nil, nil, err
 		}
@@ -199,6 +209,44 @@ func GenerateErrorPathProtoOfJson(errorPath []*Link, pathPrefix string) ([]strin
 	return jsonFileNames, linksFileNames, nil
 }
 
+func lassoProto(errorPath []*Link, cycleStart int) *proto.Lasso {
+	if cycleStart <= 0 || cycleStart >= len(errorPath) {
+		return nil
+	}
+	lasso := &proto.Lasso{
+		CycleEntry: int64(cycleStart - 1),
+		Stutter:    isStutterCycle(errorPath, cycleStart),
+	}
+	for _, missing := range lassoMissingFairLinks(errorPath, cycleStart) {
+		names := make([]string, 0, len(missing.Second))
+		for _, link := range missing.Second {
+			names = append(names, strings.ReplaceAll(link.Name, lib.SymmetryPrefix, ""))
+		}
+		lasso.MissingFairLinks = append(lasso.MissingFairLinks, &proto.MissingFairLinks{Node: int64(missing.First), Names: names})
+	}
+	return lasso
+}
+
+func deadlockProto(deadlock []*DisabledAction) []*proto.DisabledAction {
+	actions := make([]*proto.DisabledAction, 0, len(deadlock))
+	for _, d := range deadlock {
+		values := make([]*proto.NameValue, 0, len(d.Values))
+		for _, value := range d.Values {
+			values = append(values, &proto.NameValue{Name: value.First, Value: value.Second})
+		}
+		actions = append(actions, &proto.DisabledAction{
+			Name:        strings.ReplaceAll(d.Name, lib.SymmetryPrefix, ""),
+			Thread:      int64(d.Thread),
+			Reason:      d.Reason,
+			Detail:      d.Detail,
+			Line:        d.SourceInfo.GetStart().GetLine(),
+			Values:      values,
+			Description: d.String(),
+		})
+	}
+	return actions
+}
+
 func writeNodeJsonsToFile(nodeJsons []string, filename string) error {
 	// Serialize the message to binary format
 	return writeProtoMsgToFile(&proto.Nodes{Json: nodeJsons}, filename)
@@ -382,7 +430,11 @@ func printGraph(node *Node) {
 	}
 }
 
-func GenerateFailurePath(nodes []*Link, name string, invariant *InvariantPosition) string {
+// GenerateFailurePath returns the dot graph of a failure path, or a cluster
+// of it if name is set. For a liveness failure, cycleStart is the index of
+// the first link of the cycle, and the last link is drawn as a dashed back
+// edge to the entry of the cycle; it is -1 for other failures.
+func GenerateFailurePath(nodes []*Link, cycleStart int, name string, invariant *InvariantPosition) string {
 	re := regexp.MustCompile(`\\+`)
 
 	builder := strings.Builder{}
@@ -400,12 +452,17 @@ func GenerateFailurePath(nodes []*Link, name string, invariant *InvariantPositio
 	parentID := ""
 	// The visited/cycle detection is not used when using composition for now.
 	visited := map[*Node]string{}
+	hasCycle := cycleStart > 0 && cycleStart < len(nodes)
+	entryID := ""
 
 	for i, link := range nodes {
 		node := link.Node
 		nodeID := fmt.Sprintf("\"%s%d\"", prefix, i)
+		isBackEdge := hasCycle && i == len(nodes)-1
 
-		if visited[node] != "" {
+		if isBackEdge {
+			nodeID = entryID
+		} else if visited[node] != "" {
 			nodeID = visited[node]
 		} else {
 			if name == "" {
@@ -424,6 +481,9 @@ func GenerateFailurePath(nodes []*Link, name string, invariant *InvariantPositio
 			stateString := re.ReplaceAllString(node.String(), "\\")
 			builder.WriteString(fmt.Sprintf("    %s [label=\"%s\", color=\"%s\" penwidth=\"%d\" ];\n", nodeID, stateString, color, penwidth))
 		}
+		if hasCycle && i == cycleStart-1 {
+			entryID = nodeID
+		}
 
 		if parentID != "" {
 			label := strings.ReplaceAll(link.Name, "\"", "\\\"")
@@ -440,7 +500,11 @@ func GenerateFailurePath(nodes []*Link, name string, invariant *InvariantPositio
 			if link.HasFailedInvariants() {
 				edgecolor = "red"
 			}
-			builder.WriteString(fmt.Sprintf("    %s -> %s [label=\"%d: %s\", color=\"%s\" penwidth=\"%d\"];\n", parentID, nodeID, i, label, edgecolor, edgewidth))
+			style := ""
+			if isBackEdge {
+				style = " style=\"dashed\" constraint=\"false\""
+			}
+			builder.WriteString(fmt.Sprintf("    %s -> %s [label=\"%d: %s\", color=\"%s\" penwidth=\"%d\"%s];\n", parentID, nodeID, i, label, edgecolor, edgewidth, style))
 		}
 
 		parentID = nodeID
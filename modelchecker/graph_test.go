@@ -1,8 +1,14 @@
 package modelchecker
 
 import (
+	ast "fizz/proto"
 	"fmt"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	proto3 "google.golang.org/protobuf/proto"
+	"os"
+	"path/filepath"
+	"strings"
 	"testing"
 )
 
@@ -59,3 +65,61 @@ func TestRemoveMergeNodes(t *testing.T) {
 	})
 
 }
+
+func TestGenerateErrorPathProtoOfJson_Lasso(t *testing.T) {
+	runfilesDir := os.Getenv("RUNFILES_DIR")
+	dir := filepath.Join(runfilesDir, "_main", "examples/tutorials/16-elements-counter-parallel")
+	file, err := readAstFromFile(filepath.Join(dir, "Counter.json"))
+	require.Nil(t, err)
+	stateConfig, err := ReadOptionsFromYaml(filepath.Join(dir, "fizz.yaml"))
+	require.Nil(t, err)
+	p := NewProcessor([]*ast.File{file}, stateConfig, false, 0, "", "", false, nil, nil, "")
+	root, _, err := p.Start()
+	require.Nil(t, err)
+	nodes, _, _, _ := GetAllNodes(root, stateConfig.GetOptions().GetMaxActions())
+	path, failedInvariant := CheckStrictLiveness(root, nodes)
+	require.NotNil(t, failedInvariant)
+
+	cycleStart := LassoCycleStart(path, 0)
+	require.Greater(t, cycleStart, 0)
+	require.Less(t, cycleStart, len(path))
+	assert.Same(t, path[len(path)-1].Node, path[cycleStart-1].Node)
+	// The stem is a path from the initial node that visits the entry last.
+	for _, link := range path[:cycleStart-1] {
+		assert.NotSame(t, path[cycleStart-1].Node, link.Node)
+	}
+
+	prefix := t.TempDir() + "/"
+	_, linkFiles, err := GenerateErrorPathProtoOfJson(path, cycleStart, nil, prefix)
+	require.Nil(t, err)
+	require.Len(t, linkFiles, 1)
+	data, err := os.ReadFile(linkFiles[0])
+	require.Nil(t, err)
+	links := &ast.Links{}
+	require.Nil(t, proto3.Unmarshal(data, links))
+	require.NotNil(t, links.GetLasso())
+	assert.Equal(t, int64(cycleStart-1), links.GetLasso().GetCycleEntry())
+	assert.Equal(t, path[len(path)-1].Name == "stutter", links.GetLasso().GetStutter())
+	// The cycle is fair, so it leaves no fair link untaken.
+	assert.Empty(t, links.GetLasso().GetMissingFairLinks())
+
+	// The last edge of the dot graph goes back to the entry.
+	dot := GenerateFailurePath(path, cycleStart, "", failedInvariant)
+	edges := strings.Split(strings.TrimSpace(dot), "\n")
+	backEdge := edges[len(edges)-2]
+	assert.Contains(t, backEdge, fmt.Sprintf("-> \"%d\"", cycleStart-1))
+	assert.Contains(t, backEdge, "style=\"dashed\"")
+
+	// A failure path without a cycle has no lasso.
+	path = ExtractFailurePath(path[cycleStart-1].Node, root)
+	assert.Equal(t, -1, LassoCycleStart(path, 0))
+	_, linkFiles, err = GenerateErrorPathProtoOfJson(path, -1, nil, prefix)
+	require.Nil(t, err)
+	if len(linkFiles) > 0 {
+		data, err = os.ReadFile(linkFiles[0])
+		require.Nil(t, err)
+		links = &ast.Links{}
+		require.Nil(t, proto3.Unmarshal(data, links))
+		assert.Nil(t, links.GetLasso())
+	}
+}
@@ -645,6 +645,67 @@ func EventuallyAlwaysFinal(nodes []*Node, root *Node, predicate Predicate) ([]*L
 	return CycleFinderFinal(nodes, root, f)
 }
 
+// LeadsToFinal checks that from every node where trigger holds, every fair
+// path reaches a node where response holds. The trigger nodes are checked
+// one by one; the search from each stops at the response nodes, and fails on
+// a fair cycle, or stuttering, that avoids them. The nodes explored from an
+// earlier trigger are not explored again, since the search from them does
+// not depend on the trigger. Returns the failure path and the index in it of
+// the link into the trigger node.
+func LeadsToFinal(nodes []*Node, root *Node, trigger Predicate, response Predicate) ([]*Link, int, bool) {
+	var triggers []*Node
+	for _, node := range nodes {
+		if relevant, value := trigger(node); relevant && value {
+			triggers = append(triggers, node)
+		}
+	}
+	responded := func(from *Node, link *Link) bool {
+		relevant, value := response(link.Node)
+		return relevant && value
+	}
+	return leadsToFinal(root, triggers, nil, responded)
+}
+
+// leadsToFinal is LeadsToFinal for the trigger nodes given, with a response
+// that is a link taken, such as an action, rather than a node reached: the
+// search stops at the links responded returns true for, with the node they
+// leave, or nil for the link into a trigger node. stem returns the path to
+// a trigger node for the failure path; if nil, it is the one
+// ExtractFailurePath returns.
+func leadsToFinal(root *Node, triggers []*Node, stem func(*Node) []*Link, responded func(from *Node, link *Link) bool) ([]*Link, int, bool) {
+	f := func(path []*Link, cycles int) (bool, *CycleCallbackResult) {
+		mergeNode := path[len(path)-1].Node
+		for i := 0; i < len(path)-1; i++ {
+			if path[i].Node == mergeNode {
+				isFair, cycleCallbackResult := isFairCycle(path[i:], false)
+				if isFair {
+					return false, nil
+				}
+				return true, cycleCallbackResult
+			}
+		}
+		return true, nil
+	}
+	globalVisited := make(map[*Node]bool)
+	for _, node := range triggers {
+		link := InitNodeToLink(node)
+		if responded(nil, link) || globalVisited[node] {
+			continue
+		}
+		failedPath, isLive := cycleFinderHelper(node, f, make(map[*Node]bool), 0, []*Link{link}, globalVisited, responded)
+		if !isLive {
+			var failedPathFull []*Link
+			if stem != nil {
+				failedPathFull = stem(node)
+			} else {
+				failedPathFull = ExtractFailurePath(node, root)
+			}
+			return slices.Concat(failedPathFull, failedPath[1:]), len(failedPathFull) - 1, false
+		}
+	}
+	return nil, -1, true
+}
+
 func isFairCycle(path []*Link, debugLog bool) (bool, *CycleCallbackResult) {
 	strongFairLinksInChain := map[string]bool{}
 	strongFairLinksOutOfChain := map[string]bool{}
@@ -854,7 +915,7 @@ func CycleFinderFinal(nodes []*Node, root *Node, callback CycleCallback) ([]*Lin
 			path = []*Link{link}
 		}
 
-		failedPath, isLive := cycleFinderHelper(node, callback, visited, 0, path, globalVisited)
+		failedPath, isLive := cycleFinderHelper(node, callback, visited, 0, path, globalVisited, nil)
 		if !isLive {
 			//fmt.Println("CycleFinderFinal: failedPath found in node", node.String())
 			failedPathFull := ExtractFailurePath(node, root)
@@ -865,7 +926,10 @@ func CycleFinderFinal(nodes []*Node, root *Node, callback CycleCallback) ([]*Lin
 	return nil, true
 }
 
-func cycleFinderHelper(node *Node, callback CycleCallback, visited map[*Node]bool, cycles int, path []*Link, globalVisited map[*Node]bool) ([]*Link, bool) {
+// cycleFinderHelper calls callback on the cycles reachable from node. If
+// skip is not nil, the search does not take the links it returns true for,
+// with the node they leave.
+func cycleFinderHelper(node *Node, callback CycleCallback, visited map[*Node]bool, cycles int, path []*Link, globalVisited map[*Node]bool, skip func(from *Node, link *Link) bool) ([]*Link, bool) {
 	if visited[node] {
 		//fmt.Println("\n\nCycle detected in the path:")
 		////fmt.Println("Path:", path)
@@ -883,6 +947,9 @@ func cycleFinderHelper(node *Node, callback CycleCallback, visited map[*Node]boo
 		for _, links := range result.missingLinks {
 			//fmt.Println("Missing links from node", i, links.First.String())
 			for _, l := range links.Second {
+				if skip != nil && skip(links.First, l) {
+					continue
+				}
 				//fmt.Println(j, l.Name, l.Node.String())
 				// Find the next larger cycle including the missing link one by one.
 				// That is, copy path, and visited, globalVisited and recursively call cycleFinderHelper for each of the missing link/node
@@ -904,7 +971,7 @@ func cycleFinderHelper(node *Node, callback CycleCallback, visited map[*Node]boo
 
 				pathCopy = append(pathCopy, l)
 				//globalVisitedCopy := maps.Clone(globalVisited)
-				failedPath, success := cycleFinderHelper(l.Node, callback, visitedCopy, cycles+1, pathCopy, globalVisited)
+				failedPath, success := cycleFinderHelper(l.Node, callback, visitedCopy, cycles+1, pathCopy, globalVisited, skip)
 				if !success {
 					return failedPath, false
 				}
@@ -951,10 +1018,13 @@ func cycleFinderHelper(node *Node, callback CycleCallback, visited map[*Node]boo
 			//fmt.Println("Skipping crash link", link.Name, "from node", node.String(), "to node", link.Node.String())
 			continue
 		}
+		if skip != nil && skip(node, link) {
+			continue
+		}
 		pathCopy := slices.Clone(path)
 		visitedCopy := maps.Clone(visited)
 		pathCopy = append(pathCopy, link)
-		failedPath, success := cycleFinderHelper(link.Node, callback, visitedCopy, cycles, pathCopy, globalVisited)
+		failedPath, success := cycleFinderHelper(link.Node, callback, visitedCopy, cycles, pathCopy, globalVisited, skip)
 		if !success {
 			return failedPath, false
 		}
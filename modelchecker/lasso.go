@@ -0,0 +1,64 @@
+package modelchecker
+
+import (
+	"github.com/fizzbee-io/fizzbee/lib"
+)
+
+// A liveness failure path is a lasso: a stem from the initial node to the
+// entry of a cycle, and the cycle, back to the entry, that repeats forever.
+// As for LtlResult and TraceLasso, it is given as the path and cycleStart,
+// the index of the first link of the cycle, so path[cycleStart-1].Node is
+// the entry. A cycle of a single stutter link means the system stops at the
+// entry.
+
+// LassoCycleStart returns the index of the first link of the cycle a
+// failure path of the liveness checks ends with, or -1 if the path does not
+// end with a cycle. The path ends at the entry, and the cycle starts at the
+// first visit to it from the link at from on, the start of the search that
+// found the cycle: 0 for a search from the initial node, and the trigger
+// for a leads-to property.
+func LassoCycleStart(path []*Link, from int) int {
+	if len(path) < 2 || from < 0 {
+		return -1
+	}
+	entry := path[len(path)-1].Node
+	for i := from; i < len(path)-1; i++ {
+		if path[i].Node == entry {
+			return i + 1
+		}
+	}
+	return -1
+}
+
+// isStutterCycle returns true if the cycle of a lasso is the system
+// stopping at the entry.
+func isStutterCycle(path []*Link, cycleStart int) bool {
+	return len(path)-cycleStart == 1 && path[cycleStart].Name == "stutter"
+}
+
+// lassoMissingFairLinks returns the fair links out of the cycle of a lasso
+// that isFairCycle finds the cycle never takes, by the index in path of the
+// first visit in the cycle to the node they leave. The cycles the liveness
+// checks report are fair, so this is usually empty; it explains a cycle
+// that is not.
+func lassoMissingFairLinks(path []*Link, cycleStart int) []*lib.Pair[int, []*Link] {
+	isFair, result := isFairCycle(path[cycleStart-1:], false)
+	if isFair || result == nil {
+		return nil
+	}
+	index := make(map[*Node]int)
+	for i := len(path) - 1; i >= cycleStart-1; i-- {
+		index[path[i].Node] = i
+	}
+	var missing []*lib.Pair[int, []*Link]
+	seen := make(map[*Node]bool)
+	for _, links := range result.missingLinks {
+		if seen[links.First] {
+			continue
+		}
+		seen[links.First] = true
+		pair := lib.NewPair(index[links.First], links.Second)
+		missing = append(missing, &pair)
+	}
+	return missing
+}
@@ -0,0 +1,234 @@
+package modelchecker
+
+import (
+	ast "fizz/proto"
+	"fmt"
+	"github.com/fizzbee-io/fizzbee/lib"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+// LeadsToResult is the outcome of checking a leads-to property.
+type LeadsToResult struct {
+	Name  string
+	P     string
+	Q     string
+	Holds bool
+	// Path is a counterexample when the property does not hold: the links
+	// from the initial node to a state where p holds, at Path[Trigger], and
+	// on to a fair cycle or stuttering that never reaches q.
+	Path    []*Link
+	Trigger int
+}
+
+// CheckLeadsToProperties checks the leads_to properties of options on the
+// graph of a passing model check, in order, and returns their results,
+// stopping at the first property that does not hold.
+func CheckLeadsToProperties(root *Node, nodes []*Node, options *ast.StateSpaceOptions) ([]*LeadsToResult, error) {
+	var results []*LeadsToResult
+	for k, property := range options.GetLeadsTo() {
+		name := property.GetName()
+		if name == "" {
+			name = fmt.Sprintf("leads_to property %d", k)
+		}
+		result, err := CheckLeadsTo(root, nodes, property, options.GetLtlPredicates())
+		if err != nil {
+			return results, fmt.Errorf("%s: %w", name, err)
+		}
+		result.Name = name
+		results = append(results, result)
+		if !result.Holds {
+			break
+		}
+	}
+	return results, nil
+}
+
+// CheckLeadsTo checks a leads-to property p ~> q on the graph of a passing
+// model check: every state where p holds is followed, on every fair path, by
+// a state where q holds. Unlike always-eventually, each state where p holds
+// is checked on its own, so a q state before it does not count. p and q are
+// evaluated at yields, and may name expressions in predicates.
+//
+// p and q may also be action predicates: taken(A) holds when a transition
+// takes the action A, and enabled(A) in the states where A can be taken. As
+// p, taken(A) triggers in the states A leads to; as q, it is the next time
+// A is taken. A is an action name, with Role.Action matching any instance
+// of a role and Role#0.Action a single one, or a label of a step.
+func CheckLeadsTo(root *Node, nodes []*Node, property *ast.LeadsTo, predicates map[string]string) (*LeadsToResult, error) {
+	result := &LeadsToResult{Name: property.GetName(), P: property.GetP(), Q: property.GetQ(), Holds: true, Trigger: -1}
+	var triggers []*Node
+	var stem func(*Node) []*Link
+	if action, ok := takenAction(property.GetP(), predicates); ok {
+		triggers, stem = actionTargets(root, nodes, action)
+	} else {
+		p, err := evalLeadsToPredicate(nodes, property.GetP(), predicates)
+		if err != nil {
+			return nil, err
+		}
+		for _, node := range nodes {
+			if p[node] {
+				triggers = append(triggers, node)
+			}
+		}
+	}
+	var responded func(from *Node, link *Link) bool
+	if action, ok := takenAction(property.GetQ(), predicates); ok {
+		responded = func(from *Node, link *Link) bool {
+			return from != nil && linkTakesAction(from, link, action)
+		}
+	} else {
+		q, err := evalLeadsToPredicate(nodes, property.GetQ(), predicates)
+		if err != nil {
+			return nil, err
+		}
+		responded = func(from *Node, link *Link) bool {
+			return q[link.Node]
+		}
+	}
+	path, triggerIndex, isLive := leadsToFinal(root, triggers, stem, responded)
+	if !isLive {
+		result.Holds = false
+		result.Path, result.Trigger = path, triggerIndex
+	}
+	return result, nil
+}
+
+func isLeadsToState(n *Node) bool {
+	return n.Process != nil && (n.Process.GetThreadsCount() == 0 || n.Name == "yield")
+}
+
+// actionPredicate matches the action predicates, taken(A) and enabled(A).
+var actionPredicate = regexp.MustCompile(`^\s*(taken|enabled)\(\s*["']?([^"'()]*?)["']?\s*\)\s*$`)
+
+// roleInstance matches the instance of a role in an action name, such as
+// the #0 in Role#0.Action.
+var roleInstance = regexp.MustCompile(`#\d+\.`)
+
+// parseActionPredicate returns the operator and the action of an action
+// predicate, or false if expr is a state expression.
+func parseActionPredicate(expr string) (string, string, bool) {
+	match := actionPredicate.FindStringSubmatch(expr)
+	if match == nil {
+		return "", "", false
+	}
+	return match[1], match[2], true
+}
+
+// takenAction returns the action of a taken(A) predicate, or the predicate
+// it names.
+func takenAction(expr string, predicates map[string]string) (string, bool) {
+	if named, ok := predicates[expr]; ok {
+		expr = named
+	}
+	op, action, ok := parseActionPredicate(expr)
+	return action, ok && op == "taken"
+}
+
+// linkTakesAction returns true if the link from the node takes the action:
+// if the action is its fairness name, with or without the instance of the
+// role, or one of its labels.
+func linkTakesAction(from *Node, link *Link, action string) bool {
+	if slices.Contains(link.Labels, action) {
+		return true
+	}
+	name, _, _ := fairnessLinkName(from, link)
+	name = strings.ReplaceAll(name, lib.SymmetryPrefix, "")
+	return name == action || roleInstance.ReplaceAllString(name, ".") == action
+}
+
+// actionTargets returns the states at the end of the transitions that take
+// the action, and the path to each, through the first such transition
+// found. A transition is the links from a state at a yield to the next one,
+// through the nodes within an action.
+func actionTargets(root *Node, nodes []*Node, action string) ([]*Node, func(*Node) []*Link) {
+	type step struct {
+		from  *Node
+		links []*Link
+	}
+	steps := make(map[*Node]step)
+	var targets []*Node
+	for _, node := range nodes {
+		if !isLeadsToState(node) {
+			continue
+		}
+		type entry struct {
+			link   *Link
+			parent int
+			taken  bool
+		}
+		var queue []entry
+		for _, link := range node.Outbound {
+			queue = append(queue, entry{link: link, parent: -1, taken: linkTakesAction(node, link, action)})
+		}
+		type key struct {
+			node  *Node
+			taken bool
+		}
+		seen := make(map[key]bool)
+		for i := 0; i < len(queue); i++ {
+			to := queue[i].link.Node
+			if isLeadsToState(to) {
+				if _, ok := steps[to]; queue[i].taken && !ok {
+					var links []*Link
+					for j := i; j >= 0; j = queue[j].parent {
+						links = append(links, queue[j].link)
+					}
+					slices.Reverse(links)
+					steps[to] = step{from: node, links: links}
+					targets = append(targets, to)
+				}
+				continue
+			}
+			for _, out := range to.Outbound {
+				taken := queue[i].taken || linkTakesAction(to, out, action)
+				if !seen[key{out.Node, taken}] {
+					seen[key{out.Node, taken}] = true
+					queue = append(queue, entry{link: out, parent: i, taken: taken})
+				}
+			}
+		}
+	}
+	stem := func(node *Node) []*Link {
+		return append(ExtractFailurePath(steps[node].from, root), steps[node].links...)
+	}
+	return targets, stem
+}
+
+// evalLeadsToPredicate returns the nodes where the expression, or the
+// predicate it names, holds. The initial node of a spec with an Init action
+// has no variables yet, so an expression that fails there is false.
+func evalLeadsToPredicate(nodes []*Node, expr string, predicates map[string]string) (map[*Node]bool, error) {
+	if named, ok := predicates[expr]; ok {
+		expr = named
+	}
+	if expr == "" {
+		return nil, fmt.Errorf("empty predicate")
+	}
+	holds := make(map[*Node]bool)
+	if op, action, ok := parseActionPredicate(expr); ok && op == "enabled" {
+		for _, node := range nodes {
+			if isLeadsToState(node) {
+				holds[node] = slices.ContainsFunc(node.Outbound, func(link *Link) bool {
+					return !link.IsCrashLink() && linkTakesAction(node, link, action)
+				})
+			}
+		}
+		return holds, nil
+	}
+	for i, node := range nodes {
+		if !isLeadsToState(node) {
+			continue
+		}
+		value, err := evalStateFormula(node.Process, expr)
+		if err != nil {
+			if i == 0 {
+				continue
+			}
+			return nil, fmt.Errorf("evaluating %s: %w", expr, err)
+		}
+		holds[node] = value
+	}
+	return holds, nil
+}
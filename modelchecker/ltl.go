@@ -0,0 +1,547 @@
+package modelchecker
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+type ltlOp int
+
+const (
+	ltlTrue ltlOp = iota
+	ltlFalse
+	ltlAtom
+	ltlNot
+	ltlAnd
+	ltlOr
+	ltlNext
+	ltlUntil
+	ltlRelease
+)
+
+// LtlFormula is a formula of linear temporal logic over state predicates.
+// The parser desugars implication, equivalence, eventually, always and weak
+// until into the operators above.
+type LtlFormula struct {
+	op          ltlOp
+	atom        string
+	left, right *LtlFormula
+	key         string
+}
+
+func newLtl(op ltlOp, left, right *LtlFormula) *LtlFormula {
+	return &LtlFormula{op: op, left: left, right: right}
+}
+
+var (
+	ltlTrueFormula  = &LtlFormula{op: ltlTrue}
+	ltlFalseFormula = &LtlFormula{op: ltlFalse}
+)
+
+// String returns the formula in a canonical form, which also identifies the
+// formula in the tableau.
+func (f *LtlFormula) String() string {
+	if f.key != "" {
+		return f.key
+	}
+	switch f.op {
+	case ltlTrue:
+		f.key = "true"
+	case ltlFalse:
+		f.key = "false"
+	case ltlAtom:
+		f.key = "{" + f.atom + "}"
+	case ltlNot:
+		f.key = "!" + f.left.String()
+	case ltlNext:
+		f.key = "X " + f.left.String()
+	default:
+		op := map[ltlOp]string{ltlAnd: "&&", ltlOr: "||", ltlUntil: "U", ltlRelease: "R"}[f.op]
+		f.key = fmt.Sprintf("(%s %s %s)", f.left.String(), op, f.right.String())
+	}
+	return f.key
+}
+
+// Atoms returns the predicates of the formula, sorted.
+func (f *LtlFormula) Atoms() []string {
+	seen := map[string]bool{}
+	var walk func(f *LtlFormula)
+	walk = func(f *LtlFormula) {
+		if f == nil {
+			return
+		}
+		if f.op == ltlAtom {
+			seen[f.atom] = true
+		}
+		walk(f.left)
+		walk(f.right)
+	}
+	walk(f)
+	atoms := make([]string, 0, len(seen))
+	for atom := range seen {
+		atoms = append(atoms, atom)
+	}
+	sort.Strings(atoms)
+	return atoms
+}
+
+// negationNormalForm returns the formula, or its negation, with the
+// negations pushed down to the predicates.
+func (f *LtlFormula) negationNormalForm(negate bool) *LtlFormula {
+	switch f.op {
+	case ltlTrue, ltlFalse:
+		if negate == (f.op == ltlTrue) {
+			return ltlFalseFormula
+		}
+		return ltlTrueFormula
+	case ltlAtom:
+		if negate {
+			return newLtl(ltlNot, f, nil)
+		}
+		return f
+	case ltlNot:
+		return f.left.negationNormalForm(!negate)
+	case ltlNext:
+		return newLtl(ltlNext, f.left.negationNormalForm(negate), nil)
+	}
+	op := f.op
+	if negate {
+		op = map[ltlOp]ltlOp{ltlAnd: ltlOr, ltlOr: ltlAnd, ltlUntil: ltlRelease, ltlRelease: ltlUntil}[f.op]
+	}
+	return newLtl(op, f.left.negationNormalForm(negate), f.right.negationNormalForm(negate))
+}
+
+// ParseLtl parses a formula such as always (req -> eventually ack). The
+// operators, from the loosest binding:
+//
+//	<->  iff                       equivalence
+//	->   implies                   implication, right associative
+//	~>   leadsto                   leads-to: always (a -> eventually b)
+//	||   or
+//	&&   and
+//	until  U  release  R  W        until, release and weak until, right
+//	                               associative
+//	!  not  always  G  []  eventually  F  <>  next  X
+//
+// A predicate is a name in predicates, true, false, a Starlark expression
+// in braces, or an action predicate, taken(A) or enabled(A), as for the
+// leads-to properties. Names resolve to their expression.
+func ParseLtl(text string, predicates map[string]string) (*LtlFormula, error) {
+	p := &ltlParser{text: text, predicates: predicates}
+	f, err := p.iff()
+	if err != nil {
+		return nil, err
+	}
+	if tok := p.peek(); tok != "" {
+		return nil, p.errorf("unexpected %q", tok)
+	}
+	return f, nil
+}
+
+type ltlParser struct {
+	text       string
+	pos        int
+	predicates map[string]string
+}
+
+func (p *ltlParser) errorf(format string, args ...interface{}) error {
+	return fmt.Errorf("at column %d: %s", p.pos+1, fmt.Sprintf(format, args...))
+}
+
+var ltlSymbols = []string{"<->", "->", "~>", "||", "&&", "[]", "<>", "!", "(", ")"}
+
+// peek returns the next token: a symbol, a word, a braced expression, or
+// "" at the end.
+func (p *ltlParser) peek() string {
+	for p.pos < len(p.text) && unicode.IsSpace(rune(p.text[p.pos])) {
+		p.pos++
+	}
+	rest := p.text[p.pos:]
+	if rest == "" {
+		return ""
+	}
+	for _, symbol := range ltlSymbols {
+		if strings.HasPrefix(rest, symbol) {
+			return symbol
+		}
+	}
+	if rest[0] == '{' {
+		return "{"
+	}
+	end := 0
+	for end < len(rest) && (rest[end] == '_' || unicode.IsLetter(rune(rest[end])) || unicode.IsDigit(rune(rest[end]))) {
+		end++
+	}
+	if end == 0 {
+		return rest[:1]
+	}
+	return rest[:end]
+}
+
+func (p *ltlParser) accept(tokens ...string) string {
+	tok := p.peek()
+	for _, t := range tokens {
+		if tok == t {
+			p.pos += len(tok)
+			return tok
+		}
+	}
+	return ""
+}
+
+func (p *ltlParser) iff() (*LtlFormula, error) {
+	left, err := p.implies()
+	if err != nil {
+		return nil, err
+	}
+	for p.accept("<->", "iff") != "" {
+		right, err := p.implies()
+		if err != nil {
+			return nil, err
+		}
+		// a <-> b is (a && b) || (!a && !b).
+		left = newLtl(ltlOr, newLtl(ltlAnd, left, right), newLtl(ltlAnd, newLtl(ltlNot, left, nil), newLtl(ltlNot, right, nil)))
+	}
+	return left, nil
+}
+
+func (p *ltlParser) implies() (*LtlFormula, error) {
+	left, err := p.or()
+	if err != nil {
+		return nil, err
+	}
+	op := p.accept("->", "implies", "~>", "leadsto")
+	if op == "" {
+		return left, nil
+	}
+	right, err := p.implies()
+	if err != nil {
+		return nil, err
+	}
+	if op == "~>" || op == "leadsto" {
+		// a ~> b is always (!a || eventually b).
+		right = newLtl(ltlUntil, ltlTrueFormula, right)
+		return newLtl(ltlRelease, ltlFalseFormula, newLtl(ltlOr, newLtl(ltlNot, left, nil), right)), nil
+	}
+	return newLtl(ltlOr, newLtl(ltlNot, left, nil), right), nil
+}
+
+func (p *ltlParser) or() (*LtlFormula, error) {
+	left, err := p.and()
+	if err != nil {
+		return nil, err
+	}
+	for p.accept("||", "or") != "" {
+		right, err := p.and()
+		if err != nil {
+			return nil, err
+		}
+		left = newLtl(ltlOr, left, right)
+	}
+	return left, nil
+}
+
+func (p *ltlParser) and() (*LtlFormula, error) {
+	left, err := p.binary()
+	if err != nil {
+		return nil, err
+	}
+	for p.accept("&&", "and") != "" {
+		right, err := p.binary()
+		if err != nil {
+			return nil, err
+		}
+		left = newLtl(ltlAnd, left, right)
+	}
+	return left, nil
+}
+
+func (p *ltlParser) binary() (*LtlFormula, error) {
+	left, err := p.unary()
+	if err != nil {
+		return nil, err
+	}
+	op := p.accept("until", "U", "release", "R", "W")
+	if op == "" {
+		return left, nil
+	}
+	right, err := p.binary()
+	if err != nil {
+		return nil, err
+	}
+	switch op {
+	case "until", "U":
+		return newLtl(ltlUntil, left, right), nil
+	case "release", "R":
+		return newLtl(ltlRelease, left, right), nil
+	}
+	// a W b is b R (a || b).
+	return newLtl(ltlRelease, right, newLtl(ltlOr, left, right)), nil
+}
+
+func (p *ltlParser) unary() (*LtlFormula, error) {
+	op := p.accept("!", "not", "always", "G", "[]", "eventually", "F", "<>", "next", "X")
+	if op == "" {
+		return p.primary()
+	}
+	f, err := p.unary()
+	if err != nil {
+		return nil, err
+	}
+	switch op {
+	case "!", "not":
+		return newLtl(ltlNot, f, nil), nil
+	case "always", "G", "[]":
+		return newLtl(ltlRelease, ltlFalseFormula, f), nil
+	case "eventually", "F", "<>":
+		return newLtl(ltlUntil, ltlTrueFormula, f), nil
+	}
+	return newLtl(ltlNext, f, nil), nil
+}
+
+func (p *ltlParser) primary() (*LtlFormula, error) {
+	tok := p.peek()
+	switch {
+	case tok == "(":
+		p.pos++
+		f, err := p.iff()
+		if err != nil {
+			return nil, err
+		}
+		if p.accept(")") == "" {
+			return nil, p.errorf("expected )")
+		}
+		return f, nil
+	case tok == "true":
+		p.pos += len(tok)
+		return ltlTrueFormula, nil
+	case tok == "false":
+		p.pos += len(tok)
+		return ltlFalseFormula, nil
+	case tok == "{":
+		qp := &queryParser{text: p.text, pos: p.pos}
+		expr, err := qp.stateFormula()
+		if err != nil {
+			return nil, err
+		}
+		p.pos = qp.pos
+		return &LtlFormula{op: ltlAtom, atom: expr}, nil
+	case tok == "taken" || tok == "enabled":
+		end := strings.IndexByte(p.text[p.pos:], ')')
+		if end < 0 {
+			break
+		}
+		expr := p.text[p.pos : p.pos+end+1]
+		if _, _, ok := parseActionPredicate(expr); ok {
+			p.pos += end + 1
+			return &LtlFormula{op: ltlAtom, atom: strings.TrimSpace(expr)}, nil
+		}
+	case tok == "":
+		return nil, p.errorf("unexpected end of formula")
+	}
+	expr, ok := p.predicates[tok]
+	if !ok {
+		return nil, p.errorf("unknown predicate %q", tok)
+	}
+	p.pos += len(tok)
+	return &LtlFormula{op: ltlAtom, atom: expr}, nil
+}
+
+// buchiState is a state of a generalized Büchi automaton. A run reading a
+// sequence of states must have the literals of each of its automaton states
+// hold in the state read with it.
+type buchiState struct {
+	literals []*LtlFormula
+	next     []int
+	// accepting[i] tells whether the state is in the i-th acceptance set.
+	accepting []bool
+}
+
+// buchiAutomaton is the generalized Büchi automaton of a formula, accepting
+// the runs that visit each acceptance set infinitely often.
+type buchiAutomaton struct {
+	states  []*buchiState
+	initial []int
+	sets    int
+}
+
+// tableauNode is a node of the tableau construction of Gerth, Peled, Vardi
+// and Wolper, "Simple on-the-fly automatic verification of linear temporal
+// logic".
+type tableauNode struct {
+	id       int
+	incoming map[int]bool
+	pending  []*LtlFormula
+	old      map[string]*LtlFormula
+	next     map[string]*LtlFormula
+}
+
+// tableauInit is the incoming id of the initial nodes.
+const tableauInit = -1
+
+// newBuchiAutomaton returns the automaton of the formula, which must be in
+// negation normal form.
+func newBuchiAutomaton(f *LtlFormula) *buchiAutomaton {
+	var nodes []*tableauNode
+	nextId := 0
+	var expand func(n *tableauNode)
+	expand = func(n *tableauNode) {
+		if len(n.pending) == 0 {
+			for _, other := range nodes {
+				if sameFormulas(other.old, n.old) && sameFormulas(other.next, n.next) {
+					for id := range n.incoming {
+						other.incoming[id] = true
+					}
+					return
+				}
+			}
+			n.id = nextId
+			nextId++
+			nodes = append(nodes, n)
+			successor := &tableauNode{incoming: map[int]bool{n.id: true}, old: map[string]*LtlFormula{}, next: map[string]*LtlFormula{}}
+			for _, g := range sortedFormulas(n.next) {
+				successor.pending = append(successor.pending, g)
+			}
+			expand(successor)
+			return
+		}
+		g := n.pending[len(n.pending)-1]
+		n.pending = n.pending[:len(n.pending)-1]
+		if _, ok := n.old[g.String()]; ok {
+			expand(n)
+			return
+		}
+		switch g.op {
+		case ltlFalse:
+			return
+		case ltlTrue, ltlAtom, ltlNot:
+			if g.op != ltlTrue {
+				if _, ok := n.old[g.negationNormalForm(true).String()]; ok {
+					return
+				}
+			}
+			n.old[g.String()] = g
+			expand(n)
+		case ltlAnd:
+			n.old[g.String()] = g
+			n.pending = append(n.pending, g.left, g.right)
+			expand(n)
+		case ltlNext:
+			n.old[g.String()] = g
+			n.next[g.left.String()] = g.left
+			expand(n)
+		default:
+			// Split: g holds now by its first or second alternative.
+			//   a || b:  a         | b
+			//   a U b:   a, X(a U b) | b
+			//   a R b:   b, X(a R b) | a, b
+			first, second := n.split(), n.split()
+			first.old[g.String()], second.old[g.String()] = g, g
+			switch g.op {
+			case ltlOr:
+				first.pending = append(first.pending, g.left)
+				second.pending = append(second.pending, g.right)
+			case ltlUntil:
+				first.pending = append(first.pending, g.left)
+				first.next[g.String()] = g
+				second.pending = append(second.pending, g.right)
+			case ltlRelease:
+				first.pending = append(first.pending, g.right)
+				first.next[g.String()] = g
+				second.pending = append(second.pending, g.left, g.right)
+			}
+			expand(first)
+			expand(second)
+		}
+	}
+	expand(&tableauNode{incoming: map[int]bool{tableauInit: true}, pending: []*LtlFormula{f}, old: map[string]*LtlFormula{}, next: map[string]*LtlFormula{}})
+
+	var untils []*LtlFormula
+	var collect func(g *LtlFormula)
+	seen := map[string]bool{}
+	collect = func(g *LtlFormula) {
+		if g == nil || seen[g.String()] {
+			return
+		}
+		seen[g.String()] = true
+		if g.op == ltlUntil {
+			untils = append(untils, g)
+		}
+		collect(g.left)
+		collect(g.right)
+	}
+	collect(f)
+
+	automaton := &buchiAutomaton{states: make([]*buchiState, len(nodes)), sets: len(untils)}
+	for i, n := range nodes {
+		state := &buchiState{accepting: make([]bool, len(untils))}
+		for _, g := range sortedFormulas(n.old) {
+			if g.op == ltlAtom || g.op == ltlNot {
+				state.literals = append(state.literals, g)
+			}
+		}
+		// The run leaves a until b behind, or fulfils it with b.
+		for k, u := range untils {
+			_, pending := n.old[u.String()]
+			_, fulfilled := n.old[u.right.String()]
+			state.accepting[k] = !pending || fulfilled
+		}
+		automaton.states[i] = state
+		if n.incoming[tableauInit] {
+			automaton.initial = append(automaton.initial, i)
+		}
+	}
+	for i, n := range nodes {
+		for id := range n.incoming {
+			if id != tableauInit {
+				automaton.states[id].next = append(automaton.states[id].next, i)
+			}
+		}
+	}
+	for _, state := range automaton.states {
+		sort.Ints(state.next)
+	}
+	return automaton
+}
+
+func (n *tableauNode) split() *tableauNode {
+	c := &tableauNode{incoming: map[int]bool{}, old: map[string]*LtlFormula{}, next: map[string]*LtlFormula{}}
+	for id := range n.incoming {
+		c.incoming[id] = true
+	}
+	c.pending = append(c.pending, n.pending...)
+	for k, g := range n.old {
+		c.old[k] = g
+	}
+	for k, g := range n.next {
+		c.next[k] = g
+	}
+	return c
+}
+
+func sameFormulas(a, b map[string]*LtlFormula) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for k := range a {
+		if _, ok := b[k]; !ok {
+			return false
+		}
+	}
+	return true
+}
+
+func sortedFormulas(formulas map[string]*LtlFormula) []*LtlFormula {
+	keys := make([]string, 0, len(formulas))
+	for k := range formulas {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	sorted := make([]*LtlFormula, len(keys))
+	for i, k := range keys {
+		sorted[i] = formulas[k]
+	}
+	return sorted
+}
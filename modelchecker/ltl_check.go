@@ -0,0 +1,638 @@
+package modelchecker
+
+import (
+	ast "fizz/proto"
+	"fmt"
+	"slices"
+	"sort"
+)
+
+// LtlResult is the outcome of checking an LTL property.
+type LtlResult struct {
+	Name    string
+	Formula string
+	Holds   bool
+	// Path is a counterexample when the property does not hold: the links
+	// from the initial node, where Path[CycleStart:] repeats forever.
+	Path       []*Link
+	CycleStart int
+}
+
+// CheckLtlProperties checks the ltl properties of options on the graph of
+// a passing model check, in order, and returns their results, stopping at
+// the first property that does not hold.
+func CheckLtlProperties(root *Node, nodes []*Node, options *ast.StateSpaceOptions) ([]*LtlResult, error) {
+	var results []*LtlResult
+	for k, property := range options.GetLtl() {
+		result, err := CheckLtl(root, nodes, property, options.GetLtlPredicates())
+		if err != nil {
+			name := property.GetName()
+			if name == "" {
+				name = fmt.Sprintf("ltl property %d", k)
+			}
+			return results, fmt.Errorf("%s: %w", name, err)
+		}
+		if result.Name == "" {
+			result.Name = fmt.Sprintf("ltl property %d", k)
+		}
+		results = append(results, result)
+		if !result.Holds {
+			break
+		}
+	}
+	return results, nil
+}
+
+// CheckLtl checks an LTL property on the graph of a passing model check,
+// with predicates naming the Starlark expressions the formula refers to.
+//
+// The formula is over the sequence of states at yields, so the steps within
+// an atomic action are not visible to it. An action predicate taken(A)
+// holds in a state when the step to it takes A, and enabled(A) when A can
+// be taken from it. Every state may repeat forever,
+// as a process may stop acting, unless fairness forbids it: the behaviors
+// are the fair paths of the graph, as for the liveness assertions. The
+// check builds the product of the graph with a Büchi automaton of the
+// negated formula, and searches it for a strongly connected component that
+// is reachable, accepting and fair; such a component is a counterexample.
+func CheckLtl(root *Node, nodes []*Node, property *ast.LtlProperty, predicates map[string]string) (*LtlResult, error) {
+	f, err := ParseLtl(property.GetFormula(), predicates)
+	if err != nil {
+		return nil, err
+	}
+	automaton := newBuchiAutomaton(f.negationNormalForm(true))
+	kripke := newLtlKripke(root, nodes)
+	product, err := newLtlProduct(kripke, automaton)
+	if err != nil {
+		return nil, err
+	}
+	result := &LtlResult{Name: property.GetName(), Formula: property.GetFormula(), Holds: true}
+	component := product.fairAcceptingComponent()
+	if component != nil {
+		result.Holds = false
+		result.Path, result.CycleStart = product.lasso(root, component)
+	}
+	return result, nil
+}
+
+// ltlEdge is a step between states of the graph seen by the formula: the
+// links from a state to the next, through the nodes within an action.
+type ltlEdge struct {
+	to int
+	// action is the fairness name of the first link, or "" for stuttering.
+	action string
+	links  []*Link
+}
+
+// ltlKripke is the graph of the states at yields.
+type ltlKripke struct {
+	states []*Node
+	edges  [][]ltlEdge
+	// fair holds the fair actions enabled at each state, by fairness name.
+	fair []map[string]ast.FairnessLevel
+	// initial holds the edges from the root to the initial states.
+	initial []ltlEdge
+	root    *Node
+}
+
+func isLtlState(node *Node) bool {
+	return node.Process != nil && (node.GetThreadsCount() == 0 || node.Name == "yield" || node.Name == "crash")
+}
+
+func newLtlKripke(root *Node, nodes []*Node) *ltlKripke {
+	k := &ltlKripke{root: root}
+	index := make(map[*Node]int)
+	for _, node := range nodes {
+		if isLtlState(node) {
+			index[node] = len(k.states)
+			k.states = append(k.states, node)
+		}
+	}
+	// successors returns an edge to each state reached by the link, with
+	// the shortest path through the nodes within the action.
+	successors := func(link *Link, action string) []ltlEdge {
+		var edges []ltlEdge
+		type entry struct {
+			link   *Link
+			parent int
+		}
+		queue := []entry{{link: link, parent: -1}}
+		seen := map[*Node]bool{link.Node: true}
+		for i := 0; i < len(queue); i++ {
+			node := queue[i].link.Node
+			if to, ok := index[node]; ok {
+				var links []*Link
+				for j := i; j >= 0; j = queue[j].parent {
+					links = append(links, queue[j].link)
+				}
+				slices.Reverse(links)
+				edges = append(edges, ltlEdge{to: to, action: action, links: links})
+				continue
+			}
+			for _, out := range node.Outbound {
+				if !seen[out.Node] {
+					seen[out.Node] = true
+					queue = append(queue, entry{link: out, parent: i})
+				}
+			}
+		}
+		return edges
+	}
+
+	k.edges = make([][]ltlEdge, len(k.states))
+	k.fair = make([]map[string]ast.FairnessLevel, len(k.states))
+	for i, node := range k.states {
+		k.fair[i] = make(map[string]ast.FairnessLevel)
+		k.edges[i] = append(k.edges[i], ltlEdge{to: i, links: []*Link{{Node: node, Name: "stutter"}}})
+		for _, link := range node.Outbound {
+			name, fairness, _ := fairnessLinkName(node, link)
+			if fairness == ast.FairnessLevel_FAIRNESS_LEVEL_STRONG || fairness == ast.FairnessLevel_FAIRNESS_LEVEL_WEAK {
+				k.fair[i][name] = fairness
+			}
+			k.edges[i] = append(k.edges[i], successors(link, name)...)
+		}
+	}
+	if to, ok := index[root]; ok {
+		k.initial = []ltlEdge{{to: to}}
+	} else {
+		for _, link := range root.Outbound {
+			k.initial = append(k.initial, successors(link, "")...)
+		}
+	}
+	return k
+}
+
+// ltlProduct is the reachable part of the product of the states with the
+// automaton: pairs of a state and an automaton state whose literals hold in
+// it. The taken(A) predicates hold by the step to the state rather than by
+// the state, so a pair also has the bits of those that hold.
+type ltlProduct struct {
+	kripke    *ltlKripke
+	automaton *buchiAutomaton
+	pairs     [][3]int
+	// edges holds, for each pair, its successors and the index of the
+	// state edge each one takes.
+	edges [][][2]int
+	// parent is the pair and state edge each pair was first reached from,
+	// or -1 and the initial edge.
+	parent [][2]int
+}
+
+func newLtlProduct(kripke *ltlKripke, automaton *buchiAutomaton) (*ltlProduct, error) {
+	p := &ltlProduct{kripke: kripke, automaton: automaton}
+	ids := make(map[[3]int]int)
+
+	// The action predicates of the formula, with a bit for each taken(A).
+	type actionAtom struct {
+		op, action string
+		bit        int
+	}
+	actionAtoms := make(map[string]actionAtom)
+	var takenAtoms []actionAtom
+	for _, state := range automaton.states {
+		for _, literal := range state.literals {
+			atom := literal
+			if literal.op == ltlNot {
+				atom = literal.left
+			}
+			if _, ok := actionAtoms[atom.atom]; ok {
+				continue
+			}
+			if op, action, ok := parseActionPredicate(atom.atom); ok {
+				a := actionAtom{op: op, action: action, bit: -1}
+				if op == "taken" {
+					a.bit = len(takenAtoms)
+					takenAtoms = append(takenAtoms, a)
+				}
+				actionAtoms[atom.atom] = a
+			}
+		}
+	}
+	// taken returns the bits of the taken(A) predicates the edge from the
+	// state s, or from the root if s is -1, takes. Stuttering takes none.
+	taken := func(s int, edge ltlEdge) int {
+		if len(takenAtoms) == 0 || (s >= 0 && edge.action == "") {
+			return 0
+		}
+		from := kripke.root
+		if s >= 0 {
+			from = kripke.states[s]
+		}
+		bits := 0
+		for _, link := range edge.links {
+			for _, a := range takenAtoms {
+				if linkTakesAction(from, link, a.action) {
+					bits |= 1 << a.bit
+				}
+			}
+			from = link.Node
+		}
+		return bits
+	}
+	enabled := func(node *Node, action string) bool {
+		return slices.ContainsFunc(node.Outbound, func(link *Link) bool {
+			return !link.IsCrashLink() && linkTakesAction(node, link, action)
+		})
+	}
+
+	holds := make(map[string][]int8)
+	satisfies := func(s, q, bits int) (bool, error) {
+		for _, literal := range automaton.states[q].literals {
+			atom, negated := literal, false
+			if literal.op == ltlNot {
+				atom, negated = literal.left, true
+			}
+			a, isAction := actionAtoms[atom.atom]
+			if isAction && a.op == "taken" {
+				if (bits&(1<<a.bit) != 0) == negated {
+					return false, nil
+				}
+				continue
+			}
+			values := holds[atom.atom]
+			if values == nil {
+				values = make([]int8, len(kripke.states))
+				holds[atom.atom] = values
+			}
+			if values[s] == 0 {
+				var value bool
+				var err error
+				if isAction {
+					value = enabled(kripke.states[s], a.action)
+				} else {
+					value, err = evalStateFormula(kripke.states[s].Process, atom.atom)
+				}
+				if err != nil {
+					return false, fmt.Errorf("evaluating {%s}: %w", atom.atom, err)
+				}
+				values[s] = 1
+				if value {
+					values[s] = 2
+				}
+			}
+			if (values[s] == 2) == negated {
+				return false, nil
+			}
+		}
+		return true, nil
+	}
+	visit := func(s, q, bits int, parent [2]int) (int, error) {
+		if id, ok := ids[[3]int{s, q, bits}]; ok {
+			return id, nil
+		}
+		if ok, err := satisfies(s, q, bits); !ok || err != nil {
+			return -1, err
+		}
+		id := len(p.pairs)
+		ids[[3]int{s, q, bits}] = id
+		p.pairs = append(p.pairs, [3]int{s, q, bits})
+		p.edges = append(p.edges, nil)
+		p.parent = append(p.parent, parent)
+		return id, nil
+	}
+	for e, edge := range kripke.initial {
+		bits := taken(-1, edge)
+		for _, q := range automaton.initial {
+			if _, err := visit(edge.to, q, bits, [2]int{-1, e}); err != nil {
+				return nil, err
+			}
+		}
+	}
+	for id := 0; id < len(p.pairs); id++ {
+		s, q := p.pairs[id][0], p.pairs[id][1]
+		for e, edge := range kripke.edges[s] {
+			bits := taken(s, edge)
+			for _, next := range automaton.states[q].next {
+				to, err := visit(edge.to, next, bits, [2]int{id, e})
+				if err != nil {
+					return nil, err
+				}
+				if to >= 0 {
+					p.edges[id] = append(p.edges[id], [2]int{to, e})
+				}
+			}
+		}
+	}
+	return p, nil
+}
+
+// fairAcceptingComponent returns the pairs of a strongly connected component
+// that visits every acceptance set and where every fair action is taken
+// as often as fairness requires, or nil if there is none. A component is
+// fair when each strong fair action enabled in it is taken within it, and
+// each weak fair action is taken within it or disabled somewhere in it. A
+// strong fair action that is enabled but not taken excludes the pairs where
+// it is enabled, and the rest is searched again, as by Emerson and Lei.
+func (p *ltlProduct) fairAcceptingComponent() []int {
+	all := make([]int, len(p.pairs))
+	for i := range all {
+		all[i] = i
+	}
+	// Of the counterexamples, keep the one the search reached first, which
+	// has the shortest prefix.
+	var found []int
+	work := [][]int{all}
+	for len(work) > 0 {
+		subset := work[len(work)-1]
+		work = work[:len(work)-1]
+		for _, component := range p.components(subset) {
+			inside := make(map[int]bool, len(component))
+			for _, id := range component {
+				inside[id] = true
+			}
+			if !p.accepting(component) {
+				continue
+			}
+			taken := map[string]bool{}
+			for _, id := range component {
+				for _, edge := range p.edges[id] {
+					if inside[edge[0]] {
+						taken[p.kripke.edges[p.pairs[id][0]][edge[1]].action] = true
+					}
+				}
+			}
+			fair, unfairStrong := true, ""
+			for _, name := range p.enabledActions(component) {
+				if taken[name] {
+					continue
+				}
+				everywhere := true
+				for _, id := range component {
+					level, ok := p.kripke.fair[p.pairs[id][0]][name]
+					if !ok {
+						everywhere = false
+					} else if level == ast.FairnessLevel_FAIRNESS_LEVEL_STRONG && unfairStrong == "" {
+						unfairStrong = name
+					}
+				}
+				if everywhere && p.fairness(component, name) == ast.FairnessLevel_FAIRNESS_LEVEL_WEAK {
+					fair = false
+					break
+				}
+			}
+			if !fair {
+				continue
+			}
+			if unfairStrong == "" {
+				if found == nil || component[0] < found[0] {
+					found = component
+				}
+				continue
+			}
+			var rest []int
+			for _, id := range component {
+				if _, ok := p.kripke.fair[p.pairs[id][0]][unfairStrong]; !ok {
+					rest = append(rest, id)
+				}
+			}
+			if len(rest) > 0 {
+				work = append(work, rest)
+			}
+		}
+	}
+	return found
+}
+
+// enabledActions returns the fair actions enabled somewhere in the
+// component, sorted.
+func (p *ltlProduct) enabledActions(component []int) []string {
+	seen := map[string]bool{}
+	for _, id := range component {
+		for name := range p.kripke.fair[p.pairs[id][0]] {
+			seen[name] = true
+		}
+	}
+	names := make([]string, 0, len(seen))
+	for name := range seen {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// fairness returns the fairness of the action, weak if it is only weakly
+// fair everywhere in the component.
+func (p *ltlProduct) fairness(component []int, name string) ast.FairnessLevel {
+	for _, id := range component {
+		if p.kripke.fair[p.pairs[id][0]][name] == ast.FairnessLevel_FAIRNESS_LEVEL_STRONG {
+			return ast.FairnessLevel_FAIRNESS_LEVEL_STRONG
+		}
+	}
+	return ast.FairnessLevel_FAIRNESS_LEVEL_WEAK
+}
+
+func (p *ltlProduct) accepting(component []int) bool {
+	for k := 0; k < p.automaton.sets; k++ {
+		found := false
+		for _, id := range component {
+			if p.automaton.states[p.pairs[id][1]].accepting[k] {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+// components returns the strongly connected components of the subgraph of
+// the pairs in subset that have a cycle, with Tarjan's algorithm on an
+// explicit stack.
+func (p *ltlProduct) components(subset []int) [][]int {
+	inSubset := make(map[int]bool, len(subset))
+	for _, id := range subset {
+		inSubset[id] = true
+	}
+	index := make(map[int]int, len(subset))
+	low := make(map[int]int, len(subset))
+	onStack := make(map[int]bool)
+	var stack []int
+	var components [][]int
+	type frame struct{ id, next int }
+	counter := 0
+	for _, start := range subset {
+		if _, ok := index[start]; ok {
+			continue
+		}
+		calls := []frame{{id: start}}
+		index[start], low[start] = counter, counter
+		counter++
+		stack = append(stack, start)
+		onStack[start] = true
+		for len(calls) > 0 {
+			top := &calls[len(calls)-1]
+			v := top.id
+			if top.next < len(p.edges[v]) {
+				w := p.edges[v][top.next][0]
+				top.next++
+				if !inSubset[w] {
+					continue
+				}
+				if _, ok := index[w]; !ok {
+					index[w], low[w] = counter, counter
+					counter++
+					stack = append(stack, w)
+					onStack[w] = true
+					calls = append(calls, frame{id: w})
+				} else if onStack[w] {
+					low[v] = min(low[v], index[w])
+				}
+				continue
+			}
+			calls = calls[:len(calls)-1]
+			if len(calls) > 0 {
+				parent := calls[len(calls)-1].id
+				low[parent] = min(low[parent], low[v])
+			}
+			if low[v] != index[v] {
+				continue
+			}
+			var component []int
+			for {
+				w := stack[len(stack)-1]
+				stack = stack[:len(stack)-1]
+				onStack[w] = false
+				component = append(component, w)
+				if w == v {
+					break
+				}
+			}
+			if len(component) > 1 || p.hasSelfLoop(v) {
+				sort.Ints(component)
+				components = append(components, component)
+			}
+		}
+	}
+	return components
+}
+
+func (p *ltlProduct) hasSelfLoop(id int) bool {
+	for _, edge := range p.edges[id] {
+		if edge[0] == id {
+			return true
+		}
+	}
+	return false
+}
+
+// lasso returns the links of a path from the root to the component, and a
+// cycle within it that visits every acceptance set, takes every fair action
+// taken within the component and visits the states where the weak fair
+// actions it does not take are disabled.
+func (p *ltlProduct) lasso(root *Node, component []int) ([]*Link, int) {
+	inside := make(map[int]bool, len(component))
+	for _, id := range component {
+		inside[id] = true
+	}
+	entry := component[0]
+	var prefix [][2]int
+	for id := entry; id >= 0; id = p.parent[id][0] {
+		prefix = append(prefix, [2]int{id, p.parent[id][1]})
+	}
+	slices.Reverse(prefix)
+	path := []*Link{InitNodeToLink(root)}
+	for k, step := range prefix {
+		var edge ltlEdge
+		if k == 0 {
+			edge = p.kripke.initial[step[1]]
+		} else {
+			edge = p.kripke.edges[p.pairs[prefix[k-1][0]][0]][step[1]]
+		}
+		path = append(path, edge.links...)
+	}
+	cycleStart := len(path)
+
+	// Goals are pairs to visit, or edges to take, given as the pair they
+	// leave and the index of the edge in p.edges.
+	// The first goal leaves the entry, so that the cycle is not empty.
+	type goal struct{ id, edge int }
+	var goals []goal
+	for e, edge := range p.edges[entry] {
+		if inside[edge[0]] {
+			goals = append(goals, goal{id: entry, edge: e})
+			break
+		}
+	}
+	for k := 0; k < p.automaton.sets; k++ {
+		for _, id := range component {
+			if p.automaton.states[p.pairs[id][1]].accepting[k] {
+				goals = append(goals, goal{id: id, edge: -1})
+				break
+			}
+		}
+	}
+	taken := map[string]bool{}
+	for _, id := range component {
+		for e, edge := range p.edges[id] {
+			action := p.kripke.edges[p.pairs[id][0]][edge[1]].action
+			if inside[edge[0]] && action != "" && !taken[action] {
+				if _, fair := p.kripke.fair[p.pairs[id][0]][action]; fair {
+					taken[action] = true
+					goals = append(goals, goal{id: id, edge: e})
+				}
+			}
+		}
+	}
+	for _, name := range p.enabledActions(component) {
+		if taken[name] {
+			continue
+		}
+		for _, id := range component {
+			if _, ok := p.kripke.fair[p.pairs[id][0]][name]; !ok {
+				goals = append(goals, goal{id: id, edge: -1})
+				break
+			}
+		}
+	}
+
+	current := entry
+	walk := func(to int) {
+		for _, step := range p.pathWithin(current, to, inside) {
+			path = append(path, p.kripke.edges[p.pairs[step[0]][0]][step[1]].links...)
+		}
+		current = to
+	}
+	for _, g := range goals {
+		walk(g.id)
+		if g.edge >= 0 {
+			edge := p.edges[g.id][g.edge]
+			path = append(path, p.kripke.edges[p.pairs[g.id][0]][edge[1]].links...)
+			current = edge[0]
+		}
+	}
+	walk(entry)
+	return path, cycleStart
+}
+
+// pathWithin returns the shortest path from one pair to another through
+// the pairs inside, as the pair and state edge index of each step.
+func (p *ltlProduct) pathWithin(from, to int, inside map[int]bool) [][2]int {
+	if from == to {
+		return nil
+	}
+	parent := map[int][2]int{from: {-1, -1}}
+	queue := []int{from}
+	for len(queue) > 0 {
+		id := queue[0]
+		queue = queue[1:]
+		for _, edge := range p.edges[id] {
+			next := edge[0]
+			if _, ok := parent[next]; ok || !inside[next] {
+				continue
+			}
+			parent[next] = [2]int{id, edge[1]}
+			if next == to {
+				var steps [][2]int
+				for v := to; v != from; v = parent[v][0] {
+					steps = append(steps, parent[v])
+				}
+				slices.Reverse(steps)
+				return steps
+			}
+			queue = append(queue, next)
+		}
+	}
+	return nil
+}
@@ -214,6 +214,17 @@ func FindAbsorptionCosts(root *Node, perfModel *proto.PerformanceModel, fileId i
 	// Create the transition matrix
 	nodes, _, _, yields := getAllNodes(root, 0)
 	//fmt.Println("Yields", yields)
+	steadstate, histogram := absorptionAnalysis(nodes, yields, perfModel, fileId, invariantId)
+	//fmt.Println("liveness ", steadstate)
+	fmt.Println("liveness mean counts", histogram.GetMeanCounts())
+	fmt.Println("liveness histogram", histogram.GetAllHistogram())
+	return steadstate, histogram
+}
+
+// absorptionAnalysis makes the states where the invariant holds absorbing,
+// and returns the distribution and counters of the chain started from a
+// uniformly chosen yield or init node.
+func absorptionAnalysis(nodes []*Node, yields int, perfModel *proto.PerformanceModel, fileId int, invariantId int) ([]float64, *Histogram) {
 	yields += 1 // Add the root node
 
 	transitionMatrix := createAbsorptionTransitionMatrix(nodes, fileId, invariantId)
@@ -224,11 +235,7 @@ func FindAbsorptionCosts(root *Node, perfModel *proto.PerformanceModel, fileId i
 			initialDistribution[i] = 1.0 / float64(yields) // Set every node to 1.0/n
 		}
 	}
-	steadstate, histogram := markovChainAnalysis(nodes, perfModel, transitionMatrix, initialDistribution)
-	//fmt.Println("liveness ", steadstate)
-	fmt.Println("liveness mean counts", histogram.GetMeanCounts())
-	fmt.Println("liveness histogram", histogram.GetAllHistogram())
-	return steadstate, histogram
+	return markovChainAnalysis(nodes, perfModel, transitionMatrix, initialDistribution)
 }
 
 func createAbsorptionTransitionMatrix(nodes []*Node, fileId int, invariantId int) [][]float64 {
@@ -435,13 +442,30 @@ func GetAllNodes(root *Node, maxActions int64) ([]*Node, []string, *Node, int) {
 	return getAllNodes(root, maxActions)
 
 }
+
+// GetAllNodesWithTerminalStates is GetAllNodes, except that a stuck state
+// isTerminal returns true for is not a deadlock. Returns the first error of
+// isTerminal.
+func GetAllNodesWithTerminalStates(root *Node, maxActions int64, isTerminal func(*Node) (bool, error)) ([]*Node, []string, *Node, int, error) {
+	var err error
+	nodes, msgs, deadlock, yields := traverseBFS(root, maxActions, func(node *Node) bool {
+		if err != nil {
+			return false
+		}
+		var terminal bool
+		terminal, err = isTerminal(node)
+		return terminal
+	})
+	return nodes, msgs, deadlock, yields, err
+}
+
 func getAllNodes(root *Node, maxActions int64) ([]*Node, []string, *Node, int) {
 	// Implement a traversal to get all nodes in the graph
 	// This can be a simple depth-first or breadth-first traversal
 	// depending on your requirements and graph structure.
 	// For simplicity, let's assume a simple depth-first traversal here.
 
-	result, msgs, deadlock, yield := traverseBFS(root, maxActions)
+	result, msgs, deadlock, yield := traverseBFS(root, maxActions, nil)
 	//visited := make(map[*Node]bool)
 	//var result []*Node
 	//yield := 0
@@ -484,7 +508,7 @@ func traverseDFS(node *Node, visited map[*Node]bool, result *[]*Node, yield *int
 	}
 }
 
-func traverseBFS(rootNode *Node, maxActions int64) ([]*Node, []string, *Node, int) {
+func traverseBFS(rootNode *Node, maxActions int64, isTerminal func(*Node) bool) ([]*Node, []string, *Node, int) {
 	msgs := make([]string, 0)
 	msgSet := make(map[string]int)
 	type stat struct {
@@ -611,7 +635,8 @@ func traverseBFS(rootNode *Node, maxActions int64) ([]*Node, []string, *Node, in
 	var deadlock *Node
 	for _, node := range result {
 		entry := visited[node]
-		if entry.deadNode != nil && entry.livePaths == 0 && (node.Process == nil || (node.Stats != nil && node.Stats.TotalActions < int(maxActions))) {
+		if entry.deadNode != nil && entry.livePaths == 0 && (node.Process == nil || (node.Stats != nil && node.Stats.TotalActions < int(maxActions))) &&
+			(isTerminal == nil || !isTerminal(node)) {
 			// Return the yield node itself (not the dead non-yield node) so the
 			// deadlock trace stops at the meaningful stuck state rather than
 			// pointing into a dead nondeterministic branch.
@@ -0,0 +1,610 @@
+package modelchecker
+
+import (
+	"fizz/proto"
+	"fmt"
+	"math"
+	"sort"
+)
+
+// Methods of AnalyzePerformance to find the steady state.
+const (
+	// PerfMethodPower iterates the distribution from the initial state, like
+	// the dense analysis. The only method that gives the counter histogram.
+	PerfMethodPower = "power"
+	// PerfMethodGaussSeidel and PerfMethodJacobi solve the linear systems of
+	// the absorption probabilities and of the stationary distribution of
+	// each bottom strongly connected component. They converge on periodic
+	// chains too, where the power iteration oscillates.
+	PerfMethodGaussSeidel = "gauss-seidel"
+	PerfMethodJacobi      = "jacobi"
+)
+
+const (
+	powerIterations     = 10000
+	solverIterations    = 100000
+	solverTolerance     = 1e-12
+	powerConvergenceGap = 1e-7
+)
+
+// sparseMatrix is a square matrix in compressed sparse row (CSR) form: the
+// entries of row i are cols[rowStart[i]:rowStart[i+1]], sorted, and the
+// matching vals.
+type sparseMatrix struct {
+	n        int
+	rowStart []int
+	cols     []int
+	vals     []float64
+}
+
+// sparseBuilder builds a sparseMatrix row by row.
+type sparseBuilder struct {
+	m *sparseMatrix
+}
+
+func newSparseBuilder(n int) *sparseBuilder {
+	return &sparseBuilder{m: &sparseMatrix{n: n, rowStart: append(make([]int, 0, n+1), 0)}}
+}
+
+// add adds val to the entry at col of the current row.
+func (b *sparseBuilder) add(col int, val float64) {
+	b.m.cols = append(b.m.cols, col)
+	b.m.vals = append(b.m.vals, val)
+}
+
+// endRow sorts the entries of the current row and adds up the ones in the
+// same column, in the order they were added.
+func (b *sparseBuilder) endRow() {
+	m := b.m
+	start := m.rowStart[len(m.rowStart)-1]
+	sort.Stable(rowEntries{cols: m.cols[start:], vals: m.vals[start:]})
+	end := start
+	for k := start; k < len(m.cols); k++ {
+		if end > start && m.cols[end-1] == m.cols[k] {
+			m.vals[end-1] += m.vals[k]
+			continue
+		}
+		m.cols[end], m.vals[end] = m.cols[k], m.vals[k]
+		end++
+	}
+	m.cols, m.vals = m.cols[:end], m.vals[:end]
+	m.rowStart = append(m.rowStart, end)
+}
+
+func (b *sparseBuilder) build() *sparseMatrix {
+	if len(b.m.rowStart) != b.m.n+1 {
+		panic(fmt.Sprintf("sparse matrix has %d rows, want %d", len(b.m.rowStart)-1, b.m.n))
+	}
+	return b.m
+}
+
+type rowEntries struct {
+	cols []int
+	vals []float64
+}
+
+func (r rowEntries) Len() int           { return len(r.cols) }
+func (r rowEntries) Less(i, j int) bool { return r.cols[i] < r.cols[j] }
+func (r rowEntries) Swap(i, j int) {
+	r.cols[i], r.cols[j] = r.cols[j], r.cols[i]
+	r.vals[i], r.vals[j] = r.vals[j], r.vals[i]
+}
+
+func (m *sparseMatrix) row(i int) ([]int, []float64) {
+	return m.cols[m.rowStart[i]:m.rowStart[i+1]], m.vals[m.rowStart[i]:m.rowStart[i+1]]
+}
+
+func (m *sparseMatrix) get(i, j int) float64 {
+	cols, vals := m.row(i)
+	k := sort.SearchInts(cols, j)
+	if k < len(cols) && cols[k] == j {
+		return vals[k]
+	}
+	return 0
+}
+
+// leftMultiply sets y to the row vector x times m, that is, the distribution
+// one step after x.
+func (m *sparseMatrix) leftMultiply(x []float64, y []float64) {
+	clear(y)
+	for i, xi := range x {
+		if xi == 0 {
+			continue
+		}
+		cols, vals := m.row(i)
+		for k, j := range cols {
+			y[j] += xi * vals[k]
+		}
+	}
+}
+
+func (m *sparseMatrix) transpose() *sparseMatrix {
+	t := &sparseMatrix{n: m.n, rowStart: make([]int, m.n+1), cols: make([]int, len(m.cols)), vals: make([]float64, len(m.vals))}
+	for _, j := range m.cols {
+		t.rowStart[j+1]++
+	}
+	for j := 0; j < m.n; j++ {
+		t.rowStart[j+1] += t.rowStart[j]
+	}
+	next := append([]int(nil), t.rowStart[:m.n]...)
+	for i := 0; i < m.n; i++ {
+		cols, vals := m.row(i)
+		for k, j := range cols {
+			t.cols[next[j]] = i
+			t.vals[next[j]] = vals[k]
+			next[j]++
+		}
+	}
+	return t
+}
+
+// sparseChain is the Markov chain of a state graph: the transition
+// probabilities between the nodes, and for each counter of the performance
+// model, the amount the next step from each node adds on average.
+type sparseChain struct {
+	nodes   []*Node
+	p       *sparseMatrix
+	rewards map[string][]float64
+}
+
+// newSparseChain returns the chain with the branch probabilities of model,
+// the sparse counterpart of genTransitionMatrix and genCounterMatrices.
+func newSparseChain(nodes []*Node, model *proto.PerformanceModel) *sparseChain {
+	index := nodeIndex(nodes)
+	b := newSparseBuilder(len(nodes))
+	for i, node := range nodes {
+		if len(node.Outbound) == 0 {
+			b.add(i, 1.0)
+		}
+		for k, prob := range linkProbabilities(node, model) {
+			b.add(index[node.Outbound[k].Node], prob)
+		}
+		b.endRow()
+	}
+	return &sparseChain{nodes: nodes, p: b.build(), rewards: chainRewards(nodes, index, model, b.m)}
+}
+
+// newAbsorbingChain returns the chain where every outbound link of a node is
+// equally likely, and the nodes where the invariant holds are absorbing, the
+// sparse counterpart of createAbsorptionTransitionMatrix.
+func newAbsorbingChain(nodes []*Node, model *proto.PerformanceModel, fileId int, invariantId int) *sparseChain {
+	index := nodeIndex(nodes)
+	b := newSparseBuilder(len(nodes))
+	for i, node := range nodes {
+		if node.Process != nil && node.Witness[fileId][invariantId] {
+			b.add(i, 1.0)
+			b.endRow()
+			continue
+		}
+		if len(node.Outbound) == 0 {
+			b.add(i, 1.0)
+		}
+		for _, link := range node.Outbound {
+			b.add(index[link.Node], 1.0/float64(len(node.Outbound)))
+		}
+		b.endRow()
+		_, vals := b.m.row(i)
+		rowSum := 0.0
+		for _, val := range vals {
+			rowSum += val
+		}
+		if rowSum != 0 {
+			for k := range vals {
+				vals[k] /= rowSum
+			}
+		}
+	}
+	return &sparseChain{nodes: nodes, p: b.build(), rewards: chainRewards(nodes, index, model, b.m)}
+}
+
+// linkProbabilities returns the probability of each outbound link of node:
+// the probabilities of its labels in model, with the unlabeled links sharing
+// the rest evenly. If no label has a probability, the links are equally
+// likely.
+func linkProbabilities(node *Node, model *proto.PerformanceModel) []float64 {
+	totalProb := 0.0
+	missingCount := 0
+	probabilities := make([]float64, len(node.Outbound))
+	for k, link := range node.Outbound {
+		if len(link.Labels) == 0 {
+			missingCount++
+			probabilities[k] = -1
+			continue
+		}
+		for _, label := range link.Labels {
+			probabilities[k] += model.Configs[label].GetProbability()
+		}
+		totalProb += probabilities[k]
+	}
+	if totalProb > 1.0 {
+		panic("Total probability for a node cannot exceed 1")
+	}
+	if totalProb == 0 {
+		missingCount = len(node.Outbound)
+	}
+	missingProb := 0.0
+	if missingCount > 0 {
+		missingProb = (1.0 - totalProb) / float64(missingCount)
+	}
+	for k := range probabilities {
+		if probabilities[k] < 0 || totalProb == 0 {
+			probabilities[k] = missingProb
+		}
+	}
+	return probabilities
+}
+
+func nodeIndex(nodes []*Node) map[*Node]int {
+	index := make(map[*Node]int, len(nodes))
+	for i, node := range nodes {
+		index[node] = i
+	}
+	return index
+}
+
+// chainRewards returns for each counter the amount the next step from each
+// node adds on average: the counters of each labeled link, weighted by the
+// probability p gives to its destination.
+func chainRewards(nodes []*Node, index map[*Node]int, model *proto.PerformanceModel, p *sparseMatrix) map[string][]float64 {
+	rewards := make(map[string][]float64)
+	if model == nil {
+		return rewards
+	}
+	for _, config := range model.Configs {
+		for name := range config.Counters {
+			if rewards[name] == nil {
+				rewards[name] = make([]float64, len(nodes))
+			}
+		}
+	}
+	for i, node := range nodes {
+		for _, link := range node.Outbound {
+			for _, label := range link.Labels {
+				config := model.Configs[label]
+				if config == nil {
+					continue
+				}
+				prob := p.get(i, index[link.Node])
+				for name, counter := range config.Counters {
+					rewards[name][i] += counterMean(counter) * prob
+				}
+			}
+		}
+	}
+	return rewards
+}
+
+// analyze returns the steady state of the chain from initial, the expected
+// counters on the way there and, for the power method, their histogram.
+func (c *sparseChain) analyze(initial []float64, method string) ([]float64, *Histogram) {
+	switch method {
+	case PerfMethodGaussSeidel, PerfMethodJacobi:
+		return c.solve(initial, method)
+	default:
+		return c.powerIteration(initial)
+	}
+}
+
+// powerIteration is the sparse counterpart of markovChainAnalysis.
+func (c *sparseChain) powerIteration(initialDistribution []float64) ([]float64, *Histogram) {
+	n := len(c.nodes)
+	histogram := newHistogram()
+	mean := make(map[string]float64)
+	rawCounters := make(map[string]float64)
+	for name := range c.rewards {
+		mean[name] = 0.0
+		rawCounters[name] = 0.0
+	}
+	terminal := make([]bool, n)
+	for j, node := range c.nodes {
+		terminal[j] = c.p.get(j, j) == 1.0 || (node.Process != nil &&
+			node.Process.GetThreadsCount() == 0 && len(node.Process.Witness) > 0 && len(node.Process.Witness[0]) > 0 &&
+			node.Process.Witness[0][0])
+	}
+
+	currentDistribution := append([]float64(nil), initialDistribution...)
+	nextDistribution := make([]float64, n)
+	altCurrentDistribution := append([]float64(nil), initialDistribution...)
+	altNextDistribution := make([]float64, n)
+	prevTerminationProbability := 0.0
+	for i := 0; i < powerIterations; i++ {
+		for name, reward := range c.rewards {
+			mean[name] += dot(reward, currentDistribution)
+			rawCounters[name] += dot(reward, altCurrentDistribution)
+		}
+		c.p.leftMultiply(currentDistribution, nextDistribution)
+		c.p.leftMultiply(altCurrentDistribution, altNextDistribution)
+		altCurrentDistribution, altNextDistribution = altNextDistribution, altCurrentDistribution
+
+		terminationProbability := 0.0
+		totalProb := 0.0
+		for j := range altCurrentDistribution {
+			if terminal[j] {
+				altCurrentDistribution[j] = 0.0
+				terminationProbability += nextDistribution[j]
+			}
+			totalProb += altCurrentDistribution[j]
+		}
+		if len(mean) > 0 && terminationProbability > prevTerminationProbability {
+			prevTerminationProbability = terminationProbability
+			histogram.addEntry(terminationProbability, rawCounters)
+		}
+		for j, f := range altCurrentDistribution {
+			altCurrentDistribution[j] = f / totalProb
+		}
+
+		diff := 0.0
+		for j := range nextDistribution {
+			d := nextDistribution[j] - currentDistribution[j]
+			diff += d * d
+		}
+		if math.Sqrt(diff) < powerConvergenceGap {
+			break
+		}
+		currentDistribution, nextDistribution = nextDistribution, currentDistribution
+	}
+	histogram.mean = mean
+	return currentDistribution, histogram
+}
+
+func dot(a, b []float64) float64 {
+	sum := 0.0
+	for i := range a {
+		sum += a[i] * b[i]
+	}
+	return sum
+}
+
+// solve finds the steady state from initial with Gauss-Seidel or Jacobi
+// iteration. The chain ends up in its bottom strongly connected components,
+// each with the probability of being absorbed into it, spread by the
+// stationary distribution of the component. The counters are the expected
+// amounts added before reaching a bottom component.
+func (c *sparseChain) solve(initial []float64, method string) ([]float64, *Histogram) {
+	n := len(c.nodes)
+	component, components := bottomComponents(c.p)
+	pt := c.p.transpose()
+	jacobi := method == PerfMethodJacobi
+
+	// visits[j] is the expected number of visits to the transient node j:
+	// visits = initial + visits*P over the transient nodes.
+	visits := make([]float64, n)
+	transient := make([]int, 0, n)
+	for j := 0; j < n; j++ {
+		if component[j] < 0 {
+			transient = append(transient, j)
+		}
+	}
+	iterateSolver(jacobi, visits, func(x, prev []float64, backward bool) float64 {
+		change := 0.0
+		for k := range transient {
+			j := transient[k]
+			if backward {
+				j = transient[len(transient)-1-k]
+			}
+			sum, diag := initial[j], 0.0
+			cols, vals := pt.row(j)
+			for k, i := range cols {
+				if i == j {
+					diag = vals[k]
+				} else if component[i] < 0 {
+					sum += prev[i] * vals[k]
+				}
+			}
+			change = max(change, relativeChange(x[j], sum/(1-diag)))
+			x[j] = sum / (1 - diag)
+		}
+		return change
+	})
+
+	absorbed := make([]float64, components)
+	for j := 0; j < n; j++ {
+		if component[j] >= 0 {
+			absorbed[component[j]] += initial[j]
+			continue
+		}
+		cols, vals := c.p.row(j)
+		for k, i := range cols {
+			if component[i] >= 0 {
+				absorbed[component[i]] += visits[j] * vals[k]
+			}
+		}
+	}
+
+	// stationary is the stationary distribution of each bottom component,
+	// normalized per component. Jacobi steps are damped so that periodic
+	// components converge.
+	sizes := make([]int, components)
+	for j := 0; j < n; j++ {
+		if component[j] >= 0 {
+			sizes[component[j]]++
+		}
+	}
+	stationary := make([]float64, n)
+	var cyclic []int
+	for j := 0; j < n; j++ {
+		if component[j] >= 0 {
+			stationary[j] = 1.0 / float64(sizes[component[j]])
+			if sizes[component[j]] > 1 {
+				cyclic = append(cyclic, j)
+			}
+		}
+	}
+	if len(cyclic) > 0 {
+		sums := make([]float64, components)
+		iterateSolver(jacobi, stationary, func(x, prev []float64, backward bool) float64 {
+			for k := range cyclic {
+				j := cyclic[k]
+				if backward {
+					j = cyclic[len(cyclic)-1-k]
+				}
+				sum, diag := 0.0, 0.0
+				cols, vals := pt.row(j)
+				for k, i := range cols {
+					if i == j {
+						diag = vals[k]
+					} else if component[i] == component[j] {
+						sum += prev[i] * vals[k]
+					}
+				}
+				x[j] = sum / (1 - diag)
+				if jacobi {
+					x[j] = (x[j] + prev[j]) / 2
+				}
+			}
+			clear(sums)
+			for _, j := range cyclic {
+				sums[component[j]] += x[j]
+			}
+			change := 0.0
+			for _, j := range cyclic {
+				if sums[component[j]] > 0 {
+					x[j] /= sums[component[j]]
+				}
+				change = max(change, relativeChange(prev[j], x[j]))
+			}
+			return change
+		})
+	}
+
+	steadyState := make([]float64, n)
+	for j := 0; j < n; j++ {
+		if component[j] >= 0 {
+			steadyState[j] = absorbed[component[j]] * stationary[j]
+		}
+	}
+	histogram := newHistogram()
+	for name, reward := range c.rewards {
+		histogram.mean[name] = dot(reward, visits)
+	}
+	return steadyState, histogram
+}
+
+// iterateSolver repeats sweep on x until it changes no value by more than
+// solverTolerance. sweep reads the values of the previous sweep from prev,
+// which for Gauss-Seidel is x itself, so it uses the values updated in
+// the same sweep. Gauss-Seidel sweeps must measure the change themselves,
+// and Jacobi ones may. Gauss-Seidel sweeps alternate between forward and
+// backward (symmetric Gauss-Seidel): a sweep in one direction only carries
+// the values against the links one node per sweep.
+func iterateSolver(jacobi bool, x []float64, sweep func(x, prev []float64, backward bool) float64) {
+	prev := x
+	if jacobi {
+		prev = make([]float64, len(x))
+	}
+	for i := 0; i < solverIterations; i++ {
+		if jacobi {
+			copy(prev, x)
+		}
+		change := sweep(x, prev, !jacobi && i%2 == 1)
+		if jacobi {
+			for j := range x {
+				change = max(change, relativeChange(prev[j], x[j]))
+			}
+		}
+		if change <= solverTolerance {
+			return
+		}
+	}
+}
+
+func relativeChange(old, new float64) float64 {
+	d := math.Abs(new - old)
+	if d == 0 {
+		return 0
+	}
+	return d / math.Max(math.Abs(new), math.Abs(old))
+}
+
+// bottomComponents returns, for each node, the index of its bottom strongly
+// connected component, one that no transition leaves, or -1 if the node is
+// transient; and the number of bottom components. It runs Tarjan's algorithm
+// with an explicit stack, so it works on graphs of any depth.
+func bottomComponents(m *sparseMatrix) ([]int, int) {
+	n := m.n
+	index := make([]int, n)
+	low := make([]int, n)
+	onStack := make([]bool, n)
+	scc := make([]int, n)
+	for i := range index {
+		index[i] = -1
+	}
+	var stack []int
+	type frame struct {
+		node int
+		next int
+	}
+	counter, sccs := 0, 0
+	for s := 0; s < n; s++ {
+		if index[s] >= 0 {
+			continue
+		}
+		index[s], low[s] = counter, counter
+		counter++
+		stack = append(stack, s)
+		onStack[s] = true
+		calls := []frame{{s, m.rowStart[s]}}
+		for len(calls) > 0 {
+			top := len(calls) - 1
+			v := calls[top].node
+			if k := calls[top].next; k < m.rowStart[v+1] {
+				calls[top].next++
+				w := m.cols[k]
+				if m.vals[k] == 0 {
+					continue
+				}
+				if index[w] < 0 {
+					index[w], low[w] = counter, counter
+					counter++
+					stack = append(stack, w)
+					onStack[w] = true
+					calls = append(calls, frame{w, m.rowStart[w]})
+				} else if onStack[w] {
+					low[v] = min(low[v], index[w])
+				}
+				continue
+			}
+			calls = calls[:top]
+			if top > 0 {
+				u := calls[top-1].node
+				low[u] = min(low[u], low[v])
+			}
+			if low[v] == index[v] {
+				for {
+					w := stack[len(stack)-1]
+					stack = stack[:len(stack)-1]
+					onStack[w] = false
+					scc[w] = sccs
+					if w == v {
+						break
+					}
+				}
+				sccs++
+			}
+		}
+	}
+
+	leaves := make([]bool, sccs)
+	for i := 0; i < n; i++ {
+		cols, vals := m.row(i)
+		for k, j := range cols {
+			if vals[k] != 0 && scc[j] != scc[i] {
+				leaves[scc[i]] = true
+			}
+		}
+	}
+	bottom := make([]int, sccs)
+	components := 0
+	for s := range bottom {
+		bottom[s] = -1
+		if !leaves[s] {
+			bottom[s] = components
+			components++
+		}
+	}
+	component := make([]int, n)
+	for i := range component {
+		component[i] = bottom[scc[i]]
+	}
+	return component, components
+}
@@ -5,9 +5,11 @@ import (
 	"fmt"
 	"github.com/fizzbee-io/fizzbee/lib"
 	"github.com/stretchr/testify/require"
+	"math"
 	"os"
 	"path/filepath"
 	"slices"
+	"strings"
 	"testing"
 )
 
@@ -212,3 +214,296 @@ func TestSteadyStateDistribution(t *testing.T) {
 		})
 	}
 }
+
+func TestAnalyzePerformance(t *testing.T) {
+	runfilesDir := os.Getenv("RUNFILES_DIR")
+	dir := filepath.Join(runfilesDir, "_main", "examples/tutorials/38-two-dice-with-coins")
+	file, err := readAstFromFile(filepath.Join(dir, "TwoDice.json"))
+	require.Nil(t, err)
+	stateCfg, err := ReadOptionsFromYaml(filepath.Join(dir, "fizz.yaml"))
+	require.Nil(t, err)
+	perfModel := &ast.PerformanceModel{}
+	require.Nil(t, lib.ReadProtoFromFile(filepath.Join(dir, "perf_model.yaml"), perfModel))
+
+	p1 := NewProcessor([]*ast.File{file}, stateCfg, false, 0, "", "", false, nil, nil, "")
+	root, _, _ := p1.Start()
+	nodes, _, _, yields := GetAllNodes(root, stateCfg.GetOptions().GetMaxActions())
+	report := AnalyzePerformance(file, nodes, yields, perfModel, PerformanceOptions{Method: PerfMethodPower, Samples: 20000, Seed: 1})
+
+	// A die takes one toss and then two per round, until the round is
+	// accepted with probability 3/4: 1 + 2*4/3 tosses.
+	require.InDelta(t, 22.0/3, report.MeanCounters["toss"], 1e-4)
+	require.Len(t, report.SteadyState, 11)
+	require.Equal(t, "{TwoDice: 7}", report.SteadyState[0].Returns)
+	require.InDelta(t, 1.0/6, report.SteadyState[0].Probability, 1e-5)
+	require.NotEmpty(t, report.Histogram)
+	require.Equal(t, []string{"toss"}, report.CounterNames())
+
+	require.Len(t, report.Liveness, 1)
+	require.Equal(t, "invariant 1", report.Liveness[0].Assertion)
+	require.InDelta(t, 1.0, report.Liveness[0].Probability, 1e-5)
+
+	// Two dice take at least 6 tosses.
+	tosses := report.Distributions["toss"]
+	require.NotNil(t, tosses)
+	require.Equal(t, 20000, tosses.Samples)
+	require.Equal(t, 6.0, tosses.Min)
+	require.InDelta(t, 22.0/3, tosses.Mean, 0.05)
+	for i := 1; i < len(tosses.Percentiles); i++ {
+		require.LessOrEqual(t, tosses.Percentiles[i-1].Value, tosses.Percentiles[i].Value)
+	}
+
+	// Each toss takes an exponentially distributed time with mean 2.
+	latencyModel := &ast.PerformanceModel{}
+	require.Nil(t, lib.ReadProtoFromFile(filepath.Join(dir, "perf_model_latency.yaml"), latencyModel))
+	require.Nil(t, ValidatePerformanceModel(latencyModel))
+	report = AnalyzePerformance(file, nodes, yields, latencyModel, PerformanceOptions{Method: PerfMethodGaussSeidel, Samples: 20000, Seed: 1})
+	require.InDelta(t, 2*22.0/3, report.MeanCounters["latency"], 1e-6)
+	latency := report.Distributions["latency"]
+	require.InDelta(t, 2*22.0/3, latency.Mean, 0.2)
+	require.Less(t, latency.Min, 6.0)
+	require.Greater(t, latency.Percentiles[len(latency.Percentiles)-1].Value, 2*latency.Mean)
+
+	latencyModel.Configs["Toss.call"].Counters["latency"].GetDistribution().GetExponential().Mean = 0
+	require.NotNil(t, ValidatePerformanceModel(latencyModel))
+}
+
+func TestSparseChainMatchesDense(t *testing.T) {
+	runfilesDir := os.Getenv("RUNFILES_DIR")
+	tests := []struct {
+		filename   string
+		maxActions int
+		perfModel  string
+	}{
+		{filename: "examples/tutorials/10-coins-to-dice-atomic-3sided/ThreeSidedDie.json", maxActions: 10},
+		{filename: "examples/tutorials/10.1-coins-to-dice-atomic-6sided/Die.json", maxActions: 10},
+		{filename: "examples/tutorials/21-unfair-coin/FairCoin.json", maxActions: 10},
+		{filename: "examples/tutorials/24-while-stmt-atomic/FairCoin.json", maxActions: 1},
+		{filename: "examples/tutorials/28-unfair-coin-toss-while-return/FairCoin.json", maxActions: 1},
+		{filename: "examples/tutorials/31-fair-die-from-coin-toss-method/FairDie.json", maxActions: 1,
+			perfModel: "examples/tutorials/31-fair-die-from-coin-toss-method/perf_model.yaml"},
+		{filename: "examples/tutorials/16-elements-counter-parallel/Counter.json", maxActions: 2},
+		{filename: "examples/tutorials/34-simple-hour-clock/HourClock.json", maxActions: 100},
+		{filename: "examples/tutorials/37-unfair-coin-toss-labels/FairCoin.json", maxActions: 1,
+			perfModel: "examples/tutorials/37-unfair-coin-toss-labels/perf_model_biased.yaml"},
+		{filename: "examples/tutorials/38-two-dice-with-coins/TwoDice.json", maxActions: 1,
+			perfModel: "examples/tutorials/38-two-dice-with-coins/perf_model.yaml"},
+	}
+	for _, test := range tests {
+		t.Run(test.filename, func(t *testing.T) {
+			file, err := readAstFromFile(filepath.Join(runfilesDir, "_main", test.filename))
+			require.Nil(t, err)
+			stateCfg := &ast.StateSpaceOptions{
+				ContinuePathOnInvariantFailures: true,
+				ContinueOnInvariantFailures:     true,
+				Options: &ast.Options{
+					MaxActions:           int64(test.maxActions),
+					MaxConcurrentActions: int64(test.maxActions),
+				},
+			}
+			p1 := NewProcessor([]*ast.File{file}, stateCfg, false, 0, "", "", false, nil, nil, "")
+			root, _, _ := p1.Start()
+			perfModel := &ast.PerformanceModel{}
+			if test.perfModel != "" {
+				require.Nil(t, lib.ReadProtoFromFile(filepath.Join(runfilesDir, "_main", test.perfModel), perfModel))
+			}
+			nodes, _, _, yields := getAllNodes(root, 0)
+			initial := make([]float64, len(nodes))
+			initial[0] = 1.0
+
+			denseDist, denseHistogram := steadyStateDistribution(root, perfModel)
+			chain := newSparseChain(nodes, perfModel)
+			sparseDist, sparseHistogram := chain.analyze(initial, PerfMethodPower)
+			require.InDeltaSlice(t, denseDist, sparseDist, 1e-9)
+			require.Len(t, sparseHistogram.GetAllHistogram(), len(denseHistogram.GetAllHistogram()))
+			for counter, mean := range denseHistogram.GetMeanCounts() {
+				require.InDelta(t, mean, sparseHistogram.GetMean(counter), 1e-6)
+			}
+
+			// The solvers give the exact steady state, which the power
+			// iteration approaches when it converges. The hour clock is
+			// periodic, so it does not.
+			if test.maxActions < 100 {
+				for _, method := range []string{PerfMethodGaussSeidel, PerfMethodJacobi} {
+					dist, histogram := chain.analyze(initial, method)
+					require.InDeltaSlice(t, denseDist, dist, 1e-5, method)
+					for counter, mean := range denseHistogram.GetMeanCounts() {
+						require.InDelta(t, mean, histogram.GetMean(counter), 1e-4, method)
+					}
+				}
+			}
+
+			for k, inv := range file.Invariants {
+				if !slices.Contains(invariantOperators(inv), "eventually") {
+					continue
+				}
+				denseAbsorbed, denseCosts := FindAbsorptionCosts(root, perfModel, 0, k)
+				sparseAbsorbed, sparseCosts := newAbsorbingChain(nodes, perfModel, 0, k).analyze(absorptionStart(nodes, yields), PerfMethodPower)
+				require.InDeltaSlice(t, denseAbsorbed, sparseAbsorbed, 1e-9)
+				for counter, mean := range denseCosts.GetMeanCounts() {
+					require.InDelta(t, mean, sparseCosts.GetMean(counter), 1e-6)
+				}
+			}
+		})
+	}
+
+	t.Run("hour clock", func(t *testing.T) {
+		file, err := readAstFromFile(filepath.Join(runfilesDir, "_main", "examples/tutorials/34-simple-hour-clock/HourClock.json"))
+		require.Nil(t, err)
+		p1 := NewProcessor([]*ast.File{file}, &ast.StateSpaceOptions{Options: &ast.Options{MaxActions: 100, MaxConcurrentActions: 1}}, false, 0, "", "", false, nil, nil, "")
+		root, _, _ := p1.Start()
+		nodes, _, _, _ := getAllNodes(root, 0)
+		initial := make([]float64, len(nodes))
+		initial[0] = 1.0
+		chain := newSparseChain(nodes, &ast.PerformanceModel{})
+		for _, method := range []string{PerfMethodGaussSeidel, PerfMethodJacobi} {
+			dist, _ := chain.analyze(initial, method)
+			hours := 0
+			for i, prob := range dist {
+				if prob > 1e-9 && nodes[i].Name == "yield" {
+					hours++
+					require.InDelta(t, 1.0/12, prob, 1e-6, method)
+				}
+			}
+			require.Equal(t, 12, hours, method)
+		}
+	})
+}
+
+func TestEvaluateQueries(t *testing.T) {
+	runfilesDir := os.Getenv("RUNFILES_DIR")
+	tests := []struct {
+		dir       string
+		file      string
+		perfModel string
+		queries   string
+		want      []float64
+	}{
+		{
+			dir:       "examples/tutorials/38-two-dice-with-coins",
+			file:      "TwoDice.json",
+			perfModel: "perf_model.yaml",
+			queries: `
+# A sum of 7 is the most likely.
+P=? [ F {__returns__.get('TwoDice') == 7} ]
+P>=0.2 [ F {__returns__.get('TwoDice') == 7} ]
+R{toss}=? [ F {'TwoDice' in __returns__} ]
+P=? [ G {__returns__.get('TwoDice', 2) >= 2} ]
+`,
+			want: []float64{1.0 / 6, 1.0 / 6, 22.0 / 3, 1},
+		},
+		{
+			dir:  "examples/tutorials/34-simple-hour-clock",
+			file: "HourClock.json",
+			queries: `
+P=? [ F<=4 {hour == 6} ]
+P=? [ F<=5 {hour == 6} ]
+P=? [ G<=4 {hour != 6} ]
+P=? [ G {hour != 6} ]
+P=? [ {hour < 4} U {hour == 6} ]
+P=? [ {hour < 7} U {hour == 6} ]
+R{steps}=? [ F {hour == 6} ]
+R{steps}=? [ F {hour == 13} ]
+`,
+			want: []float64{0, 1, 1, 0, 0, 1, 5, math.Inf(1)},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.dir, func(t *testing.T) {
+			dir := filepath.Join(runfilesDir, "_main", test.dir)
+			file, err := readAstFromFile(filepath.Join(dir, test.file))
+			require.Nil(t, err)
+			stateCfg, err := ReadOptionsFromYaml(filepath.Join(dir, "fizz.yaml"))
+			require.Nil(t, err)
+			queries, err := ParseQueries(test.queries)
+			require.Nil(t, err)
+			var perfModel *ast.PerformanceModel
+			if test.perfModel != "" {
+				perfModel = &ast.PerformanceModel{}
+				require.Nil(t, lib.ReadProtoFromFile(filepath.Join(dir, test.perfModel), perfModel))
+			}
+
+			p1 := NewProcessor([]*ast.File{file}, stateCfg, false, 0, "", "", false, nil, nil, "")
+			root, _, _ := p1.Start()
+			nodes, _, _, _ := GetAllNodes(root, stateCfg.GetOptions().GetMaxActions())
+			results := EvaluateQueries(queries, nodes, perfModel)
+			require.Len(t, results, len(test.want))
+			for i, result := range results {
+				require.Empty(t, result.Error, result.Query)
+				if math.IsInf(test.want[i], 1) {
+					require.True(t, math.IsInf(result.Value, 1), result.Query)
+				} else {
+					require.InDelta(t, test.want[i], result.Value, 1e-6, result.Query)
+				}
+			}
+		})
+	}
+
+	for _, query := range []string{"P=? [ F {x}", "P=? F {x}", "Q=? [ F {x} ]", "R{toss}=? [ G {x} ]", "P=? [ F<=1.5 {x} ]", "P>= [ F {x} ]"} {
+		_, err := ParseQuery(query)
+		require.NotNil(t, err, query)
+	}
+	q, err := ParseQuery(`P>0.5 [ {s == "}"} U<=3 {t in {"a": 1}} ]`)
+	require.Nil(t, err)
+	require.Equal(t, &Query{Text: q.Text, Compare: ">", Bound: 0.5, Operator: "U", Left: `s == "}"`, Right: `t in {"a": 1}`, Steps: 3}, q)
+}
+
+func TestGeneratePrismFiles(t *testing.T) {
+	runfilesDir := os.Getenv("RUNFILES_DIR")
+	dir := filepath.Join(runfilesDir, "_main", "examples/tutorials/38-two-dice-with-coins")
+	file, err := readAstFromFile(filepath.Join(dir, "TwoDice.json"))
+	require.Nil(t, err)
+	stateCfg, err := ReadOptionsFromYaml(filepath.Join(dir, "fizz.yaml"))
+	require.Nil(t, err)
+	perfModel := &ast.PerformanceModel{}
+	require.Nil(t, lib.ReadProtoFromFile(filepath.Join(dir, "perf_model.yaml"), perfModel))
+
+	p1 := NewProcessor([]*ast.File{file}, stateCfg, false, 0, "", "", false, nil, nil, "")
+	root, _, _ := p1.Start()
+	nodes, _, _, _ := GetAllNodes(root, stateCfg.GetOptions().GetMaxActions())
+	prefix := t.TempDir() + "/"
+	fileNames, err := GeneratePrismFiles(file, nodes, perfModel, prefix)
+	require.Nil(t, err)
+	require.Equal(t, []string{prefix + "model.tra", prefix + "model.sta", prefix + "model.lab", prefix + "model_toss.trew"}, fileNames)
+
+	readLines := func(name string) []string {
+		data, err := os.ReadFile(prefix + name)
+		require.Nil(t, err)
+		return strings.Split(strings.TrimSpace(string(data)), "\n")
+	}
+	// Each row of the transitions adds up to 1, and the rewards weighted by
+	// the transition probabilities add up to the expected tosses of a step.
+	tra := readLines("model.tra")
+	require.Equal(t, fmt.Sprintf("%d %d", len(nodes), len(tra)-1), tra[0])
+	probs := map[[2]int]float64{}
+	rowSums := make([]float64, len(nodes))
+	for _, line := range tra[1:] {
+		var i, j int
+		var prob float64
+		_, err := fmt.Sscanf(line, "%d %d %g", &i, &j, &prob)
+		require.Nil(t, err)
+		probs[[2]int{i, j}] = prob
+		rowSums[i] += prob
+	}
+	for _, sum := range rowSums {
+		require.InDelta(t, 1.0, sum, 1e-12)
+	}
+	trew := readLines("model_toss.trew")
+	expected := make([]float64, len(nodes))
+	for _, line := range trew[1:] {
+		var i, j int
+		var reward float64
+		_, err := fmt.Sscanf(line, "%d %d %g", &i, &j, &reward)
+		require.Nil(t, err)
+		require.Contains(t, probs, [2]int{i, j})
+		expected[i] += probs[[2]int{i, j}] * reward
+	}
+	require.InDeltaSlice(t, newSparseChain(nodes, perfModel).rewards["toss"], expected, 1e-12)
+
+	sta := readLines("model.sta")
+	require.Len(t, sta, len(nodes)+1)
+	require.Equal(t, "0:()", sta[1])
+	lab := readLines("model.lab")
+	require.Equal(t, `0="init" 1="deadlock" 2="yield" 3="crash" 4="invariant_1" 5="link_RollDie_call" 6="link_Toss_call"`, lab[0])
+	require.Equal(t, "0: 0", lab[1])
+}
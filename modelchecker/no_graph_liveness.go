@@ -0,0 +1,667 @@
+package modelchecker
+
+import (
+	ast "fizz/proto"
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// With --experimental_no_graph the yield-points are dropped once expanded,
+// so the liveness checks that walk Outbound/Inbound cannot run. Instead, the
+// processor records a fingerprint graph while it explores: a compact id for
+// each visited state, the transitions between them with the fairness of the
+// action taken, and for each state whether the liveness assertions hold.
+// After the exploration, the strongly connected components of this graph
+// are searched for a fair cycle that violates an assertion, in the style of
+// Emerson and Lei, and the counterexample is reported as a lasso of trace
+// steps: a stem from Init to a state, and a cycle that returns to it.
+
+// fingerprintGraph is the state graph kept for liveness checking in no-graph
+// mode. States are numbered in the order they are first reached, so a state
+// with a smaller id has a shorter trace.
+type fingerprintGraph struct {
+	bits   int
+	ids    map[Fingerprint]int32
+	states []fingerprintState
+	edges  [][]fingerprintEdge
+
+	// names interns the fairness names of the actions and the trace steps.
+	names   []string
+	nameIds map[string]int32
+
+	// invariants are the liveness assertions of the spec, and
+	// alwaysEventually tells which of them are always-eventually rather
+	// than eventually-always assertions.
+	invariants       []*InvariantPosition
+	alwaysEventually []bool
+}
+
+// fingerprintState flags
+const (
+	// stateRelevant: the liveness assertions are evaluated in the state, a
+	// yield or a state with no running threads.
+	stateRelevant uint8 = 1 << iota
+	// stateFairness: the fair actions enabled in the state count for the
+	// fairness of the cycles through it, as in isFairCycle.
+	stateFairness
+	// stateStutter: the state is a yield or init, where the system may stop
+	// if no fair action is enabled.
+	stateStutter
+	// stateBusy: a fair action or a thread continuation leaves the state, so
+	// it may not stutter.
+	stateBusy
+)
+
+type fingerprintState struct {
+	// path is the trace that first reached the state.
+	path  *pathNode
+	flags uint8
+	// witness has bit k set when liveness assertion k holds in the state.
+	witness uint64
+}
+
+type fingerprintEdge struct {
+	to int32
+	// action is the fairness name of the transition, or -1 if it is not
+	// fair or does not leave a fairness state. step is the trace step of the
+	// transition, or -1 if it has none, as for thread continuations.
+	action int32
+	step   int32
+	level  ast.FairnessLevel
+}
+
+// pendingFingerprintEdge is a transition recorded when a node is forked, and
+// added to the graph when the node reaches the visited set.
+type pendingFingerprintEdge struct {
+	from     int32
+	action   int32
+	step     int32
+	level    ast.FairnessLevel
+	fairness bool
+	busy     bool
+}
+
+// maxNoGraphLivenessInvariants is the number of liveness assertions a
+// fingerprint state has witness bits for.
+const maxNoGraphLivenessInvariants = 64
+
+func newFingerprintGraph(files []*ast.File, bits int) (*fingerprintGraph, error) {
+	g := &fingerprintGraph{
+		bits:    bits,
+		ids:     make(map[Fingerprint]int32),
+		nameIds: make(map[string]int32),
+	}
+	for i, file := range files {
+		for j, invariant := range file.Invariants {
+			eventuallyAlways, alwaysEventually := livenessOperators(invariant)
+			if !eventuallyAlways && !alwaysEventually {
+				continue
+			}
+			g.invariants = append(g.invariants, NewInvariantPosition(i, j))
+			g.alwaysEventually = append(g.alwaysEventually, alwaysEventually)
+		}
+	}
+	if len(g.invariants) > maxNoGraphLivenessInvariants {
+		return nil, fmt.Errorf("liveness checking in no-graph mode supports at most %d liveness assertions, the spec has %d", maxNoGraphLivenessInvariants, len(g.invariants))
+	}
+	return g, nil
+}
+
+// livenessOperators tells whether the invariant is an eventually-always or
+// an always-eventually assertion.
+func livenessOperators(invariant *ast.Invariant) (eventuallyAlways bool, alwaysEventually bool) {
+	if invariant.Block == nil {
+		if invariant.Always && invariant.Eventually {
+			return false, true
+		}
+		return invariant.Eventually && invariant.GetNested().GetAlways(), false
+	}
+	operators := invariant.TemporalOperators
+	if !slices.Contains(operators, "eventually") {
+		return false, false
+	}
+	return operators[0] == "eventually" && operators[1] == "always", operators[0] == "always" && operators[1] == "eventually"
+}
+
+func (g *fingerprintGraph) intern(name string) int32 {
+	if id, ok := g.nameIds[name]; ok {
+		return id
+	}
+	id := int32(len(g.names))
+	g.names = append(g.names, name)
+	g.nameIds[name] = id
+	return id
+}
+
+func (g *fingerprintGraph) addState(path *pathNode, flags uint8) int32 {
+	id := int32(len(g.states))
+	g.states = append(g.states, fingerprintState{path: path, flags: flags})
+	g.edges = append(g.edges, nil)
+	return id
+}
+
+// setWitness sets the witness bits of the state from the liveness
+// assertions that hold in the process. The processor evaluates them at
+// yields and in Init; in the other states where they are checked, such as
+// at the end of a thread that does not yield, they are evaluated here.
+func (g *fingerprintGraph) setWitness(v int32, process *Process, evaluated bool) {
+	if !evaluated {
+		CheckInvariants(process)
+	}
+	for k, position := range g.invariants {
+		if process.Witness[position.FileIndex][position.InvariantIndex] {
+			g.states[v].witness |= 1 << k
+		}
+	}
+}
+
+// fork records the transition from parent to child, a node forked from it
+// that is about to be scheduled. The parent still has its process, which
+// names the fair choices and thread continuations.
+func (g *fingerprintGraph) fork(parent *Node, child *Node) {
+	if parent.fingerprintId == 0 {
+		// Init, when the spec has no Init action, forks the actions
+		// without being processed.
+		parent.fingerprintId = g.addState(parent.pathTail, stateRelevant|stateFairness|stateStutter) + 1
+		g.setWitness(parent.fingerprintId-1, parent.Process, true)
+	}
+	link := child.Inbound[0]
+	edge := &pendingFingerprintEdge{from: parent.fingerprintId - 1, action: -1, step: -1}
+	isFairChoice := strings.HasPrefix(link.Name, "Any:") &&
+		link.ChoiceFairness != ast.FairnessLevel_FAIRNESS_LEVEL_UNKNOWN &&
+		link.ChoiceFairness != ast.FairnessLevel_FAIRNESS_LEVEL_UNFAIR
+	edge.fairness = parent.Name == "init" || parent.Name == "yield" || parent.Name == "crash" || isFairChoice
+	if edge.fairness {
+		name, level, _ := fairnessLinkName(parent, &Link{Name: link.Name, Fairness: child.Process.Fairness})
+		if level == ast.FairnessLevel_FAIRNESS_LEVEL_STRONG || level == ast.FairnessLevel_FAIRNESS_LEVEL_WEAK {
+			edge.action, edge.level = g.intern(name), level
+		}
+	}
+	edge.busy = child.Process.Fairness == ast.FairnessLevel_FAIRNESS_LEVEL_STRONG ||
+		child.Process.Fairness == ast.FairnessLevel_FAIRNESS_LEVEL_WEAK ||
+		strings.HasPrefix(link.Name, "thread-")
+	if child.pathTail != nil && child.pathTail != parent.pathTail {
+		edge.step = g.intern(child.pathTail.name)
+	}
+	child.fingerprintEdge = edge
+}
+
+// reach records that node reached the state with the canonical hash, adding
+// the state if it is new, and the transition into it. A yield reached by an
+// action that was not enabled is not a transition.
+func (g *fingerprintGraph) reach(node *Node, canonicalHash string, yield bool) {
+	fp := toFingerprint(canonicalHash, g.bits)
+	to, ok := g.ids[fp]
+	if !ok {
+		var flags uint8
+		relevant := yield || node.Process.GetThreadsCount() == 0
+		if relevant {
+			flags |= stateRelevant
+		}
+		if yield || node.Name == "init" || node.Name == "crash" {
+			flags |= stateFairness | stateStutter
+		}
+		to = g.addState(node.pathTail, flags)
+		g.ids[fp] = to
+		if relevant {
+			g.setWitness(to, node.Process, yield)
+		}
+	} else if yield && !node.Enabled {
+		node.fingerprintEdge = nil
+		return
+	}
+	node.fingerprintId = to + 1
+	edge := node.fingerprintEdge
+	if edge == nil {
+		return
+	}
+	node.fingerprintEdge = nil
+	from := &g.states[edge.from]
+	if edge.fairness {
+		from.flags |= stateFairness
+	}
+	if edge.busy {
+		from.flags |= stateBusy
+	}
+	g.edges[edge.from] = append(g.edges[edge.from], fingerprintEdge{to: to, action: edge.action, step: edge.step, level: edge.level})
+}
+
+func (g *fingerprintGraph) has(v int32, flag uint8) bool {
+	return g.states[v].flags&flag != 0
+}
+
+// stutters tells whether the system may stop in the state.
+func (g *fingerprintGraph) stutters(v int32) bool {
+	return g.has(v, stateStutter) && !g.has(v, stateBusy)
+}
+
+// LivenessLasso is a counterexample to a liveness assertion as trace steps:
+// Path[:CycleStart] leads from Init to a state, and Path[CycleStart:] returns
+// to it, repeating forever. An empty cycle means the system stops in the
+// state.
+type LivenessLasso struct {
+	Invariant  *InvariantPosition
+	Path       []string
+	CycleStart int
+}
+
+// SetNoGraphLiveness makes the no-graph mode record the fingerprint graph,
+// so CheckNoGraphLiveness can check the liveness assertions after the run.
+// Must be called before Start. Not supported with disk spill or checkpoints,
+// whose states are not all in memory.
+func (p *Processor) SetNoGraphLiveness(v bool) {
+	p.noGraphLiveness = v
+}
+
+// CheckNoGraphLiveness checks the liveness assertions on the fingerprint
+// graph recorded by a no-graph run, and returns a lasso for the first one
+// that fails, or nil if they all hold or the graph was not recorded.
+func (p *Processor) CheckNoGraphLiveness() *LivenessLasso {
+	g := p.fingerprints
+	if g == nil || len(g.states) == 0 {
+		return nil
+	}
+	all := make([]int32, len(g.states))
+	for v := range all {
+		all[v] = int32(v)
+	}
+	k, component, accepting := g.violation(all)
+	if component == nil {
+		return nil
+	}
+	entry, cycle := g.cycle(component, accepting)
+	lasso := &LivenessLasso{Invariant: g.invariants[k], Path: collectPath(g.states[entry].path)}
+	lasso.CycleStart = len(lasso.Path)
+	for _, edge := range cycle {
+		if edge.step >= 0 {
+			lasso.Path = append(lasso.Path, g.names[edge.step])
+		}
+	}
+	return lasso
+}
+
+// violation returns the index in g.invariants of the first liveness
+// assertion that fails on a fair cycle through the states in subset, with
+// the component of the cycle and its accepting states, or a nil component if
+// they all hold there.
+func (g *fingerprintGraph) violation(subset []int32) (int, []int32, func(v int32) bool) {
+	for k := range g.invariants {
+		holds := func(v int32) bool {
+			return g.has(v, stateRelevant) && g.states[v].witness&(1<<k) != 0
+		}
+		var candidates []int32
+		var accepting func(v int32) bool
+		if g.alwaysEventually[k] {
+			// A fair cycle that never reaches a state where it holds.
+			for _, v := range subset {
+				if !holds(v) {
+					candidates = append(candidates, v)
+				}
+			}
+		} else {
+			// A fair cycle through a state where it does not hold.
+			candidates = subset
+			accepting = func(v int32) bool {
+				return g.has(v, stateRelevant) && !holds(v)
+			}
+		}
+		if component := g.fairComponent(candidates, accepting); component != nil {
+			return k, component, accepting
+		}
+	}
+	return -1, nil, nil
+}
+
+// fairComponent returns a strongly connected component of the states in
+// subset that has a cycle through an accepting state, if accepting is not
+// nil, and where every fair action is taken as often as fairness requires,
+// or nil if there is none. As in ltlProduct.fairAcceptingComponent, a strong
+// fair action that is enabled but not taken excludes the states where it is
+// enabled, and the rest is searched again. Of the components found, the one
+// with the smallest state is returned, for the shortest stem.
+func (g *fingerprintGraph) fairComponent(subset []int32, accepting func(v int32) bool) []int32 {
+	var found []int32
+	work := [][]int32{subset}
+	for len(work) > 0 {
+		subset := work[len(work)-1]
+		work = work[:len(work)-1]
+		for _, component := range g.components(subset) {
+			if accepting != nil && !slices.ContainsFunc(component, accepting) {
+				continue
+			}
+			inside := make(map[int32]bool, len(component))
+			for _, v := range component {
+				inside[v] = true
+			}
+			taken := make(map[int32]bool)
+			enabled := make(map[int32]int)
+			strong := make(map[int32]bool)
+			fairnessStates := 0
+			for _, v := range component {
+				if !g.has(v, stateFairness) {
+					continue
+				}
+				fairnessStates++
+				seen := make(map[int32]bool)
+				for _, edge := range g.edges[v] {
+					if edge.action < 0 {
+						continue
+					}
+					if inside[edge.to] {
+						taken[edge.action] = true
+					}
+					if edge.level == ast.FairnessLevel_FAIRNESS_LEVEL_STRONG {
+						strong[edge.action] = true
+					}
+					if !seen[edge.action] {
+						seen[edge.action] = true
+						enabled[edge.action]++
+					}
+				}
+			}
+			fair, unfairStrong := true, int32(-1)
+			for _, action := range sortedActions(enabled) {
+				if taken[action] {
+					continue
+				}
+				if strong[action] {
+					if unfairStrong < 0 {
+						unfairStrong = action
+					}
+				} else if enabled[action] == fairnessStates {
+					// A weak fair action enabled in every state and
+					// never taken.
+					fair = false
+					break
+				}
+			}
+			if !fair {
+				continue
+			}
+			if unfairStrong < 0 {
+				if found == nil || component[0] < found[0] {
+					found = component
+				}
+				continue
+			}
+			var rest []int32
+			for _, v := range component {
+				if !g.enables(v, unfairStrong) {
+					rest = append(rest, v)
+				}
+			}
+			if len(rest) > 0 {
+				work = append(work, rest)
+			}
+		}
+	}
+	return found
+}
+
+func sortedActions(actions map[int32]int) []int32 {
+	sorted := make([]int32, 0, len(actions))
+	for action := range actions {
+		sorted = append(sorted, action)
+	}
+	slices.Sort(sorted)
+	return sorted
+}
+
+// enables tells whether the fair action leaves the state.
+func (g *fingerprintGraph) enables(v int32, action int32) bool {
+	if !g.has(v, stateFairness) {
+		return false
+	}
+	for _, edge := range g.edges[v] {
+		if edge.action == action {
+			return true
+		}
+	}
+	return false
+}
+
+// components returns the strongly connected components of the subgraph of
+// the states in subset that have a cycle, counting stuttering as a cycle,
+// with Tarjan's algorithm on an explicit stack. Each component is sorted.
+func (g *fingerprintGraph) components(subset []int32) [][]int32 {
+	inSubset := make(map[int32]bool, len(subset))
+	for _, v := range subset {
+		inSubset[v] = true
+	}
+	index := make(map[int32]int32, len(subset))
+	low := make(map[int32]int32, len(subset))
+	onStack := make(map[int32]bool)
+	var stack []int32
+	var components [][]int32
+	type frame struct {
+		v    int32
+		next int
+	}
+	counter := int32(0)
+	for _, start := range subset {
+		if _, ok := index[start]; ok {
+			continue
+		}
+		calls := []frame{{v: start}}
+		index[start], low[start] = counter, counter
+		counter++
+		stack = append(stack, start)
+		onStack[start] = true
+		for len(calls) > 0 {
+			top := &calls[len(calls)-1]
+			v := top.v
+			if top.next < len(g.edges[v]) {
+				w := g.edges[v][top.next].to
+				top.next++
+				if !inSubset[w] {
+					continue
+				}
+				if _, ok := index[w]; !ok {
+					index[w], low[w] = counter, counter
+					counter++
+					stack = append(stack, w)
+					onStack[w] = true
+					calls = append(calls, frame{v: w})
+				} else if onStack[w] {
+					low[v] = min(low[v], index[w])
+				}
+				continue
+			}
+			calls = calls[:len(calls)-1]
+			if len(calls) > 0 {
+				parent := calls[len(calls)-1].v
+				low[parent] = min(low[parent], low[v])
+			}
+			if low[v] != index[v] {
+				continue
+			}
+			var component []int32
+			for {
+				w := stack[len(stack)-1]
+				stack = stack[:len(stack)-1]
+				onStack[w] = false
+				component = append(component, w)
+				if w == v {
+					break
+				}
+			}
+			if len(component) > 1 || g.stutters(v) || slices.ContainsFunc(g.edges[v], func(e fingerprintEdge) bool { return e.to == v }) {
+				slices.Sort(component)
+				components = append(components, component)
+			}
+		}
+	}
+	return components
+}
+
+// cycle returns the smallest state of the component, where the lasso
+// enters it, and the transitions of a cycle within the component back to it
+// that visits an accepting state, takes every fair action taken within the
+// component, and visits the states where the weak fair actions it does not
+// take are disabled. The cycle is empty if the state stutters and no
+// transition stays within the component.
+func (g *fingerprintGraph) cycle(component []int32, accepting func(v int32) bool) (int32, []fingerprintEdge) {
+	inside := make(map[int32]bool, len(component))
+	for _, v := range component {
+		inside[v] = true
+	}
+	entry := component[0]
+	var cycle []fingerprintEdge
+
+	// Goals are states to visit, or transitions to take, given as the state
+	// they leave and the index of the transition in g.edges.
+	type goal struct {
+		v    int32
+		edge int
+	}
+	var goals []goal
+	// The first goal leaves the entry, so that the cycle is not empty.
+	for e, edge := range g.edges[entry] {
+		if inside[edge.to] {
+			goals = append(goals, goal{v: entry, edge: e})
+			break
+		}
+	}
+	if len(goals) == 0 {
+		return entry, nil
+	}
+	if accepting != nil {
+		for _, v := range component {
+			if accepting(v) {
+				goals = append(goals, goal{v: v, edge: -1})
+				break
+			}
+		}
+	}
+	taken := make(map[int32]bool)
+	enabled := make(map[int32]bool)
+	for _, v := range component {
+		if !g.has(v, stateFairness) {
+			continue
+		}
+		for e, edge := range g.edges[v] {
+			if edge.action < 0 {
+				continue
+			}
+			enabled[edge.action] = true
+			if inside[edge.to] && !taken[edge.action] {
+				taken[edge.action] = true
+				goals = append(goals, goal{v: v, edge: e})
+			}
+		}
+	}
+	for action := range enabled {
+		if taken[action] {
+			continue
+		}
+		for _, v := range component {
+			if g.has(v, stateFairness) && !g.enables(v, action) {
+				goals = append(goals, goal{v: v, edge: -1})
+				break
+			}
+		}
+	}
+
+	current := entry
+	take := func(edge fingerprintEdge) {
+		cycle = append(cycle, edge)
+		current = edge.to
+	}
+	walk := func(to int32) {
+		for _, edge := range g.pathWithin(current, to, inside) {
+			take(edge)
+		}
+	}
+	for _, goal := range goals {
+		walk(goal.v)
+		if goal.edge >= 0 {
+			take(g.edges[goal.v][goal.edge])
+		}
+	}
+	walk(entry)
+	return entry, cycle
+}
+
+// pathWithin returns the transitions of a shortest path from one state to
+// another through the states inside.
+func (g *fingerprintGraph) pathWithin(from, to int32, inside map[int32]bool) []fingerprintEdge {
+	if from == to {
+		return nil
+	}
+	type step struct {
+		from int32
+		edge int
+	}
+	parent := map[int32]step{from: {from: -1}}
+	queue := []int32{from}
+	for len(queue) > 0 {
+		v := queue[0]
+		queue = queue[1:]
+		for e, edge := range g.edges[v] {
+			if _, ok := parent[edge.to]; ok || !inside[edge.to] {
+				continue
+			}
+			parent[edge.to] = step{from: v, edge: e}
+			if edge.to == to {
+				var path []fingerprintEdge
+				for w := to; w != from; w = parent[w].from {
+					path = append(path, g.edges[parent[w].from][parent[w].edge])
+				}
+				slices.Reverse(path)
+				return path
+			}
+			queue = append(queue, edge.to)
+		}
+	}
+	return nil
+}
+
+// TraceLasso returns the lasso a guided trace ending with a cycle, as
+// written for a no-graph liveness failure, describes: the links of the
+// trace, up to the state it ends in, and the index of the link after the
+// first visit to that state, from which the trace repeats. If the trace
+// visits that state only at its end, it stutters there. Also returns the
+// first liveness assertion the cycle violates, or nil if none does.
+func (p *Processor) TraceLasso() ([]*Link, int, *InvariantPosition) {
+	if p.guidedTrace == nil || p.guidedTrace.end == nil {
+		return nil, 0, nil
+	}
+	end := p.guidedTrace.end
+	path := ExtractFailurePath(end, p.Init)
+	hash := p.canonicalHash(end)
+	cycleStart := len(path)
+	for i := 0; i < len(path)-1; i++ {
+		if node := path[i].Node; node.Process != nil && (node.Name == "yield" || node.GetThreadsCount() == 0) && p.canonicalHash(node) == hash {
+			cycleStart = i + 1
+			break
+		}
+	}
+	if cycleStart == len(path) {
+		path = append(path, &Link{Node: end, Name: "stutter"})
+	}
+	for i, file := range p.Files {
+		for j, invariant := range file.Invariants {
+			eventuallyAlways, alwaysEventually := livenessOperators(invariant)
+			if !eventuallyAlways && !alwaysEventually {
+				continue
+			}
+			witnessed, violated := false, false
+			for _, link := range path[cycleStart:] {
+				node := link.Node
+				if node.Process == nil || (node.Name != "yield" && node.GetThreadsCount() != 0) {
+					continue
+				}
+				if node.Witness[i][j] {
+					witnessed = true
+				} else {
+					violated = true
+				}
+			}
+			if (alwaysEventually && !witnessed) || (eventuallyAlways && violated) {
+				return path, cycleStart, NewInvariantPosition(i, j)
+			}
+		}
+	}
+	return path, cycleStart, nil
+}
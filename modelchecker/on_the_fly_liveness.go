@@ -0,0 +1,217 @@
+package modelchecker
+
+import (
+	ast "fizz/proto"
+	"strings"
+)
+
+// The liveness checks that walk the state graph run after the exploration,
+// so a spec with an early liveness bug is explored in full before the bug is
+// reported. With on-the-fly liveness, the exploration also pauses every so
+// often to search the part of the graph explored so far, in the style of
+// Couvreur's algorithm. A node is closed when all its successors are known,
+// that is, when none of the nodes forked from it is still queued, so its
+// Outbound links are complete. A fair cycle through closed nodes that
+// violates an assertion is a cycle of the whole graph, so the run stops with
+// it as the lasso. Closed nodes that reach no open node belong to components
+// that can no longer grow, and are not searched again. The full check still
+// runs after the exploration if no cycle was found on the way.
+
+// livenessSearchInterval is the least number of expansions between two
+// searches.
+const livenessSearchInterval = 1000
+
+// livenessSearch is the state of the on-the-fly liveness check.
+type livenessSearch struct {
+	// template has the liveness assertions of the spec, for the fingerprint
+	// graph each search builds.
+	template *fingerprintGraph
+	// queued has the nodes in the processing queue.
+	queued map[*Node]bool
+	// done has the closed nodes that reach no open node.
+	done map[*Node]bool
+	// expansions counts the expansions since the last search; the next one
+	// runs after next of them, as many as the nodes the last one searched,
+	// so the searches take about as long as the exploration.
+	expansions int
+	next       int
+
+	failurePath     []*Link
+	failedInvariant *InvariantPosition
+}
+
+func newLivenessSearch(files []*ast.File) (*livenessSearch, error) {
+	template, err := newFingerprintGraph(files, 0)
+	if err != nil {
+		return nil, err
+	}
+	return &livenessSearch{
+		template: template,
+		queued:   make(map[*Node]bool),
+		done:     make(map[*Node]bool),
+		next:     livenessSearchInterval,
+	}, nil
+}
+
+// SetOnTheFlyLiveness makes Start search for liveness failures while it
+// explores, and stop at the first fair cycle found that violates a liveness
+// assertion. Must be called before Start. Only the default exploration
+// supports it, not simulation or the processed queue.
+func (p *Processor) SetOnTheFlyLiveness(v bool) {
+	p.onTheFlyLiveness = v
+}
+
+// OnTheFlyLivenessFailure returns the lasso, as the failure path of the
+// liveness checks, and the assertion it violates, if the on-the-fly check
+// stopped the run. The path ends with a stutter link if the system stops.
+func (p *Processor) OnTheFlyLivenessFailure() ([]*Link, *InvariantPosition) {
+	if p.livenessSearch == nil {
+		return nil, nil
+	}
+	return p.livenessSearch.failurePath, p.livenessSearch.failedInvariant
+}
+
+// searchLiveness counts an expansion and runs a search if one is due.
+// Returns true if the search found a liveness failure.
+func (p *Processor) searchLiveness() bool {
+	s := p.livenessSearch
+	s.expansions++
+	if s.expansions < s.next {
+		return false
+	}
+	s.expansions = 0
+	s.next = max(livenessSearchInterval, s.search(p.Init))
+	return s.failedInvariant != nil
+}
+
+// search builds the fingerprint graph of the nodes reachable from init that
+// are not done, and searches its closed nodes for a fair cycle that violates
+// a liveness assertion. Returns the number of nodes searched.
+func (s *livenessSearch) search(init *Node) int {
+	if s.done[init] {
+		return 0
+	}
+	open := make(map[*Node]bool)
+	for node := range s.queued {
+		open[node] = true
+		if len(node.Inbound) > 0 {
+			open[node.Inbound[0].Node] = true
+		}
+	}
+
+	g := &fingerprintGraph{
+		nameIds:          make(map[string]int32),
+		invariants:       s.template.invariants,
+		alwaysEventually: s.template.alwaysEventually,
+	}
+	// State 0 stands for all the done nodes, outside every component.
+	g.addState(nil, 0)
+	nodes := []*Node{nil}
+	ids := make(map[*Node]int32)
+	add := func(node *Node) {
+		var flags uint8
+		relevant := node.Name == "yield" || node.Process.GetThreadsCount() == 0
+		if relevant {
+			flags |= stateRelevant
+		}
+		if node.Name == "yield" || node.Name == "init" || node.Name == "crash" {
+			flags |= stateFairness | stateStutter
+		}
+		v := g.addState(nil, flags)
+		if relevant {
+			for k, position := range g.invariants {
+				if node.Process.Witness[position.FileIndex][position.InvariantIndex] {
+					g.states[v].witness |= 1 << k
+				}
+			}
+		}
+		ids[node] = v
+		nodes = append(nodes, node)
+	}
+	add(init)
+	var subset []int32
+	var links []*Link
+	for v := int32(1); int(v) < len(nodes); v++ {
+		node := nodes[v]
+		for _, link := range node.Outbound {
+			if _, ok := ids[link.Node]; !ok && !s.done[link.Node] {
+				add(link.Node)
+			}
+		}
+		// The transitions out of an open node are not all known yet.
+		if open[node] {
+			continue
+		}
+		subset = append(subset, v)
+		for _, link := range node.Outbound {
+			if link.IsCrashLink() {
+				continue
+			}
+			edge := fingerprintEdge{to: ids[link.Node], action: -1, step: int32(len(links))}
+			links = append(links, link)
+			isFairChoice := strings.HasPrefix(link.Name, "Any:") &&
+				link.ChoiceFairness != ast.FairnessLevel_FAIRNESS_LEVEL_UNKNOWN &&
+				link.ChoiceFairness != ast.FairnessLevel_FAIRNESS_LEVEL_UNFAIR
+			if g.has(v, stateStutter) || isFairChoice {
+				g.states[v].flags |= stateFairness
+				name, level, _ := fairnessLinkName(node, link)
+				if level == ast.FairnessLevel_FAIRNESS_LEVEL_STRONG || level == ast.FairnessLevel_FAIRNESS_LEVEL_WEAK {
+					edge.action, edge.level = g.intern(name), level
+				}
+			}
+			if link.Fairness == ast.FairnessLevel_FAIRNESS_LEVEL_STRONG ||
+				link.Fairness == ast.FairnessLevel_FAIRNESS_LEVEL_WEAK ||
+				strings.HasPrefix(link.Name, "thread-") {
+				g.states[v].flags |= stateBusy
+			}
+			g.edges[v] = append(g.edges[v], edge)
+		}
+	}
+
+	if k, component, accepting := g.violation(subset); component != nil {
+		entry, cycle := g.cycle(component, accepting)
+		s.failurePath = ExtractFailurePath(nodes[entry], init)
+		for _, edge := range cycle {
+			s.failurePath = append(s.failurePath, links[edge.step])
+		}
+		if len(cycle) == 0 {
+			s.failurePath = append(s.failurePath, &Link{Node: nodes[entry], Name: "stutter"})
+		}
+		s.failedInvariant = g.invariants[k]
+		return len(nodes)
+	}
+
+	// The closed nodes that cannot reach an open node are done.
+	inbound := make([][]int32, len(nodes))
+	for _, v := range subset {
+		for _, edge := range g.edges[v] {
+			if edge.to != 0 {
+				inbound[edge.to] = append(inbound[edge.to], v)
+			}
+		}
+	}
+	reachesOpen := make([]bool, len(nodes))
+	var work []int32
+	for v := 1; v < len(nodes); v++ {
+		if open[nodes[v]] {
+			reachesOpen[v] = true
+			work = append(work, int32(v))
+		}
+	}
+	for len(work) > 0 {
+		v := work[len(work)-1]
+		work = work[:len(work)-1]
+		for _, u := range inbound[v] {
+			if !reachesOpen[u] {
+				reachesOpen[u] = true
+				work = append(work, u)
+			}
+		}
+	}
+	for _, v := range subset {
+		if !reachesOpen[v] {
+			s.done[nodes[v]] = true
+		}
+	}
+	return len(nodes)
+}
@@ -0,0 +1,165 @@
+package modelchecker
+
+import (
+	"sync"
+	"sync/atomic"
+
+	"github.com/fizzbee-io/fizzbee/lib"
+)
+
+// prefetchWindowPerWorker is how many upcoming action-starts each worker is
+// given per prefetch round. Larger windows amortize the goroutine fan-out;
+// smaller windows waste less work when the run stops early on a failure.
+const prefetchWindowPerWorker = 16
+
+// prefetchResult is the outcome of running a node's current thread to its
+// next fork/yield on a worker goroutine, plus the node's canonical (symmetry
+// reduced) hash. processNode consumes it in place of executing inline.
+type prefetchResult struct {
+	forks         []*Process
+	yield         bool
+	canonicalHash string
+
+	// panicked holds the value recovered from a panic on the worker, so it
+	// can be re-raised on the coordinating goroutine at the exact point the
+	// single-threaded checker would have raised it.
+	panicked interface{}
+}
+
+// SetWorkers sets the number of goroutines that prefetch action-starts
+// during exhaustive BFS. Must be called before Start. Values <= 1 keep the
+// single-threaded path. Has no effect in simulation mode or with the dfs and
+// random exploration strategies, whose order depends on each step's result.
+//
+// This is a prefetch, not a shared frontier: only the expensive, state-local
+// work runs in parallel: executing each action-start's thread to its next
+// yield or fork, and computing the canonical symmetry-reduced hash. p.queue
+// and p.visited are not shared; dedup, graph linking, invariant checks and
+// scheduling stay on the coordinating goroutine in exactly the order the
+// single-threaded BFS uses, so the unique state count, the graph and the
+// (shortest) counterexample are identical for any N.
+func (p *Processor) SetWorkers(n int) {
+	p.workers = n
+}
+
+// parallelEnabled reports whether action-starts should be prefetched on
+// worker goroutines. Only the FIFO (bfs) queues have a fixed order to look
+// ahead into.
+func (p *Processor) parallelEnabled() bool {
+	if p.workers <= 1 || p.simulation {
+		return false
+	}
+	switch p.queue.(type) {
+	case *lib.Queue[*Node], *lib.DiskQueue[*Node]:
+		return true
+	}
+	return false
+}
+
+// prefetchFrontier makes sure head has been prefetched before processNode
+// runs it. When head has no result yet, it and the next window of p.queue
+// are executed concurrently. head must already be removed from p.queue.
+func (p *Processor) prefetchFrontier(head *Node) {
+	if !p.parallelEnabled() || head.prefetched != nil {
+		return
+	}
+	queue, ok := p.queue.(*lib.Queue[*Node])
+	if !ok {
+		return
+	}
+	window := []*Node{head}
+	window = append(window, queue.PeekN(p.workers*prefetchWindowPerWorker-1)...)
+	p.prefetch(window)
+}
+
+// prefetchPending is the processed-queue mode counterpart of
+// prefetchFrontier: it prefetches the head of pendingActionStarts together
+// with the following window.
+func (p *Processor) prefetchPending() {
+	if !p.parallelEnabled() || len(p.pendingActionStarts) == 0 || p.pendingActionStarts[0].prefetched != nil {
+		return
+	}
+	n := min(len(p.pendingActionStarts), p.workers*prefetchWindowPerWorker)
+	p.prefetch(p.pendingActionStarts[:n])
+}
+
+// prefetch executes the eligible nodes concurrently on up to p.workers
+// goroutines and stores each result on the node.
+func (p *Processor) prefetch(nodes []*Node) {
+	eligible := make([]*Node, 0, len(nodes))
+	for _, node := range nodes {
+		if p.canPrefetch(node) {
+			eligible = append(eligible, node)
+		}
+	}
+	if len(eligible) == 0 {
+		return
+	}
+	var next atomic.Int64
+	var wg sync.WaitGroup
+	for w := 0; w < min(p.workers, len(eligible)); w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				i := int(next.Add(1)) - 1
+				if i >= len(eligible) {
+					return
+				}
+				eligible[i].prefetched = p.executeAndHash(eligible[i])
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+// canPrefetch reports whether node can be executed ahead of its turn
+// without observing or mutating state shared with other nodes.
+//
+// Thread.Execute reads the parent process's Enabled flag and may set it
+// (propagateEnabled). Once the parent is enabled that flag never changes
+// again, so the result is the same whenever the node runs; nodes whose
+// parent is still disabled are left for the coordinating goroutine.
+func (p *Processor) canPrefetch(node *Node) bool {
+	if node.prefetched != nil || node.Process == nil {
+		return false
+	}
+	if node.actionDepth > int(p.config.Options.MaxActions) {
+		return false
+	}
+	if node.Process.currentThread().currentPc() == "" && node.Name == "init" {
+		return false
+	}
+	return node.Process.Parent == nil || node.Process.Parent.Enabled
+}
+
+func (p *Processor) executeAndHash(node *Node) (result *prefetchResult) {
+	result = &prefetchResult{}
+	defer func() {
+		if r := recover(); r != nil {
+			result.panicked = r
+		}
+	}()
+	p.recordParentEnabled(node)
+	node.CachedHashCode = ""
+	result.forks, result.yield = node.currentThread().Execute()
+	if len(result.forks) == 0 && !node.Enabled && !node.ThreadProgress {
+		return result
+	}
+	result.canonicalHash = p.canonicalHash(node)
+	return result
+}
+
+// takePrefetched returns and clears the node's prefetched result, re-raising
+// a panic recovered on the worker.
+func (n *Node) takePrefetched() *prefetchResult {
+	result := n.prefetched
+	if result == nil {
+		return nil
+	}
+	n.prefetched = nil
+	if result.panicked != nil {
+		panic(result.panicked)
+	}
+	return result
+}
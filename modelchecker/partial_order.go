@@ -0,0 +1,853 @@
+package modelchecker
+
+import (
+	ast "fizz/proto"
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+
+	"go.starlark.net/syntax"
+)
+
+// Partial-order reduction skips interleavings of role actions that commute.
+//
+// At a yield point where no action is in progress and no message is in
+// flight, the successors are action-starts. If one role instance's actions
+// are independent of every other transition and invisible to the assertions,
+// exploring only that instance's actions (its ample set) reaches every state
+// the assertions and the deadlock check can tell apart from the full graph.
+//
+// A role type qualifies when, judged statically from the spec:
+//   - its actions and functions touch only the role's own fields, their own
+//     locals, and globals no action writes; they create no roles and call no
+//     other role or global function (so they commute with everything else);
+//   - no code outside the role reads or writes its fields or calls its
+//     functions;
+//   - no assertion reads a field it writes (invisibility);
+//   - it has no per-action limits in the options.
+//
+// The spec as a whole must have only atomic actions and functions, so that
+// starting an action never waits on max_concurrent_actions, and no liveness
+// assertions. At run time the ample set is taken only if it reaches at least
+// one new state and no visited one (the cycle proviso); otherwise the yield
+// point is fully expanded.
+
+type partialOrder struct {
+	// independent holds the role types whose instances may form an ample
+	// set.
+	independent map[string]bool
+	// notes explains, per role type, whether it is reduced.
+	notes []string
+
+	expansions int
+	reduced    int
+}
+
+// SetPartialOrderReduction enables partial-order reduction. Must be called
+// before Start; only the processed-queue mode applies it. Returns an error if
+// the spec has liveness assertions or the options ltl or leads_to
+// properties, which the reduction does not preserve.
+func (p *Processor) SetPartialOrderReduction() error {
+	if ltl := p.config.GetLtl(); len(ltl) > 0 {
+		return fmt.Errorf("partial-order reduction does not preserve liveness, but the options declare ltl property '%s'", ltlName(ltl[0]))
+	}
+	if leadsTo := p.config.GetLeadsTo(); len(leadsTo) > 0 {
+		return fmt.Errorf("partial-order reduction does not preserve liveness, but the options declare leads_to property '%s'", leadsToName(leadsTo[0]))
+	}
+	for _, file := range p.Files {
+		for _, invariant := range file.Invariants {
+			if isLivenessInvariant(invariant) {
+				return fmt.Errorf("partial-order reduction does not preserve liveness, but the spec declares liveness assertion '%s'", invariantName(invariant))
+			}
+		}
+		for _, role := range file.Roles {
+			for _, invariant := range role.Invariants {
+				if isLivenessInvariant(invariant) {
+					return fmt.Errorf("partial-order reduction does not preserve liveness, but role %s declares liveness assertion '%s'", role.Name, invariantName(invariant))
+				}
+			}
+		}
+	}
+	p.por = analyzePartialOrder(p.Files, p.config)
+	return nil
+}
+
+// PartialOrderNotes explains which role types partial-order reduction
+// applies to, and why not for the others.
+func (p *Processor) PartialOrderNotes() []string {
+	if p.por == nil {
+		return nil
+	}
+	return p.por.notes
+}
+
+func isLivenessInvariant(invariant *ast.Invariant) bool {
+	return slices.Contains(invariantOperators(invariant), "eventually")
+}
+
+func ltlName(property *ast.LtlProperty) string {
+	if property.GetName() != "" {
+		return property.GetName()
+	}
+	return property.GetFormula()
+}
+
+func leadsToName(property *ast.LeadsTo) string {
+	if property.GetName() != "" {
+		return property.GetName()
+	}
+	return property.GetP() + " ~> " + property.GetQ()
+}
+
+func invariantName(invariant *ast.Invariant) string {
+	if invariant.Name != "" {
+		return invariant.Name
+	}
+	return invariant.PyExpr
+}
+
+// drainAmple is drainAndFlush for a yield-point expansion under
+// partial-order reduction. It tries the action-starts of each independent
+// role instance in turn, and keeps the first group that reaches a new state
+// and no visited one; the other action-starts are dropped. If no group
+// qualifies, everything left is expanded.
+func (p *Processor) drainAmple(quiescent bool, startTime time.Time, prevCount *int, failedNode *Node) (earlyReturn bool, newFailedNode *Node) {
+	p.por.expansions++
+	var groups [][]*Node
+	if quiescent {
+		groups = p.por.ampleCandidates(p.pendingActionStarts)
+	}
+	if groups == nil {
+		return p.drainAndFlush(startTime, prevCount, failedNode)
+	}
+	rest := slices.DeleteFunc(p.pendingActionStarts, func(n *Node) bool {
+		for _, group := range groups {
+			if slices.Contains(group, n) {
+				return true
+			}
+		}
+		return false
+	})
+	newFailedNode = failedNode
+	for i, group := range groups {
+		queueLen, dedupHits := p.queue.Len(), p.dedupHitsInExpansion
+		p.pendingActionStarts = group
+		earlyReturn, newFailedNode = p.drainAndFlush(startTime, prevCount, newFailedNode)
+		if earlyReturn {
+			return true, newFailedNode
+		}
+		if p.dedupHitsInExpansion > dedupHits {
+			// The group closes a cycle or joins a visited state, so it
+			// could postpone the other transitions forever.
+			for _, later := range groups[i+1:] {
+				rest = append(rest, later...)
+			}
+			break
+		}
+		if p.queue.Len() > queueLen {
+			p.por.reduced++
+			return false, newFailedNode
+		}
+		// Every action of the group was disabled; try the next one.
+	}
+	p.pendingActionStarts = rest
+	return p.drainAndFlush(startTime, prevCount, newFailedNode)
+}
+
+// ampleCandidates groups the action-starts of the independent role
+// instances, in scheduling order. Returns nil if there are none, or if any
+// pending node is not an action-start (a thread continuation or a message).
+func (po *partialOrder) ampleCandidates(pending []*Node) [][]*Node {
+	var groups [][]*Node
+	index := map[string]int{}
+	for _, n := range pending {
+		role, ok := actionStartRole(n)
+		if !ok {
+			return nil
+		}
+		if role == "" || !po.independent[strings.SplitN(role, "#", 2)[0]] {
+			continue
+		}
+		i, found := index[role]
+		if !found {
+			i = len(groups)
+			index[role] = i
+			groups = append(groups, nil)
+		}
+		groups[i] = append(groups[i], n)
+	}
+	return groups
+}
+
+// actionStartRole returns the role instance (e.g. Counter#0) whose action n
+// starts, or "" for a top-level action. ok is false if n is not an
+// action-start.
+func actionStartRole(n *Node) (role string, ok bool) {
+	if n.ThreadProgress || n.Process == nil || len(n.Process.Threads) == 0 {
+		return "", false
+	}
+	frame := n.currentThread().currentFrame()
+	switch {
+	case strings.HasPrefix(frame.pc, "Actions[") && !strings.Contains(frame.pc, "."):
+		return "", true
+	case strings.HasPrefix(frame.pc, "Roles[") && frame.obj != nil &&
+		strings.Count(frame.pc, ".") == 1 && strings.Contains(frame.pc, "].Actions["):
+		return frame.obj.RefStringShort(), true
+	}
+	return "", false
+}
+
+// printPartialOrderSummary reports how many expansions were reduced.
+func (p *Processor) printPartialOrderSummary() {
+	if p.por == nil || !p.experimentalProcessedQueue {
+		return
+	}
+	fmt.Printf("Partial-order reduction: %d of %d expansions reduced\n", p.por.reduced, p.por.expansions)
+}
+
+// codeUnit is what one action, function, assertion or code block reads,
+// writes and calls, as far as it can be told from the source.
+type codeUnit struct {
+	// bound holds the names assigned, including loop variables.
+	bound map[string]bool
+	// used holds every name referenced.
+	used map[string]bool
+	// selfReads and selfWrites hold the fields accessed as self.<field>.
+	selfReads  map[string]bool
+	selfWrites map[string]bool
+	// attrs holds the attributes accessed on anything but self.
+	attrs map[string]bool
+	// mutated holds the names whose value is modified in place: the root
+	// of an assignment target or of a method call, or an argument to a
+	// function of the spec.
+	mutated map[string]bool
+	// selfCalls holds the functions called on self.
+	selfCalls map[string]bool
+	// globalCalls holds the functions of the spec called without a
+	// receiver; roleCalls the functions called on another receiver.
+	globalCalls map[string]bool
+	roleCalls   map[string]bool
+	// passesSelf is set when self is passed to a function of the spec.
+	passesSelf bool
+	nonAtomic  bool
+	unparsable bool
+}
+
+func newCodeUnit() *codeUnit {
+	return &codeUnit{
+		bound:       map[string]bool{},
+		used:        map[string]bool{},
+		selfReads:   map[string]bool{},
+		selfWrites:  map[string]bool{},
+		attrs:       map[string]bool{},
+		mutated:     map[string]bool{},
+		selfCalls:   map[string]bool{},
+		globalCalls: map[string]bool{},
+		roleCalls:   map[string]bool{},
+	}
+}
+
+type porAnalyzer struct {
+	opts *syntax.FileOptions
+	// globals are the names bound at the top level: state variables,
+	// functions, roles, imports and Python definitions.
+	globals map[string]bool
+}
+
+func (a *porAnalyzer) action(action *ast.Action) *codeUnit {
+	u := newCodeUnit()
+	if action.Flow != ast.Flow_FLOW_ATOMIC && action.Flow != ast.Flow_FLOW_ONEOF {
+		u.nonAtomic = true
+	}
+	a.block(u, action.Block)
+	return u
+}
+
+func (a *porAnalyzer) function(function *ast.Function) *codeUnit {
+	u := newCodeUnit()
+	if function.Flow != ast.Flow_FLOW_ATOMIC && function.Flow != ast.Flow_FLOW_ONEOF {
+		u.nonAtomic = true
+	}
+	for _, param := range function.Params {
+		u.bound[param.Name] = true
+		a.expr(u, param.DefaultPyExpr)
+	}
+	a.block(u, function.Block)
+	return u
+}
+
+func (a *porAnalyzer) invariant(invariant *ast.Invariant) *codeUnit {
+	u := newCodeUnit()
+	for inv := invariant; inv != nil; inv = inv.Nested {
+		switch {
+		case inv.PyCode != "":
+			a.code(u, inv.PyCode)
+		case inv.Block != nil:
+			a.block(u, inv.Block)
+		default:
+			a.expr(u, inv.PyExpr)
+		}
+	}
+	return u
+}
+
+func (a *porAnalyzer) block(u *codeUnit, b *ast.Block) {
+	if b == nil {
+		return
+	}
+	a.flow(u, b.Flow)
+	for _, stmt := range b.Stmts {
+		a.stmt(u, stmt)
+	}
+}
+
+func (a *porAnalyzer) flow(u *codeUnit, flow ast.Flow) {
+	if flow == ast.Flow_FLOW_SERIAL || flow == ast.Flow_FLOW_PARALLEL {
+		u.nonAtomic = true
+	}
+}
+
+func (a *porAnalyzer) stmt(u *codeUnit, s *ast.Statement) {
+	switch {
+	case s.PyStmt != nil:
+		a.code(u, s.PyStmt.Code)
+	case s.Block != nil:
+		a.block(u, s.Block)
+	case s.IfStmt != nil:
+		a.flow(u, s.IfStmt.Flow)
+		for _, branch := range s.IfStmt.Branches {
+			a.expr(u, branch.Condition)
+			a.block(u, branch.Block)
+		}
+	case s.ForStmt != nil:
+		a.flow(u, s.ForStmt.Flow)
+		for _, v := range s.ForStmt.LoopVars {
+			u.bound[v] = true
+		}
+		a.expr(u, s.ForStmt.PyExpr)
+		a.block(u, s.ForStmt.Block)
+	case s.AnyStmt != nil:
+		a.flow(u, s.AnyStmt.Flow)
+		for _, v := range s.AnyStmt.LoopVars {
+			u.bound[v] = true
+		}
+		a.expr(u, s.AnyStmt.PyExpr)
+		a.expr(u, s.AnyStmt.Condition)
+		a.block(u, s.AnyStmt.Block)
+	case s.WhileStmt != nil:
+		a.flow(u, s.WhileStmt.Flow)
+		a.expr(u, s.WhileStmt.PyExpr)
+		a.block(u, s.WhileStmt.Block)
+	case s.ReturnStmt != nil:
+		a.expr(u, s.ReturnStmt.PyExpr)
+	case s.RequireStmt != nil:
+		a.expr(u, s.RequireStmt.Condition)
+	case s.CallStmt != nil:
+		call := s.CallStmt
+		for _, v := range call.Vars {
+			u.bound[v] = true
+		}
+		switch call.Receiver {
+		case "":
+			u.globalCalls[call.Name] = true
+		case "self":
+			u.selfCalls[call.Name] = true
+		default:
+			u.roleCalls[call.Name] = true
+			a.expr(u, call.Receiver)
+		}
+		for _, arg := range call.Args {
+			a.expr(u, arg.PyExpr)
+			a.markArgument(u, arg.PyExpr)
+		}
+	}
+}
+
+// markArgument records an argument to a function of the spec, which may
+// modify it.
+func (a *porAnalyzer) markArgument(u *codeUnit, src string) {
+	if src == "" {
+		return
+	}
+	e, err := a.opts.ParseExpr("", src, 0)
+	if err != nil {
+		u.unparsable = true
+		return
+	}
+	a.argument(u, e)
+}
+
+func (a *porAnalyzer) argument(u *codeUnit, e syntax.Expr) {
+	if field, ok := selfField(e); ok {
+		u.selfWrites[field] = true
+	} else if id, ok := e.(*syntax.Ident); ok && id.Name == "self" {
+		u.passesSelf = true
+	} else if root := rootName(e); root != "" {
+		u.mutated[root] = true
+	}
+}
+
+func (a *porAnalyzer) code(u *codeUnit, src string) {
+	if src == "" {
+		return
+	}
+	f, err := a.opts.Parse("", src, 0)
+	if err != nil {
+		u.unparsable = true
+		return
+	}
+	for _, stmt := range f.Stmts {
+		a.visit(u, stmt)
+	}
+}
+
+func (a *porAnalyzer) expr(u *codeUnit, src string) {
+	if src == "" {
+		return
+	}
+	e, err := a.opts.ParseExpr("", src, 0)
+	if err != nil {
+		u.unparsable = true
+		return
+	}
+	a.visit(u, e)
+}
+
+func (a *porAnalyzer) visit(u *codeUnit, n syntax.Node) {
+	syntax.Walk(n, func(n syntax.Node) bool {
+		switch n := n.(type) {
+		case *syntax.Ident:
+			u.used[n.Name] = true
+		case *syntax.AssignStmt:
+			a.target(u, n.LHS)
+		case *syntax.ForStmt:
+			a.target(u, n.Vars)
+		case *syntax.ForClause:
+			a.bind(u, n.Vars)
+		case *syntax.DefStmt:
+			u.bound[n.Name.Name] = true
+			for _, param := range n.Params {
+				a.bind(u, param)
+			}
+		case *syntax.LambdaExpr:
+			for _, param := range n.Params {
+				a.bind(u, param)
+			}
+		case *syntax.LoadStmt:
+			for _, to := range n.To {
+				u.bound[to.Name] = true
+			}
+		case *syntax.CallExpr:
+			switch fn := n.Fn.(type) {
+			case *syntax.DotExpr:
+				if id, ok := fn.X.(*syntax.Ident); ok && id.Name == "self" {
+					u.selfCalls[fn.Name.Name] = true
+				} else if field, ok := selfField(fn.X); ok {
+					u.selfWrites[field] = true
+				} else if root := rootName(fn.X); root != "" {
+					u.mutated[root] = true
+				}
+			case *syntax.Ident:
+				if a.globals[fn.Name] {
+					for _, arg := range n.Args {
+						a.argument(u, keywordValue(arg))
+					}
+				}
+			}
+			a.visit(u, n.Fn)
+			for _, arg := range n.Args {
+				a.visit(u, keywordValue(arg))
+			}
+			return false
+		case *syntax.DotExpr:
+			// The attribute name is not a variable reference.
+			if id, ok := n.X.(*syntax.Ident); ok && id.Name == "self" {
+				u.selfReads[n.Name.Name] = true
+			} else {
+				u.attrs[n.Name.Name] = true
+			}
+			a.visit(u, n.X)
+			return false
+		}
+		return true
+	})
+}
+
+// keywordValue returns the value of a keyword argument name=value, or arg
+// itself.
+func keywordValue(arg syntax.Expr) syntax.Expr {
+	if b, ok := arg.(*syntax.BinaryExpr); ok && b.Op == syntax.EQ {
+		return b.Y
+	}
+	return arg
+}
+
+// target records the names and fields an assignment to e writes.
+func (a *porAnalyzer) target(u *codeUnit, e syntax.Expr) {
+	switch e := e.(type) {
+	case *syntax.Ident:
+		u.bound[e.Name] = true
+	case *syntax.ParenExpr:
+		a.target(u, e.X)
+	case *syntax.TupleExpr:
+		for _, x := range e.List {
+			a.target(u, x)
+		}
+	case *syntax.ListExpr:
+		for _, x := range e.List {
+			a.target(u, x)
+		}
+	default:
+		if field, ok := selfField(e); ok {
+			u.selfWrites[field] = true
+		} else if root := rootName(e); root != "" {
+			u.mutated[root] = true
+		}
+	}
+}
+
+// bind records the names a comprehension or parameter list binds.
+func (a *porAnalyzer) bind(u *codeUnit, e syntax.Node) {
+	syntax.Walk(e, func(n syntax.Node) bool {
+		if id, ok := n.(*syntax.Ident); ok {
+			u.bound[id.Name] = true
+		}
+		return true
+	})
+}
+
+// selfField returns the field f of an expression rooted at self.f, such as
+// self.f, self.f[k] or self.f.g.
+func selfField(e syntax.Expr) (string, bool) {
+	for {
+		switch x := e.(type) {
+		case *syntax.DotExpr:
+			if id, ok := x.X.(*syntax.Ident); ok && id.Name == "self" {
+				return x.Name.Name, true
+			}
+			e = x.X
+		case *syntax.IndexExpr:
+			e = x.X
+		case *syntax.SliceExpr:
+			e = x.X
+		case *syntax.ParenExpr:
+			e = x.X
+		default:
+			return "", false
+		}
+	}
+}
+
+// rootName returns the name an attribute or index expression is rooted at.
+func rootName(e syntax.Expr) string {
+	for {
+		switch x := e.(type) {
+		case *syntax.Ident:
+			return x.Name
+		case *syntax.DotExpr:
+			e = x.X
+		case *syntax.IndexExpr:
+			e = x.X
+		case *syntax.SliceExpr:
+			e = x.X
+		case *syntax.ParenExpr:
+			e = x.X
+		default:
+			return ""
+		}
+	}
+}
+
+// roleCode is the analyzed code of one role type.
+type roleCode struct {
+	role      *ast.Role
+	init      *codeUnit
+	actions   []*codeUnit
+	functions []*codeUnit
+	// names holds the names of the actions, then of the functions.
+	names []string
+	// members holds the role's fields and functions.
+	members map[string]bool
+}
+
+func (rc *roleCode) units() []*codeUnit {
+	units := append([]*codeUnit{}, rc.actions...)
+	return append(units, rc.functions...)
+}
+
+func analyzePartialOrder(files []*ast.File, config *ast.StateSpaceOptions) *partialOrder {
+	po := &partialOrder{independent: map[string]bool{}}
+	if len(files) != 1 || len(files[0].Refinements) > 0 || files[0].Composition != nil {
+		po.notes = append(po.notes, "not applied: only single specs are supported")
+		return po
+	}
+	file := files[0]
+	a := &porAnalyzer{
+		opts:    &syntax.FileOptions{Set: true, While: true, TopLevelControl: true, GlobalReassign: true, Recursion: true},
+		globals: map[string]bool{},
+	}
+
+	// The top level: everything it binds is a global.
+	top := newCodeUnit()
+	a.code(top, file.GetStates().GetCode())
+	for _, stmt := range file.Stmts {
+		a.stmt(top, stmt)
+	}
+	for _, code := range file.PyCode {
+		a.code(top, code)
+	}
+	for _, action := range file.Actions {
+		if action.Name == "Init" {
+			a.block(top, action.Block)
+		}
+	}
+	for name := range top.bound {
+		a.globals[name] = true
+	}
+	for _, imp := range file.Imports {
+		a.globals[imp.Alias] = true
+		a.globals[getFileNameWithoutExt(imp.Path)] = true
+	}
+	roleNames := map[string]bool{}
+	for _, role := range file.Roles {
+		a.globals[role.Name] = true
+		roleNames[role.Name] = true
+	}
+	for _, function := range file.Functions {
+		a.globals[function.Name] = true
+	}
+	delete(a.globals, "")
+
+	// Every unit whose effects matter after Init, with the globals known.
+	var actions []*codeUnit
+	var actionNames []string
+	for _, action := range file.Actions {
+		if action.Name != "Init" {
+			actions = append(actions, a.action(action))
+			actionNames = append(actionNames, action.Name)
+		}
+	}
+	var functions []*codeUnit
+	for _, function := range file.Functions {
+		functions = append(functions, a.function(function))
+	}
+	pyCode := newCodeUnit()
+	for _, code := range file.PyCode {
+		a.code(pyCode, code)
+	}
+	roles := make([]*roleCode, len(file.Roles))
+	allMembers := map[string]bool{}
+	for i, role := range file.Roles {
+		rc := &roleCode{role: role, init: newCodeUnit(), members: map[string]bool{}}
+		a.code(rc.init, role.GetStates().GetCode())
+		for name := range rc.init.bound {
+			rc.members[name] = true
+		}
+		for _, action := range role.Actions {
+			if action.Name == "Init" {
+				a.block(rc.init, action.Block)
+				continue
+			}
+			rc.actions = append(rc.actions, a.action(action))
+			rc.names = append(rc.names, action.Name)
+		}
+		for _, function := range role.Functions {
+			rc.functions = append(rc.functions, a.function(function))
+			rc.names = append(rc.names, function.Name)
+			rc.members[function.Name] = true
+		}
+		for _, u := range append(rc.units(), rc.init) {
+			for f := range u.selfReads {
+				rc.members[f] = true
+			}
+			for f := range u.selfWrites {
+				rc.members[f] = true
+			}
+		}
+		for m := range rc.members {
+			allMembers[m] = true
+		}
+		roles[i] = rc
+	}
+
+	// Globals some unit writes after Init.
+	mutable := map[string]bool{}
+	var writers []*codeUnit
+	writers = append(writers, actions...)
+	writers = append(writers, functions...)
+	for _, rc := range roles {
+		writers = append(writers, rc.init)
+		writers = append(writers, rc.units()...)
+	}
+	for _, u := range writers {
+		for name := range u.bound {
+			if a.globals[name] {
+				mutable[name] = true
+			}
+		}
+		for name := range u.mutated {
+			if a.globals[name] {
+				mutable[name] = true
+			}
+		}
+	}
+
+	// Fields the assertions read.
+	asserted := map[string]bool{}
+	addAsserted := func(u *codeUnit) {
+		for f := range u.attrs {
+			asserted[f] = true
+		}
+		for f := range u.selfReads {
+			asserted[f] = true
+		}
+	}
+	for _, invariant := range file.Invariants {
+		addAsserted(a.invariant(invariant))
+	}
+	for _, role := range file.Roles {
+		for _, invariant := range role.Invariants {
+			addAsserted(a.invariant(invariant))
+		}
+	}
+	addAsserted(pyCode)
+
+	var spec []string
+	for i, u := range actions {
+		if u.nonAtomic {
+			spec = append(spec, fmt.Sprintf("action %s is not atomic", actionNames[i]))
+		}
+	}
+	for i, u := range functions {
+		if u.nonAtomic {
+			spec = append(spec, fmt.Sprintf("function %s is not atomic", file.Functions[i].Name))
+		}
+	}
+	for _, rc := range roles {
+		for i, u := range rc.units() {
+			if u.nonAtomic {
+				spec = append(spec, fmt.Sprintf("%s.%s is not atomic", rc.role.Name, rc.names[i]))
+			}
+		}
+	}
+	if len(spec) > 0 {
+		sort.Strings(spec)
+		po.notes = append(po.notes, "not applied: "+spec[0]+" (every action and function must be atomic)")
+		return po
+	}
+
+	for _, rc := range roles {
+		reason := a.dependence(rc, roles, actions, functions, pyCode, mutable, roleNames, allMembers, asserted, config)
+		if reason == "" {
+			po.independent[rc.role.Name] = true
+			po.notes = append(po.notes, fmt.Sprintf("role %s: reduced", rc.role.Name))
+		} else {
+			po.notes = append(po.notes, fmt.Sprintf("role %s: not reduced, %s", rc.role.Name, reason))
+		}
+	}
+	if len(roles) == 0 {
+		po.notes = append(po.notes, "not applied: the spec has no roles")
+	}
+	return po
+}
+
+// dependence returns why the actions of role type rc may not form an ample
+// set, or "" if they may.
+func (a *porAnalyzer) dependence(rc *roleCode, roles []*roleCode, actions, functions []*codeUnit, pyCode *codeUnit,
+	mutable, roleNames, allMembers, asserted map[string]bool, config *ast.StateSpaceOptions) string {
+	name := rc.role.Name
+	if len(rc.actions) == 0 {
+		return "it has no actions"
+	}
+	for key := range config.GetActionOptions() {
+		if strings.HasPrefix(key, name+".") || strings.HasPrefix(key, name+"#") {
+			return "it has per-action limits"
+		}
+	}
+	functionNames := map[string]bool{}
+	for _, function := range rc.role.Functions {
+		functionNames[function.Name] = true
+	}
+	for i, u := range rc.units() {
+		where := rc.names[i]
+		if u.unparsable {
+			return fmt.Sprintf("%s could not be analyzed", where)
+		}
+		for _, n := range sortedKeys(u.bound) {
+			if a.globals[n] {
+				return fmt.Sprintf("%s writes global %s", where, n)
+			}
+		}
+		for _, n := range sortedKeys(u.used) {
+			switch {
+			case u.bound[n]:
+			case roleNames[n]:
+				return fmt.Sprintf("%s refers to role %s", where, n)
+			case mutable[n]:
+				return fmt.Sprintf("%s reads global %s, which actions write", where, n)
+			}
+		}
+		for _, attr := range sortedKeys(u.attrs) {
+			if allMembers[attr] {
+				return fmt.Sprintf("%s accesses %s of another role", where, attr)
+			}
+		}
+		if len(u.globalCalls) > 0 {
+			return fmt.Sprintf("%s calls function %s", where, sortedKeys(u.globalCalls)[0])
+		}
+		if len(u.roleCalls) > 0 {
+			return fmt.Sprintf("%s calls %s on another role", where, sortedKeys(u.roleCalls)[0])
+		}
+		for _, f := range sortedKeys(u.selfCalls) {
+			if !functionNames[f] {
+				return fmt.Sprintf("%s calls self.%s, which is not a function of the role", where, f)
+			}
+		}
+		if u.passesSelf {
+			return fmt.Sprintf("%s passes self to a function", where)
+		}
+	}
+
+	// Nothing outside the role may touch its fields or call its functions.
+	outside := []*codeUnit{pyCode}
+	outside = append(outside, actions...)
+	outside = append(outside, functions...)
+	for _, other := range roles {
+		if other != rc {
+			outside = append(outside, other.init)
+			outside = append(outside, other.units()...)
+		}
+	}
+	for _, u := range outside {
+		for _, attr := range sortedKeys(u.attrs) {
+			if rc.members[attr] {
+				return fmt.Sprintf("%s is accessed outside the role", attr)
+			}
+		}
+		for _, f := range sortedKeys(u.roleCalls) {
+			if functionNames[f] {
+				return fmt.Sprintf("%s is called from outside the role", f)
+			}
+		}
+	}
+
+	for _, u := range rc.units() {
+		for _, f := range sortedKeys(u.selfWrites) {
+			if asserted[f] {
+				return fmt.Sprintf("it writes %s, which an assertion reads", f)
+			}
+		}
+	}
+	return ""
+}
+
+func sortedKeys(m map[string]bool) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
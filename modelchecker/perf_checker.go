@@ -89,7 +89,7 @@ func genCounterMatrices(nodes []*Node, model *proto.PerformanceModel) map[string
                     continue
                 }
                 for name, counter := range config.Counters {
-                    matrices[name][indexMap[node]][indexMap[outboundLink.Node]] += counter.GetNumeric()
+                    matrices[name][indexMap[node]][indexMap[outboundLink.Node]] += counterMean(counter)
                 }
             }
 
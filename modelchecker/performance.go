@@ -0,0 +1,221 @@
+package modelchecker
+
+import (
+	ast "fizz/proto"
+	"fmt"
+	"slices"
+	"sort"
+)
+
+// PerformanceReport is the Markov chain analysis of the state graph of a
+// passing model check, with the branch probabilities and counters of a
+// performance model.
+type PerformanceReport struct {
+	// Nodes is the number of nodes of the graph, including the ones
+	// between yields.
+	Nodes int `json:"nodes"`
+	// SteadyState holds the states the chain ends up in from the initial
+	// state, most likely first.
+	SteadyState []StateProbability `json:"steady_state"`
+	// MeanCounters is the expected value of each counter accumulated on the
+	// way to the steady state.
+	MeanCounters map[string]float64  `json:"mean_counters"`
+	Histogram    []CounterPercentile `json:"histogram,omitempty"`
+	// Distributions holds the distribution of each counter on the way to
+	// the steady state, with the counter values drawn from their
+	// distributions in the performance model.
+	Distributions map[string]*CounterDistribution `json:"distributions,omitempty"`
+	// Liveness holds the analysis of each assertion with an eventually
+	// operator, in the order of the spec.
+	Liveness []LivenessPerformance `json:"liveness,omitempty"`
+}
+
+// StateProbability is the steady-state probability of a node. Node is the
+// index of the node in the nodes_*.pb files.
+type StateProbability struct {
+	Node        int     `json:"node"`
+	Probability float64 `json:"probability"`
+	State       string  `json:"state"`
+	Returns     string  `json:"returns,omitempty"`
+}
+
+// CounterPercentile is a point of the cumulative distribution of the
+// counters: with probability Probability the chain has terminated by the
+// time the counters reach Counters.
+type CounterPercentile struct {
+	Probability float64            `json:"probability"`
+	Counters    map[string]float64 `json:"counters"`
+}
+
+// LivenessPerformance is the analysis of a liveness assertion. For an
+// eventually-always assertion, Probability is the share of the terminal
+// steady state where the assertion holds. Otherwise, it is the probability
+// of reaching a state where it holds, starting from a uniformly chosen
+// state, and the counters are the costs of getting there.
+type LivenessPerformance struct {
+	Assertion         string              `json:"assertion"`
+	TemporalOperators []string            `json:"temporal_operators"`
+	Probability       float64             `json:"probability"`
+	MeanCounters      map[string]float64  `json:"mean_counters,omitempty"`
+	Histogram         []CounterPercentile `json:"histogram,omitempty"`
+}
+
+// PerformanceOptions configures AnalyzePerformance.
+type PerformanceOptions struct {
+	// Method is one of the PerfMethod constants.
+	Method string
+	// Samples is the number of Monte Carlo walks that estimate the counter
+	// distributions, or 0 to skip them.
+	Samples int
+	Seed    int64
+}
+
+// AnalyzePerformance runs the steady-state and absorption-cost analysis on
+// nodes, as returned by GetAllNodes for the graph of file, along with
+// yields, the number of yield nodes. A nil model makes every branch of a
+// node equally likely and has no counters. The chain is kept sparse, so it
+// scales with the number of links rather than the square of the number of
+// nodes.
+func AnalyzePerformance(file *ast.File, nodes []*Node, yields int, model *ast.PerformanceModel, options PerformanceOptions) *PerformanceReport {
+	if model == nil {
+		model = &ast.PerformanceModel{}
+	}
+	report := &PerformanceReport{Nodes: len(nodes)}
+	if len(nodes) == 0 {
+		return report
+	}
+	initialDistribution := make([]float64, len(nodes))
+	initialDistribution[0] = 1.0
+	chain := newSparseChain(nodes, model)
+	steadyState, histogram := chain.analyze(initialDistribution, options.Method)
+	report.MeanCounters = histogram.GetMeanCounts()
+	report.Histogram = counterPercentiles(histogram)
+	report.Distributions = sampleCounterDistributions(chain, model, initialDistribution, options.Samples, options.Seed)
+	for i, prob := range steadyState {
+		if prob > 1e-6 && nodes[i].Process != nil {
+			report.SteadyState = append(report.SteadyState, StateProbability{
+				Node:        i,
+				Probability: prob,
+				State:       nodes[i].Heap.String(),
+				Returns:     nodes[i].Returns.String(),
+			})
+		}
+	}
+	sort.SliceStable(report.SteadyState, func(i, j int) bool {
+		return report.SteadyState[i].Probability > report.SteadyState[j].Probability
+	})
+
+	for k, inv := range file.Invariants {
+		operators := invariantOperators(inv)
+		if !slices.Contains(operators, "eventually") {
+			continue
+		}
+		liveness := LivenessPerformance{Assertion: inv.Name, TemporalOperators: operators}
+		if liveness.Assertion == "" {
+			// Invariants listed in the front matter have no name.
+			liveness.Assertion = fmt.Sprintf("invariant %d", k)
+		}
+		if len(operators) == 2 && operators[0] == "eventually" && operators[1] == "always" {
+			terminal, live := 0.0, 0.0
+			for i, prob := range steadyState {
+				if nodes[i].Process == nil || nodes[i].Process.GetThreadsCount() != 0 {
+					continue
+				}
+				terminal += prob
+				if nodes[i].Witness[0][k] {
+					live += prob
+				}
+			}
+			if terminal > 0 {
+				liveness.Probability = live / terminal
+			}
+		} else {
+			absorbed, histogram := newAbsorbingChain(nodes, model, 0, k).analyze(absorptionStart(nodes, yields), options.Method)
+			for i, prob := range absorbed {
+				if nodes[i].Process != nil && nodes[i].Witness[0][k] {
+					liveness.Probability += prob
+				}
+			}
+			liveness.MeanCounters = histogram.GetMeanCounts()
+			liveness.Histogram = counterPercentiles(histogram)
+		}
+		report.Liveness = append(report.Liveness, liveness)
+	}
+	return report
+}
+
+// absorptionStart is the uniform distribution over the init and yield
+// nodes, where the absorption analysis starts.
+func absorptionStart(nodes []*Node, yields int) []float64 {
+	initialDistribution := make([]float64, len(nodes))
+	for i, node := range nodes {
+		if node.Name == "init" || node.Name == "yield" {
+			initialDistribution[i] = 1.0 / float64(yields+1)
+		}
+	}
+	return initialDistribution
+}
+
+func counterPercentiles(histogram *Histogram) []CounterPercentile {
+	var percentiles []CounterPercentile
+	for _, entry := range histogram.GetAllHistogram() {
+		percentiles = append(percentiles, CounterPercentile{Probability: entry.percentile, Counters: entry.counters})
+	}
+	return percentiles
+}
+
+// CounterNames returns the names of the counters in the report, sorted.
+func (r *PerformanceReport) CounterNames() []string {
+	names := map[string]bool{}
+	for name := range r.MeanCounters {
+		names[name] = true
+	}
+	for _, liveness := range r.Liveness {
+		for name := range liveness.MeanCounters {
+			names[name] = true
+		}
+	}
+	sorted := make([]string, 0, len(names))
+	for name := range names {
+		sorted = append(sorted, name)
+	}
+	sort.Strings(sorted)
+	return sorted
+}
+
+// PrintReport prints the mean counters, the most likely steady states and the
+// liveness probabilities.
+func (r *PerformanceReport) PrintReport() {
+	fmt.Println("Performance analysis:")
+	for _, name := range r.CounterNames() {
+		if mean, ok := r.MeanCounters[name]; ok {
+			fmt.Printf("  mean %s: %.6f\n", name, mean)
+		}
+	}
+	for _, name := range r.CounterNames() {
+		if d, ok := r.Distributions[name]; ok {
+			fmt.Printf("  %s distribution (%d samples): mean %.6f, stddev %.6f, min %.6f", name, d.Samples, d.Mean, d.StdDev, d.Min)
+			for _, q := range d.Percentiles {
+				fmt.Printf(", p%g %.6f", q.Percentile*100, q.Value)
+			}
+			fmt.Printf(", max %.6f\n", d.Max)
+		}
+	}
+	const maxStates = 30
+	for i, state := range r.SteadyState {
+		if i == maxStates {
+			fmt.Printf("  ... %d more states in the steady state\n", len(r.SteadyState)-maxStates)
+			break
+		}
+		fmt.Printf("  %4d: %.6f state: %s / returns: %s\n", state.Node, state.Probability, state.State, state.Returns)
+	}
+	for _, liveness := range r.Liveness {
+		fmt.Printf("  %s: probability %.6f", liveness.Assertion, liveness.Probability)
+		for _, name := range r.CounterNames() {
+			if mean, ok := liveness.MeanCounters[name]; ok {
+				fmt.Printf(", mean %s %.6f", name, mean)
+			}
+		}
+		fmt.Println()
+	}
+}
@@ -0,0 +1,262 @@
+package modelchecker
+
+import (
+	"errors"
+	"fizz/proto"
+	"fmt"
+	"math"
+	"math/rand"
+	"sort"
+)
+
+// maxWalkSteps bounds a Monte Carlo walk that does not reach a bottom
+// component.
+const maxWalkSteps = 100000
+
+// reportedPercentiles are the percentiles reported for each counter.
+var reportedPercentiles = []float64{0.5, 0.9, 0.95, 0.99, 0.999}
+
+// CounterDistribution is the distribution of a counter accumulated on the
+// way to the steady state, estimated from Samples Monte Carlo walks.
+type CounterDistribution struct {
+	Samples     int               `json:"samples"`
+	Mean        float64           `json:"mean"`
+	StdDev      float64           `json:"stddev"`
+	Min         float64           `json:"min"`
+	Max         float64           `json:"max"`
+	Percentiles []CounterQuantile `json:"percentiles"`
+}
+
+// CounterQuantile is the value the counter stays at or below with
+// probability Percentile.
+type CounterQuantile struct {
+	Percentile float64 `json:"percentile"`
+	Value      float64 `json:"value"`
+}
+
+// ValidatePerformanceModel returns an error if a counter of model has a
+// distribution that cannot be sampled.
+func ValidatePerformanceModel(model *proto.PerformanceModel) error {
+	for label, config := range model.GetConfigs() {
+		if p := config.GetProbability(); p < 0 || p > 1 {
+			return fmt.Errorf("%s: probability %g is not in [0, 1]", label, p)
+		}
+		for name, counter := range config.GetCounters() {
+			if err := validateDistribution(counter.GetDistribution()); err != nil {
+				return fmt.Errorf("%s: counter %s: %w", label, name, err)
+			}
+		}
+	}
+	return nil
+}
+
+func validateDistribution(d *proto.Distribution) error {
+	switch kind := d.GetKind().(type) {
+	case *proto.Distribution_Uniform:
+		if kind.Uniform.GetMin() > kind.Uniform.GetMax() {
+			return errors.New("uniform min is greater than max")
+		}
+	case *proto.Distribution_Normal:
+		if kind.Normal.GetStddev() < 0 {
+			return errors.New("normal stddev is negative")
+		}
+	case *proto.Distribution_Exponential:
+		if kind.Exponential.GetMean() <= 0 {
+			return errors.New("exponential mean must be positive")
+		}
+	case *proto.Distribution_Empirical:
+		values, weights := kind.Empirical.GetValues(), kind.Empirical.GetWeights()
+		if len(values) == 0 {
+			return errors.New("empirical distribution has no values")
+		}
+		if len(weights) == 0 {
+			return nil
+		}
+		if len(weights) != len(values) {
+			return fmt.Errorf("empirical distribution has %d values and %d weights", len(values), len(weights))
+		}
+		total := 0.0
+		for _, w := range weights {
+			if w < 0 {
+				return errors.New("empirical weights must not be negative")
+			}
+			total += w
+		}
+		if total == 0 {
+			return errors.New("empirical weights add up to zero")
+		}
+	}
+	return nil
+}
+
+// counterMean is the expected value added to the counter.
+func counterMean(counter *proto.Counter) float64 {
+	d := counter.GetDistribution()
+	switch kind := d.GetKind().(type) {
+	case *proto.Distribution_Constant:
+		return kind.Constant
+	case *proto.Distribution_Uniform:
+		return (kind.Uniform.GetMin() + kind.Uniform.GetMax()) / 2
+	case *proto.Distribution_Normal:
+		return kind.Normal.GetMean()
+	case *proto.Distribution_Exponential:
+		return kind.Exponential.GetMean()
+	case *proto.Distribution_Empirical:
+		values, weights := kind.Empirical.GetValues(), kind.Empirical.GetWeights()
+		if len(weights) == 0 {
+			return sum(values) / float64(len(values))
+		}
+		return dot(values, weights) / sum(weights)
+	}
+	return counter.GetNumeric()
+}
+
+// counterSampler draws a value to add to a counter.
+type counterSampler func(r *rand.Rand) float64
+
+func newCounterSampler(counter *proto.Counter) counterSampler {
+	switch kind := counter.GetDistribution().GetKind().(type) {
+	case *proto.Distribution_Uniform:
+		lo, hi := kind.Uniform.GetMin(), kind.Uniform.GetMax()
+		return func(r *rand.Rand) float64 { return lo + (hi-lo)*r.Float64() }
+	case *proto.Distribution_Normal:
+		mean, stddev := kind.Normal.GetMean(), kind.Normal.GetStddev()
+		return func(r *rand.Rand) float64 { return mean + stddev*r.NormFloat64() }
+	case *proto.Distribution_Exponential:
+		mean := kind.Exponential.GetMean()
+		return func(r *rand.Rand) float64 { return mean * r.ExpFloat64() }
+	case *proto.Distribution_Empirical:
+		values := kind.Empirical.GetValues()
+		weights := kind.Empirical.GetWeights()
+		if len(weights) == 0 {
+			return func(r *rand.Rand) float64 { return values[r.Intn(len(values))] }
+		}
+		return cumulativeSampler(values, weights)
+	}
+	value := counterMean(counter)
+	return func(r *rand.Rand) float64 { return value }
+}
+
+// cumulativeSampler draws values[i] with probability proportional to
+// weights[i].
+func cumulativeSampler(values []float64, weights []float64) counterSampler {
+	cumulative := make([]float64, len(weights))
+	total := 0.0
+	for i, w := range weights {
+		total += w
+		cumulative[i] = total
+	}
+	return func(r *rand.Rand) float64 {
+		i := sort.SearchFloat64s(cumulative, r.Float64()*total)
+		return values[min(i, len(values)-1)]
+	}
+}
+
+// walkLink is an outbound link of a node in a Monte Carlo walk.
+type walkLink struct {
+	dest int
+	// cumulative is the probability of this link and the ones before it.
+	cumulative float64
+	counters   []walkCounter
+}
+
+type walkCounter struct {
+	name   string
+	sample counterSampler
+}
+
+// sampleCounterDistributions estimates the distribution of each counter from
+// samples walks on the chain of nodes with the probabilities of model, from
+// a node drawn from initial until a bottom strongly connected component.
+// The walks use seed, so the estimates are reproducible. Returns nil if the
+// model has no counters.
+func sampleCounterDistributions(chain *sparseChain, model *proto.PerformanceModel, initial []float64, samples int, seed int64) map[string]*CounterDistribution {
+	if len(chain.rewards) == 0 || samples <= 0 {
+		return nil
+	}
+	nodes := chain.nodes
+	index := nodeIndex(nodes)
+	samplers := map[*proto.Counter]counterSampler{}
+	links := make([][]walkLink, len(nodes))
+	for i, node := range nodes {
+		total := 0.0
+		for k, prob := range linkProbabilities(node, model) {
+			total += prob
+			link := walkLink{dest: index[node.Outbound[k].Node], cumulative: total}
+			for _, label := range node.Outbound[k].Labels {
+				counters := model.Configs[label].GetCounters()
+				// Sorted, so that a seed draws the same values every time.
+				names := make([]string, 0, len(counters))
+				for name := range counters {
+					names = append(names, name)
+				}
+				sort.Strings(names)
+				for _, name := range names {
+					counter := counters[name]
+					if samplers[counter] == nil {
+						samplers[counter] = newCounterSampler(counter)
+					}
+					link.counters = append(link.counters, walkCounter{name: name, sample: samplers[counter]})
+				}
+			}
+			links[i] = append(links[i], link)
+		}
+	}
+	component, _ := bottomComponents(chain.p)
+	start := make([]walkLink, 0)
+	total := 0.0
+	for i, prob := range initial {
+		if prob > 0 {
+			total += prob
+			start = append(start, walkLink{dest: i, cumulative: total})
+		}
+	}
+
+	r := rand.New(rand.NewSource(seed))
+	values := make(map[string][]float64, len(chain.rewards))
+	for name := range chain.rewards {
+		values[name] = make([]float64, samples)
+	}
+	for s := 0; s < samples; s++ {
+		node := pickLink(start, r).dest
+		for step := 0; step < maxWalkSteps && component[node] < 0; step++ {
+			link := pickLink(links[node], r)
+			for _, counter := range link.counters {
+				values[counter.name][s] += counter.sample(r)
+			}
+			node = link.dest
+		}
+	}
+
+	distributions := make(map[string]*CounterDistribution, len(values))
+	for name, v := range values {
+		distributions[name] = summarizeSamples(v)
+	}
+	return distributions
+}
+
+func pickLink(links []walkLink, r *rand.Rand) walkLink {
+	u := r.Float64() * links[len(links)-1].cumulative
+	i := sort.Search(len(links), func(i int) bool { return links[i].cumulative > u })
+	return links[min(i, len(links)-1)]
+}
+
+// summarizeSamples sorts values and returns their distribution, with
+// nearest-rank percentiles.
+func summarizeSamples(values []float64) *CounterDistribution {
+	sort.Float64s(values)
+	n := len(values)
+	d := &CounterDistribution{Samples: n, Mean: sum(values) / float64(n), Min: values[0], Max: values[n-1]}
+	variance := 0.0
+	for _, v := range values {
+		variance += (v - d.Mean) * (v - d.Mean)
+	}
+	if n > 1 {
+		d.StdDev = math.Sqrt(variance / float64(n-1))
+	}
+	for _, p := range reportedPercentiles {
+		rank := int(math.Ceil(p * float64(n)))
+		d.Percentiles = append(d.Percentiles, CounterQuantile{Percentile: p, Value: values[max(rank, 1)-1]})
+	}
+	return d
+}
@@ -0,0 +1,360 @@
+package modelchecker
+
+import (
+	"bufio"
+	ast "fizz/proto"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+
+	"go.starlark.net/starlark"
+)
+
+// GeneratePrismFiles writes the Markov chain of nodes, as returned by
+// GetAllNodes for the graph of file, in the PRISM explicit-model format, so
+// that PRISM or Storm can check it offline:
+//
+//   - <prefix>model.tra: the transitions, with the branch probabilities of
+//     model, or uniform ones if it is nil. Nodes without outbound links
+//     loop to themselves.
+//   - <prefix>model.sta: the state variables of each node.
+//   - <prefix>model.lab: the labels init, deadlock, yield and crash, a
+//     label for each eventually or exists assertion where its predicate
+//     holds, and a label link_<label> for the nodes entered by a link with
+//     the label.
+//   - <prefix>model_<counter>.trew: the transition rewards of each counter.
+//
+// State i is node i of the nodes_*.pb files, which hold the full states.
+// Integer and boolean variables are written as they are; the values of the
+// other variables are numbered in their sorted order. Returns the names of
+// the files written.
+func GeneratePrismFiles(file *ast.File, nodes []*Node, model *ast.PerformanceModel, pathPrefix string) ([]string, error) {
+	if model == nil {
+		model = &ast.PerformanceModel{}
+	}
+	if err := os.MkdirAll(filepath.Dir(pathPrefix), os.ModePerm); err != nil {
+		return nil, err
+	}
+	chain := newSparseChain(nodes, model)
+	var fileNames []string
+	write := func(name string, writeTo func(w *bufio.Writer) error) error {
+		fileName := pathPrefix + name
+		f, err := os.Create(fileName)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		w := bufio.NewWriter(f)
+		if err := writeTo(w); err != nil {
+			return err
+		}
+		if err := w.Flush(); err != nil {
+			return err
+		}
+		fileNames = append(fileNames, fileName)
+		return nil
+	}
+
+	if err := write("model.tra", chain.writePrismTransitions); err != nil {
+		return nil, err
+	}
+	if err := write("model.sta", func(w *bufio.Writer) error { return writePrismStates(w, nodes) }); err != nil {
+		return nil, err
+	}
+	if err := write("model.lab", func(w *bufio.Writer) error { return writePrismLabels(w, file, nodes) }); err != nil {
+		return nil, err
+	}
+	rewards := prismTransitionRewards(chain, model)
+	counters := make([]string, 0, len(rewards))
+	for name := range rewards {
+		counters = append(counters, name)
+	}
+	sort.Strings(counters)
+	for _, name := range counters {
+		err := write(fmt.Sprintf("model_%s.trew", prismIdentifier(name)), func(w *bufio.Writer) error {
+			return chain.writePrismRewards(w, rewards[name])
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	return fileNames, nil
+}
+
+func formatPrismFloat(v float64) string {
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+// writePrismTransitions writes the .tra file: the numbers of states and
+// transitions, then a transition per line, sorted by source and destination.
+func (c *sparseChain) writePrismTransitions(w *bufio.Writer) error {
+	transitions := 0
+	for i := range c.nodes {
+		cols, _ := c.p.row(i)
+		transitions += len(cols)
+	}
+	fmt.Fprintf(w, "%d %d\n", len(c.nodes), transitions)
+	for i := range c.nodes {
+		cols, vals := c.p.row(i)
+		for k, j := range cols {
+			if _, err := fmt.Fprintf(w, "%d %d %s\n", i, j, formatPrismFloat(vals[k])); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// prismTransitionRewards returns for each counter the mean amount the
+// transition from i to j adds, keyed by i, then j. Links between the same
+// nodes are merged into one transition, so their amounts are weighted by
+// their share of its probability.
+func prismTransitionRewards(c *sparseChain, model *ast.PerformanceModel) map[string][]map[int]float64 {
+	index := nodeIndex(c.nodes)
+	rewards := make(map[string][]map[int]float64)
+	for name := range c.rewards {
+		rewards[name] = make([]map[int]float64, len(c.nodes))
+	}
+	for i, node := range c.nodes {
+		for k, prob := range linkProbabilities(node, model) {
+			link := node.Outbound[k]
+			j := index[link.Node]
+			for _, label := range link.Labels {
+				for name, counter := range model.Configs[label].GetCounters() {
+					if rewards[name][i] == nil {
+						rewards[name][i] = make(map[int]float64)
+					}
+					if total := c.p.get(i, j); total > 0 {
+						rewards[name][i][j] += counterMean(counter) * prob / total
+					}
+				}
+			}
+		}
+	}
+	return rewards
+}
+
+// writePrismRewards writes a .trew file with the transitions that add to the
+// counter.
+func (c *sparseChain) writePrismRewards(w *bufio.Writer, rewards []map[int]float64) error {
+	transitions := 0
+	for _, row := range rewards {
+		for _, v := range row {
+			if v != 0 {
+				transitions++
+			}
+		}
+	}
+	fmt.Fprintf(w, "%d %d\n", len(c.nodes), transitions)
+	for i, row := range rewards {
+		dests := make([]int, 0, len(row))
+		for j, v := range row {
+			if v != 0 {
+				dests = append(dests, j)
+			}
+		}
+		sort.Ints(dests)
+		for _, j := range dests {
+			if _, err := fmt.Fprintf(w, "%d %d %s\n", i, j, formatPrismFloat(row[j])); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// prismVariable is a state variable of the .sta file. Variables that are not
+// all integers or all booleans, or are missing from some states, have their
+// values numbered in sorted order, with -1 for missing.
+type prismVariable struct {
+	name    string
+	kind    string
+	numbers map[string]int
+}
+
+func writePrismStates(w *bufio.Writer, nodes []*Node) error {
+	var names []string
+	kinds := make(map[string]string)
+	values := make(map[string]map[string]bool)
+	for _, node := range nodes {
+		if node.Process == nil {
+			continue
+		}
+		for name, value := range node.Heap.state {
+			if _, ok := kinds[name]; !ok {
+				names = append(names, name)
+				values[name] = make(map[string]bool)
+			}
+			kind := "other"
+			switch v := value.(type) {
+			case starlark.Bool:
+				kind = "bool"
+			case starlark.Int:
+				if _, ok := v.Int64(); ok {
+					kind = "int"
+				}
+			}
+			if previous, ok := kinds[name]; ok && previous != kind {
+				kind = "other"
+			}
+			kinds[name] = kind
+			values[name][value.String()] = true
+		}
+	}
+	sort.Strings(names)
+	variables := make([]*prismVariable, 0, len(names))
+	for _, name := range names {
+		v := &prismVariable{name: name, kind: kinds[name]}
+		for _, node := range nodes {
+			if node.Process == nil || node.Heap.state[name] == nil {
+				v.kind = "other"
+				break
+			}
+		}
+		if v.kind == "other" {
+			sorted := make([]string, 0, len(values[name]))
+			for value := range values[name] {
+				sorted = append(sorted, value)
+			}
+			sort.Strings(sorted)
+			v.numbers = make(map[string]int, len(sorted))
+			for k, value := range sorted {
+				v.numbers[value] = k
+			}
+		}
+		variables = append(variables, v)
+	}
+
+	header := make([]string, len(variables))
+	for k, v := range variables {
+		header[k] = prismIdentifier(v.name)
+	}
+	fmt.Fprintf(w, "(%s)\n", strings.Join(header, ","))
+	row := make([]string, len(variables))
+	for i, node := range nodes {
+		for k, v := range variables {
+			var value starlark.Value
+			if node.Process != nil {
+				value = node.Heap.state[v.name]
+			}
+			switch {
+			case value == nil:
+				row[k] = "-1"
+			case v.kind == "bool":
+				row[k] = strconv.FormatBool(bool(value.Truth()))
+			case v.kind == "int":
+				row[k] = value.String()
+			default:
+				row[k] = strconv.Itoa(v.numbers[value.String()])
+			}
+		}
+		if _, err := fmt.Fprintf(w, "%d:(%s)\n", i, strings.Join(row, ",")); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// writePrismLabels writes the .lab file: the label declarations, then the
+// labels of each state that has any.
+func writePrismLabels(w *bufio.Writer, file *ast.File, nodes []*Node) error {
+	labels := []string{"init", "deadlock", "yield", "crash"}
+	holds := make([][]int, len(nodes))
+	holds[0] = append(holds[0], 0)
+	for i, node := range nodes {
+		if len(node.Outbound) == 0 {
+			holds[i] = append(holds[i], 1)
+		}
+		if node.Process != nil && node.Name == "yield" {
+			holds[i] = append(holds[i], 2)
+		}
+		if node.Process != nil && node.Name == "crash" {
+			holds[i] = append(holds[i], 3)
+		}
+	}
+	for k, inv := range file.GetInvariants() {
+		operators := invariantOperators(inv)
+		if !slices.Contains(operators, "eventually") && !slices.Contains(operators, "exists") {
+			continue
+		}
+		name := inv.Name
+		if name == "" {
+			name = fmt.Sprintf("invariant_%d", k)
+		}
+		label := len(labels)
+		labels = append(labels, prismIdentifier(name))
+		for i, node := range nodes {
+			if node.Process != nil && node.Witness[0][k] {
+				holds[i] = append(holds[i], label)
+			}
+		}
+	}
+	linkLabels := make(map[string]int)
+	for _, node := range nodes {
+		for _, link := range node.Outbound {
+			for _, name := range link.Labels {
+				if _, ok := linkLabels[name]; !ok {
+					linkLabels[name] = -1
+				}
+			}
+		}
+	}
+	names := make([]string, 0, len(linkLabels))
+	for name := range linkLabels {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		linkLabels[name] = len(labels)
+		labels = append(labels, "link_"+prismIdentifier(name))
+	}
+	if len(linkLabels) > 0 {
+		index := nodeIndex(nodes)
+		for _, node := range nodes {
+			for _, link := range node.Outbound {
+				j := index[link.Node]
+				for _, name := range link.Labels {
+					if !slices.Contains(holds[j], linkLabels[name]) {
+						holds[j] = append(holds[j], linkLabels[name])
+					}
+				}
+			}
+		}
+	}
+
+	declarations := make([]string, len(labels))
+	for k, label := range labels {
+		declarations[k] = fmt.Sprintf("%d=%q", k, label)
+	}
+	fmt.Fprintln(w, strings.Join(declarations, " "))
+	for i, labelIds := range holds {
+		if len(labelIds) == 0 {
+			continue
+		}
+		sort.Ints(labelIds)
+		ids := make([]string, len(labelIds))
+		for k, id := range labelIds {
+			ids[k] = strconv.Itoa(id)
+		}
+		if _, err := fmt.Fprintf(w, "%d: %s\n", i, strings.Join(ids, " ")); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// prismIdentifier replaces the characters PRISM does not allow in names with
+// underscores.
+func prismIdentifier(name string) string {
+	id := []byte(name)
+	for k, c := range id {
+		if !(c == '_' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || k > 0 && c >= '0' && c <= '9') {
+			id[k] = '_'
+		}
+	}
+	return string(id)
+}
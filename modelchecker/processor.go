@@ -26,6 +26,7 @@ import (
 	"slices"
 	"sort"
 	"strings"
+	"sync/atomic"
 	"time"
 
 	"github.com/fizzbee-io/fizzbee/lib"
@@ -46,15 +47,6 @@ const (
 // When false: permute all symmetric values from the definition
 const canonicalizeSymmetricValues = true
 
-// excludeReturnsFromState, when true, omits Process.Returns from HashCode,
-// JSON state serialization, and the dot-file state label. Returns remain
-// populated during execution (functions/invariants still read them) and are
-// always available on Link.Returns. Use this to verify downstream consumers
-// have migrated to reading return values from links rather than from state.
-// Toggled via Processor.SetExperimentalNoStateReturns; planned to become the
-// default once consumers have migrated.
-var excludeReturnsFromState bool
-
 const enableCaptureStackTrace = false
 
 type Definition struct {
@@ -202,6 +194,10 @@ type Process struct {
 	// This is persisted across transitions so fresh() can find the next unused value.
 	RotationalLastAllocated map[string]int64 `json:"-"`
 
+	// RefCounters allocates role refs and channel ids for roles and channels
+	// created by this process. Cloned on Fork, so allocation is per-path.
+	RefCounters *lib.RefCounters `json:"-"`
+
 	ChannelMessages map[int][]*ChannelMessage `json:"channel_messages"`
 
 	CachedHashCode     string   `json:"-"`
@@ -213,6 +209,15 @@ type Process struct {
 	durabilitySpec   *DurabilitySpec
 	guidedTrace      GuidedTrace
 
+	// excludeReturnsFromState, when true, omits Returns from HashCode,
+	// JSON state serialization, and the dot-file state label. Returns remain
+	// populated during execution (functions/invariants still read them) and are
+	// always available on Link.Returns. Use this to verify downstream consumers
+	// have migrated to reading return values from links rather than from state.
+	// Toggled via Processor.SetExperimentalNoStateReturns; planned to become the
+	// default once consumers have migrated. Inherited by forks and clones.
+	excludeReturnsFromState bool
+
 	topLevelVars []string
 }
 
@@ -274,6 +279,12 @@ func NewProcess(name string, files []*ast.File, parent *Process) *Process {
 	p.Children = append(p.Children, p)
 	p.Channels = make(map[int]*lib.Channel)
 	p.ChannelMessages = make(map[int][]*ChannelMessage)
+	if parent != nil {
+		p.RefCounters = parent.RefCounters.Clone()
+		p.excludeReturnsFromState = parent.excludeReturnsFromState
+	} else {
+		p.RefCounters = lib.NewRefCounters()
+	}
 	return p
 }
 
@@ -290,7 +301,7 @@ func (p *Process) MarshalJSON() ([]byte, error) {
 		"channels":         p.Channels,
 		"channel_messages": p.ChannelMessages,
 	}
-	if !excludeReturnsFromState {
+	if !p.excludeReturnsFromState {
 		fields["returns"] = StringDictToJsonString(p.Returns)
 	}
 	return lib.MarshalJSON(fields)
@@ -354,6 +365,9 @@ func (p *Process) Fork() *Process {
 		durabilitySpec: p.durabilitySpec,
 		guidedTrace:    p.guidedTrace,
 
+		RefCounters:             p.RefCounters.Clone(),
+		excludeReturnsFromState: p.excludeReturnsFromState,
+
 		Children:    []*Process{},
 		Files:       p.Files,
 		Returns:     make(starlark.StringDict),
@@ -427,6 +441,9 @@ func (p *Process) CloneWithRefs(permutations map[*lib.SymmetricValue][]*lib.Symm
 		durabilitySpec: p.durabilitySpec,
 		guidedTrace:    p.guidedTrace,
 
+		RefCounters:             p.RefCounters.Clone(),
+		excludeReturnsFromState: p.excludeReturnsFromState,
+
 		Children:    []*Process{},
 		Files:       p.Files,
 		Returns:     returnsCopy,
@@ -566,7 +583,7 @@ func (n *Node) appendState(p *Process, buf *strings.Builder) {
 		buf.WriteString("State: ")
 		buf.WriteString(escapedString)
 	}
-	if !excludeReturnsFromState && len(p.Returns) > 0 {
+	if !p.excludeReturnsFromState && len(p.Returns) > 0 {
 		jsonString := StringDictToJsonString(p.Returns)
 		// Escape double quotes
 		escapedString := strings.ReplaceAll(jsonString, "\"", "\\\"")
@@ -622,7 +639,7 @@ func (p *Process) HashCode() string {
 		h.Write([]byte(hash))
 	}
 
-	if !excludeReturnsFromState {
+	if !p.excludeReturnsFromState {
 		h.Write([]byte(StringDictToJsonString(p.Returns)))
 	}
 
@@ -723,10 +740,10 @@ func (p *Process) GetAllVariables() starlark.StringDict {
 	for _, file := range p.Files {
 		for _, role := range file.Roles {
 			symmetric := slices.Contains(role.Modifiers, "symmetric")
-			dict[role.Name] = lib.CreateRoleBuiltin(role, symmetric, &p.Roles)
+			dict[role.Name] = lib.CreateRoleBuiltin(role, symmetric, &p.Roles, p.RefCounters)
 		}
 	}
-	dict["Channel"] = lib.CreateChannelBuiltin(p.Channels)
+	dict["Channel"] = lib.CreateChannelBuiltin(p.Channels, p.RefCounters)
 	return dict
 }
 
@@ -753,10 +770,10 @@ func (p *Process) GetAllVariablesNocopy() starlark.StringDict {
 	for _, file := range p.Files {
 		for _, role := range file.Roles {
 			symmetric := slices.Contains(role.Modifiers, "symmetric")
-			dict[role.Name] = lib.CreateRoleBuiltin(role, symmetric, &p.Roles)
+			dict[role.Name] = lib.CreateRoleBuiltin(role, symmetric, &p.Roles, p.RefCounters)
 		}
 	}
-	dict["Channel"] = lib.CreateChannelBuiltin(p.Channels)
+	dict["Channel"] = lib.CreateChannelBuiltin(p.Channels, p.RefCounters)
 	return dict
 }
 
@@ -939,6 +956,23 @@ type Node struct {
 	// trace without keeping ancestor Process objects alive. Nil otherwise.
 	// Siblings share the parent's pathTail pointer.
 	pathTail *pathNode `json:"-"`
+
+	// prefetched: when the processor runs with workers > 1, the result of
+	// executing this node on a worker goroutine ahead of its turn. Consumed
+	// (and cleared) by processNode. Nil otherwise.
+	prefetched *prefetchResult `json:"-"`
+
+	// recipe: with disk spill enabled, the scheduling and fork choices that
+	// lead from Init to this node, so a spilled yield-point can be rebuilt
+	// by replaying them. Nil otherwise.
+	recipe *recipeStep `json:"-"`
+
+	// fingerprintId: when the processor records the fingerprint graph, one
+	// more than the id of this node's state in it, or 0 before the node
+	// reaches the visited set. fingerprintEdge is the transition into the
+	// node, until then. See no_graph_liveness.go.
+	fingerprintId   int32                   `json:"-"`
+	fingerprintEdge *pendingFingerprintEdge `json:"-"`
 }
 
 // pathNode is a single entry in the no-graph mode's action-name chain. It
@@ -1147,9 +1181,9 @@ type Processor struct {
 	Init               *Node
 	Files              []*ast.File
 	queue              lib.LinearCollection[*Node]
-	visited            map[string]*Node
+	visited            *visitedSet
 	config             *ast.StateSpaceOptions
-	stopped            bool
+	stopped            atomic.Bool
 	dirPath            string
 	intermediateStates lib.LinearCollection[*Node]
 	simulation         bool
@@ -1171,13 +1205,23 @@ type Processor struct {
 	// also be true), the model checker skips dedup, skips Outbound link
 	// tracking, drops heavy Process fields (Heap/Threads/Roles/Channels)
 	// from yield-points after their expansion completes, and detects
-	// deadlocks at expansion time rather than post-traversal. Liveness
-	// checks are NOT supported in this mode — main.go rejects specs that
-	// declare any eventually/always-eventually/eventually-always invariants
-	// at startup. The failure path (parent pointer chain via Inbound[0])
+	// deadlocks at expansion time rather than post-traversal. The liveness
+	// checks that walk the graph cannot run in this mode; see
+	// noGraphLiveness. The failure path (parent pointer chain via Inbound[0])
 	// remains intact so a failure trace can be reconstructed on demand.
 	experimentalNoGraph bool
 
+	// noGraphLiveness: in no-graph mode, record the fingerprint graph in
+	// fingerprints while exploring, for CheckNoGraphLiveness. See
+	// no_graph_liveness.go.
+	noGraphLiveness bool
+	fingerprints    *fingerprintGraph
+
+	// onTheFlyLiveness: search for liveness failures during the exploration
+	// in livenessSearch. See on_the_fly_liveness.go.
+	onTheFlyLiveness bool
+	livenessSearch   *livenessSearch
+
 	// disableSymmetryReduction: when true, visited-set dedup uses only the
 	// plain state hash — no symmetry permutations, so no canonical renaming
 	// of symmetric values/roles in stored states. Larger state space, but
@@ -1224,6 +1268,63 @@ type Processor struct {
 	// Used by no-graph mode to report "Unique states" without the in-memory
 	// graph traversal (markovchain's yieldsCount).
 	uniqueYieldCount int
+
+	// excludeReturnsFromState: stamped on the Init process so every process
+	// in this run omits Returns from its state. See SetExperimentalNoStateReturns.
+	excludeReturnsFromState bool
+
+	// workers: number of goroutines that execute action-starts ahead of the
+	// coordinating loop. <= 1 means single-threaded. See SetWorkers.
+	workers int
+
+	// spill: when non-nil, the visited set and the processed queue live on
+	// disk. See SetDiskSpill.
+	spill *diskSpill
+
+	// recipes: when non-nil, every node records how it was reached from
+	// Init, so yield-points can leave memory. Enabled by disk spill and
+	// checkpoints. See recipe.go.
+	recipes *recipeReplay
+
+	// checkpoint: when non-nil, the run writes and/or resumes from
+	// checkpoints. See SetCheckpoint and SetResume.
+	checkpoint *checkpointer
+
+	// budget: when non-nil, the run stops once it is exceeded, recording
+	// why in stopReason. See SetBudget.
+	budget     *Budget
+	stopReason atomic.Pointer[string]
+
+	// startTime is when Start was called; depthReached is the largest
+	// actionDepth expanded so far. Both feed PartialReport.
+	startTime    time.Time
+	depthReached int
+
+	// progress: when non-nil, receives periodic progress events. See
+	// SetProgress.
+	progress *ProgressReporter
+
+	// por: when non-nil, yield-point expansions explore an ample subset of
+	// the action-starts. See SetPartialOrderReduction.
+	por *partialOrder
+
+	// actionOrder: when non-nil, the order to schedule the top-level
+	// actions (index 0) and the actions of role i (index i+1) in, instead
+	// of declaration order. Set by a Swarm.
+	actionOrder [][]int
+
+	// guide: when non-nil, simulation runs pick successors weighted toward
+	// unexplored behaviour. See SetSimulationGuide.
+	guide *SimulationGuide
+
+	// statistical: simulation runs are judged by a StatisticalCheck, so
+	// liveness assertions do not extend them. perfModel, when non-nil, gives
+	// the probabilities of their choices. See SetStatistical.
+	statistical bool
+	perfModel   *ast.PerformanceModel
+
+	// simulationEnd is the node the last simulation run ended at.
+	simulationEnd *Node
 }
 
 // GetEarlyDeadlock returns the first deadlocked yield-point detected during
@@ -1234,6 +1335,70 @@ func (p *Processor) GetEarlyDeadlock() *Node {
 	return p.earlyDeadlock
 }
 
+// IsTerminalState returns true if the system may stop at the node: the
+// terminal_state option, the name of a function of the spec or a Starlark
+// expression, returns true in its state. A stuck terminal state is not a
+// deadlock. A function that returns None is false. Returns a ModelError if
+// the function or the expression fails.
+func (p *Processor) IsTerminalState(node *Node) (terminal bool, err error) {
+	name := p.config.GetTerminalState()
+	if name == "" || node.Process == nil || node.Process.Heap == nil {
+		return false, nil
+	}
+	// Before the Init action runs, the state has no variables yet.
+	if node == p.Init && p.Files[0].Actions[0].Name == "Init" {
+		return false, nil
+	}
+	if _, ok := node.Process.SymbolTable[name]; ok {
+		defer func() {
+			if r := recover(); r != nil {
+				modelErr, ok := r.(*ModelError)
+				if !ok {
+					panic(r)
+				}
+				terminal, err = false, modelErr
+			}
+		}()
+		value := ExecFunction(node.Process.CloneForAssert(nil, 0), name)
+		// A function that returns None leaves no return value.
+		return value != nil && bool(value.Truth()), nil
+	}
+	holds, err := evalStateFormula(node.Process, name)
+	if err != nil {
+		return false, node.Process.NewModelError(nil, fmt.Sprintf("Error evaluating terminal_state %s: %v", name, err), err)
+	}
+	return holds, nil
+}
+
+// isTerminalState is IsTerminalState for the exploration, which raises the
+// errors of the spec as ModelError panics.
+func (p *Processor) isTerminalState(node *Node) bool {
+	terminal, err := p.IsTerminalState(node)
+	if err != nil {
+		panic(err)
+	}
+	return terminal
+}
+
+// checkTerminalState checks the terminal_state option before the run: a
+// function must take no parameters, and an expression must parse.
+func (p *Processor) checkTerminalState(process *Process) error {
+	name := p.config.GetTerminalState()
+	if name == "" {
+		return nil
+	}
+	if def, ok := process.SymbolTable[name]; ok {
+		if len(def.params) > 0 {
+			return fmt.Errorf("terminal_state: function %s must take no parameters", name)
+		}
+		return nil
+	}
+	if _, err := syntax.ParseExpr(process.Files[0].GetSourceInfo().GetFileName(), name, 0); err != nil {
+		return fmt.Errorf("terminal_state: %w", err)
+	}
+	return nil
+}
+
 // SetExperimentalProcessedQueue switches the processor to the experimental
 // queue-of-processed-nodes path. Must be called before Start.
 func (p *Processor) SetExperimentalProcessedQueue(v bool) {
@@ -1242,7 +1407,8 @@ func (p *Processor) SetExperimentalProcessedQueue(v bool) {
 
 // SetExperimentalNoGraph enables the no-graph memory mode. Must be called
 // before Start. Caller is responsible for also enabling
-// experimentalProcessedQueue and for refusing specs with liveness assertions.
+// experimentalProcessedQueue, and for SetNoGraphLiveness if the spec has
+// liveness assertions.
 func (p *Processor) SetExperimentalNoGraph(v bool) {
 	p.experimentalNoGraph = v
 }
@@ -1258,10 +1424,10 @@ func (p *Processor) SetDisableSymmetryReduction(v bool) {
 // SetExperimentalNoStateReturns toggles whether Process.Returns is included
 // in HashCode, JSON state, and dot labels. When true, returns are visible
 // only via Link.Returns — use this to verify downstream consumers have
-// migrated. Sets a package-level variable (the flag is process-wide, not
-// per-Processor).
+// migrated. Must be called before Start; the setting is stamped on the Init
+// process and inherited by every process forked from it.
 func (p *Processor) SetExperimentalNoStateReturns(v bool) {
-	excludeReturnsFromState = v
+	p.excludeReturnsFromState = v
 }
 
 // breakParentRef releases a freshly-forked child's back-reference to its
@@ -1273,6 +1439,9 @@ func (p *Processor) breakParentRef(child *Node) {
 		return
 	}
 	if len(child.Inbound) > 0 {
+		if p.fingerprints != nil && child.Inbound[0].Node != nil {
+			p.fingerprints.fork(child.Inbound[0].Node, child)
+		}
 		child.Inbound[0].Node = nil
 	}
 }
@@ -1346,7 +1515,11 @@ func (p *Processor) GetUniqueYieldCount() int {
 // during the expansion of the owning yield-point.
 func (p *Processor) enqueueScheduled(node *Node) {
 	if p.experimentalProcessedQueue {
+		p.recordStart(node)
 		p.pendingActionStarts = append(p.pendingActionStarts, node)
+		if p.recipes != nil && p.recipes.replaying {
+			return
+		}
 		if l := len(p.pendingActionStarts); l > p.peakPendingActionStarts {
 			p.peakPendingActionStarts = l
 		}
@@ -1360,6 +1533,9 @@ func (p *Processor) enqueueScheduled(node *Node) {
 // either mode) should go through this helper so peak tracking is accurate.
 func (p *Processor) addToProcessingQueue(node *Node) {
 	p.queue.Add(node)
+	if p.livenessSearch != nil {
+		p.livenessSearch.queued[node] = true
+	}
 	if l := p.queue.Len(); l > p.peakQueueLen {
 		p.peakQueueLen = l
 	}
@@ -1390,7 +1566,6 @@ func NewProcessorWithVisitedTracking(files []*ast.File, options *ast.StateSpaceO
 		collection = lib.NewQueue[*Node]()
 		intermediateStates = lib.NewQueue[*Node]()
 	}
-	lib.ClearRoleRefs()
 	durabilitySpec := &DurabilitySpec{RoleDurabilitySpec: make(map[string]RoleDurabilitySpec)}
 	mc := NewModelChecker("example")
 	for _, file := range files {
@@ -1402,7 +1577,7 @@ func NewProcessorWithVisitedTracking(files []*ast.File, options *ast.StateSpaceO
 	return &Processor{
 		Files:   files,
 		queue:   collection,
-		visited: make(map[string]*Node),
+		visited: newVisitedSet(DefaultFingerprintBits),
 		config:  proto.Clone(options).(*ast.StateSpaceOptions),
 		dirPath: dirPath,
 
@@ -1424,12 +1599,13 @@ func NewProcessorWithVisitedTracking(files []*ast.File, options *ast.StateSpaceO
 }
 
 func (p *Processor) GetVisitedNodesCount() int {
-	return len(p.visited)
+	return p.visitedCount()
 }
 
 func (p *Processor) InitializeNode() (*Node, *Node, error) {
 	process := NewProcess("init", p.Files, nil)
 	process.durabilitySpec = p.durabilitySpec
+	process.excludeReturnsFromState = p.excludeReturnsFromState
 	if p.guidedTrace == nil {
 		process.guidedTrace = GuidedTrace{}
 	} else {
@@ -1442,6 +1618,9 @@ func (p *Processor) InitializeNode() (*Node, *Node, error) {
 	}
 	process.Modules = modules
 	p.Init = NewNode(process)
+	if err := p.checkTerminalState(process); err != nil {
+		return p.Init, nil, err
+	}
 
 	if len(p.Files[0].Stmts) > 0 {
 		processPreInit(p.Init, p.Files[0].Stmts, p.preinitHookContent)
@@ -1455,6 +1634,11 @@ func (p *Processor) InitializeNode() (*Node, *Node, error) {
 		}
 		process.Enable()
 		process.Heap.state = globals
+		// Evaluate terminal_state once in the initial state, so a mistake in
+		// it is reported now rather than when a deadlock is found.
+		if _, err := p.IsTerminalState(p.Init); err != nil {
+			return p.Init, nil, err
+		}
 		failed := CheckInvariantsWithProber(process, p.makeProber(process))
 		if len(failed[0]) > 0 {
 			p.Init.Process.FailedInvariants = failed
@@ -1477,6 +1661,7 @@ func (p *Processor) InitializeNode() (*Node, *Node, error) {
 
 // Start the model checker
 func (p *Processor) Start() (init *Node, failedNode *Node, err error) {
+	p.startTime = time.Now()
 	if p.simulation {
 		return p.StartSimulation()
 	}
@@ -1491,19 +1676,31 @@ func (p *Processor) Start() (init *Node, failedNode *Node, err error) {
 	if err != nil {
 		return init, failedNode, err
 	}
+	if p.onTheFlyLiveness {
+		if p.livenessSearch, err = newLivenessSearch(p.Files); err != nil {
+			return init, failedNode, err
+		}
+		if len(p.livenessSearch.template.invariants) == 0 {
+			p.livenessSearch = nil
+		}
+	}
 
 	p.addToProcessingQueue(p.Init)
 	prevCount := 0
-	for p.queue.Len() != 0 && !p.stopped {
+	for p.queue.Len() != 0 && !p.stopped.Load() && !p.budgetExceeded() {
 		node, found := p.queue.Remove()
 		if !found {
 			panic("queue should not be empty")
 		}
+		if p.livenessSearch != nil {
+			delete(p.livenessSearch.queued, node)
+		}
 
 		if node.actionDepth > int(p.config.Options.MaxActions) {
 			// Add a node to indicate why this node was not processed
 			continue
 		}
+		p.prefetchFrontier(node)
 
 		invariantFailure, symmetryFound, crashFailedNode, finalNode := p.expandToYield(node, startTime, &prevCount)
 
@@ -1521,6 +1718,9 @@ func (p *Processor) Start() (init *Node, failedNode *Node, err error) {
 		if invariantFailure && !p.config.ContinueOnInvariantFailures {
 			break
 		}
+		if p.livenessSearch != nil && p.searchLiveness() {
+			break
+		}
 		//if node.Process != nil && *p.config.Options.CrashOnYield && node.Enabled {
 		//	failedCrashNode := p.crashProcess(node)
 		//	if failedCrashNode != nil && failedNode == nil {
@@ -1532,9 +1732,9 @@ func (p *Processor) Start() (init *Node, failedNode *Node, err error) {
 		//}
 	}
 	if p.isTest {
-		fmt.Printf("Nodes: %d, queued: %d\n", len(p.visited), p.queue.Len())
+		fmt.Printf("Nodes: %d, queued: %d\n", p.visitedCount(), p.queue.Len())
 	} else {
-		fmt.Printf("Nodes: %d, queued: %d, elapsed: %s\n", len(p.visited), p.queue.Len(), time.Since(startTime))
+		fmt.Printf("Nodes: %d, queued: %d, elapsed: %s\n", p.visitedCount(), p.queue.Len(), time.Since(startTime))
 	}
 	p.printPeakSummary()
 
@@ -1563,18 +1763,20 @@ func (p *Processor) Start() (init *Node, failedNode *Node, err error) {
 func (p *Processor) expandToYield(node *Node, startTime time.Time, prevCount *int) (
 	invariantFailure bool, symmetryFound bool, crashFailedNode *Node, finalNode *Node) {
 	finalNode = node
+	p.depthReached = max(p.depthReached, node.actionDepth)
 	for {
-		if len(p.visited)%20000 == 0 && len(p.visited) != *prevCount {
+		if visited := p.visitedCount(); visited%20000 == 0 && visited != *prevCount {
 			if p.isTest {
-				fmt.Printf("Nodes: %d, queued: %d\n", len(p.visited), p.queue.Len())
+				fmt.Printf("Nodes: %d, queued: %d\n", visited, p.queue.Len())
 			} else {
-				fmt.Printf("Nodes: %d, queued: %d, elapsed: %s\n", len(p.visited), p.queue.Len(), time.Since(startTime))
+				fmt.Printf("Nodes: %d, queued: %d, elapsed: %s\n", visited, p.queue.Len(), time.Since(startTime))
 			}
-			*prevCount = len(p.visited)
+			*prevCount = visited
 		}
+		p.reportProgress()
 		invariantFailure, symmetryFound = p.processNode(finalNode)
 		if p.guidedTrace != nil {
-			p.visited = make(map[string]*Node)
+			p.visited.Clear()
 		}
 
 		// no_graph mode disables crash simulation: crashRole/crashThread
@@ -1632,43 +1834,69 @@ func (p *Processor) startProcessedQueue() (init *Node, failedNode *Node, err err
 	if err != nil {
 		return init, failedNode, err
 	}
+	if p.checkpoint != nil {
+		if err = p.checkCheckpointSupported(); err != nil {
+			return init, failedNode, err
+		}
+	}
+	if p.spill != nil || p.checkpoint != nil {
+		p.enableRecipes()
+	} else if p.experimentalNoGraph && p.noGraphLiveness && p.guidedTrace == nil {
+		if p.fingerprints, err = newFingerprintGraph(p.Files, p.visited.bits); err != nil {
+			return init, failedNode, err
+		}
+	}
+	if p.spill != nil {
+		if err = p.initDiskSpill(); err != nil {
+			return init, failedNode, err
+		}
+		defer p.closeDiskSpill()
+	}
 
 	prevCount := 0
-
-	// Phase 1: process Init. The "normal" path is that Init is an action
-	// whose body yields, so publishYieldPoint appends Init's yield-point to
-	// expandedYieldPoints. The "no Init action" path (processInit, used for
-	// specs whose first action isn't named Init) instead schedules each
-	// top-level action-start directly via enqueueScheduled, populating
-	// pendingActionStarts WITHOUT producing a yield-point. drainAndFlush
-	// covers both: it drains any pendingActionStarts (handling the
-	// processInit case) and then flushes whatever yield-points were
-	// discovered into the queue.
-	invariantFailure, _, crashFailedNode, finalNode := p.expandToYield(p.Init, startTime, &prevCount)
-	if crashFailedNode != nil && failedNode == nil {
-		failedNode = crashFailedNode
-	}
-	if invariantFailure {
-		if failedNode == nil {
-			failedNode = finalNode
+	var earlyReturn bool
+	if p.checkpoint != nil && p.checkpoint.resumeDir != "" {
+		// Phase 1 already ran before the checkpoint was written.
+		if err = p.loadCheckpoint(); err != nil {
+			return init, failedNode, fmt.Errorf("resuming from %s: %w", p.checkpoint.resumeDir, err)
+		}
+		prevCount = p.visitedCount()
+	} else {
+		// Phase 1: process Init. The "normal" path is that Init is an action
+		// whose body yields, so publishYieldPoint appends Init's yield-point to
+		// expandedYieldPoints. The "no Init action" path (processInit, used for
+		// specs whose first action isn't named Init) instead schedules each
+		// top-level action-start directly via enqueueScheduled, populating
+		// pendingActionStarts WITHOUT producing a yield-point. drainAndFlush
+		// covers both: it drains any pendingActionStarts (handling the
+		// processInit case) and then flushes whatever yield-points were
+		// discovered into the queue.
+		invariantFailure, _, crashFailedNode, finalNode := p.expandToYield(p.Init, startTime, &prevCount)
+		if crashFailedNode != nil && failedNode == nil {
+			failedNode = crashFailedNode
+		}
+		if invariantFailure {
+			if failedNode == nil {
+				failedNode = finalNode
+			}
+			if !p.config.ContinueOnInvariantFailures {
+				p.printRunSummary(startTime)
+				return p.Init, failedNode, err
+			}
 		}
-		if !p.config.ContinueOnInvariantFailures {
+		earlyReturn, failedNode = p.drainAndFlush(startTime, &prevCount, failedNode)
+		if earlyReturn {
 			p.printRunSummary(startTime)
 			return p.Init, failedNode, err
 		}
 	}
-	var earlyReturn bool
-	earlyReturn, failedNode = p.drainAndFlush(startTime, &prevCount, failedNode)
-	if earlyReturn {
-		p.printRunSummary(startTime)
-		return p.Init, failedNode, err
-	}
 
 	// Phase 2: drain the processed-queue. Each iteration replays yp's
 	// deferred YieldNode/YieldFork to schedule its successor action-starts,
 	// then drainAndFlush processes them through to their yield-points and
 	// pushes those into the queue.
-	for p.queue.Len() != 0 && !p.stopped {
+	for p.queue.Len() != 0 && !p.stopped.Load() && !p.budgetExceeded() {
+		p.maybeCheckpoint(startTime)
 		yp, found := p.queue.Remove()
 		if !found {
 			panic("queue should not be empty")
@@ -1679,6 +1907,10 @@ func (p *Processor) startProcessedQueue() (init *Node, failedNode *Node, err err
 
 		// Replay the deferred YieldNode/YieldFork to schedule yp's
 		// successor action-starts into pendingActionStarts.
+		if p.recipes != nil {
+			p.recipes.expanding = yp
+		}
+		quiescent := len(yp.yieldForks) == 0
 		if len(yp.yieldForks) > 0 {
 			for _, fork := range yp.yieldForks {
 				p.YieldFork(yp, fork)
@@ -1699,7 +1931,11 @@ func (p *Processor) startProcessedQueue() (init *Node, failedNode *Node, err err
 		queueLenBefore := p.queue.Len()
 		p.dedupHitsInExpansion = 0
 
-		earlyReturn, failedNode = p.drainAndFlush(startTime, &prevCount, failedNode)
+		if p.por != nil {
+			earlyReturn, failedNode = p.drainAmple(quiescent, startTime, &prevCount, failedNode)
+		} else {
+			earlyReturn, failedNode = p.drainAndFlush(startTime, &prevCount, failedNode)
+		}
 		if earlyReturn {
 			p.printRunSummary(startTime)
 			return p.Init, failedNode, err
@@ -1714,7 +1950,8 @@ func (p *Processor) startProcessedQueue() (init *Node, failedNode *Node, err err
 		if p.config.GetDeadlockDetection() &&
 			p.queue.Len() == queueLenBefore &&
 			p.dedupHitsInExpansion == 0 &&
-			yp.actionDepth < int(p.config.Options.MaxActions) {
+			yp.actionDepth < int(p.config.Options.MaxActions) &&
+			!p.isTerminalState(yp) {
 			if p.earlyDeadlock == nil {
 				p.earlyDeadlock = yp
 			}
@@ -1738,6 +1975,11 @@ func (p *Processor) startProcessedQueue() (init *Node, failedNode *Node, err err
 		}
 	}
 
+	// Stop only takes effect between expansions, so the queue and the
+	// visited set are consistent and can be checkpointed.
+	if p.stopped.Load() && p.checkpoint != nil && p.checkpoint.dir != "" {
+		p.writeCheckpointOrWarn(startTime)
+	}
 	p.printRunSummary(startTime)
 	return p.Init, failedNode, err
 }
@@ -1755,6 +1997,7 @@ func (p *Processor) startProcessedQueue() (init *Node, failedNode *Node, err err
 func (p *Processor) drainAndFlush(startTime time.Time, prevCount *int, failedNode *Node) (earlyReturn bool, newFailedNode *Node) {
 	newFailedNode = failedNode
 	for len(p.pendingActionStarts) > 0 {
+		p.prefetchPending()
 		as := p.pendingActionStarts[0]
 		// Nil out so the backing array doesn't keep the popped *Node
 		// reachable after the slice header advances — matters in no_graph
@@ -1802,11 +2045,12 @@ func (p *Processor) flushExpandedYieldPoints() {
 // completion. Extracted so startProcessedQueue can share it.
 func (p *Processor) printRunSummary(startTime time.Time) {
 	if p.isTest {
-		fmt.Printf("Nodes: %d, queued: %d\n", len(p.visited), p.queue.Len())
+		fmt.Printf("Nodes: %d, queued: %d\n", p.visitedCount(), p.queue.Len())
 	} else {
-		fmt.Printf("Nodes: %d, queued: %d, elapsed: %s\n", len(p.visited), p.queue.Len(), time.Since(startTime))
+		fmt.Printf("Nodes: %d, queued: %d, elapsed: %s\n", p.visitedCount(), p.queue.Len(), time.Since(startTime))
 	}
 	p.printPeakSummary()
+	p.printPartialOrderSummary()
 }
 
 // printPeakSummary reports the peak processing-queue length observed during
@@ -1876,17 +2120,13 @@ type NextTransition struct {
 //
 // Everything created here is discarded: probe forks are never attached,
 // never enter p.queue/p.visited, and are not invariant-checked (which also
-// prevents recursion — a probed state must not re-probe). lib-level
-// allocation counters (role refs, channel ids) are snapshotted and restored
-// so the discarded execution doesn't shift ref numbering for subsequent
-// real exploration.
+// prevents recursion — a probed state must not re-probe). Role ref and
+// channel id allocation happens on the probe forks' own RefCounters, so the
+// discarded execution doesn't shift ref numbering for real exploration.
 //
 // Crash variants are intentionally excluded: a crash is not a witness that
 // an action is possible.
 func (p *Processor) probeNextStates(process *Process) []*NextTransition {
-	snapshot := lib.SnapshotGlobalRefs()
-	defer lib.RestoreGlobalRefs(snapshot)
-
 	// Temp wrapper node; ForkForAction/ForkForAlternatePaths only read it.
 	base := &Node{Process: process}
 
@@ -2051,7 +2291,7 @@ func (p *Processor) StartSimulation() (init *Node, failedNode *Node, err error)
 	}
 	livenessEnabled := false
 	livenessNode := failedNode
-	if p.config.GetLiveness() == "" || p.config.GetLiveness() == "strict" {
+	if !p.statistical && (p.config.GetLiveness() == "" || p.config.GetLiveness() == "strict") {
 		for _, file := range p.Files {
 			for _, invariant := range file.Invariants {
 				if invariant.Eventually || slices.Contains(invariant.TemporalOperators, "eventually") {
@@ -2078,11 +2318,23 @@ func (p *Processor) StartSimulation() (init *Node, failedNode *Node, err error)
 
 	p.queue.Add(p.Init)
 	liveness := false
-	for p.queue.Len() != 0 && !p.stopped {
-		node, found := p.queue.Remove()
+	guidedQueue, guided := p.queue.(*lib.RandomQueue[*Node])
+	guided = guided && p.guide != nil
+	if guided {
+		defer p.guide.runDone()
+	}
+	for p.queue.Len() != 0 && !p.stopped.Load() && !p.budgetExceeded() {
+		var node *Node
+		var found bool
+		if guided {
+			node, found = p.guide.choose(guidedQueue)
+		} else {
+			node, found = p.removeSimulationNode(p.queue)
+		}
 		if !found {
 			panic("queue should not be empty")
 		}
+		candidate := node
 
 		if livenessEnabled && !liveness && node.actionDepth > int(p.config.Options.MaxActions-1) {
 			//fmt.Println("Max actions reached, switching to liveness", p.config.Options.MaxActions)
@@ -2100,6 +2352,7 @@ func (p *Processor) StartSimulation() (init *Node, failedNode *Node, err error)
 				continue
 			}
 		}
+		p.depthReached = max(p.depthReached, node.actionDepth)
 
 		invariantFailure := false
 		symmetryFound := false
@@ -2118,7 +2371,7 @@ func (p *Processor) StartSimulation() (init *Node, failedNode *Node, err error)
 		}
 
 		if shouldClearVisited {
-			p.visited = make(map[string]*Node)
+			p.visited.Clear()
 		}
 		for {
 			inCrashPath := false
@@ -2157,7 +2410,7 @@ func (p *Processor) StartSimulation() (init *Node, failedNode *Node, err error)
 				if p.intermediateStates.Len() == 0 {
 					break
 				}
-				node, _ = p.intermediateStates.Remove()
+				node, _ = p.removeSimulationNode(p.intermediateStates)
 			} else {
 				hasAnotherCrashAction := false
 				var anotherCrashNode *Node
@@ -2180,6 +2433,12 @@ func (p *Processor) StartSimulation() (init *Node, failedNode *Node, err error)
 
 		}
 		p.intermediateStates.ClearAll()
+		if node.Process != nil {
+			p.simulationEnd = node
+			if guided {
+				p.guide.record(candidate, node)
+			}
+		}
 
 		if symmetryFound {
 			continue
@@ -2205,7 +2464,7 @@ func (p *Processor) StartSimulation() (init *Node, failedNode *Node, err error)
 		}
 
 		if node.Process != nil && !node.Process.Enabled && prevLen == 0 && len(node.Inbound[0].Node.Outbound) == 0 {
-			if !liveness && p.config.GetDeadlockDetection() {
+			if !liveness && p.config.GetDeadlockDetection() && !p.isTerminalState(node.Inbound[0].Node) {
 				failedNode = node.Inbound[0].Node
 				break
 			} else if liveness && p.config.GetDeadlockDetection() {
@@ -2297,14 +2556,24 @@ func processPreInit(init *Node, stmts []*ast.Statement, preinitHookContent strin
 }
 
 func (p *Processor) processNode(node *Node) (bool, bool) {
-	if node.Process.currentThread().currentPc() == "" && node.Name == "init" {
+	// A prefetched node has already executed on a worker (see canPrefetch,
+	// which never prefetches the init node), so its thread may be gone.
+	prefetched := node.takePrefetched()
+	if prefetched == nil && node.Process.currentThread().currentPc() == "" && node.Name == "init" {
 		if node.Process.Files[0].Actions[0].Name != "Init" {
 			return p.processInit(node), false
 		}
 
 	}
-	node.CachedHashCode = ""
-	forks, yield := node.currentThread().Execute()
+	var forks []*Process
+	var yield bool
+	if prefetched != nil {
+		forks, yield = prefetched.forks, prefetched.yield
+	} else {
+		p.recordParentEnabled(node)
+		node.CachedHashCode = ""
+		forks, yield = node.currentThread().Execute()
+	}
 	if len(forks) == 0 && !node.Enabled && !node.ThreadProgress {
 		return false, false
 	}
@@ -2366,7 +2635,15 @@ func (p *Processor) processNode(node *Node) (bool, bool) {
 		}
 	}
 
-	other, found, canonicalHash := p.findVisitedSymmetric(node)
+	var other *Node
+	var found bool
+	var canonicalHash string
+	if prefetched != nil && prefetched.canonicalHash != "" {
+		canonicalHash = prefetched.canonicalHash
+		other, found = p.lookupVisited(canonicalHash)
+	} else {
+		other, found, canonicalHash = p.findVisitedSymmetric(node)
+	}
 	if p.experimentalNoGraph {
 		// No-graph mode: visited stores hashes only (values are nil). Skip
 		// Attach (no graph edges) and skip the Enabled-vs-existing logic
@@ -2374,9 +2651,15 @@ func (p *Processor) processNode(node *Node) (bool, bool) {
 		// in no_graph mode we don't keep the existing Node to compare.
 		if found {
 			// Pure dedup hit; the current node won't be retained either.
+			// Still a live successor for the early deadlock detector, as
+			// in the graph branch below.
+			if p.fingerprints != nil {
+				p.fingerprints.reach(node, canonicalHash, yield)
+			}
+			p.dedupHitsInExpansion++
 			return false, false
 		}
-		p.visited[canonicalHash] = nil
+		p.markVisited(canonicalHash)
 	} else if found {
 		// TODO: Enabled should be a property of the link/transition, not the node.
 		// We will keep the enabled state in the node, during execution but have to be
@@ -2397,16 +2680,19 @@ func (p *Processor) processNode(node *Node) (bool, bool) {
 			return false, false
 		} else {
 			node.Attach()
-			p.visited[canonicalHash] = node
+			p.visited.Put(canonicalHash, node)
 		}
 	} else {
 		node.Attach()
-		p.visited[canonicalHash] = node
+		p.visited.Put(canonicalHash, node)
 	}
 	var failedInvariants map[int][]int
 	if yield {
 		failedInvariants = CheckInvariantsWithProber(node.Process, p.makeProber(node.Process))
 	}
+	if p.fingerprints != nil {
+		p.fingerprints.reach(node, canonicalHash, yield)
+	}
 	if len(failedInvariants[0]) > 0 {
 		//panic(fmt.Sprintf("Invariant failed: %v", failedInvariants))
 		node.Process.FailedInvariants = failedInvariants
@@ -2417,7 +2703,7 @@ func (p *Processor) processNode(node *Node) (bool, bool) {
 		}
 	}
 	if !yield {
-		for _, fork := range forks {
+		for i, fork := range forks {
 			newNode := node.ForkForAlternatePaths(fork, fork.Name)
 			if p.ShouldScheduleNode(newNode) {
 				// Intermediate forks carry choice information in fork.Name:
@@ -2425,6 +2711,7 @@ func (p *Processor) processNode(node *Node) (bool, bool) {
 				// These need to be in the trace so guided-trace replay can
 				// re-make the same nondeterministic choices.
 				p.extendPath(node, newNode, fork.Name)
+				p.recordFork(node, newNode, i)
 				p.breakParentRef(newNode)
 				p.intermediateStates.Add(newNode)
 			}
@@ -2557,7 +2844,7 @@ func (p *Processor) crashRole(node *Node, role *lib.Role) (*Node, *Node) {
 		return nil, nil
 	}
 	crashNode.Attach()
-	p.visited[canonicalHash] = crashNode
+	p.visited.Put(canonicalHash, crashNode)
 
 	// Crash variants have no forks (single deterministic crash continuation),
 	// so pass nil. In NEW mode the crash yield-point is queued like any
@@ -2586,7 +2873,7 @@ func (p *Processor) crashThread(node *Node) {
 		return
 	}
 	crashNode.Attach()
-	p.visited[canonicalHash] = crashNode
+	p.visited.Put(canonicalHash, crashNode)
 	p.publishYieldPoint(crashNode, nil)
 }
 
@@ -2625,6 +2912,15 @@ func (p *Process) minHashCode(hashes []string) string {
 // findVisitedSymmetric looks up a node in the visited map by trying all symmetry
 // permutation hashes. Returns the matching node and true if found, nil and false otherwise.
 func (p *Processor) findVisitedSymmetric(node *Node) (*Node, bool, string) {
+	hash := p.canonicalHash(node)
+	other, ok := p.lookupVisited(hash)
+	return other, ok, hash
+}
+
+// canonicalHash returns the key a node is deduplicated under: the minimum
+// hash over all symmetry permutations. It reads only the node's own process,
+// so it is safe to call from prefetch workers.
+func (p *Processor) canonicalHash(node *Node) string {
 	// Skip symmetry reduction in simulation mode (we only check one path
 	// anyway) or when explicitly disabled. Disabling keeps every persisted
 	// state concrete — no canonical renaming of symmetric values/roles —
@@ -2633,14 +2929,10 @@ func (p *Processor) findVisitedSymmetric(node *Node) (*Node, bool, string) {
 	// renamed destination state would not match them. Exact-duplicate
 	// states still dedup via the plain hash.
 	if p.simulation || p.disableSymmetryReduction {
-		hash := node.HashCode()
-		other, ok := p.visited[hash]
-		return other, ok, hash
+		return node.HashCode()
 	}
 	hashes := node.getSymmetryTranslations()
-	minHash := node.minHashCode(hashes)
-	other, ok := p.visited[minHash]
-	return other, ok, minHash
+	return node.minHashCode(hashes)
 }
 
 func (p *Process) symmetricHash(permutations map[*lib.SymmetricValue][]*lib.SymmetricValue, alt int) string {
@@ -3191,9 +3483,7 @@ func (p *Processor) YieldNode(node *Node) {
 		return
 	}
 
-	for i, action := range p.Files[0].Actions {
-		p.scheduleAction(node, nil, nil, 0, action, i)
-	}
+	p.scheduleActions(node, nil, nil, 0, p.Files[0].Actions, 0)
 	if len(node.Roles) > 0 {
 		p.scheduleRoleActions(node, nil)
 	}
@@ -3214,9 +3504,22 @@ func (p *Processor) scheduleRoleActions(node *Node, process *Process) {
 		}
 		index := roleMap[role.Name]
 		roleAst := p.Files[0].Roles[index]
-		for i, action := range roleAst.Actions {
-			p.scheduleAction(node, process, role, index, action, i)
+		p.scheduleActions(node, process, role, index, roleAst.Actions, index+1)
+	}
+}
+
+// scheduleActions schedules each of actions, in the order actionOrder[list]
+// gives if set.
+func (p *Processor) scheduleActions(node *Node, process *Process, role *lib.Role, roleIndex int,
+	actions []*ast.Action, list int) {
+	if p.actionOrder == nil {
+		for i, action := range actions {
+			p.scheduleAction(node, process, role, roleIndex, action, i)
 		}
+		return
+	}
+	for _, i := range p.actionOrder[list] {
+		p.scheduleAction(node, process, role, roleIndex, actions[i], i)
 	}
 }
 
@@ -3242,9 +3545,7 @@ func (p *Processor) YieldFork(node *Node, process *Process) {
 
 		return
 	}
-	for i, action := range p.Files[0].Actions {
-		p.scheduleAction(node, process, nil, 0, action, i)
-	}
+	p.scheduleActions(node, process, nil, 0, p.Files[0].Actions, 0)
 
 	if len(node.Roles) > 0 {
 		p.scheduleRoleActions(node, process)
@@ -3295,6 +3596,29 @@ func (p *Processor) scheduleAction(node *Node, process *Process, role *lib.Role,
 		return
 	}
 
+	newNode := newActionFork(node, process, role, roleIndex, action, actionIndex)
+	if newNode == nil {
+		return
+	}
+
+	if p.ShouldScheduleNode(newNode) {
+		// In no_graph mode, extend the lightweight action-name chain before
+		// breakParentRef nils the back-reference.
+		actionLabel := action.Name
+		if role != nil {
+			actionLabel = role.RefStringShort() + "." + action.Name
+		}
+		p.extendPath(node, newNode, actionLabel)
+		p.breakParentRef(newNode)
+		p.enqueueScheduled(newNode)
+	}
+}
+
+// newActionFork forks the node, or the process at it, to start the action,
+// with a new thread at its first statement. Returns nil if the role the
+// action belongs to is no longer in the heap.
+func newActionFork(node *Node, process *Process, role *lib.Role, roleIndex int,
+	action *ast.Action, actionIndex int) *Node {
 	newNode := node.ForkForAction(process, role, action)
 	thread := newNode.Process.NewThread()
 	//newNode.Process.Current = len(newNode.Process.Threads) - 1
@@ -3313,7 +3637,7 @@ func (p *Processor) scheduleAction(node *Node, process *Process, role *lib.Role,
 		if frame.obj == nil {
 			// This happens when a node is removed from the heap. But we cannot remove the node from
 			// the old node's `roles` list. So, we filter it out here.
-			return
+			return nil
 		}
 		frame.pc = fmt.Sprintf("Roles[%d].Actions[%d]", roleIndex, actionIndex)
 		frame.Name = role.Name + "." + action.Name
@@ -3321,21 +3645,16 @@ func (p *Processor) scheduleAction(node *Node, process *Process, role *lib.Role,
 		frame.pc = fmt.Sprintf("Actions[%d]", actionIndex)
 		frame.Name = action.Name
 	}
-
-	if p.ShouldScheduleNode(newNode) {
-		// In no_graph mode, extend the lightweight action-name chain before
-		// breakParentRef nils the back-reference.
-		actionLabel := action.Name
-		if role != nil {
-			actionLabel = role.RefStringShort() + "." + action.Name
-		}
-		p.extendPath(node, newNode, actionLabel)
-		p.breakParentRef(newNode)
-		p.enqueueScheduled(newNode)
-	}
+	return newNode
 }
 
 func (p *Processor) ExceedsActionCountLimits(action *ast.Action, statProcess *Process, role *lib.Role) bool {
+	return p.actionCountLimit(action, statProcess, role) != ""
+}
+
+// actionCountLimit returns the action_options limit the action has reached
+// in the process, as the option and its value, or "" if it has reached none.
+func (p *Processor) actionCountLimit(action *ast.Action, statProcess *Process, role *lib.Role) string {
 	actionName := action.Name
 	if role != nil {
 		actionName = role.RefStringShort() + "." + actionName
@@ -3356,29 +3675,29 @@ func (p *Processor) ExceedsActionCountLimits(action *ast.Action, statProcess *Pr
 	//fmt.Println("Concurrent stats", concurrentStats, actionName, concurrentStats[actionName], p.config.ActionOptions[actionName])
 	if p.config.ActionOptions[actionName] != nil &&
 		int(p.config.ActionOptions[actionName].MaxActions) > 0 && statProcess.Stats.Counts[actionName] >= int(p.config.ActionOptions[actionName].MaxActions) {
-		return true
+		return actionLimit(actionName, "max_actions", p.config.ActionOptions[actionName].MaxActions)
 	}
 	if p.config.ActionOptions[actionName] != nil &&
 		int(p.config.ActionOptions[actionName].GetMaxConcurrentActions()) > 0 && concurrentStats[actionName] >= int(p.config.ActionOptions[actionName].GetMaxConcurrentActions()) {
-		return true
+		return actionLimit(actionName, "max_concurrent_actions", p.config.ActionOptions[actionName].GetMaxConcurrentActions())
 	}
 	if role == nil {
-		return false
+		return ""
 	}
 	if p.config.ActionOptions[role.Name+"#."+action.Name] != nil {
 		perRoleActionLimit := p.config.ActionOptions[role.Name+"#."+action.Name].MaxActions
 		perRoleActionConcurrency := p.config.ActionOptions[role.Name+"#."+action.Name].GetMaxConcurrentActions()
 		//fmt.Println("Per role action limit", role.Name + "#." + action.Name, perRoleActionLimit)
 		if int(perRoleActionLimit) > 0 && statProcess.Stats.Counts[actionName] >= int(perRoleActionLimit) {
-			return true
+			return actionLimit(role.Name+"#."+action.Name, "max_actions", perRoleActionLimit)
 		}
 		if int(perRoleActionConcurrency) > 0 && concurrentStats[actionName] >= int(perRoleActionConcurrency) {
-			return true
+			return actionLimit(role.Name+"#."+action.Name, "max_concurrent_actions", perRoleActionConcurrency)
 		}
 	}
 	actionName = role.Name + "." + action.Name
 	if p.config.ActionOptions[actionName] == nil {
-		return false
+		return ""
 	}
 	actionCount := 0
 	for k, count := range statProcess.Stats.Counts {
@@ -3391,24 +3710,30 @@ func (p *Processor) ExceedsActionCountLimits(action *ast.Action, statProcess *Pr
 		int(p.config.ActionOptions[actionName].MaxActions) > 0 &&
 		actionCount >= int(p.config.ActionOptions[actionName].MaxActions) {
 		//fmt.Println("Exceeds action count limit", actionName, actionCount, role.RefStringShort(), action.Name)
-		return true
+		return actionLimit(actionName, "max_actions", p.config.ActionOptions[actionName].MaxActions)
 	}
 	if p.config.ActionOptions[actionName] != nil &&
 		int(p.config.ActionOptions[actionName].GetMaxConcurrentActions()) > 0 &&
 		concurrentStats[actionName] >= int(p.config.ActionOptions[actionName].GetMaxConcurrentActions()) {
 		//fmt.Println("Exceeds concurrent action count limit", actionName, concurrentStats[actionName])
-		return true
+		return actionLimit(actionName, "max_concurrent_actions", p.config.ActionOptions[actionName].GetMaxConcurrentActions())
 	}
 
-	return false
+	return ""
+}
+
+func actionLimit(key string, option string, limit int64) string {
+	return fmt.Sprintf("action_options[%s].%s: %d", key, option, limit)
 }
 
 func (p *Processor) Stop() {
-	p.stopped = true
+	interrupted := "interrupted"
+	p.stopReason.CompareAndSwap(nil, &interrupted)
+	p.stopped.Store(true)
 }
 
 func (p *Processor) Stopped() bool {
-	return p.stopped
+	return p.stopped.Load()
 }
 
 func (p *Processor) checkLiveness(node *Node) (*InvariantPosition, *Node, bool) {
@@ -1,15 +1,20 @@
 package modelchecker
 
 import (
+	"bytes"
+	"encoding/json"
 	ast "fizz/proto"
 	"fmt"
 	"io"
 	"io/ioutil"
 	"os"
 	"path/filepath"
+	"slices"
+	"strings"
 	"testing"
 	"time"
 
+	"github.com/fizzbee-io/fizzbee/lib"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 	"go.starlark.net/starlark"
@@ -102,7 +107,7 @@ func TestProcessor_Start(t *testing.T) {
 	}, false, 0, "", "", false, nil, nil, "")
 	root, _, _ := p1.Start()
 	assert.NotNil(t, root)
-	assert.Equal(t, 91, len(p1.visited))
+	assert.Equal(t, 91, p1.visited.Len())
 }
 
 func printFileNames(rootDir string) error {
@@ -537,8 +542,8 @@ func TestProcessor_Tutorials(t *testing.T) {
 			root, _, err := p1.Start()
 			require.Nil(t, err)
 			require.NotNil(t, root)
-			assert.Equal(t, test.expectedNodes, len(p1.visited))
-			fmt.Printf("Completed Nodes: %d, elapsed: %s\n", len(p1.visited), time.Since(startTime))
+			assert.Equal(t, test.expectedNodes, p1.visited.Len())
+			fmt.Printf("Completed Nodes: %d, elapsed: %s\n", p1.visited.Len(), time.Since(startTime))
 
 			//RemoveMergeNodes(root)
 			// Print the modified graph
@@ -566,6 +571,270 @@ func TestProcessor_Tutorials(t *testing.T) {
 	}
 }
 
+// TestProcessor_Workers checks that parallel BFS explores exactly the same
+// state space and finds the same counterexample as the single-threaded run.
+func TestProcessor_Workers(t *testing.T) {
+	runfilesDir := os.Getenv("RUNFILES_DIR")
+	tests := []struct {
+		filename    string
+		stateConfig string
+	}{
+		{
+			filename:    "examples/comparisons/ewd426-token-ring/TokenRing.json",
+			stateConfig: "examples/comparisons/ewd426-token-ring/fizz.yaml",
+		},
+		{
+			filename:    "examples/comparisons/diehard/DieHard.json",
+			stateConfig: "examples/comparisons/diehard/fizz.yaml",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.filename, func(t *testing.T) {
+			file, err := readAstFromFile(filepath.Join(runfilesDir, "_main", test.filename))
+			require.Nil(t, err)
+			stateConfig, err := ReadOptionsFromYaml(filepath.Join(runfilesDir, "_main", test.stateConfig))
+			require.Nil(t, err)
+
+			run := func(workers int) (int, []string) {
+				p := NewProcessor([]*ast.File{file}, stateConfig, false, 0, "", "", true, nil, nil, "")
+				p.SetWorkers(workers)
+				_, failedNode, err := p.Start()
+				require.Nil(t, err)
+				var path []string
+				for n := failedNode; n != nil && len(n.Inbound) > 0; n = n.Inbound[0].Node {
+					path = append(path, n.Inbound[0].Name)
+				}
+				return p.visited.Len(), path
+			}
+			expectedNodes, expectedPath := run(1)
+			nodes, path := run(4)
+			assert.Equal(t, expectedNodes, nodes)
+			assert.Equal(t, expectedPath, path)
+		})
+	}
+}
+
+// TestProcessor_DiskSpill checks that spilling the visited set and frontier
+// to disk, with a tiny in-memory budget, explores the same state space as the
+// in-memory no-graph run.
+func TestProcessor_DiskSpill(t *testing.T) {
+	runfilesDir := os.Getenv("RUNFILES_DIR")
+	tests := []struct {
+		filename    string
+		stateConfig string
+	}{
+		{
+			filename:    "examples/tutorials/20-for-stmt-parallel-check-again/ForLoop.json",
+			stateConfig: "examples/tutorials/20-for-stmt-parallel-check-again/fizz.yaml",
+		},
+		{
+			filename:    "examples/tutorials/38-two-dice-with-coins/TwoDice.json",
+			stateConfig: "examples/tutorials/38-two-dice-with-coins/fizz.yaml",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.filename, func(t *testing.T) {
+			file, err := readAstFromFile(filepath.Join(runfilesDir, "_main", test.filename))
+			require.Nil(t, err)
+			stateConfig, err := ReadOptionsFromYaml(filepath.Join(runfilesDir, "_main", test.stateConfig))
+			require.Nil(t, err)
+
+			run := func(spillDir string) (int, int, []string) {
+				p := NewProcessor([]*ast.File{file}, stateConfig, false, 0, "", "", true, nil, nil, "")
+				p.SetExperimentalProcessedQueue(true)
+				p.SetExperimentalNoGraph(true)
+				if spillDir != "" {
+					p.SetDiskSpill(spillDir, 2)
+				}
+				_, failedNode, err := p.Start()
+				require.Nil(t, err)
+				return p.GetVisitedNodesCount(), p.GetUniqueYieldCount(), failedNode.PathNames()
+			}
+			expectedNodes, expectedYields, expectedPath := run("")
+			spillDir := filepath.Join(t.TempDir(), "spill")
+			nodes, yields, path := run(spillDir)
+			assert.Equal(t, expectedNodes, nodes)
+			assert.Equal(t, expectedYields, yields)
+			assert.Equal(t, expectedPath, path)
+			assert.NoDirExists(t, spillDir)
+		})
+	}
+}
+
+// TestProcessor_CheckpointResume checks that resuming from the last
+// checkpoint of a run reaches the same result as the uninterrupted run.
+func TestProcessor_CheckpointResume(t *testing.T) {
+	runfilesDir := os.Getenv("RUNFILES_DIR")
+	tests := []struct {
+		filename    string
+		stateConfig string
+	}{
+		{
+			filename:    "examples/tutorials/20-for-stmt-parallel-check-again/ForLoop.json",
+			stateConfig: "examples/tutorials/20-for-stmt-parallel-check-again/fizz.yaml",
+		},
+		{
+			filename:    "examples/tutorials/38-two-dice-with-coins/TwoDice.json",
+			stateConfig: "examples/tutorials/38-two-dice-with-coins/fizz.yaml",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.filename, func(t *testing.T) {
+			file, err := readAstFromFile(filepath.Join(runfilesDir, "_main", test.filename))
+			require.Nil(t, err)
+			stateConfig, err := ReadOptionsFromYaml(filepath.Join(runfilesDir, "_main", test.stateConfig))
+			require.Nil(t, err)
+
+			newProcessor := func() *Processor {
+				p := NewProcessor([]*ast.File{file}, stateConfig, false, 0, "", "", true, nil, nil, "")
+				p.SetExperimentalProcessedQueue(true)
+				p.SetExperimentalNoGraph(true)
+				return p
+			}
+			run := func(p *Processor) (int, int, []string) {
+				_, failedNode, err := p.Start()
+				require.Nil(t, err)
+				return p.GetVisitedNodesCount(), p.GetUniqueYieldCount(), failedNode.PathNames()
+			}
+			expectedNodes, expectedYields, expectedPath := run(newProcessor())
+
+			// A tiny interval checkpoints before every expansion, so the
+			// checkpoint left behind is the one before the last expansion.
+			checkpointDir := filepath.Join(t.TempDir(), "checkpoint")
+			p := newProcessor()
+			p.SetCheckpoint(checkpointDir, time.Nanosecond)
+			run(p)
+			require.DirExists(t, checkpointDir)
+
+			for _, spill := range []bool{false, true} {
+				p := newProcessor()
+				p.SetResume(checkpointDir)
+				if spill {
+					p.SetDiskSpill(filepath.Join(t.TempDir(), "spill"), 2)
+				}
+				nodes, yields, path := run(p)
+				assert.Equal(t, expectedNodes, nodes)
+				assert.Equal(t, expectedYields, yields)
+				assert.Equal(t, expectedPath, path)
+			}
+
+			p = NewProcessor([]*ast.File{file}, stateConfig, false, 0, "", "", true, nil, nil, "")
+			p.SetExperimentalProcessedQueue(true)
+			p.SetExperimentalNoGraph(true)
+			require.Nil(t, p.SetFingerprintBits(64))
+			p.SetResume(checkpointDir)
+			_, _, err = p.Start()
+			assert.NotNil(t, err)
+		})
+	}
+}
+
+// TestProcessor_Budget checks that an exhausted budget stops the run and that
+// the partial report describes what was explored.
+func TestProcessor_Budget(t *testing.T) {
+	runfilesDir := os.Getenv("RUNFILES_DIR")
+	file, err := readAstFromFile(filepath.Join(runfilesDir, "_main", "examples/tutorials/34-simple-hour-clock/HourClock.json"))
+	require.Nil(t, err)
+	stateConfig, err := ReadOptionsFromYaml(filepath.Join(runfilesDir, "_main", "examples/tutorials/34-simple-hour-clock/fizz.yaml"))
+	require.Nil(t, err)
+	stateConfig.Ltl = []*ast.LtlProperty{{Formula: "always eventually {hour == 6}"}}
+	stateConfig.LeadsTo = []*ast.LeadsTo{{P: "hour == 1", Q: "hour == 6"}}
+
+	p := NewProcessor([]*ast.File{file}, stateConfig, false, 0, "", "", true, nil, nil, "")
+	p.SetExperimentalProcessedQueue(true)
+	p.SetBudget(NewBudget(time.Nanosecond, 0))
+	_, failedNode, err := p.Start()
+	require.Nil(t, err)
+	assert.Nil(t, failedNode)
+	assert.True(t, p.Stopped())
+	assert.Contains(t, p.StopReason(), "time budget")
+
+	report := p.PartialReport()
+	assert.Equal(t, p.StopReason(), report.Reason)
+	assert.Equal(t, p.GetVisitedNodesCount(), report.StatesExplored)
+	assert.Greater(t, report.StatesExplored, 0)
+	assert.Greater(t, report.FrontierSize, 0)
+	assert.Equal(t, report.DepthReached-1, report.CompleteDepth)
+	assert.Equal(t, []AssertionStatus{
+		{Name: "Safety", Operators: []string{"always"}, Status: AssertionHeld},
+		{Name: "Liveness", Operators: []string{"always", "eventually"}, Status: AssertionNotChecked},
+		{Name: "always eventually {hour == 6}", Operators: []string{"ltl"}, Status: AssertionNotChecked},
+		{Name: "hour == 1 ~> hour == 6", Operators: []string{"leads_to"}, Status: AssertionNotChecked},
+	}, report.Assertions)
+
+	p = NewProcessor([]*ast.File{file}, stateConfig, false, 0, "", "", true, nil, nil, "")
+	p.SetBudget(NewBudget(time.Hour, 1<<50))
+	_, _, err = p.Start()
+	require.Nil(t, err)
+	assert.False(t, p.Stopped())
+	assert.Empty(t, p.StopReason())
+}
+
+func TestProcessor_Progress(t *testing.T) {
+	runfilesDir := os.Getenv("RUNFILES_DIR")
+	file, err := readAstFromFile(filepath.Join(runfilesDir, "_main", "examples/comparisons/ewd426-token-ring/TokenRing.json"))
+	require.Nil(t, err)
+	stateConfig, err := ReadOptionsFromYaml(filepath.Join(runfilesDir, "_main", "examples/comparisons/ewd426-token-ring/fizz.yaml"))
+	require.Nil(t, err)
+
+	var buf bytes.Buffer
+	r := NewProgressReporter(&buf, time.Nanosecond)
+	p := NewProcessor([]*ast.File{file}, stateConfig, false, 0, "", "", true, nil, nil, "")
+	p.SetProgress(r)
+	_, _, err = p.Start()
+	require.Nil(t, err)
+	r.Finish(p)
+
+	var events []ProgressEvent
+	dec := json.NewDecoder(&buf)
+	for dec.More() {
+		var e ProgressEvent
+		require.Nil(t, dec.Decode(&e))
+		events = append(events, e)
+	}
+	require.Greater(t, len(events), 1)
+	for i, e := range events[:len(events)-1] {
+		assert.False(t, e.Done)
+		if i > 0 {
+			assert.GreaterOrEqual(t, e.States, events[i-1].States)
+			assert.GreaterOrEqual(t, e.ElapsedSeconds, events[i-1].ElapsedSeconds)
+		}
+	}
+	last := events[len(events)-1]
+	assert.True(t, last.Done)
+	assert.Equal(t, p.GetVisitedNodesCount(), last.States)
+	assert.Equal(t, p.GetUniqueYieldCount(), last.UniqueStates)
+}
+
+// TestProcessor_FingerprintBits checks that compact fingerprints dedup the
+// same states as full hashes, and that the collision bound shrinks with size.
+func TestProcessor_FingerprintBits(t *testing.T) {
+	runfilesDir := os.Getenv("RUNFILES_DIR")
+	file, err := readAstFromFile(filepath.Join(runfilesDir, "_main", "examples/comparisons/ewd426-token-ring/TokenRing.json"))
+	require.Nil(t, err)
+	stateConfig, err := ReadOptionsFromYaml(filepath.Join(runfilesDir, "_main", "examples/comparisons/ewd426-token-ring/fizz.yaml"))
+	require.Nil(t, err)
+
+	run := func(bits int) (int, float64) {
+		p := NewProcessor([]*ast.File{file}, stateConfig, false, 0, "", "", true, nil, nil, "")
+		require.Nil(t, p.SetFingerprintBits(bits))
+		_, _, err := p.Start()
+		require.Nil(t, err)
+		return p.visited.Len(), p.CollisionProbability()
+	}
+	fullNodes, fullProb := run(FullHashBits)
+	nodes128, prob128 := run(128)
+	nodes64, prob64 := run(64)
+	assert.Equal(t, fullNodes, nodes128)
+	assert.Equal(t, fullNodes, nodes64)
+	assert.Greater(t, prob64, prob128)
+	assert.Greater(t, prob128, fullProb)
+	assert.Less(t, prob64, 1e-9)
+
+	p := NewProcessor([]*ast.File{file}, stateConfig, false, 0, "", "", true, nil, nil, "")
+	assert.NotNil(t, p.SetFingerprintBits(32))
+}
+
 func readAstFromFile(filename string) (*ast.File, error) {
 	jsonFile, err := os.Open(filename)
 	if err != nil {
@@ -601,3 +870,669 @@ func WriteFile(t *testing.T, tempDir string, filename string, content []byte) {
 		t.Fatalf("Failed to write file: %v", err)
 	}
 }
+
+// TestProcessor_PartialOrderReduction checks that reducing the interleavings
+// of independent roles visits fewer states and still finds the deadlock, and
+// that specs with liveness assertions are refused.
+func TestProcessor_PartialOrderReduction(t *testing.T) {
+	runfilesDir := os.Getenv("RUNFILES_DIR")
+	file, err := readAstFromFile(filepath.Join(runfilesDir, "_main", "examples/tutorials/52-independent-roles/Counters.json"))
+	require.Nil(t, err)
+	stateConfig, err := ReadOptionsFromYaml(filepath.Join(runfilesDir, "_main", "examples/tutorials/52-independent-roles/fizz.yaml"))
+	require.Nil(t, err)
+
+	run := func(reduce bool) (int, []string) {
+		p := NewProcessor([]*ast.File{file}, stateConfig, false, 0, "", "", true, nil, nil, "")
+		p.SetExperimentalProcessedQueue(true)
+		p.SetExperimentalNoGraph(true)
+		if reduce {
+			require.Nil(t, p.SetPartialOrderReduction())
+			assert.Equal(t, []string{"role Counter: reduced"}, p.PartialOrderNotes())
+		}
+		_, _, err := p.Start()
+		require.Nil(t, err)
+		deadlock := p.GetEarlyDeadlock()
+		require.NotNil(t, deadlock)
+		return p.GetVisitedNodesCount(), deadlock.PathNames()
+	}
+	fullNodes, _ := run(false)
+	nodes, path := run(true)
+	assert.Less(t, nodes, fullNodes)
+	// Each of the three counters incremented to MAX.
+	assert.Len(t, path, 6)
+
+	file, err = readAstFromFile(filepath.Join(runfilesDir, "_main", "examples/tutorials/37-unfair-coin-toss-labels/FairCoin.json"))
+	require.Nil(t, err)
+	p := NewProcessor([]*ast.File{file}, &ast.StateSpaceOptions{}, false, 0, "", "", true, nil, nil, "")
+	p.SetExperimentalProcessedQueue(true)
+	assert.ErrorContains(t, p.SetPartialOrderReduction(), "liveness assertion 'Liveness'")
+
+	p = NewProcessor([]*ast.File{file}, &ast.StateSpaceOptions{Ltl: []*ast.LtlProperty{{Name: "Toss", Formula: "eventually {True}"}}}, false, 0, "", "", true, nil, nil, "")
+	assert.ErrorContains(t, p.SetPartialOrderReduction(), "ltl property 'Toss'")
+
+	p = NewProcessor([]*ast.File{file}, &ast.StateSpaceOptions{LeadsTo: []*ast.LeadsTo{{Name: "Tossed", P: "True", Q: "taken(FairToss)"}}}, false, 0, "", "", true, nil, nil, "")
+	assert.ErrorContains(t, p.SetPartialOrderReduction(), "leads_to property 'Tossed'")
+}
+
+// TestProcessor_TerminalState checks that a stuck state the terminal_state
+// option accepts is not reported as a deadlock, by the graph or by the
+// early check of the processed queue, and that the mistakes in the option
+// are reported.
+func TestProcessor_TerminalState(t *testing.T) {
+	runfilesDir := os.Getenv("RUNFILES_DIR")
+	file, err := readAstFromFile(filepath.Join(runfilesDir, "_main", "examples/tutorials/52-independent-roles/Counters.json"))
+	require.Nil(t, err)
+	// AllDone returns whether every counter is done, and NoReturn falls off
+	// the end, returning None.
+	file.Functions = append(file.Functions,
+		&ast.Function{Name: "AllDone", Flow: ast.Flow_FLOW_ATOMIC, Block: &ast.Block{Flow: ast.Flow_FLOW_ATOMIC, Stmts: []*ast.Statement{
+			{ReturnStmt: &ast.ReturnStmt{PyExpr: "all([c.value == MAX for c in counters])", Expr: &ast.Expr{PyExpr: "all([c.value == MAX for c in counters])"}}},
+		}}},
+		&ast.Function{Name: "NoReturn", Flow: ast.Flow_FLOW_ATOMIC, Block: &ast.Block{Flow: ast.Flow_FLOW_ATOMIC, Stmts: []*ast.Statement{
+			{PyStmt: &ast.PyStmt{Code: "pass"}},
+		}}},
+	)
+
+	tests := []struct {
+		terminal string
+		deadlock bool
+		startErr string
+		err      string
+	}{
+		{terminal: "", deadlock: true},
+		{terminal: "all([c.value == 2 for c in counters])", deadlock: false},
+		{terminal: "all([c.value == 1 for c in counters])", deadlock: true},
+		{terminal: "AllDone", deadlock: false},
+		{terminal: "NoReturn", deadlock: true},
+		{terminal: "all([c.value == 2 for c in counters]", startErr: "terminal_state:"},
+		{terminal: "all([c.value == 2 for c in countrs])", err: "countrs"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.terminal, func(t *testing.T) {
+			stateConfig, err := ReadOptionsFromYaml(filepath.Join(runfilesDir, "_main", "examples/tutorials/52-independent-roles/fizz.yaml"))
+			require.Nil(t, err)
+			stateConfig.TerminalState = tt.terminal
+
+			p := NewProcessor([]*ast.File{file}, stateConfig, false, 0, "", "", true, nil, nil, "")
+			root, _, err := p.Start()
+			if tt.startErr != "" {
+				assert.ErrorContains(t, err, tt.startErr)
+				return
+			}
+			require.Nil(t, err)
+			_, _, deadlock, _, err := GetAllNodesWithTerminalStates(root, stateConfig.GetOptions().GetMaxActions(), p.IsTerminalState)
+			if tt.err != "" {
+				assert.ErrorContains(t, err, tt.err)
+			} else {
+				require.Nil(t, err)
+				assert.Equal(t, tt.deadlock, deadlock != nil)
+			}
+
+			p = NewProcessor([]*ast.File{file}, stateConfig, false, 0, "", "", true, nil, nil, "")
+			p.SetExperimentalProcessedQueue(true)
+			_, _, err = startCatchingModelErrors(p)
+			if tt.err != "" {
+				assert.ErrorContains(t, err, tt.err)
+				return
+			}
+			require.Nil(t, err)
+			assert.Equal(t, tt.deadlock, p.GetEarlyDeadlock() != nil)
+		})
+	}
+}
+
+// TestProcessor_ExplainDeadlock checks the explanation of why nothing is
+// enabled in the stuck state of a deadlock.
+func TestProcessor_ExplainDeadlock(t *testing.T) {
+	runfilesDir := os.Getenv("RUNFILES_DIR")
+	tests := []struct {
+		filename string
+		expected []string
+	}{
+		{
+			filename: "examples/tutorials/52-independent-roles/Counters.json",
+			expected: []string{
+				"Counter#0.Inc: require self.value < MAX is false (line 12), with self.value = 2, MAX = 2",
+				"Counter#1.Inc: require self.value < MAX is false (line 12), with self.value = 2, MAX = 2",
+				"Counter#2.Inc: require self.value < MAX is false (line 12), with self.value = 2, MAX = 2",
+			},
+		},
+		{
+			filename: "examples/tutorials/20-for-stmt-parallel-check-again/ForLoop.json",
+			expected: []string{
+				"thread-0 (Remove): runs without changing the state",
+				"thread-1 (Remove): runs without changing the state",
+				"Remove: limited by max_concurrent_actions: 2",
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.filename, func(t *testing.T) {
+			file, err := readAstFromFile(filepath.Join(runfilesDir, "_main", tt.filename))
+			require.Nil(t, err)
+			stateConfig, err := ReadOptionsFromYaml(filepath.Join(runfilesDir, "_main", filepath.Dir(tt.filename), "fizz.yaml"))
+			require.Nil(t, err)
+
+			p := NewProcessor([]*ast.File{file}, stateConfig, false, 0, "", "", true, nil, nil, "")
+			root, _, err := p.Start()
+			require.Nil(t, err)
+			_, _, deadlock, _ := GetAllNodes(root, stateConfig.GetOptions().GetMaxActions())
+			require.NotNil(t, deadlock)
+			var explanation []string
+			for _, d := range p.ExplainDeadlock(deadlock) {
+				explanation = append(explanation, d.String())
+			}
+			assert.Equal(t, tt.expected, explanation)
+		})
+	}
+}
+
+// TestProcessor_Swarm checks that a swarm stops at the first violation, and
+// that when none is found its workers together cover the whole state space.
+func TestProcessor_Swarm(t *testing.T) {
+	runfilesDir := os.Getenv("RUNFILES_DIR")
+	run := func(filename, stateConfigFile string) *Swarm {
+		file, err := readAstFromFile(filepath.Join(runfilesDir, "_main", filename))
+		require.Nil(t, err)
+		stateConfig, err := ReadOptionsFromYaml(filepath.Join(runfilesDir, "_main", stateConfigFile))
+		require.Nil(t, err)
+		s := NewSwarm(4, 1, int(stateConfig.GetOptions().GetMaxActions()))
+		s.Run(func(w *SwarmWorker) *Processor {
+			return NewProcessor([]*ast.File{file}, stateConfig, false, w.Seed, "", w.Strategy, true, nil, nil, "")
+		}, nil)
+		return s
+	}
+
+	var strategies []string
+	var bounds []int
+	for _, w := range NewSwarm(4, 1, 10).Workers {
+		strategies = append(strategies, w.Strategy)
+		bounds = append(bounds, w.MaxActions)
+	}
+	assert.Equal(t, []string{"random", "dfs", "random", "dfs"}, strategies)
+	assert.Equal(t, []int{10, 9, 7, 5}, bounds)
+	assert.Equal(t, NewSwarm(4, 1, 10).Workers[3].Seed, NewSwarm(4, 1, 10).Workers[3].Seed)
+
+	s := run("examples/comparisons/diehard/DieHard.json", "examples/comparisons/diehard/fizz.yaml")
+	winner := s.Winner()
+	require.NotNil(t, winner)
+	require.NotNil(t, winner.Failed)
+	assert.NotEmpty(t, winner.Failed.FailedInvariants[0])
+	for _, w := range s.Workers {
+		assert.True(t, w == winner || w.Processor.Stopped() || w.Violation())
+	}
+	assert.False(t, s.Stopped())
+
+	s = run("examples/tutorials/38-two-dice-with-coins/TwoDice.json", "examples/tutorials/38-two-dice-with-coins/fizz.yaml")
+	require.Nil(t, s.Winner())
+	file, err := readAstFromFile(filepath.Join(runfilesDir, "_main", "examples/tutorials/38-two-dice-with-coins/TwoDice.json"))
+	require.Nil(t, err)
+	stateConfig, err := ReadOptionsFromYaml(filepath.Join(runfilesDir, "_main", "examples/tutorials/38-two-dice-with-coins/fizz.yaml"))
+	require.Nil(t, err)
+	p := NewProcessor([]*ast.File{file}, stateConfig, false, 0, "", "", true, nil, nil, "")
+	_, _, err = p.Start()
+	require.Nil(t, err)
+	distinct, total := s.Coverage()
+	assert.Equal(t, p.GetVisitedNodesCount(), distinct)
+	assert.GreaterOrEqual(t, total, distinct)
+}
+
+// TestProcessor_SimulationPool checks that concurrent simulation runs are
+// returned in run order and report the same first failure as running the
+// same seeds one after another.
+func TestProcessor_SimulationPool(t *testing.T) {
+	runfilesDir := os.Getenv("RUNFILES_DIR")
+	file, err := readAstFromFile(filepath.Join(runfilesDir, "_main", "examples/comparisons/diehard/DieHard.json"))
+	require.Nil(t, err)
+	stateConfig, err := ReadOptionsFromYaml(filepath.Join(runfilesDir, "_main", "examples/comparisons/diehard/fizz.yaml"))
+	require.Nil(t, err)
+	newProcessor := func(seed int64) *Processor {
+		return NewProcessor([]*ast.File{file}, stateConfig, true, seed, "", "", true, nil, nil, "")
+	}
+
+	pathNames := func(failedNode, root *Node) []string {
+		var names []string
+		for _, link := range ExtractFailurePath(failedNode, root) {
+			names = append(names, link.Name)
+		}
+		return names
+	}
+
+	const maxRuns = 200
+	expectedRun := -1
+	var expectedPath []string
+	for i := 0; i < maxRuns; i++ {
+		p := newProcessor(SimulationSeed(7, i))
+		root, failedNode, err := p.Start()
+		require.Nil(t, err)
+		if failedNode != nil {
+			expectedRun = i
+			expectedPath = pathNames(failedNode, root)
+			break
+		}
+	}
+	require.GreaterOrEqual(t, expectedRun, 0)
+
+	pool := NewSimulationPool(4, maxRuns, 7, newProcessor)
+	defer pool.Stop()
+	for i := 0; ; i++ {
+		run := pool.Next(nil)
+		require.NotNil(t, run)
+		assert.Equal(t, i, run.Index)
+		assert.Equal(t, SimulationSeed(7, i), run.Seed)
+		require.Nil(t, run.Err)
+		if run.Failed != nil {
+			assert.Equal(t, expectedRun, run.Index)
+			assert.Equal(t, expectedPath, pathNames(run.Failed, run.Root))
+			break
+		}
+	}
+}
+
+func TestProcessor_SimulationGuide(t *testing.T) {
+	runfilesDir := os.Getenv("RUNFILES_DIR")
+	file, err := readAstFromFile(filepath.Join(runfilesDir, "_main", "examples/comparisons/diehard/DieHard.json"))
+	require.Nil(t, err)
+	stateConfig, err := ReadOptionsFromYaml(filepath.Join(runfilesDir, "_main", "examples/comparisons/diehard/fizz.yaml"))
+	require.Nil(t, err)
+	// The shortest way to 4 gallons takes 6 actions, so with no slack a
+	// uniform random walk rarely finds it.
+	stateConfig.Options.MaxActions = 6
+
+	// runsToFailure returns the number of the first run that fails the
+	// CheckBigJug invariant, or 0 if none of maxRuns does.
+	const maxRuns = 2000
+	runsToFailure := func(guide *SimulationGuide) int {
+		for i := 0; i < maxRuns; i++ {
+			p := NewProcessor([]*ast.File{file}, stateConfig, true, SimulationSeed(5, i), "", "", true, nil, nil, "")
+			if guide != nil {
+				p.SetSimulationGuide(guide)
+			}
+			_, failedNode, err := p.Start()
+			require.Nil(t, err)
+			if failedNode != nil {
+				return i + 1
+			}
+		}
+		return 0
+	}
+
+	guide := NewSimulationGuide()
+	guided := runsToFailure(guide)
+	require.NotZero(t, guided)
+	unguided := runsToFailure(nil)
+	assert.True(t, unguided == 0 || guided < unguided, "guided: %d runs, unguided: %d runs", guided, unguided)
+
+	history := guide.History()
+	require.NotEmpty(t, history)
+	assert.Equal(t, 1, history[0].Runs)
+	assert.Equal(t, CoveragePoint{Runs: guided, States: guide.Coverage().States}, history[len(history)-1])
+	for i := 1; i < len(history); i++ {
+		assert.Greater(t, history[i].Runs, history[i-1].Runs)
+		assert.GreaterOrEqual(t, history[i].States, history[i-1].States)
+	}
+}
+
+func TestProcessor_StatisticalCheck(t *testing.T) {
+	runfilesDir := os.Getenv("RUNFILES_DIR")
+	dir := filepath.Join(runfilesDir, "_main", "examples/tutorials/53-biased-coin-smc")
+	file, err := readAstFromFile(filepath.Join(dir, "BiasedCoin.json"))
+	require.Nil(t, err)
+	stateConfig, err := ReadOptionsFromYaml(filepath.Join(dir, "fizz.yaml"))
+	require.Nil(t, err)
+	stateConfig.ContinuePathOnInvariantFailures = true
+	biased := &ast.PerformanceModel{}
+	require.Nil(t, lib.ReadProtoFromFile(filepath.Join(dir, "perf_model.yaml"), biased))
+
+	// run records simulation runs until check is done and returns the
+	// number of runs.
+	run := func(check *StatisticalCheck, model *ast.PerformanceModel) int {
+		i := 0
+		for ; !check.Done(); i++ {
+			require.Less(t, i, 100000)
+			p := NewProcessor([]*ast.File{file}, stateConfig, true, SimulationSeed(11, i), "", "", true, nil, nil, "")
+			p.SetStatistical(model)
+			_, _, err := p.Start()
+			require.Nil(t, err)
+			check.Record(p)
+		}
+		return i
+	}
+
+	// Two tosses of a coin: two heads with probability 1/4 when fair, and
+	// 0.81 when heads has probability 0.9.
+	for _, test := range []struct {
+		model    *ast.PerformanceModel
+		twoHeads float64
+	}{
+		{nil, 0.25},
+		{biased, 0.81},
+	} {
+		check, err := NewStatisticalCheck(file, StatisticalOptions{Confidence: 0.95, ErrorBound: 0.02})
+		require.Nil(t, err)
+		assert.Equal(t, check.RequiredRuns(), run(check, test.model))
+		results := check.Results()
+		require.Len(t, results, 2)
+		assert.Equal(t, "AtMostOneHead", results[0].Assertion)
+		assert.Equal(t, propertyAlways, results[0].Property)
+		assert.Equal(t, propertyReach, results[1].Property)
+		assert.InDelta(t, 1-test.twoHeads, results[0].Estimate, 0.02)
+		assert.InDelta(t, test.twoHeads, results[1].Estimate, 0.02)
+		assert.LessOrEqual(t, results[1].Low, test.twoHeads)
+		assert.GreaterOrEqual(t, results[1].High, test.twoHeads)
+	}
+
+	check, err := NewStatisticalCheck(file, StatisticalOptions{Confidence: 0.95, Threshold: 0.7, Indifference: 0.03})
+	require.Nil(t, err)
+	assert.Zero(t, check.RequiredRuns())
+	run(check, nil)
+	results := check.Results()
+	assert.Equal(t, DecisionHolds, results[0].Decision)
+	assert.Equal(t, DecisionFails, results[1].Decision)
+
+	_, err = NewStatisticalCheck(file, StatisticalOptions{Confidence: 0.95, Threshold: 0.99, Indifference: 0.05})
+	assert.NotNil(t, err)
+}
+
+func TestProcessor_CheckLtl(t *testing.T) {
+	runfilesDir := os.Getenv("RUNFILES_DIR")
+	tests := []struct {
+		dir        string
+		file       string
+		predicates map[string]string
+		formula    string
+		holds      bool
+	}{
+		// Tick is not fair, so the clock may stop at any hour.
+		{dir: "34-simple-hour-clock", file: "HourClock.json", formula: "always {hour >= 1 and hour <= 12}", holds: true},
+		{dir: "34-simple-hour-clock", file: "HourClock.json", formula: "always eventually {hour == 6}", holds: false},
+		{dir: "34-simple-hour-clock", file: "HourClock.json", formula: "{hour == 1} && next ({hour == 2} || {hour == 1})", holds: true},
+		{dir: "34-simple-hour-clock", file: "HourClock.json", formula: "{hour < 6} until {hour == 6}", holds: false},
+		{dir: "34-simple-hour-clock", file: "HourClock.json", formula: "{hour < 6} W {hour == 6}", holds: true},
+		{dir: "34-simple-hour-clock", file: "HourClock.json", formula: "always ({hour == 12} -> next {hour == 1 or hour == 12})", holds: true},
+		{dir: "40-simple-hour-clock-init-action", file: "HourClock.json", formula: "{hour == 1}", holds: false},
+		{dir: "40-simple-hour-clock-init-action", file: "HourClock.json", formula: "eventually always {hour >= 1}", holds: true},
+		// The actions are weakly fair, so the token keeps moving, and the
+		// first counter keeps changing.
+		{
+			dir:  "../comparisons/ewd426-token-ring",
+			file: "TokenRing.json",
+			predicates: map[string]string{
+				"stable": "any([all([counters[j] == counters[0] for j in range(0, i)]) and all([counters[j] == (counters[0] - 1) % M for j in range(i, N)]) for i in range(N + 1)])",
+			},
+			formula: "eventually always stable && always (stable -> always stable)",
+			holds:   true,
+		},
+		{dir: "../comparisons/ewd426-token-ring", file: "TokenRing.json", formula: "always eventually {counters[0] == 0}", holds: true},
+		{dir: "../comparisons/ewd426-token-ring", file: "TokenRing.json", formula: "eventually always {counters[0] == 0}", holds: false},
+		{dir: "../comparisons/ewd426-token-ring", file: "TokenRing.json", formula: "{counters[0] == 1} ~> {counters[0] == 0}", holds: true},
+		// With max_actions: 1, FairToss is taken at most once.
+		{dir: "37-unfair-coin-toss-labels", file: "FairCoin.json", formula: "always (taken(FairToss) -> next always !taken(FairToss))", holds: true},
+		// An action that does not change the state is still taken.
+		{dir: "25-break-continue", file: "Loop.json", formula: "always (taken(ForContinueExample) -> always !taken(WhileContinueExample))", holds: false},
+		// Increment is limited to 4 times, and Decrement at 0 has no effect.
+		{dir: "39-actions-limit", file: "Limit.json", formula: "always ({count == 4} -> next !taken(Increment))", holds: true},
+		{dir: "39-actions-limit", file: "Limit.json", formula: "always (taken(Increment) -> always !taken(Decrement))", holds: false},
+		{dir: "39-actions-limit", file: "Limit.json", formula: "always (taken(Decrement) -> {count < 4})", holds: true},
+		{dir: "39-actions-limit", file: "Limit.json", formula: "always ({count == 0} -> !enabled(Decrement))", holds: true},
+		{dir: "39-actions-limit", file: "Limit.json", formula: "always eventually taken(Increment)", holds: false},
+	}
+	for _, test := range tests {
+		t.Run(test.dir+"/"+test.formula, func(t *testing.T) {
+			dir := filepath.Join(runfilesDir, "_main", "examples/tutorials", test.dir)
+			file, err := readAstFromFile(filepath.Join(dir, test.file))
+			require.Nil(t, err)
+			stateConfig, err := ReadOptionsFromYaml(filepath.Join(dir, "fizz.yaml"))
+			require.Nil(t, err)
+			p := NewProcessor([]*ast.File{file}, stateConfig, false, 0, "", "", false, nil, nil, "")
+			root, _, err := p.Start()
+			require.Nil(t, err)
+			nodes, _, _, _ := GetAllNodes(root, stateConfig.GetOptions().GetMaxActions())
+
+			result, err := CheckLtl(root, nodes, &ast.LtlProperty{Name: "Property", Formula: test.formula}, test.predicates)
+			require.Nil(t, err)
+			assert.Equal(t, test.holds, result.Holds)
+			if test.holds {
+				assert.Empty(t, result.Path)
+				return
+			}
+			// The cycle of the lasso returns to the node it starts from.
+			require.Less(t, result.CycleStart, len(result.Path))
+			assert.Same(t, result.Path[result.CycleStart-1].Node, result.Path[len(result.Path)-1].Node)
+		})
+	}
+
+	for _, formula := range []string{"always (p", "p until", "unknown", "{x} ->", "always {x} }", "taken(A"} {
+		_, err := ParseLtl(formula, map[string]string{"p": "x"})
+		assert.NotNil(t, err, formula)
+	}
+}
+
+func TestProcessor_CheckLeadsTo(t *testing.T) {
+	runfilesDir := os.Getenv("RUNFILES_DIR")
+	stable := "any([all([counters[j] == counters[0] for j in range(0, i)]) and all([counters[j] == (counters[0] - 1) % M for j in range(i, N)]) for i in range(N + 1)])"
+	tests := []struct {
+		dir   string
+		file  string
+		p     string
+		q     string
+		holds bool
+	}{
+		// Tick is not fair, so the clock may stop before reaching 6.
+		{dir: "34-simple-hour-clock", file: "HourClock.json", p: "hour == 1", q: "hour == 6", holds: false},
+		{dir: "34-simple-hour-clock", file: "HourClock.json", p: "hour == 1", q: "hour <= 2", holds: true},
+		{dir: "40-simple-hour-clock-init-action", file: "HourClock.json", p: "hour == 3", q: "hour == 4", holds: false},
+		// The actions are weakly fair, so the token keeps moving.
+		{dir: "../comparisons/ewd426-token-ring", file: "TokenRing.json", p: "not stable", q: "stable", holds: true},
+		{dir: "../comparisons/ewd426-token-ring", file: "TokenRing.json", p: "counters[0] == 1", q: "counters[0] == 0", holds: true},
+		{dir: "../comparisons/ewd426-token-ring", file: "TokenRing.json", p: "stable", q: "not stable", holds: false},
+		// Action predicates.
+		{dir: "34-simple-hour-clock", file: "HourClock.json", p: "hour == 1", q: "taken(Tick)", holds: false},
+		{dir: "34-simple-hour-clock", file: "HourClock.json", p: "hour == 1", q: "enabled(Tick)", holds: true},
+		{dir: "34-simple-hour-clock", file: "HourClock.json", p: "taken(Tick)", q: "hour == 6", holds: false},
+		{dir: "../comparisons/ewd426-token-ring", file: "TokenRing.json", p: "taken(CreateToken)", q: "taken(PassToken)", holds: true},
+		{dir: "../comparisons/ewd426-token-ring", file: "TokenRing.json", p: "taken(CreateToken)", q: "taken(PassToken.passtoken)", holds: true},
+		{dir: "../comparisons/ewd426-token-ring", file: "TokenRing.json", p: "stable", q: "taken(CreateToken)", holds: true},
+		{dir: "../comparisons/ewd426-token-ring", file: "TokenRing.json", p: "enabled(CreateToken)", q: "not stable", holds: false},
+	}
+	for _, test := range tests {
+		t.Run(test.dir+"/"+test.p+" ~> "+test.q, func(t *testing.T) {
+			dir := filepath.Join(runfilesDir, "_main", "examples/tutorials", test.dir)
+			file, err := readAstFromFile(filepath.Join(dir, test.file))
+			require.Nil(t, err)
+			stateConfig, err := ReadOptionsFromYaml(filepath.Join(dir, "fizz.yaml"))
+			require.Nil(t, err)
+			p := NewProcessor([]*ast.File{file}, stateConfig, false, 0, "", "", false, nil, nil, "")
+			root, _, err := p.Start()
+			require.Nil(t, err)
+			nodes, _, _, _ := GetAllNodes(root, stateConfig.GetOptions().GetMaxActions())
+
+			predicates := map[string]string{"stable": stable, "not stable": "not (" + stable + ")"}
+			property := &ast.LeadsTo{Name: "Property", P: test.p, Q: test.q}
+			result, err := CheckLeadsTo(root, nodes, property, predicates)
+			require.Nil(t, err)
+			assert.Equal(t, test.holds, result.Holds)
+			if test.holds {
+				assert.Empty(t, result.Path)
+				return
+			}
+			// The path goes through the trigger state, and never responds
+			// after it.
+			require.Less(t, result.Trigger, len(result.Path))
+			trigger := result.Path[result.Trigger].Node
+			if op, action, ok := parseActionPredicate(test.p); ok {
+				if op == "enabled" {
+					assert.True(t, slices.ContainsFunc(trigger.Outbound, func(link *Link) bool {
+						return linkTakesAction(trigger, link, action)
+					}))
+				} else {
+					// The stem ends with the transition that takes the action.
+					assert.Equal(t, action, result.Path[result.Trigger].Name)
+				}
+				return
+			}
+			expr := test.p
+			if named, ok := predicates[expr]; ok {
+				expr = named
+			}
+			holds, err := evalStateFormula(trigger.Process, expr)
+			require.Nil(t, err)
+			assert.True(t, holds)
+		})
+	}
+}
+
+// TestProcessor_NoGraphLiveness checks that liveness on the fingerprint graph
+// of the no-graph mode agrees with the liveness check on the full graph, and
+// that its lasso is a trace of the spec.
+func TestProcessor_NoGraphLiveness(t *testing.T) {
+	runfilesDir := os.Getenv("RUNFILES_DIR")
+	tests := []struct {
+		dir      string
+		file     string
+		liveness string
+		live     bool
+	}{
+		{dir: "30-unfair-coin-toss-method", file: "FairCoin.json"},
+		{dir: "37-unfair-coin-toss-labels", file: "FairCoin.json"},
+		{dir: "34-simple-hour-clock", file: "HourClock.json"},
+		// Holds in Init already, which the no-graph mode adds without
+		// processing it.
+		{dir: "34-simple-hour-clock", file: "HourClock.json", liveness: "hour >= 1", live: true},
+		{dir: "40-simple-hour-clock-init-action", file: "HourClock.json"},
+		{dir: "../comparisons/ewd426-token-ring", file: "TokenRing.json", live: true},
+		// The token keeps moving, so counters[0] never settles.
+		{dir: "../comparisons/ewd426-token-ring", file: "TokenRing.json", liveness: "counters[0] == 0"},
+	}
+	for _, test := range tests {
+		t.Run(test.dir+"/"+test.liveness, func(t *testing.T) {
+			dir := filepath.Join(runfilesDir, "_main", "examples/tutorials", test.dir)
+			newProcessor := func(noGraph bool, trace *GuidedTrace) *Processor {
+				file, err := readAstFromFile(filepath.Join(dir, test.file))
+				require.Nil(t, err)
+				if test.liveness != "" {
+					file.Invariants[len(file.Invariants)-1].Block.Stmts[0].ReturnStmt.Expr.PyExpr = test.liveness
+				}
+				stateConfig, err := ReadOptionsFromYaml(filepath.Join(dir, "fizz.yaml"))
+				require.Nil(t, err)
+				// Deadlock detection is on, as the command line defaults it,
+				// so a cycle must not end the no-graph run as a deadlock.
+				deadlockDetection := true
+				stateConfig.DeadlockDetection = &deadlockDetection
+				p := NewProcessor([]*ast.File{file}, stateConfig, false, 0, "", "", false, nil, trace, "")
+				if noGraph {
+					p.SetExperimentalProcessedQueue(true)
+					p.SetExperimentalNoGraph(true)
+					p.SetNoGraphLiveness(true)
+				}
+				return p
+			}
+
+			p := newProcessor(false, nil)
+			root, _, err := p.Start()
+			require.Nil(t, err)
+			nodes, _, _, _ := GetAllNodes(root, 0)
+			_, failedInvariant := CheckStrictLiveness(root, nodes)
+			if test.live {
+				require.Nil(t, failedInvariant)
+			}
+
+			p = newProcessor(true, nil)
+			_, failedNode, err := p.Start()
+			require.Nil(t, err)
+			require.Nil(t, failedNode)
+			require.Nil(t, p.GetEarlyDeadlock())
+			lasso := p.CheckNoGraphLiveness()
+			if failedInvariant == nil {
+				assert.Nil(t, lasso)
+				return
+			}
+			require.NotNil(t, lasso)
+			assert.Equal(t, failedInvariant.InvariantIndex, lasso.Invariant.InvariantIndex)
+			require.LessOrEqual(t, lasso.CycleStart, len(lasso.Path))
+
+			if len(lasso.Path) == 0 {
+				return
+			}
+
+			// The lasso replays as a guided trace, which closes the same cycle.
+			lines := append(append(append([]string{}, lasso.Path[:lasso.CycleStart]...), TraceCycleMarker), lasso.Path[lasso.CycleStart:]...)
+			trace, err := ParseTraceString(strings.Join(lines, "\n"))
+			require.Nil(t, err)
+			assert.True(t, trace.HasCycle)
+			p = newProcessor(false, trace)
+			_, _, err = p.Start()
+			require.Nil(t, err)
+			require.True(t, trace.IsExhausted())
+			path, cycleStart, tracedInvariant := p.TraceLasso()
+			require.NotNil(t, tracedInvariant)
+			assert.Equal(t, lasso.Invariant.InvariantIndex, tracedInvariant.InvariantIndex)
+			if lasso.CycleStart == len(lasso.Path) {
+				require.Equal(t, 1, len(path)-cycleStart)
+				assert.Equal(t, "stutter", path[cycleStart].Name)
+			} else {
+				assert.Equal(t, len(lasso.Path)-lasso.CycleStart, len(path)-cycleStart)
+			}
+		})
+	}
+}
+
+// TestProcessor_OnTheFlyLiveness checks that the on-the-fly liveness check
+// stops the exploration at a liveness failure the full check also finds, and
+// that it does not fail specs the full check passes.
+func TestProcessor_OnTheFlyLiveness(t *testing.T) {
+	runfilesDir := os.Getenv("RUNFILES_DIR")
+	tests := []struct {
+		dir      string
+		file     string
+		strategy string
+		early    bool
+	}{
+		{dir: "16-elements-counter-parallel", file: "Counter.json", strategy: "dfs", early: true},
+		{dir: "../comparisons/gossa-v1", file: "gossa.json", strategy: "dfs", early: true},
+		{dir: "../comparisons/gossa-v1", file: "gossa.json", strategy: "bfs", early: true},
+		// The state space is smaller than the interval between searches.
+		{dir: "34-simple-hour-clock", file: "HourClock.json", strategy: "dfs"},
+		{dir: "../comparisons/ewd426-token-ring", file: "TokenRing.json", strategy: "dfs"},
+	}
+	for _, test := range tests {
+		t.Run(test.dir+"/"+test.strategy, func(t *testing.T) {
+			dir := filepath.Join(runfilesDir, "_main", "examples/tutorials", test.dir)
+			file, err := readAstFromFile(filepath.Join(dir, test.file))
+			require.Nil(t, err)
+			stateConfig, err := ReadOptionsFromYaml(filepath.Join(dir, "fizz.yaml"))
+			require.Nil(t, err)
+
+			p := NewProcessor([]*ast.File{file}, stateConfig, false, 0, "", test.strategy, false, nil, nil, "")
+			root, _, err := p.Start()
+			require.Nil(t, err)
+			nodes, _, _, _ := GetAllNodes(root, stateConfig.GetOptions().GetMaxActions())
+			_, failedInvariant := CheckStrictLiveness(root, nodes)
+			explored := p.GetVisitedNodesCount()
+
+			p = NewProcessor([]*ast.File{file}, stateConfig, false, 0, "", test.strategy, false, nil, nil, "")
+			p.SetOnTheFlyLiveness(true)
+			_, failedNode, err := p.Start()
+			require.Nil(t, err)
+			require.Nil(t, failedNode)
+			path, invariant := p.OnTheFlyLivenessFailure()
+			if !test.early {
+				assert.Nil(t, invariant)
+				assert.Equal(t, explored, p.GetVisitedNodesCount())
+				return
+			}
+			require.NotNil(t, invariant)
+			require.NotNil(t, failedInvariant)
+			assert.Equal(t, failedInvariant.InvariantIndex, invariant.InvariantIndex)
+			assert.Less(t, p.GetVisitedNodesCount(), explored)
+
+			// The path is a lasso: it ends where its cycle starts, or
+			// stutters.
+			require.Greater(t, len(path), 1)
+			last := path[len(path)-1]
+			if last.Name != "stutter" {
+				assert.True(t, slices.ContainsFunc(path[:len(path)-1], func(link *Link) bool { return link.Node == last.Node }))
+			}
+		})
+	}
+}
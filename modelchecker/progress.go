@@ -0,0 +1,138 @@
+package modelchecker
+
+import (
+	"encoding/json"
+	"io"
+	"time"
+)
+
+// ProgressReporter writes a JSON-lines progress stream: one ProgressEvent per
+// interval while a run explores, and a final one marked done. Unlike the
+// "Nodes: N, queued: M" lines, the stream is meant for dashboards that chart
+// exploration live. One reporter may be shared by the processors of
+// consecutive simulation runs, like a Budget.
+type ProgressReporter struct {
+	enc      *json.Encoder
+	interval time.Duration
+
+	start      time.Time
+	last       time.Time
+	lastStates int
+
+	// Totals of the finished simulation runs.
+	runs         int
+	runStates    int
+	runUnique    int
+	runMaxDepth  int
+	runPeakQueue int
+}
+
+// ProgressEvent is one line of the progress stream.
+type ProgressEvent struct {
+	ElapsedSeconds float64 `json:"elapsed_seconds"`
+	// States is the number of distinct states visited; in simulation, the
+	// total over the runs so far.
+	States       int `json:"states"`
+	UniqueStates int `json:"unique_states"`
+	QueueLen     int `json:"queue_len"`
+	// Depth is the largest number of actions from Init of any explored
+	// state. In bfs, the depth currently being explored.
+	Depth int `json:"depth"`
+	// StatesPerSec is the rate of new states since the previous event.
+	StatesPerSec   float64 `json:"states_per_sec"`
+	PeakQueueLen   int     `json:"peak_queue_len"`
+	SimulationRuns int     `json:"simulation_runs,omitempty"`
+	Done           bool    `json:"done,omitempty"`
+}
+
+// NewProgressReporter returns a reporter that writes an event to w at most
+// once per interval. The clock starts now.
+func NewProgressReporter(w io.Writer, interval time.Duration) *ProgressReporter {
+	now := time.Now()
+	return &ProgressReporter{enc: json.NewEncoder(w), interval: interval, start: now, last: now}
+}
+
+// SetProgress streams the progress of the run to r. Must be called before
+// Start.
+func (p *Processor) SetProgress(r *ProgressReporter) {
+	p.progress = r
+}
+
+// reportProgress writes an event if the interval has passed. Called once per
+// processed node, so it only reads the clock. Simulation runs are reported
+// per run by SimulationRunDone instead.
+func (p *Processor) reportProgress() {
+	r := p.progress
+	if r == nil || p.simulation || time.Since(r.last) < r.interval {
+		return
+	}
+	r.write(p.progressEvent())
+}
+
+func (p *Processor) progressEvent() *ProgressEvent {
+	return &ProgressEvent{
+		States:       p.visitedCount(),
+		UniqueStates: p.uniqueYieldCount,
+		QueueLen:     p.queue.Len() + len(p.pendingActionStarts),
+		Depth:        p.depthReached,
+		PeakQueueLen: p.peakQueueLen,
+	}
+}
+
+// SimulationRunDone adds a finished simulation run to the totals and writes
+// an event if the interval has passed.
+func (r *ProgressReporter) SimulationRunDone(p *Processor) {
+	if r == nil {
+		return
+	}
+	r.runs++
+	r.runStates += p.visitedCount()
+	r.runUnique += p.uniqueYieldCount
+	r.runMaxDepth = max(r.runMaxDepth, p.depthReached)
+	r.runPeakQueue = max(r.runPeakQueue, p.peakQueueLen)
+	if time.Since(r.last) >= r.interval {
+		r.write(r.simulationEvent())
+	}
+}
+
+func (r *ProgressReporter) simulationEvent() *ProgressEvent {
+	return &ProgressEvent{
+		States:         r.runStates,
+		UniqueStates:   r.runUnique,
+		Depth:          r.runMaxDepth,
+		PeakQueueLen:   r.runPeakQueue,
+		SimulationRuns: r.runs,
+	}
+}
+
+// Finish writes the final event for the last run of p, or for all the
+// simulation runs if any were reported, and resets the simulation totals.
+func (r *ProgressReporter) Finish(p *Processor) {
+	if r == nil {
+		return
+	}
+	var e *ProgressEvent
+	if r.runs > 0 {
+		e = r.simulationEvent()
+	} else if p != nil {
+		e = p.progressEvent()
+	} else {
+		e = &ProgressEvent{}
+	}
+	e.Done = true
+	r.write(e)
+	r.runs, r.runStates, r.runUnique, r.runMaxDepth, r.runPeakQueue = 0, 0, 0, 0, 0
+}
+
+// write fills in the timings of e and writes it. Write errors are ignored:
+// progress is best effort and must not fail the run.
+func (r *ProgressReporter) write(e *ProgressEvent) {
+	now := time.Now()
+	e.ElapsedSeconds = now.Sub(r.start).Seconds()
+	if d := now.Sub(r.last).Seconds(); d > 0 {
+		e.StatesPerSec = float64(e.States-r.lastStates) / d
+	}
+	r.last = now
+	r.lastStates = e.States
+	_ = r.enc.Encode(e)
+}
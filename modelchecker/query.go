@@ -0,0 +1,575 @@
+package modelchecker
+
+import (
+	"encoding/json"
+	"errors"
+	"fizz/proto"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"go.starlark.net/starlark"
+)
+
+// StepsReward is the reward of R queries that counts the steps, the
+// transitions between yield states.
+const StepsReward = "steps"
+
+// Query is a probabilistic property of the state graph, in a subset of
+// PCTL:
+//
+//	P=? [ F {leader != None} ]             probability of reaching a state
+//	P>=0.99 [ F<=10 {leader != None} ]     ... within 10 steps, checked
+//	P=? [ {phase != "done"} U {committed} ] probability of until
+//	P=? [ G<=5 {len(queue) < 3} ]          probability of holding globally
+//	R{latency}=? [ F {phase == "done"} ]   expected counter until reached
+//	R{steps}=? [ F {leader != None} ]      expected steps until reached
+//
+// State formulas are Starlark expressions in braces, evaluated like
+// assertions on the variables of each state, or true. Steps are the
+// transitions into yield states, so the Init action counts as one.
+type Query struct {
+	Text string `json:"query"`
+	// Reward is the counter of an R query, or StepsReward; empty for P.
+	Reward string `json:"reward,omitempty"`
+	// Compare is "=?" to compute the value, or the operator to compare it
+	// with Bound.
+	Compare string  `json:"compare"`
+	Bound   float64 `json:"bound,omitempty"`
+	// Operator is F, G or U. Left is the left operand of U.
+	Operator string `json:"operator"`
+	Left     string `json:"left,omitempty"`
+	Right    string `json:"right"`
+	// Steps bounds the path formula, or is -1.
+	Steps int `json:"steps"`
+}
+
+// QueryResult is the value of a query from the initial state.
+type QueryResult struct {
+	Query string  `json:"query"`
+	Value float64 `json:"value"`
+	// Satisfied is set for the queries that compare with a bound.
+	Satisfied *bool  `json:"satisfied,omitempty"`
+	Error     string `json:"error,omitempty"`
+}
+
+// MarshalJSON writes an infinite value, the expected reward of a state that
+// is not reached almost surely, as the string "Infinity".
+func (r QueryResult) MarshalJSON() ([]byte, error) {
+	type result QueryResult
+	if !math.IsInf(r.Value, 1) {
+		return json.Marshal(result(r))
+	}
+	return json.Marshal(struct {
+		result
+		Value string `json:"value"`
+	}{result(r), "Infinity"})
+}
+
+// ParseQueries parses one query per line of text, skipping empty lines and
+// lines starting with #.
+func ParseQueries(text string) ([]*Query, error) {
+	var queries []*Query
+	for i, line := range strings.Split(text, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		q, err := ParseQuery(line)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", i+1, err)
+		}
+		queries = append(queries, q)
+	}
+	return queries, nil
+}
+
+// ParseQuery parses a single query.
+func ParseQuery(text string) (*Query, error) {
+	p := &queryParser{text: text}
+	q := &Query{Text: text, Steps: -1}
+	switch {
+	case p.consume("P"):
+	case p.consume("R"):
+		if !p.consume("{") {
+			return nil, p.errorf("expected { after R")
+		}
+		end := strings.IndexByte(p.text[p.pos:], '}')
+		if end < 0 {
+			return nil, p.errorf("expected } after the reward name")
+		}
+		q.Reward = strings.Trim(strings.TrimSpace(p.text[p.pos:p.pos+end]), `"`)
+		p.pos += end + 1
+		if q.Reward == "" {
+			return nil, p.errorf("empty reward name")
+		}
+	default:
+		return nil, p.errorf("expected P or R")
+	}
+
+	for _, op := range []string{"=?", ">=", "<=", ">", "<"} {
+		if p.consume(op) {
+			q.Compare = op
+			break
+		}
+	}
+	if q.Compare == "" {
+		return nil, p.errorf("expected =?, >=, >, <= or <")
+	}
+	if q.Compare != "=?" {
+		bound, err := p.number()
+		if err != nil {
+			return nil, err
+		}
+		q.Bound = bound
+	}
+
+	if !p.consume("[") {
+		return nil, p.errorf("expected [")
+	}
+	switch {
+	case p.consume("F"):
+		q.Operator = "F"
+	case p.consume("G"):
+		q.Operator = "G"
+	default:
+		left, err := p.stateFormula()
+		if err != nil {
+			return nil, err
+		}
+		if !p.consume("U") {
+			return nil, p.errorf("expected F, G or U")
+		}
+		q.Operator, q.Left = "U", left
+	}
+	if p.consume("<=") {
+		steps, err := p.number()
+		if err != nil {
+			return nil, err
+		}
+		if steps < 0 || steps != math.Trunc(steps) {
+			return nil, p.errorf("the step bound must be a non-negative integer")
+		}
+		q.Steps = int(steps)
+	}
+	right, err := p.stateFormula()
+	if err != nil {
+		return nil, err
+	}
+	q.Right = right
+	if !p.consume("]") {
+		return nil, p.errorf("expected ]")
+	}
+	if p.skipSpace(); p.pos != len(p.text) {
+		return nil, p.errorf("unexpected text after ]")
+	}
+	if q.Reward != "" && (q.Operator != "F" || q.Steps >= 0) {
+		return nil, errors.New("R queries support only unbounded F")
+	}
+	return q, nil
+}
+
+type queryParser struct {
+	text string
+	pos  int
+}
+
+func (p *queryParser) errorf(format string, args ...interface{}) error {
+	return fmt.Errorf("at column %d: %s", p.pos+1, fmt.Sprintf(format, args...))
+}
+
+func (p *queryParser) skipSpace() {
+	for p.pos < len(p.text) && unicode.IsSpace(rune(p.text[p.pos])) {
+		p.pos++
+	}
+}
+
+func (p *queryParser) consume(token string) bool {
+	p.skipSpace()
+	if strings.HasPrefix(p.text[p.pos:], token) {
+		p.pos += len(token)
+		return true
+	}
+	return false
+}
+
+func (p *queryParser) number() (float64, error) {
+	p.skipSpace()
+	end := p.pos
+	for end < len(p.text) && strings.ContainsRune("0123456789.eE+-", rune(p.text[end])) {
+		end++
+	}
+	value, err := strconv.ParseFloat(p.text[p.pos:end], 64)
+	if err != nil {
+		return 0, p.errorf("expected a number")
+	}
+	p.pos = end
+	return value, nil
+}
+
+// stateFormula parses true or a Starlark expression in braces, which may
+// contain braces and strings of its own.
+func (p *queryParser) stateFormula() (string, error) {
+	if p.consume("true") {
+		return "True", nil
+	}
+	if !p.consume("{") {
+		return "", p.errorf("expected a state formula: true or {expression}")
+	}
+	start, depth := p.pos, 1
+	var quote byte
+	for ; p.pos < len(p.text); p.pos++ {
+		c := p.text[p.pos]
+		switch {
+		case quote != 0:
+			if c == '\\' {
+				p.pos++
+			} else if c == quote {
+				quote = 0
+			}
+		case c == '"' || c == '\'':
+			quote = c
+		case c == '{':
+			depth++
+		case c == '}':
+			depth--
+			if depth == 0 {
+				expr := strings.TrimSpace(p.text[start:p.pos])
+				p.pos++
+				if expr == "" {
+					return "", p.errorf("empty state formula")
+				}
+				return expr, nil
+			}
+		}
+	}
+	return "", p.errorf("unterminated state formula")
+}
+
+// EvaluateQueries evaluates queries from the initial state on nodes, as
+// returned by GetAllNodes, with the branch probabilities and counters of
+// model.
+func EvaluateQueries(queries []*Query, nodes []*Node, model *proto.PerformanceModel) []QueryResult {
+	if model == nil {
+		model = &proto.PerformanceModel{}
+	}
+	results := make([]QueryResult, 0, len(queries))
+	if len(nodes) == 0 {
+		return results
+	}
+	chain := newSparseChain(nodes, model)
+	for _, q := range queries {
+		result := QueryResult{Query: q.Text}
+		value, err := chain.evaluate(q)
+		if err != nil {
+			result.Error = err.Error()
+		} else {
+			result.Value = value
+			if q.Compare != "=?" {
+				satisfied := compareQueryValue(value, q.Compare, q.Bound)
+				result.Satisfied = &satisfied
+			}
+		}
+		results = append(results, result)
+	}
+	return results
+}
+
+func compareQueryValue(value float64, compare string, bound float64) bool {
+	switch compare {
+	case ">=":
+		return value >= bound
+	case ">":
+		return value > bound
+	case "<=":
+		return value <= bound
+	default:
+		return value < bound
+	}
+}
+
+// isStepNode tells whether entering the node ends a step. The other nodes
+// are within an action, where the state formulas are not evaluated.
+func isStepNode(node *Node) bool {
+	return node.Process != nil && (node.Name == "yield" || node.Name == "crash")
+}
+
+// isStateNode tells whether the state formulas are evaluated at the node:
+// the step nodes and the initial node.
+func isStateNode(node *Node) bool {
+	return isStepNode(node) || (node.Process != nil && node.Name == "init")
+}
+
+// satisfying evaluates the state formula, or its negation, at each state
+// node. At the initial node, an expression that fails is false either way,
+// since the Init action may not have defined the variables yet.
+func (c *sparseChain) satisfying(expr string, negate bool) ([]bool, error) {
+	holds := make([]bool, len(c.nodes))
+	for i, node := range c.nodes {
+		if !isStateNode(node) {
+			continue
+		}
+		if expr == "True" {
+			holds[i] = !negate
+			continue
+		}
+		value, err := evalStateFormula(node.Process, expr)
+		if err != nil {
+			if node.Name == "init" {
+				continue
+			}
+			return nil, fmt.Errorf("evaluating {%s}: %w", expr, err)
+		}
+		holds[i] = value != negate
+	}
+	return holds, nil
+}
+
+func evalStateFormula(process *Process, expr string) (bool, error) {
+	ref := make(map[starlark.Value]starlark.Value)
+	vars := CloneDict(process.Heap.state, ref, nil, 0)
+	vars["__returns__"] = NewDictFromStringDict(process.Returns)
+	cond, err := process.Evaluator.EvalPyExprWithContext(process.Files[0].GetSourceInfo().GetFileName(), expr, vars, process.createSymmetryContext())
+	if err != nil {
+		return false, err
+	}
+	return bool(cond.Truth()), nil
+}
+
+// evaluate returns the value of the query from the initial node.
+func (c *sparseChain) evaluate(q *Query) (float64, error) {
+	// G phi is not (true U not phi).
+	right, err := c.satisfying(q.Right, q.Operator == "G")
+	if err != nil {
+		return 0, err
+	}
+	left := make([]bool, len(c.nodes))
+	for i, node := range c.nodes {
+		left[i] = isStateNode(node)
+	}
+	if q.Operator == "U" {
+		if left, err = c.satisfying(q.Left, false); err != nil {
+			return 0, err
+		}
+	}
+
+	var values []float64
+	switch {
+	case q.Reward != "":
+		values, err = c.expectedReward(q.Reward, right)
+		if err != nil {
+			return 0, err
+		}
+	case q.Steps >= 0:
+		values = c.boundedUntil(left, right, q.Steps)
+	default:
+		values = c.until(left, right)
+	}
+	if q.Operator == "G" {
+		return 1 - values[0], nil
+	}
+	return values[0], nil
+}
+
+// untilMasks returns, for phi U psi, which nodes are decided: the ones where
+// psi holds, with probability 1, and the state nodes where neither holds or
+// from which no psi node can be reached, with probability 0.
+func (c *sparseChain) untilMasks(left, right []bool) (one []bool, zero []bool) {
+	n := len(c.nodes)
+	one = right
+	// Search back from the psi nodes through the nodes the path may pass:
+	// phi state nodes and the nodes within actions.
+	pt := c.p.transpose()
+	reach := make([]bool, n)
+	var queue []int
+	for i := range right {
+		if right[i] {
+			reach[i] = true
+			queue = append(queue, i)
+		}
+	}
+	for len(queue) > 0 {
+		j := queue[len(queue)-1]
+		queue = queue[:len(queue)-1]
+		cols, vals := pt.row(j)
+		for k, i := range cols {
+			if vals[k] == 0 || reach[i] || (isStateNode(c.nodes[i]) && !left[i]) {
+				continue
+			}
+			reach[i] = true
+			queue = append(queue, i)
+		}
+	}
+	zero = make([]bool, n)
+	for i := range zero {
+		zero[i] = !reach[i]
+	}
+	return one, zero
+}
+
+// until returns the probability of phi U psi from each node, solving the
+// linear system with Gauss-Seidel.
+func (c *sparseChain) until(left, right []bool) []float64 {
+	one, zero := c.untilMasks(left, right)
+	x := make([]float64, len(c.nodes))
+	var open []int
+	for i := range x {
+		switch {
+		case one[i]:
+			x[i] = 1
+		case !zero[i]:
+			open = append(open, i)
+		}
+	}
+	c.solveBackward(x, open, func(i int, next func(j int) float64) float64 {
+		sum := 0.0
+		cols, vals := c.p.row(i)
+		for k, j := range cols {
+			sum += vals[k] * next(j)
+		}
+		return sum
+	})
+	return x
+}
+
+// boundedUntil returns the probability of phi U<=steps psi from each node.
+// x holds the probability with the remaining steps, and entering a step
+// node uses one.
+func (c *sparseChain) boundedUntil(left, right []bool, steps int) []float64 {
+	one, zero := c.untilMasks(left, right)
+	n := len(c.nodes)
+	prev := make([]float64, n)
+	x := make([]float64, n)
+	var within []int
+	for i, node := range c.nodes {
+		if !isStepNode(node) && !one[i] && !zero[i] {
+			within = append(within, i)
+		}
+	}
+	for m := 0; m <= steps; m++ {
+		// A step node moves to the nodes within its next action, or
+		// directly to the next step node, using one step.
+		for i, node := range c.nodes {
+			x[i] = 0
+			if one[i] {
+				x[i] = 1
+			} else if !zero[i] && isStepNode(node) && m > 0 {
+				cols, vals := c.p.row(i)
+				for k, j := range cols {
+					if isStepNode(c.nodes[j]) {
+						x[i] += vals[k] * prev[j]
+					}
+				}
+			}
+		}
+		// The nodes within an action reach step nodes with the same number
+		// of steps left as the step node the action started from, which
+		// may take a cycle through the action.
+		c.solveBackward(x, within, func(i int, next func(j int) float64) float64 {
+			sum := 0.0
+			cols, vals := c.p.row(i)
+			for k, j := range cols {
+				if isStepNode(c.nodes[j]) {
+					if m > 0 {
+						sum += vals[k] * prev[j]
+					}
+				} else {
+					sum += vals[k] * next(j)
+				}
+			}
+			return sum
+		})
+		for i, node := range c.nodes {
+			if !isStepNode(node) || one[i] || zero[i] || m == 0 {
+				continue
+			}
+			cols, vals := c.p.row(i)
+			for k, j := range cols {
+				if !isStepNode(c.nodes[j]) {
+					x[i] += vals[k] * x[j]
+				}
+			}
+		}
+		prev, x = x, prev
+	}
+	return prev
+}
+
+// expectedReward returns the expected reward accumulated until reaching a
+// psi node from each node, or +Inf where it is reached with probability
+// below 1.
+func (c *sparseChain) expectedReward(reward string, right []bool) ([]float64, error) {
+	n := len(c.nodes)
+	rewards := c.rewards[reward]
+	if reward == StepsReward {
+		rewards = make([]float64, n)
+		for i := range rewards {
+			cols, vals := c.p.row(i)
+			for k, j := range cols {
+				if isStepNode(c.nodes[j]) {
+					rewards[i] += vals[k]
+				}
+			}
+		}
+	} else if rewards == nil {
+		return nil, fmt.Errorf("no counter %s in the performance model", reward)
+	}
+	always := make([]bool, n)
+	for i, node := range c.nodes {
+		always[i] = isStateNode(node)
+	}
+	reach := c.until(always, right)
+	x := make([]float64, n)
+	var open []int
+	for i := range x {
+		switch {
+		case right[i]:
+		case reach[i] < 1-1e-9:
+			x[i] = math.Inf(1)
+		default:
+			open = append(open, i)
+		}
+	}
+	c.solveBackward(x, open, func(i int, next func(j int) float64) float64 {
+		sum := rewards[i]
+		cols, vals := c.p.row(i)
+		for k, j := range cols {
+			sum += vals[k] * next(j)
+		}
+		return sum
+	})
+	return x, nil
+}
+
+// solveBackward solves x[i] = value(i, x) for the open nodes with symmetric
+// Gauss-Seidel, keeping the other values of x. value reads x through next,
+// with the self loop of i solved out.
+func (c *sparseChain) solveBackward(x []float64, open []int, value func(i int, next func(j int) float64) float64) {
+	if len(open) == 0 {
+		return
+	}
+	iterateSolver(false, x, func(x, _ []float64, backward bool) float64 {
+		change := 0.0
+		for k := range open {
+			i := open[k]
+			if backward {
+				i = open[len(open)-1-k]
+			}
+			diag := c.p.get(i, i)
+			v := value(i, func(j int) float64 {
+				if j == i {
+					return 0
+				}
+				return x[j]
+			})
+			if diag < 1 {
+				v /= 1 - diag
+			}
+			change = max(change, relativeChange(x[i], v))
+			x[i] = v
+		}
+		return change
+	})
+}
@@ -0,0 +1,314 @@
+package modelchecker
+
+import (
+	"encoding/binary"
+	"fmt"
+	"slices"
+
+	"go.starlark.net/starlark"
+)
+
+// A Process cannot be deserialized (its heap holds arbitrary starlark values
+// and the evaluator), so a yield-point that leaves memory, whether spilled to
+// disk or written to a checkpoint, is stored as the recipe that produced it:
+// the sequence of scheduling and fork choices from Init. Decoding replays that
+// recipe deterministically. The replay reuses the yield-points restored for
+// the previous entry, so siblings in BFS order share most of the work.
+
+type recipeKind uint8
+
+const (
+	// recipeRoot is the Init node.
+	recipeRoot recipeKind = iota
+	// recipeStart is the index-th action-start scheduled when the parent
+	// yield-point (or the Init node, for specs without an Init action) was
+	// expanded, in pendingActionStarts order.
+	recipeStart
+	// recipeFork is the index-th fork returned by the parent's Execute.
+	recipeFork
+)
+
+// recipeStep is one step in the recipe that leads from Init to a node. Steps
+// form a linked list towards the root, like pathTail, so siblings share the
+// prefix.
+type recipeStep struct {
+	kind  recipeKind
+	index int
+	// parentEnabled is the parent process's Enabled flag observed when this
+	// node was executed. Thread.Execute reads it, and siblings executed
+	// earlier may have flipped it, so the replay restores it explicitly.
+	parentEnabled bool
+	parent        *recipeStep
+}
+
+type recipeEntry struct {
+	kind          recipeKind
+	index         int
+	parentEnabled bool
+}
+
+func (s *recipeStep) entries() []recipeEntry {
+	depth := 0
+	for r := s; r != nil; r = r.parent {
+		depth++
+	}
+	out := make([]recipeEntry, depth)
+	for r := s; r != nil; r = r.parent {
+		depth--
+		out[depth] = recipeEntry{kind: r.kind, index: r.index, parentEnabled: r.parentEnabled}
+	}
+	return out
+}
+
+type recipeReplay struct {
+	// root is a pristine copy of the Init process, taken before it runs.
+	root *Process
+	// expanding is the node whose successors are currently being scheduled.
+	// Action-starts buffered by enqueueScheduled record it as their parent.
+	expanding *Node
+	// replaying suppresses recipe recording and stats while a recipe is
+	// being replayed.
+	replaying bool
+
+	// cachedEntries and cached describe the last replayed recipe: cached[i]
+	// is the yield-point reached after cachedEntries[i], or nil when that
+	// step did not end at a yield-point.
+	cachedEntries []recipeEntry
+	cached        []*Node
+}
+
+// enableRecipes starts recording recipes for every node. Called once the
+// Init node exists and before anything runs.
+func (p *Processor) enableRecipes() {
+	if p.recipes != nil {
+		return
+	}
+	p.recipes = &recipeReplay{root: p.Init.Process.snapshot(), expanding: p.Init}
+	p.Init.recipe = &recipeStep{kind: recipeRoot}
+}
+
+// recordStart gives an action-start buffered in pendingActionStarts its
+// recipe step, relative to the node being expanded.
+func (p *Processor) recordStart(node *Node) {
+	if p.recipes == nil || p.recipes.replaying || p.recipes.expanding == nil {
+		return
+	}
+	node.recipe = &recipeStep{kind: recipeStart, index: len(p.pendingActionStarts), parent: p.recipes.expanding.recipe}
+}
+
+// recordFork gives the index-th intermediate fork of parent its recipe step.
+func (p *Processor) recordFork(parent *Node, child *Node, index int) {
+	if p.recipes == nil || p.recipes.replaying {
+		return
+	}
+	child.recipe = &recipeStep{kind: recipeFork, index: index, parent: parent.recipe}
+}
+
+// recordParentEnabled saves the parent's Enabled flag just before node runs.
+func (p *Processor) recordParentEnabled(node *Node) {
+	if node.recipe == nil {
+		return
+	}
+	node.recipe.parentEnabled = node.Process.Parent != nil && node.Process.Parent.Enabled
+}
+
+// isInitWithoutAction reports whether node is the Init node of a spec whose
+// first action is not Init. processNode hands such a node to processInit
+// instead of executing it.
+func (p *Processor) isInitWithoutAction(node *Node) bool {
+	return node.Name == "init" && node.Process.currentThread().currentPc() == "" &&
+		node.Process.Files[0].Actions[0].Name != "Init"
+}
+
+// restoreYieldPoint replays a recipe from Init and returns the yield-point it
+// leads to, in the same shape startProcessedQueue left it before it was
+// spilled or checkpointed: yieldForks set, pathTail and recipe rebuilt, ready for expansion.
+func (p *Processor) restoreYieldPoint(entries []recipeEntry) (*Node, error) {
+	s := p.recipes
+	common := 0
+	for common < len(entries) && common < len(s.cachedEntries) && entries[common] == s.cachedEntries[common] {
+		common++
+	}
+	var cursor *Node
+	start := 0
+	for i := common - 1; i >= 0; i-- {
+		if s.cached[i] != nil {
+			cursor = s.cached[i]
+			start = i + 1
+			break
+		}
+	}
+	s.cachedEntries = append(s.cachedEntries[:start], entries[start:]...)
+	s.cached = s.cached[:start]
+
+	var forks []*Process
+	for i := start; i < len(entries); i++ {
+		e := entries[i]
+		var node *Node
+		switch e.kind {
+		case recipeRoot:
+			if i != 0 {
+				return nil, fmt.Errorf("recipe step %d: root must come first", i)
+			}
+			node = NewNode(s.root.snapshot())
+		case recipeStart:
+			if cursor == nil {
+				return nil, fmt.Errorf("recipe step %d: action-start without a parent", i)
+			}
+			starts := p.replaySchedule(cursor)
+			if e.index >= len(starts) {
+				return nil, fmt.Errorf("recipe step %d: action-start %d of %d", i, e.index, len(starts))
+			}
+			node = starts[e.index]
+		case recipeFork:
+			if e.index >= len(forks) {
+				return nil, fmt.Errorf("recipe step %d: fork %d of %d", i, e.index, len(forks))
+			}
+			fork := forks[e.index]
+			node = cursor.ForkForAlternatePaths(fork, fork.Name)
+			p.extendPath(cursor, node, fork.Name)
+			p.breakParentRef(node)
+		default:
+			return nil, fmt.Errorf("recipe step %d: unknown kind %d", i, e.kind)
+		}
+		var parentRecipe *recipeStep
+		if cursor != nil {
+			parentRecipe = cursor.recipe
+		}
+		node.recipe = &recipeStep{kind: e.kind, index: e.index, parentEnabled: e.parentEnabled, parent: parentRecipe}
+		cursor = node
+
+		if e.kind == recipeRoot && p.isInitWithoutAction(node) {
+			// processInit schedules the top-level actions without
+			// executing anything; replaySchedule repeats that.
+			s.cached = append(s.cached, nil)
+			continue
+		}
+		if node.Process.Parent != nil {
+			node.Process.Parent.Enabled = e.parentEnabled
+		}
+		node.CachedHashCode = ""
+		var yield bool
+		forks, yield = node.currentThread().Execute()
+		if node.ThreadProgress {
+			node.Enable()
+		}
+		if !yield {
+			s.cached = append(s.cached, nil)
+			continue
+		}
+		node.Process.IsYield = true
+		node.yieldForks = forks
+		node.Name = "yield"
+		// Children only read their direct parent, so the replay chain
+		// behind the yield-point can be released.
+		node.Process.Parent = nil
+		s.cached = append(s.cached, node)
+		forks = nil
+	}
+	yp := s.cached[len(s.cached)-1]
+	if yp == nil {
+		return nil, fmt.Errorf("recipe of %d steps does not end at a yield-point", len(entries))
+	}
+	// The caller expands and then strips the returned yield-point, so it
+	// must not be reused as a replay prefix.
+	s.cached[len(s.cached)-1] = nil
+	return yp, nil
+}
+
+// replaySchedule repeats the scheduling startProcessedQueue does for node and
+// returns the action-starts in pendingActionStarts order.
+func (p *Processor) replaySchedule(node *Node) []*Node {
+	s := p.recipes
+	saved := p.pendingActionStarts
+	p.pendingActionStarts = nil
+	s.replaying = true
+	if node.recipe.kind == recipeRoot && p.isInitWithoutAction(node) {
+		p.processInit(node)
+	} else if len(node.yieldForks) > 0 {
+		for _, fork := range node.yieldForks {
+			p.YieldFork(node, fork)
+			fork.Children = nil
+		}
+	} else {
+		p.YieldNode(node)
+	}
+	s.replaying = false
+	starts := p.pendingActionStarts
+	p.pendingActionStarts = saved
+	node.Process.Children = nil
+	return starts
+}
+
+// snapshot returns a detached copy of p, including the scheduling flags that
+// Fork resets.
+func (p *Process) snapshot() *Process {
+	c := p.Fork()
+	p.Children = p.Children[:len(p.Children)-1]
+	c.Parent = p.Parent
+	c.Enabled = p.Enabled
+	c.ThreadProgress = p.ThreadProgress
+	c.IsYield = p.IsYield
+	c.Fairness = p.Fairness
+	c.ChoiceFairness = p.ChoiceFairness
+	c.EnableCheckpoint = p.EnableCheckpoint
+	c.FailedInvariants = p.FailedInvariants
+	c.Labels = slices.Clone(p.Labels)
+	c.Messages = slices.Clone(p.Messages)
+	c.Returns = make(starlark.StringDict, len(p.Returns))
+	for k, v := range p.Returns {
+		c.Returns[k] = v
+	}
+	for k, v := range p.Channels {
+		c.Channels[k] = v
+	}
+	return c
+}
+
+// frontierCodec encodes a frontier yield-point as its recipe: a uvarint step
+// count followed by, per step, the kind, the uvarint index and the
+// parentEnabled flag.
+type frontierCodec struct {
+	p *Processor
+}
+
+func (c *frontierCodec) Encode(node *Node) ([]byte, error) {
+	if node.recipe == nil {
+		return nil, fmt.Errorf("node %s has no recipe", node.Name)
+	}
+	entries := node.recipe.entries()
+	buf := binary.AppendUvarint(nil, uint64(len(entries)))
+	for _, e := range entries {
+		enabled := byte(0)
+		if e.parentEnabled {
+			enabled = 1
+		}
+		buf = append(buf, byte(e.kind))
+		buf = binary.AppendUvarint(buf, uint64(e.index))
+		buf = append(buf, enabled)
+	}
+	return buf, nil
+}
+
+func (c *frontierCodec) Decode(data []byte) (*Node, error) {
+	count, n := binary.Uvarint(data)
+	if n <= 0 {
+		return nil, fmt.Errorf("corrupt frontier record")
+	}
+	data = data[n:]
+	entries := make([]recipeEntry, count)
+	for i := range entries {
+		if len(data) < 1 {
+			return nil, fmt.Errorf("corrupt frontier record")
+		}
+		entries[i].kind = recipeKind(data[0])
+		index, n := binary.Uvarint(data[1:])
+		if n <= 0 || len(data) < 2+n {
+			return nil, fmt.Errorf("corrupt frontier record")
+		}
+		entries[i].index = int(index)
+		entries[i].parentEnabled = data[1+n] == 1
+		data = data[2+n:]
+	}
+	return c.p.restoreYieldPoint(entries)
+}
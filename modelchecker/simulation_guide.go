@@ -0,0 +1,173 @@
+package modelchecker
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/fizzbee-io/fizzbee/lib"
+)
+
+// SimulationGuide biases simulation runs toward unexplored behaviour. It is
+// shared by all the runs of a session and remembers how often the runs
+// reached each state, which state each action last led to from each state,
+// and how often each action led to a state no earlier run had reached. Each
+// run then picks successors in proportion to how productive their action has
+// been and how rarely the state it leads to was visited, rather than
+// uniformly at random. Actions never taken from a state count as leading to
+// a new state.
+//
+// A guided run depends on the runs before it, so unlike an unguided run it
+// cannot be replayed from its seed alone. Safe for concurrent use.
+type SimulationGuide struct {
+	mu sync.Mutex
+	// visits counts how often the runs reached each state.
+	visits map[Fingerprint]int
+	// next is the state each action last led to from each state.
+	next    map[guideTransition]Fingerprint
+	actions map[string]*guideActionStats
+	runs    int
+	// history holds the coverage after runs 1, 2, 4, 8, ... so the growth
+	// can be reported without keeping a point per run.
+	history []CoveragePoint
+}
+
+// CoveragePoint is the number of distinct states reached after Runs runs.
+type CoveragePoint struct {
+	Runs   int
+	States int
+}
+
+type guideTransition struct {
+	state  Fingerprint
+	action string
+}
+
+type guideActionStats struct {
+	taken int
+	// novel is how often taking the action reached a new state.
+	novel int
+}
+
+func NewSimulationGuide() *SimulationGuide {
+	return &SimulationGuide{
+		visits:  map[Fingerprint]int{},
+		next:    map[guideTransition]Fingerprint{},
+		actions: map[string]*guideActionStats{},
+	}
+}
+
+// SetSimulationGuide makes the simulation runs of the processor pick their
+// successors with g. Must be called before Start.
+func (p *Processor) SetSimulationGuide(g *SimulationGuide) {
+	p.guide = g
+}
+
+// transitionOf returns the state and action a candidate node continues
+// from, or false for the initial node.
+func transitionOf(node *Node) (guideTransition, bool) {
+	if len(node.Inbound) == 0 || node.Inbound[0].Node == nil || node.Inbound[0].Node.Process == nil {
+		return guideTransition{}, false
+	}
+	link := node.Inbound[0]
+	return guideTransition{state: toFingerprint(link.Node.Process.HashCode(), 128), action: link.Name}, true
+}
+
+// weight scores a candidate successor: the fraction of the times its action
+// reached a new state, smoothed so untried actions score 1/2, divided by how
+// often the runs visited the state it led to last time. Every candidate keeps
+// a positive weight, so none is ruled out.
+func (g *SimulationGuide) weight(node *Node) float64 {
+	t, ok := transitionOf(node)
+	if !ok {
+		return 1
+	}
+	novel, taken := 0, 0
+	if stats := g.actions[t.action]; stats != nil {
+		novel, taken = stats.novel, stats.taken
+	}
+	w := float64(novel+1) / float64(taken+2)
+	if next, ok := g.next[t]; ok {
+		w /= float64(1 + g.visits[next])
+	}
+	return w
+}
+
+// choose removes the next node to explore from queue.
+func (g *SimulationGuide) choose(queue *lib.RandomQueue[*Node]) (*Node, bool) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return queue.RemoveWeighted(func(nodes []*Node) []float64 {
+		weights := make([]float64, len(nodes))
+		for i, node := range nodes {
+			weights[i] = g.weight(node)
+		}
+		return weights
+	})
+}
+
+// record notes that exploring from the candidate node reached the state of
+// reached.
+func (g *SimulationGuide) record(candidate *Node, reached *Node) {
+	fp := toFingerprint(reached.Process.HashCode(), 128)
+	t, ok := transitionOf(candidate)
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	novel := g.visits[fp] == 0
+	g.visits[fp]++
+	if ok {
+		g.next[t] = fp
+		stats := g.actions[t.action]
+		if stats == nil {
+			stats = &guideActionStats{}
+			g.actions[t.action] = stats
+		}
+		stats.taken++
+		if novel {
+			stats.novel++
+		}
+	}
+}
+
+// runDone counts a finished run.
+func (g *SimulationGuide) runDone() {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.runs++
+	if g.runs&(g.runs-1) == 0 {
+		g.history = append(g.history, CoveragePoint{Runs: g.runs, States: len(g.visits)})
+	}
+}
+
+// Coverage returns the number of runs so far and the distinct states they
+// reached together.
+func (g *SimulationGuide) Coverage() CoveragePoint {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return CoveragePoint{Runs: g.runs, States: len(g.visits)}
+}
+
+// History returns how the coverage grew: the points after runs 1, 2, 4, 8,
+// ... and the current one.
+func (g *SimulationGuide) History() []CoveragePoint {
+	g.mu.Lock()
+	history := append([]CoveragePoint(nil), g.history...)
+	g.mu.Unlock()
+	if last := g.Coverage(); len(history) == 0 || history[len(history)-1] != last {
+		history = append(history, last)
+	}
+	return history
+}
+
+// PrintReport prints the coverage growth and the actions that were taken.
+func (g *SimulationGuide) PrintReport() {
+	history := g.History()
+	points := make([]string, len(history))
+	for i, point := range history {
+		points[i] = fmt.Sprintf("%d: %d", point.Runs, point.States)
+	}
+	fmt.Printf("Guided coverage (runs: distinct states): %s\n", strings.Join(points, ", "))
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	fmt.Printf("Distinct transitions taken: %d, of %d actions\n", len(g.next), len(g.actions))
+}
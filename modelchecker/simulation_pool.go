@@ -0,0 +1,184 @@
+package modelchecker
+
+import (
+	"sync"
+	"time"
+)
+
+// SimulationPool runs simulation runs concurrently on several goroutines.
+// Run i uses the seed SimulationSeed(masterSeed, i), so its outcome depends
+// neither on which worker executed it nor when, and Next hands the runs back
+// in index order. A caller that stops at the first failing run from Next
+// therefore reports the same run as a sequential campaign with those seeds
+// would, and the run can be replayed alone with its seed.
+type SimulationPool struct {
+	masterSeed   int64
+	maxRuns      int
+	window       int
+	newProcessor func(seed int64) *Processor
+
+	mu   sync.Mutex
+	cond *sync.Cond
+	// next is the index of the next run to start; consumed the number of
+	// runs Next returned. Workers run at most window runs ahead of Next, so
+	// finished runs waiting to be consumed do not pile up.
+	next     int
+	consumed int
+	finished map[int]*SimulationRun
+	running  map[int]*Processor
+	stopped  bool
+	// done is signalled whenever a run finishes.
+	done chan struct{}
+	wg   sync.WaitGroup
+}
+
+// SimulationRun is one run of a SimulationPool and its outcome.
+type SimulationRun struct {
+	Index     int
+	Seed      int64
+	Processor *Processor
+	Root      *Node
+	Failed    *Node
+	// Err is set when the spec raised an error.
+	Err error
+}
+
+// NewSimulationPool starts workers goroutines running simulations with
+// processors from newProcessor, which must return a fresh simulation
+// processor using the given seed. maxRuns <= 0 means no limit. Call Stop
+// when done with the pool.
+func NewSimulationPool(workers, maxRuns int, masterSeed int64, newProcessor func(seed int64) *Processor) *SimulationPool {
+	s := &SimulationPool{
+		masterSeed:   masterSeed,
+		maxRuns:      maxRuns,
+		window:       2 * workers,
+		newProcessor: newProcessor,
+		finished:     map[int]*SimulationRun{},
+		running:      map[int]*Processor{},
+		done:         make(chan struct{}, 1),
+	}
+	s.cond = sync.NewCond(&s.mu)
+	for w := 0; w < workers; w++ {
+		s.wg.Add(1)
+		go s.work()
+	}
+	return s
+}
+
+// SimulationSeed returns the seed of run i of a campaign with the given
+// master seed. It is never 0, which NewProcessor would replace with the
+// clock.
+func SimulationSeed(masterSeed int64, i int) int64 {
+	// splitmix64, so neighbouring runs get unrelated seeds.
+	z := uint64(masterSeed) + uint64(i+1)*0x9e3779b97f4a7c15
+	z = (z ^ (z >> 30)) * 0xbf58476d1ce4e5b9
+	z = (z ^ (z >> 27)) * 0x94d049bb133111eb
+	z ^= z >> 31
+	if seed := int64(z >> 1); seed != 0 {
+		return seed
+	}
+	return 1
+}
+
+func (s *SimulationPool) work() {
+	defer s.wg.Done()
+	for {
+		s.mu.Lock()
+		for !s.stopped && !s.exhausted() && s.next >= s.consumed+s.window {
+			s.cond.Wait()
+		}
+		if s.stopped || s.exhausted() {
+			s.mu.Unlock()
+			return
+		}
+		run := &SimulationRun{Index: s.next}
+		s.next++
+		s.mu.Unlock()
+
+		run.Seed = SimulationSeed(s.masterSeed, run.Index)
+		p := s.newProcessor(run.Seed)
+		run.Processor = p
+		s.mu.Lock()
+		if s.stopped {
+			p.Stop()
+		}
+		s.running[run.Index] = p
+		s.mu.Unlock()
+
+		run.Root, run.Failed, run.Err = startCatchingModelErrors(p)
+
+		s.mu.Lock()
+		delete(s.running, run.Index)
+		s.finished[run.Index] = run
+		s.mu.Unlock()
+		select {
+		case s.done <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// exhausted reports whether every run up to maxRuns has been started.
+// Called with mu held.
+func (s *SimulationPool) exhausted() bool {
+	return s.maxRuns > 0 && s.next >= s.maxRuns
+}
+
+// Next waits for the next run in index order and returns it, or nil once
+// the runs are exhausted or the pool is stopped. A non-nil budget stops the
+// pool once exceeded; since the budget is not safe for concurrent use,
+// only the goroutine calling Next polls it.
+func (s *SimulationPool) Next(budget *Budget) *SimulationRun {
+	ticker := time.NewTicker(100 * time.Millisecond)
+	defer ticker.Stop()
+	for {
+		s.mu.Lock()
+		if s.stopped || (s.maxRuns > 0 && s.consumed >= s.maxRuns) {
+			s.mu.Unlock()
+			return nil
+		}
+		if run, ok := s.finished[s.consumed]; ok {
+			delete(s.finished, s.consumed)
+			s.consumed++
+			s.cond.Broadcast()
+			s.mu.Unlock()
+			return run
+		}
+		s.mu.Unlock()
+		select {
+		case <-s.done:
+		case <-ticker.C:
+			if budget.Exceeded() != "" {
+				s.Stop()
+			}
+		}
+	}
+}
+
+// Stop stops the running simulations and waits for the workers to exit.
+// Safe to call more than once and from any goroutine.
+func (s *SimulationPool) Stop() {
+	s.mu.Lock()
+	s.stopped = true
+	for _, p := range s.running {
+		p.Stop()
+	}
+	s.cond.Broadcast()
+	s.mu.Unlock()
+	s.wg.Wait()
+}
+
+// startCatchingModelErrors starts p, returning an error raised by the spec
+// as err instead of panicking.
+func startCatchingModelErrors(p *Processor) (root *Node, failed *Node, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			modelErr, ok := r.(*ModelError)
+			if !ok {
+				panic(r)
+			}
+			root, failed, err = nil, nil, modelErr
+		}
+	}()
+	return p.Start()
+}
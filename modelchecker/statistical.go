@@ -0,0 +1,378 @@
+package modelchecker
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"slices"
+
+	ast "fizz/proto"
+	"github.com/fizzbee-io/fizzbee/lib"
+)
+
+// Statistical model checking estimates, from independent simulation runs,
+// the probability that a run satisfies each assertion of the spec. A run is
+// bounded by max_actions and judged by what it observed:
+//
+//   - always: every state of the run satisfies the assertion.
+//   - transition: every step of the run satisfies the assertion.
+//   - eventually, exists: some state of the run satisfies it (reachability).
+//   - always eventually, eventually always: the last state of the run
+//     satisfies it, the usual reading of these operators on finite runs.
+//
+// Without a threshold, the number of runs is fixed up front by the
+// Chernoff-Hoeffding bound so that each estimate is within the error bound
+// of the true probability with the requested confidence. With a threshold,
+// Wald's sequential probability ratio test (SPRT) decides for each assertion
+// whether the probability is at least the threshold, and stops as soon as
+// every assertion is decided.
+
+// Statistical property kinds, as reported in StatisticalResult.Property.
+const (
+	propertyAlways     = "always"
+	propertyTransition = "transition"
+	propertyReach      = "reachability"
+	propertyFinal      = "final"
+)
+
+// SPRT decisions, as reported in StatisticalResult.Decision.
+const (
+	DecisionHolds     = "holds"
+	DecisionFails     = "fails"
+	DecisionUndecided = "undecided"
+)
+
+// StatisticalOptions configures a StatisticalCheck.
+type StatisticalOptions struct {
+	// Confidence is the probability that the reported interval, or the SPRT
+	// decision, is right. For example 0.95.
+	Confidence float64
+	// ErrorBound is the half-width of the interval of the Chernoff-Hoeffding
+	// estimate. Unused with a threshold.
+	ErrorBound float64
+	// Threshold, when positive, selects the SPRT: it tests whether each
+	// probability is at least Threshold.
+	Threshold float64
+	// Indifference is the half-width of the region around Threshold within
+	// which the SPRT may decide either way.
+	Indifference float64
+}
+
+// StatisticalResult is the estimate for one assertion.
+type StatisticalResult struct {
+	Assertion string  `json:"assertion"`
+	Property  string  `json:"property"`
+	Runs      int     `json:"runs"`
+	Successes int     `json:"successes"`
+	Estimate  float64 `json:"estimate"`
+	// Low and High bound the probability with the requested confidence.
+	Low    float64 `json:"low"`
+	High   float64 `json:"high"`
+	Method string  `json:"method"`
+	// Decision is the outcome of the SPRT, if a threshold was given.
+	Decision string `json:"decision,omitempty"`
+}
+
+// StatisticalCheck accumulates the outcomes of simulation runs for all the
+// assertions of a spec.
+type StatisticalCheck struct {
+	options    StatisticalOptions
+	invariants []*ast.Invariant
+	results    []*StatisticalResult
+	// llr is the SPRT log-likelihood ratio of each assertion.
+	llr []float64
+}
+
+// NewStatisticalCheck prepares a check of the assertions of file.
+func NewStatisticalCheck(file *ast.File, options StatisticalOptions) (*StatisticalCheck, error) {
+	if options.Confidence <= 0 || options.Confidence >= 1 {
+		return nil, errors.New("confidence must be between 0 and 1")
+	}
+	if options.Threshold > 0 {
+		if options.Threshold >= 1 {
+			return nil, errors.New("threshold must be between 0 and 1")
+		}
+		if options.Indifference <= 0 || options.Threshold-options.Indifference <= 0 || options.Threshold+options.Indifference >= 1 {
+			return nil, fmt.Errorf("indifference region %g ± %g must be positive and within (0, 1)", options.Threshold, options.Indifference)
+		}
+	} else if options.ErrorBound <= 0 || options.ErrorBound >= 1 {
+		return nil, errors.New("error bound must be between 0 and 1")
+	}
+	s := &StatisticalCheck{options: options}
+	for _, invariant := range file.Invariants {
+		name := invariant.Name
+		if name == "" {
+			name = invariant.PyExpr
+		}
+		s.invariants = append(s.invariants, invariant)
+		s.results = append(s.results, &StatisticalResult{Assertion: name, Property: statisticalProperty(invariant), Method: s.method()})
+		s.llr = append(s.llr, 0)
+	}
+	if len(s.invariants) == 0 {
+		return nil, errors.New("the spec has no assertions to estimate")
+	}
+	return s, nil
+}
+
+func statisticalProperty(invariant *ast.Invariant) string {
+	operators := invariantOperators(invariant)
+	switch {
+	case slices.Contains(operators, "transition"):
+		return propertyTransition
+	case slices.Equal(operators, []string{"always"}):
+		return propertyAlways
+	case len(operators) == 1:
+		// eventually or exists
+		return propertyReach
+	default:
+		return propertyFinal
+	}
+}
+
+func (s *StatisticalCheck) method() string {
+	if s.options.Threshold > 0 {
+		return "sprt"
+	}
+	return "chernoff-hoeffding"
+}
+
+// RequiredRuns returns the number of runs after which the Chernoff-Hoeffding
+// estimate is within the error bound, or 0 for the SPRT, which decides when
+// to stop as the runs come in.
+func (s *StatisticalCheck) RequiredRuns() int {
+	if s.options.Threshold > 0 {
+		return 0
+	}
+	eps := s.options.ErrorBound
+	return int(math.Ceil(math.Log(2/(1-s.options.Confidence)) / (2 * eps * eps)))
+}
+
+// Record adds the outcome of the run the simulation processor p just made.
+func (s *StatisticalCheck) Record(p *Processor) {
+	path := p.simulationPath()
+	for i := range s.invariants {
+		result := s.results[i]
+		result.Runs++
+		success := runSatisfies(path, result.Property, i)
+		if success {
+			result.Successes++
+		}
+		if s.options.Threshold > 0 && result.Decision == "" {
+			// H0: the probability is at least p0; H1: at most p1.
+			p0 := s.options.Threshold + s.options.Indifference
+			p1 := s.options.Threshold - s.options.Indifference
+			if success {
+				s.llr[i] += math.Log(p1 / p0)
+			} else {
+				s.llr[i] += math.Log((1 - p1) / (1 - p0))
+			}
+			alpha := 1 - s.options.Confidence
+			if s.llr[i] >= math.Log((1-alpha)/alpha) {
+				result.Decision = DecisionFails
+			} else if s.llr[i] <= math.Log(alpha/(1-alpha)) {
+				result.Decision = DecisionHolds
+			}
+		}
+	}
+}
+
+// runSatisfies reports whether the run along path, from Init to the last
+// node, satisfies the assertion at index of the given property kind.
+func runSatisfies(path []*Node, property string, index int) bool {
+	switch property {
+	case propertyAlways:
+		for _, node := range path {
+			if node.Process != nil && slices.Contains(node.Process.FailedInvariants[0], index) {
+				return false
+			}
+		}
+		return true
+	case propertyTransition:
+		for _, node := range path {
+			if len(node.Inbound) > 0 && slices.Contains(node.Inbound[0].FailedInvariants[0], index) {
+				return false
+			}
+		}
+		return true
+	case propertyReach:
+		for _, node := range path {
+			if node.Process != nil && node.Process.Witness[0][index] {
+				return true
+			}
+		}
+		return false
+	default:
+		// Witnesses are only computed at yield points, so look at the last
+		// one.
+		for i := len(path) - 1; i >= 0; i-- {
+			if node := path[i]; node.Process != nil && (node.Process.IsYield || i == 0) {
+				return node.Process.Witness[0][index]
+			}
+		}
+		return false
+	}
+}
+
+// Done reports whether the check has enough runs: the required runs for the
+// Chernoff-Hoeffding estimate, or a decision for every assertion with the
+// SPRT.
+func (s *StatisticalCheck) Done() bool {
+	for _, result := range s.results {
+		if s.options.Threshold > 0 && result.Decision == "" {
+			return false
+		}
+		if s.options.Threshold <= 0 && result.Runs < s.RequiredRuns() {
+			return false
+		}
+	}
+	return true
+}
+
+// Results returns the estimate for each assertion so far. The interval is
+// the Hoeffding interval for the number of runs made.
+func (s *StatisticalCheck) Results() []StatisticalResult {
+	results := make([]StatisticalResult, len(s.results))
+	for i, result := range s.results {
+		r := *result
+		if r.Runs > 0 {
+			r.Estimate = float64(r.Successes) / float64(r.Runs)
+			eps := math.Sqrt(math.Log(2/(1-s.options.Confidence)) / (2 * float64(r.Runs)))
+			r.Low, r.High = max(0, r.Estimate-eps), min(1, r.Estimate+eps)
+		} else {
+			r.High = 1
+		}
+		if s.options.Threshold > 0 && r.Decision == "" {
+			r.Decision = DecisionUndecided
+		}
+		results[i] = r
+	}
+	return results
+}
+
+// PrintReport prints the estimate for each assertion.
+func (s *StatisticalCheck) PrintReport() {
+	confidence := s.options.Confidence * 100
+	for _, r := range s.Results() {
+		line := fmt.Sprintf("  %s (%s): P = %.4f, %g%% interval [%.4f, %.4f], %d/%d runs",
+			r.Assertion, r.Property, r.Estimate, confidence, r.Low, r.High, r.Successes, r.Runs)
+		if r.Decision != "" {
+			line += fmt.Sprintf(", P >= %g: %s", s.options.Threshold, r.Decision)
+		}
+		fmt.Println(line)
+	}
+}
+
+// SetStatistical makes the simulation runs of the processor suitable for
+// statistical model checking: liveness assertions are judged on the bounded
+// run by a StatisticalCheck rather than by extending the run, and when model
+// is non-nil, choices follow its transition probabilities instead of being
+// uniform. The caller must also set ContinuePathOnInvariantFailures, so that
+// a run is not cut short by a failing assertion. Must be called before Start.
+func (p *Processor) SetStatistical(model *ast.PerformanceModel) {
+	p.statistical = true
+	p.perfModel = model
+	// A run revisiting a state must go on as if it were new; with the state
+	// deduplicated, the run would pick another branch instead, skewing the
+	// probabilities.
+	p.visitedMapTracking = 2
+}
+
+// simulationPath returns the nodes of the last simulation run, from Init to
+// where the run ended.
+func (p *Processor) simulationPath() []*Node {
+	var path []*Node
+	for node := p.simulationEnd; node != nil; {
+		path = append(path, node)
+		if len(node.Inbound) == 0 {
+			break
+		}
+		node = node.Inbound[0].Node
+	}
+	slices.Reverse(path)
+	return path
+}
+
+// removeSimulationNode removes the next node of a simulation run from queue:
+// uniformly at random, or following the transition probabilities of the
+// performance model if one is set.
+func (p *Processor) removeSimulationNode(queue lib.LinearCollection[*Node]) (*Node, bool) {
+	if random, ok := queue.(*lib.RandomQueue[*Node]); ok && p.perfModel != nil {
+		return random.RemoveWeighted(p.transitionWeights)
+	}
+	return queue.Remove()
+}
+
+// transitionWeights weights the candidates of a simulation step by the
+// performance model. Candidates forked from the same node are weighted
+// among themselves as genTransitionMatrix weights the links of a node:
+// labeled branches by the probabilities of their labels, and unlabeled ones
+// share the rest evenly. Each such group keeps the share of the choice a
+// uniform pick would give it.
+func (p *Processor) transitionWeights(nodes []*Node) []float64 {
+	type group struct {
+		size, missing int
+		total         float64
+	}
+	groups := map[*Node]*group{}
+	labeled := make([]bool, len(nodes))
+	probs := make([]float64, len(nodes))
+	parents := make([]*Node, len(nodes))
+	for i, node := range nodes {
+		if len(node.Inbound) > 0 {
+			parents[i] = node.Inbound[0].Node
+		}
+		g := groups[parents[i]]
+		if g == nil {
+			g = &group{}
+			groups[parents[i]] = g
+		}
+		g.size++
+		label := nextStatementLabel(node)
+		if label == "" {
+			g.missing++
+			continue
+		}
+		labeled[i] = true
+		probs[i] = p.perfModel.Configs[label].GetProbability()
+		g.total += probs[i]
+	}
+	weights := make([]float64, len(nodes))
+	for i := range nodes {
+		g := groups[parents[i]]
+		switch {
+		case g.total == 0:
+			weights[i] = 1
+		case labeled[i]:
+			weights[i] = float64(g.size) * probs[i]
+		default:
+			weights[i] = float64(g.size) * (1 - g.total) / float64(g.missing)
+		}
+	}
+	return weights
+}
+
+// nextStatementLabel returns the label the node's next statement adds to its
+// process, e.g. "UnfairToss.head" for the `head` branch of a oneof in
+// UnfairToss, or "" if the statement has no label.
+func nextStatementLabel(node *Node) string {
+	if node.Process == nil || node.Process.Current >= len(node.Process.Threads) {
+		return ""
+	}
+	t := node.currentThread()
+	if t.Stack.Len() == 0 || t.currentFrame().pc == "" {
+		return ""
+	}
+	stmt, ok := GetProtoFieldByPath(t.currentFileAst(), t.currentFrame().pc).(*ast.Statement)
+	if !ok || stmt.Label == "" {
+		return ""
+	}
+	return t.currentFrame().Name + "." + stmt.Label
+}
+
+// String summarizes the options for the run header.
+func (o StatisticalOptions) String() string {
+	if o.Threshold > 0 {
+		return fmt.Sprintf("SPRT of P >= %g ± %g, confidence %g", o.Threshold, o.Indifference, o.Confidence)
+	}
+	return fmt.Sprintf("Chernoff-Hoeffding estimate ± %g, confidence %g", o.ErrorBound, o.Confidence)
+}
@@ -0,0 +1,200 @@
+package modelchecker
+
+import (
+	"fmt"
+	"math/rand"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Swarm runs several diversified searches of the same spec in parallel, for
+// state spaces too big to explore exhaustively. Each worker explores with
+// its own seed, strategy (random or dfs), order of trying actions and
+// max_actions bound, so together they cover more distinct corners than one
+// search order repeated. The first violation any worker finds stops them all.
+type Swarm struct {
+	Workers []*SwarmWorker
+
+	// winner is the index of the first worker that found a violation, or -1.
+	winner  atomic.Int32
+	stopped atomic.Bool
+}
+
+// SwarmWorker is one search of a swarm and its outcome.
+type SwarmWorker struct {
+	Seed       int64
+	Strategy   string
+	MaxActions int
+
+	Processor *Processor
+	Root      *Node
+	// Failed is the node that failed a safety or transition assertion.
+	Failed *Node
+	// Deadlock is a deadlocked node, if deadlock detection is enabled.
+	Deadlock *Node
+	// Err is set when the spec raised an error.
+	Err     error
+	Elapsed time.Duration
+}
+
+// NewSwarm plans n searches. The seeds of the workers are drawn from seed,
+// so the same seed plans the same swarm. Workers alternate between the
+// random and dfs strategies. Worker 0 keeps the maxActions bound; the
+// others get bounds spread down to half of it, since a shallower dfs bound
+// finds shallow violations sooner.
+func NewSwarm(n int, seed int64, maxActions int) *Swarm {
+	random := rand.New(rand.NewSource(seed))
+	s := &Swarm{}
+	s.winner.Store(-1)
+	for i := 0; i < n; i++ {
+		w := &SwarmWorker{Seed: random.Int63(), Strategy: "random", MaxActions: maxActions}
+		if i%2 == 1 {
+			w.Strategy = "dfs"
+		}
+		if n > 1 {
+			w.MaxActions = max(1, maxActions-i*(maxActions/2)/(n-1))
+		}
+		s.Workers = append(s.Workers, w)
+	}
+	return s
+}
+
+// Run runs the workers until they all finish or one finds a violation.
+// newProcessor must return a fresh processor with the worker's seed and
+// strategy; Run applies the worker's max_actions bound and action order.
+// A non-nil budget stops the swarm once exceeded.
+func (s *Swarm) Run(newProcessor func(w *SwarmWorker) *Processor, budget *Budget) {
+	for _, w := range s.Workers {
+		w.Processor = newProcessor(w)
+		w.Processor.config.Options.MaxActions = int64(w.MaxActions)
+		w.Processor.shuffleActionOrder(rand.New(rand.NewSource(w.Seed)))
+	}
+	var wg sync.WaitGroup
+	for i, w := range s.Workers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			start := time.Now()
+			s.runWorker(w)
+			w.Elapsed = time.Since(start)
+			if w.Violation() && s.winner.CompareAndSwap(-1, int32(i)) {
+				s.stopWorkers()
+			}
+		}()
+	}
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+	// The budget is not safe for concurrent use, so only this goroutine
+	// polls it.
+	ticker := time.NewTicker(100 * time.Millisecond)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-done:
+			return
+		case <-ticker.C:
+			if budget.Exceeded() != "" {
+				s.Stop()
+			}
+		}
+	}
+}
+
+func (s *Swarm) runWorker(w *SwarmWorker) {
+	p := w.Processor
+	w.Root, w.Failed, w.Err = startCatchingModelErrors(p)
+	if w.Failed != nil || w.Err != nil || p.Stopped() || !p.config.GetDeadlockDetection() {
+		return
+	}
+	_, _, w.Deadlock, _, w.Err = GetAllNodesWithTerminalStates(w.Root, int64(w.MaxActions), p.IsTerminalState)
+}
+
+// Violation reports whether the worker found a failure of any kind.
+func (w *SwarmWorker) Violation() bool {
+	return w.Failed != nil || w.Deadlock != nil || w.Err != nil
+}
+
+// Stop stops all the workers, e.g. on Ctrl-C. Safe to call from any
+// goroutine.
+func (s *Swarm) Stop() {
+	s.stopped.Store(true)
+	s.stopWorkers()
+}
+
+func (s *Swarm) stopWorkers() {
+	for _, w := range s.Workers {
+		if w.Processor != nil {
+			w.Processor.Stop()
+		}
+	}
+}
+
+// Stopped reports whether the swarm was stopped by Stop before completing.
+func (s *Swarm) Stopped() bool {
+	return s.stopped.Load()
+}
+
+// Winner returns the first worker that found a violation, or nil.
+func (s *Swarm) Winner() *SwarmWorker {
+	if i := s.winner.Load(); i >= 0 {
+		return s.Workers[i]
+	}
+	return nil
+}
+
+// Coverage returns the number of distinct states the workers visited
+// together, and the sum of the states each visited.
+func (s *Swarm) Coverage() (distinct int, total int) {
+	union := map[string]struct{}{}
+	for _, w := range s.Workers {
+		total += w.Processor.visitedCount()
+		_ = w.Processor.visited.ForEachKey(func(key []byte) error {
+			union[string(key)] = struct{}{}
+			return nil
+		})
+	}
+	return len(union), total
+}
+
+// PrintReport prints the outcome of every worker and the aggregate
+// coverage. Call after Run.
+func (s *Swarm) PrintReport() {
+	fmt.Printf("Swarm of %d workers:\n", len(s.Workers))
+	depth := 0
+	for i, w := range s.Workers {
+		status := "completed"
+		switch {
+		case w.Violation():
+			status = "violation"
+		case w.Processor.Stopped():
+			status = "stopped"
+		}
+		if s.Winner() == w {
+			status += " (first)"
+		}
+		fmt.Printf("  worker %d: %-6s seed=%d max_actions=%d: %d states, %d unique, depth %d, %s, %s\n",
+			i, w.Strategy, w.Seed, w.MaxActions, w.Processor.visitedCount(), w.Processor.uniqueYieldCount,
+			w.Processor.depthReached, w.Elapsed.Round(time.Millisecond), status)
+		depth = max(depth, w.Processor.depthReached)
+	}
+	distinct, total := s.Coverage()
+	overlap := 0.0
+	if total > 0 {
+		overlap = 100 * float64(total-distinct) / float64(total)
+	}
+	fmt.Printf("Swarm coverage: %d distinct states (%d visited in total, %.1f%% overlap), max depth %d\n",
+		distinct, total, overlap, depth)
+}
+
+// shuffleActionOrder makes the processor try the actions of the spec and
+// of each role in an order drawn from random, instead of declaration order.
+func (p *Processor) shuffleActionOrder(random *rand.Rand) {
+	p.actionOrder = [][]int{random.Perm(len(p.Files[0].Actions))}
+	for _, role := range p.Files[0].Roles {
+		p.actionOrder = append(p.actionOrder, random.Perm(len(role.Actions)))
+	}
+}
@@ -13,16 +13,33 @@ type GuidedTrace struct {
 	currentIndex int
 	ExtendDepth  int // How many actions to explore after trace ends (0 = stop)
 	extendedCount int // How many extended actions taken so far
+
+	// HasCycle is set when the trace has a TraceCycleMarker line: the links
+	// from CycleStart on return to the state the links before it reach, as
+	// in a liveness counterexample.
+	HasCycle   bool
+	CycleStart int
+	// end is the node that took the last link of the trace.
+	end *Node
 }
 
+// TraceCycleMarker is the comment line that marks the start of the cycle of
+// a lasso-shaped trace.
+const TraceCycleMarker = "# cycle: the steps below repeat forever"
+
 // parseTrace parses trace content from a scanner
 // Format: Each non-empty, non-comment line is a link name
-func parseTrace(scanner *bufio.Scanner) ([]string, error) {
+func parseTrace(scanner *bufio.Scanner) ([]string, int, error) {
 	var linkNames []string
+	cycleStart := -1
 
 	for scanner.Scan() {
 		line := strings.TrimSpace(scanner.Text())
 
+		if line == TraceCycleMarker {
+			cycleStart = len(linkNames)
+			continue
+		}
 		// Skip empty lines and comments
 		if line == "" || strings.HasPrefix(line, "#") {
 			continue
@@ -32,14 +49,18 @@ func parseTrace(scanner *bufio.Scanner) ([]string, error) {
 	}
 
 	if err := scanner.Err(); err != nil {
-		return nil, err
+		return nil, -1, err
 	}
 
 	if len(linkNames) == 0 {
-		return nil, fmt.Errorf("trace is empty")
+		return nil, -1, fmt.Errorf("trace is empty")
 	}
 
-	return linkNames, nil
+	return linkNames, cycleStart, nil
+}
+
+func newGuidedTrace(linkNames []string, cycleStart int) *GuidedTrace {
+	return &GuidedTrace{LinkNames: linkNames, HasCycle: cycleStart >= 0, CycleStart: cycleStart}
 }
 
 // ParseTraceFile reads and parses a trace file
@@ -51,23 +72,23 @@ func ParseTraceFile(filename string) (*GuidedTrace, error) {
 	}
 	defer file.Close()
 
-	linkNames, err := parseTrace(bufio.NewScanner(file))
+	linkNames, cycleStart, err := parseTrace(bufio.NewScanner(file))
 	if err != nil {
 		return nil, fmt.Errorf("error reading trace file: %w", err)
 	}
 
-	return &GuidedTrace{LinkNames: linkNames}, nil
+	return newGuidedTrace(linkNames, cycleStart), nil
 }
 
 // ParseTraceString parses a trace from a string
 // Format: Each non-empty, non-comment line is a link name
 func ParseTraceString(content string) (*GuidedTrace, error) {
-	linkNames, err := parseTrace(bufio.NewScanner(strings.NewReader(content)))
+	linkNames, cycleStart, err := parseTrace(bufio.NewScanner(strings.NewReader(content)))
 	if err != nil {
 		return nil, fmt.Errorf("error parsing trace string: %w", err)
 	}
 
-	return &GuidedTrace{LinkNames: linkNames}, nil
+	return newGuidedTrace(linkNames, cycleStart), nil
 }
 
 // GetNextLinkName returns the next expected link name
@@ -149,6 +170,9 @@ func (p *Processor) ShouldScheduleNode(node *Node) bool {
 	if linkName == expectedLinkName {
 		node.guidedTrace.Advance()
 		p.guidedTrace.Advance()
+		if p.guidedTrace.IsExhausted() {
+			p.guidedTrace.end = node
+		}
 		return true
 	}
 
@@ -0,0 +1,151 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	ast "fizz/proto"
+	"fmt"
+	"github.com/fizzbee-io/fizzbee/lib"
+	"github.com/fizzbee-io/fizzbee/modelchecker"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+)
+
+// analyzePerformance runs with --perf_model the Markov chain analysis of the
+// graph of a passing model check, and writes it next to the graph as
+// performance.json, performance_histogram.csv and, when the counters were
+// sampled, performance_distributions.csv.
+func analyzePerformance(f *ast.File, nodes []*modelchecker.Node, yields int, outDir string) error {
+	perfModel, err := readPerformanceModel()
+	if err != nil {
+		return err
+	}
+	startTime := time.Now()
+	report := modelchecker.AnalyzePerformance(f, nodes, yields, perfModel, modelchecker.PerformanceOptions{
+		Method:  perfMethod,
+		Samples: perfSamples,
+	})
+	report.PrintReport()
+	if !isTest {
+		fmt.Printf("Time taken for performance analysis: %v\n", time.Since(startTime))
+	}
+
+	data, err := json.MarshalIndent(report, "", "  ")
+	if err != nil {
+		return err
+	}
+	jsonFileName := filepath.Join(outDir, "performance.json")
+	if err := os.WriteFile(jsonFileName, data, 0644); err != nil {
+		return err
+	}
+	csvFileName := filepath.Join(outDir, "performance_histogram.csv")
+	if err := writePerformanceHistogram(report, csvFileName); err != nil {
+		return err
+	}
+	if len(report.Distributions) > 0 {
+		csvFileName = filepath.Join(outDir, "performance_distributions.csv")
+		if err := writePerformanceDistributions(report, csvFileName); err != nil {
+			return err
+		}
+	}
+	fmt.Printf("Wrote performance analysis to %s\n", outDir)
+	return nil
+}
+
+// exportPrism writes with --prism_export the graph of a passing model check
+// in the PRISM explicit-model format to the prism dir of outDir.
+func exportPrism(f *ast.File, nodes []*modelchecker.Node, outDir string) error {
+	var perfModel *ast.PerformanceModel
+	if perfModelFile != "" {
+		var err error
+		if perfModel, err = readPerformanceModel(); err != nil {
+			return err
+		}
+	}
+	prismDir := filepath.Join(outDir, "prism")
+	fileNames, err := modelchecker.GeneratePrismFiles(f, nodes, perfModel, prismDir+"/")
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Wrote %d PRISM files to dir %s\n", len(fileNames), prismDir)
+	return nil
+}
+
+// readPerformanceModel reads and validates the --perf_model file.
+func readPerformanceModel() (*ast.PerformanceModel, error) {
+	perfModel := &ast.PerformanceModel{}
+	if err := lib.ReadProtoFromFile(perfModelFile, perfModel); err != nil {
+		return nil, fmt.Errorf("reading --perf_model: %w", err)
+	}
+	if err := modelchecker.ValidatePerformanceModel(perfModel); err != nil {
+		return nil, fmt.Errorf("--perf_model: %w", err)
+	}
+	return perfModel, nil
+}
+
+// writePerformanceHistogram writes the counter histograms of the report as
+// CSV, one row per point. The analysis column is "steady_state" for the
+// chain from the initial state, and the assertion name for the costs of
+// reaching a liveness assertion.
+func writePerformanceHistogram(report *modelchecker.PerformanceReport, fileName string) error {
+	file, err := os.Create(fileName)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	counters := report.CounterNames()
+	w := csv.NewWriter(file)
+	w.Write(append([]string{"analysis", "probability"}, counters...))
+	writeRows := func(analysis string, histogram []modelchecker.CounterPercentile) {
+		for _, point := range histogram {
+			row := []string{analysis, strconv.FormatFloat(point.Probability, 'g', -1, 64)}
+			for _, name := range counters {
+				row = append(row, strconv.FormatFloat(point.Counters[name], 'g', -1, 64))
+			}
+			w.Write(row)
+		}
+	}
+	writeRows("steady_state", report.Histogram)
+	for _, liveness := range report.Liveness {
+		writeRows(liveness.Assertion, liveness.Histogram)
+	}
+	w.Flush()
+	return w.Error()
+}
+
+// writePerformanceDistributions writes the counter distributions of the
+// report as CSV, one row per counter.
+func writePerformanceDistributions(report *modelchecker.PerformanceReport, fileName string) error {
+	file, err := os.Create(fileName)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	w := csv.NewWriter(file)
+	header := []string{"counter", "samples", "mean", "stddev", "min"}
+	format := func(v float64) string { return strconv.FormatFloat(v, 'g', -1, 64) }
+	for _, name := range report.CounterNames() {
+		d, ok := report.Distributions[name]
+		if !ok {
+			continue
+		}
+		if header != nil {
+			for _, q := range d.Percentiles {
+				header = append(header, "p"+format(q.Percentile*100))
+			}
+			w.Write(append(header, "max"))
+			header = nil
+		}
+		row := []string{name, strconv.Itoa(d.Samples), format(d.Mean), format(d.StdDev), format(d.Min)}
+		for _, q := range d.Percentiles {
+			row = append(row, format(q.Value))
+		}
+		w.Write(append(row, format(d.Max)))
+	}
+	w.Flush()
+	return w.Error()
+}
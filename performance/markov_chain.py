@@ -17,6 +17,31 @@ class Metrics:
         return f"Metrics(mean={self.mean}, histogram={self.histogram})"
 
 
+def counter_mean(counter):
+    """
+    The expected value added to the counter: the mean of its distribution if it has one, else numeric.
+    Matches counterMean in modelchecker/performance_distribution.go.
+    """
+    if not counter.HasField('distribution'):
+        return counter.numeric
+    d = counter.distribution
+    kind = d.WhichOneof('kind')
+    if kind == 'constant':
+        return d.constant
+    if kind == 'uniform':
+        return (d.uniform.min + d.uniform.max) / 2
+    if kind == 'normal':
+        return d.normal.mean
+    if kind == 'exponential':
+        return d.exponential.mean
+    if kind == 'empirical':
+        values, weights = d.empirical.values, d.empirical.weights
+        if len(weights) == 0:
+            return sum(values) / len(values)
+        return sum(v * w for v, w in zip(values, weights)) / sum(weights)
+    return counter.numeric
+
+
 # def update_transition_matrix(matrix, links):
 #     for link in links.links:
 #         matrix[link.src][link.dest] += link.weight
@@ -150,7 +175,7 @@ def create_cost_matrices_sparse(links, model):
                     continue
                 config = model.configs[label]
                 for counter in config.counters:
-                    link_prob *= config.counters[counter].numeric
+                    link_prob *= counter_mean(config.counters[counter])
             total_prob += link_prob
             relative_probs.append(link_prob)
 
@@ -160,7 +185,7 @@ def create_cost_matrices_sparse(links, model):
                     continue
                 config = model.configs[label]
                 for counter in config.counters:
-                    cost_matrices[counter][link.src,link.dest] += (relative_probs[i] / total_prob) * config.counters[counter].numeric
+                    cost_matrices[counter][link.src,link.dest] += (relative_probs[i] / total_prob) * counter_mean(config.counters[counter])
 
     csr_matrices = {}
     for counter in cost_matrices:
@@ -188,7 +213,7 @@ def create_cost_matrices(links, model):
             config = model.configs[label]
             for counter in config.counters:
                 # print(counter, link.src, link.dest, config.counters[counter])
-                cost_matrices[counter][link.src][link.dest] += config.counters[counter].numeric
+                cost_matrices[counter][link.src][link.dest] += counter_mean(config.counters[counter])
 
     print('cost_matrices', cost_matrices)
     return cost_matrices
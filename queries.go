@@ -0,0 +1,48 @@
+package main
+
+import (
+	"encoding/json"
+	ast "fizz/proto"
+	"fmt"
+	"github.com/fizzbee-io/fizzbee/modelchecker"
+	"os"
+	"path/filepath"
+)
+
+// evaluateQueries evaluates with --queries the probabilistic queries on the
+// graph of a passing model check, prints the results and writes them to
+// queries.json. The queries only report; they do not fail the model check.
+func evaluateQueries(nodes []*modelchecker.Node, outDir string) error {
+	text, err := os.ReadFile(queriesFile)
+	if err != nil {
+		return fmt.Errorf("reading --queries: %w", err)
+	}
+	queries, err := modelchecker.ParseQueries(string(text))
+	if err != nil {
+		return fmt.Errorf("--queries: %w", err)
+	}
+	var perfModel *ast.PerformanceModel
+	if perfModelFile != "" {
+		if perfModel, err = readPerformanceModel(); err != nil {
+			return err
+		}
+	}
+	results := modelchecker.EvaluateQueries(queries, nodes, perfModel)
+	fmt.Println("Queries:")
+	for _, result := range results {
+		switch {
+		case result.Error != "":
+			fmt.Printf("  %s: error: %s\n", result.Query, result.Error)
+		case result.Satisfied != nil:
+			fmt.Printf("  %s: %t (%.6g)\n", result.Query, *result.Satisfied, result.Value)
+		default:
+			fmt.Printf("  %s: %.6g\n", result.Query, result.Value)
+		}
+	}
+
+	data, err := json.MarshalIndent(results, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(outDir, "queries.json"), data, 0644)
+}
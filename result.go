@@ -0,0 +1,243 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	ast "fizz/proto"
+	"fmt"
+	"github.com/fizzbee-io/fizzbee/modelchecker"
+	"os"
+	"path/filepath"
+	"slices"
+	"time"
+)
+
+// Exit codes of the model checker. A run that checks several specs (refinement
+// or composition) exits with the code of the first spec that did not pass.
+const (
+	exitPassed        = 0 // all checks passed
+	exitError         = 1 // invalid flags or spec, or an internal error
+	exitSafety        = 2 // an always assertion failed
+	exitTransition    = 3 // a transition assertion failed
+	exitLiveness      = 4 // a liveness assertion failed
+	exitDeadlock      = 5 // a deadlock was found
+	exitExistsWitness = 6 // an exists assertion was never satisfied
+	exitRuntimeError  = 7 // the spec raised an error while being checked
+	exitStopped       = 8 // stopped by a budget or Ctrl-C before completing
+	exitProbability   = 9 // --smc decided a probability is below --smc_threshold
+)
+
+const exitCodesHelp = `Exit codes:
+  0  passed
+  1  invalid flags or spec, or internal error
+  2  safety (always) assertion failed
+  3  transition assertion failed
+  4  liveness assertion failed
+  5  deadlock detected
+  6  exists assertion never satisfied
+  7  runtime error in the spec
+  8  stopped by --max_time, --max_memory or Ctrl-C before completing
+  9  a probability was decided to be below --smc_threshold
+`
+
+// Run statuses in result.json.
+const (
+	statusPassed  = "passed"
+	statusFailed  = "failed"
+	statusStopped = "stopped"
+	statusError   = "error"
+)
+
+// Failure kinds in result.json.
+const (
+	failureSafety        = "safety"
+	failureTransition    = "transition"
+	failureLiveness      = "liveness"
+	failureDeadlock      = "deadlock"
+	failureExistsWitness = "exists-witness"
+	failureRuntimeError  = "runtime-error"
+	failureProbability   = "probability"
+)
+
+var failureExitCodes = map[string]int{
+	failureSafety:        exitSafety,
+	failureTransition:    exitTransition,
+	failureLiveness:      exitLiveness,
+	failureDeadlock:      exitDeadlock,
+	failureExistsWitness: exitExistsWitness,
+	failureRuntimeError:  exitRuntimeError,
+	failureProbability:   exitProbability,
+}
+
+// exitCode is the process exit code, set by the first spec that does not
+// pass.
+var exitCode = exitPassed
+
+// runResult is the machine-readable outcome of checking one spec, written
+// to result.json in the output dir.
+type runResult struct {
+	Status   string                      `json:"status"`
+	ExitCode int                         `json:"exit_code"`
+	Spec     string                      `json:"spec"`
+	Mode     string                      `json:"mode"`
+	Failure  *runFailure                 `json:"failure,omitempty"`
+	Error    string                      `json:"error,omitempty"`
+	Stats    runStats                    `json:"stats"`
+	Partial  *modelchecker.PartialReport `json:"partial,omitempty"`
+	// Statistical holds the estimates of --smc.
+	Statistical []modelchecker.StatisticalResult `json:"statistical,omitempty"`
+
+	start time.Time
+}
+
+type runFailure struct {
+	Kind      string          `json:"kind"`
+	Invariant string          `json:"invariant,omitempty"`
+	Message   string          `json:"message,omitempty"`
+	Location  *sourceLocation `json:"location,omitempty"`
+	// Trace is the sequence of link names from Init to the failure.
+	Trace []string `json:"trace,omitempty"`
+	Seed  int64    `json:"seed,omitempty"`
+}
+
+type sourceLocation struct {
+	File   string `json:"file,omitempty"`
+	Line   int32  `json:"line,omitempty"`
+	Column int32  `json:"column,omitempty"`
+}
+
+type runStats struct {
+	States         int     `json:"states"`
+	UniqueStates   int     `json:"unique_states"`
+	SimulationRuns int     `json:"simulation_runs,omitempty"`
+	ElapsedSeconds float64 `json:"elapsed_seconds,omitempty"`
+}
+
+func newRunResult(sourceFileName string) *runResult {
+	mode := "model_checking"
+	if simulation {
+		mode = "simulation"
+	}
+	return &runResult{
+		Status:   statusError,
+		ExitCode: exitError,
+		Spec:     sourceFileName,
+		Mode:     mode,
+		start:    time.Now(),
+	}
+}
+
+func (r *runResult) setStats(p *modelchecker.Processor, runs int) {
+	r.Stats.States = p.GetVisitedNodesCount()
+	r.Stats.UniqueStates = p.GetUniqueYieldCount()
+	if simulation {
+		r.Stats.SimulationRuns = runs
+	}
+}
+
+func (r *runResult) pass() {
+	r.Status = statusPassed
+	r.ExitCode = exitPassed
+}
+
+// stop records a run stopped before completing. report may be nil.
+func (r *runResult) stop(report *modelchecker.PartialReport) {
+	r.Status = statusStopped
+	r.ExitCode = exitStopped
+	r.Partial = report
+}
+
+func (r *runResult) setError(msg string) {
+	r.Status = statusError
+	r.ExitCode = exitError
+	r.Error = msg
+}
+
+// fail records a failure of the given kind. invariant may be nil.
+func (r *runResult) fail(kind string, invariant *ast.Invariant, trace []string) {
+	r.Status = statusFailed
+	r.ExitCode = failureExitCodes[kind]
+	r.Failure = &runFailure{Kind: kind, Trace: trace}
+	if invariant != nil {
+		r.Failure.Invariant = invariant.Name
+		if r.Failure.Invariant == "" {
+			r.Failure.Invariant = invariant.PyExpr
+		}
+		r.Failure.Location = newSourceLocation(invariant.GetSourceInfo(), r.Spec)
+	}
+}
+
+// failInvariant records an assertion failure, classified as a transition or
+// safety failure by the invariant's temporal operators.
+func (r *runResult) failInvariant(invariant *ast.Invariant, trace []string) {
+	kind := failureSafety
+	if invariant != nil && slices.Contains(invariant.TemporalOperators, "transition") {
+		kind = failureTransition
+	}
+	r.fail(kind, invariant, trace)
+}
+
+// setRunError records an error returned by the model checker: a runtime
+// error failure if the spec raised it, an internal error otherwise.
+func (r *runResult) setRunError(err error) {
+	var modelErr *modelchecker.ModelError
+	if !errors.As(err, &modelErr) {
+		r.setError(err.Error())
+		return
+	}
+	r.fail(failureRuntimeError, nil, nil)
+	r.Failure.Message = modelErr.Msg
+	r.Failure.Location = newSourceLocation(modelErr.SourceInfo, r.Spec)
+}
+
+// failSpec records that a spec checked before the composition or refinement
+// itself did not pass. That spec's result set the exit code.
+func (r *runResult) failSpec(name string) {
+	r.Status = statusFailed
+	if exitCode != exitPassed {
+		r.ExitCode = exitCode
+	}
+	r.Error = fmt.Sprintf("spec %s did not pass", name)
+}
+
+func newSourceLocation(info *ast.SourceInfo, defaultFile string) *sourceLocation {
+	if info == nil {
+		return nil
+	}
+	loc := &sourceLocation{
+		File:   info.GetFileName(),
+		Line:   info.GetStart().GetLine(),
+		Column: info.GetStart().GetColumn(),
+	}
+	if loc.File == "" {
+		loc.File = defaultFile
+	}
+	return loc
+}
+
+// linkNames returns the names of the links of a failure path.
+func linkNames(path []*modelchecker.Link) []string {
+	names := make([]string, len(path))
+	for i, link := range path {
+		names[i] = link.Name
+	}
+	return names
+}
+
+// finish writes result.json to outDir and records the exit code.
+func (r *runResult) finish(outDir string) {
+	if !isTest {
+		r.Stats.ElapsedSeconds = time.Since(r.start).Seconds()
+	}
+	if exitCode == exitPassed {
+		exitCode = r.ExitCode
+	}
+	data, err := json.MarshalIndent(r, "", "  ")
+	if err != nil {
+		fmt.Println("Error encoding result:", err)
+		return
+	}
+	if err := os.WriteFile(filepath.Join(outDir, "result.json"), data, 0644); err != nil {
+		fmt.Println("Error writing result:", err)
+	}
+}
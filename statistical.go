@@ -0,0 +1,116 @@
+package main
+
+import (
+	ast "fizz/proto"
+	"fmt"
+	"github.com/fizzbee-io/fizzbee/lib"
+	"github.com/fizzbee-io/fizzbee/modelchecker"
+	"time"
+)
+
+// modelCheckStatistical estimates with --smc the probability that a
+// simulation run satisfies each assertion of the spec, running until the
+// requested confidence and error bound are met.
+func modelCheckStatistical(f *ast.File, stateConfig *ast.StateSpaceOptions, dirPath string, outDir string, sourceFileName string,
+	hashes modelchecker.JoinHashes, preinitHookContent string, result *runResult) *modelchecker.Node {
+	result.Mode = "statistical"
+	options := modelchecker.StatisticalOptions{
+		Confidence:   smcConfidence,
+		ErrorBound:   smcError,
+		Threshold:    smcThreshold,
+		Indifference: smcIndifference,
+	}
+	check, err := modelchecker.NewStatisticalCheck(f, options)
+	if err != nil {
+		fmt.Println("Error:", err)
+		result.setError(err.Error())
+		return nil
+	}
+	var perfModel *ast.PerformanceModel
+	if perfModelFile != "" {
+		perfModel = &ast.PerformanceModel{}
+		if err := lib.ReadProtoFromFile(perfModelFile, perfModel); err != nil {
+			fmt.Println("Error reading --perf_model:", err)
+			result.setError(fmt.Sprintf("reading --perf_model: %v", err))
+			return nil
+		}
+		if err := modelchecker.ValidatePerformanceModel(perfModel); err != nil {
+			fmt.Println("Error in --perf_model:", err)
+			result.setError(fmt.Sprintf("--perf_model: %v", err))
+			return nil
+		}
+	}
+	// Every assertion is judged on the whole run, so a failing one must not
+	// end it early.
+	stateConfig.ContinuePathOnInvariantFailures = true
+
+	masterSeed := simMasterSeed
+	if masterSeed == 0 {
+		masterSeed = time.Now().UnixMicro()
+	}
+	fmt.Printf("Statistical model checking: %s. Master seed: %d\n", options, masterSeed)
+	runLimit := check.RequiredRuns()
+	if runLimit > 0 {
+		fmt.Printf("Runs required: %d\n", runLimit)
+	}
+	if maxRuns > 0 && (runLimit == 0 || maxRuns < runLimit) {
+		runLimit = maxRuns
+	}
+	var budget *modelchecker.Budget
+	if maxTime > 0 || maxMemoryBytes > 0 {
+		budget = modelchecker.NewBudget(maxTime, maxMemoryBytes)
+	}
+
+	// Run i uses the seed derived from the master seed and i, on any number
+	// of workers, so the same master seed repeats the same campaign.
+	pool := modelchecker.NewSimulationPool(simWorkers, runLimit, masterSeed, func(seed int64) *modelchecker.Processor {
+		p := modelchecker.NewProcessor([]*ast.File{f}, stateConfig, true, seed, dirPath, explorationStrategy, isTest, hashes, nil, preinitHookContent)
+		p.SetStatistical(perfModel)
+		return p
+	})
+	defer pool.Stop()
+	setupSignalHandler(pool.Stop)
+
+	startTime := time.Now()
+	runs := 0
+	for !check.Done() {
+		run := pool.Next(budget)
+		if run == nil {
+			break
+		}
+		if run.Err != nil {
+			fmt.Println("seed:", run.Seed)
+			result.setRunError(run.Err)
+			printTrace(run.Err)
+			return nil
+		}
+		check.Record(run.Processor)
+		runs++
+	}
+	pool.Stop()
+	if !isTest {
+		fmt.Printf("Time taken for %d runs: %v\n", runs, time.Since(startTime))
+	}
+	check.PrintReport()
+	result.Statistical = check.Results()
+	result.Stats.SimulationRuns = runs
+
+	for i, r := range result.Statistical {
+		if r.Decision == modelchecker.DecisionFails {
+			fmt.Printf("FAILED: the probability of %s is below %g\n", r.Assertion, smcThreshold)
+			result.fail(failureProbability, f.Invariants[i], nil)
+			return nil
+		}
+	}
+	if !check.Done() {
+		if reason := budget.Exceeded(); reason != "" {
+			fmt.Println("Stopped:", reason)
+		}
+		fmt.Println("Stopped before reaching the requested bound; the intervals above are for the runs made.")
+		result.stop(nil)
+		return nil
+	}
+	fmt.Println("PASSED: Statistical model checking completed")
+	result.pass()
+	return nil
+}
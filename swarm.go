@@ -0,0 +1,96 @@
+package main
+
+import (
+	ast "fizz/proto"
+	"fmt"
+	"github.com/fizzbee-io/fizzbee/modelchecker"
+	"os"
+	"time"
+)
+
+// modelCheckSwarm checks the spec with --swarm diversified searches instead
+// of one exhaustive search, and reports the first violation found.
+func modelCheckSwarm(f *ast.File, stateConfig *ast.StateSpaceOptions, dirPath string, outDir string, sourceFileName string,
+	hashes modelchecker.JoinHashes, preinitHookContent string, result *runResult) *modelchecker.Node {
+	masterSeed := seed
+	if masterSeed == 0 {
+		masterSeed = time.Now().UnixMicro()
+	}
+	fmt.Printf("Swarm: %d workers, seed %d\n", swarm, masterSeed)
+	s := modelchecker.NewSwarm(swarm, masterSeed, int(stateConfig.GetOptions().GetMaxActions()))
+	var budget *modelchecker.Budget
+	if maxTime > 0 || maxMemoryBytes > 0 {
+		budget = modelchecker.NewBudget(maxTime, maxMemoryBytes)
+	}
+	setupSignalHandler(s.Stop)
+
+	startTime := time.Now()
+	s.Run(func(w *modelchecker.SwarmWorker) *modelchecker.Processor {
+		p := modelchecker.NewProcessor([]*ast.File{f}, stateConfig, false, w.Seed, dirPath, w.Strategy, isTest, hashes, nil, preinitHookContent)
+		p.SetExperimentalNoStateReturns(experimentalNoStateReturns)
+		p.SetDisableSymmetryReduction(noSymmetryReduction)
+		if err := p.SetFingerprintBits(fingerprintBits); err != nil {
+			fmt.Println("Error:", err)
+			os.Exit(1)
+		}
+		return p
+	}, budget)
+	if !isTest {
+		fmt.Printf("Time taken for model checking: %v\n", time.Since(startTime))
+	}
+	s.PrintReport()
+
+	// Only the union of the visited sets is known; the unique states of
+	// the widest worker are a lower bound for the swarm's.
+	result.Stats.States, _ = s.Coverage()
+	for _, w := range s.Workers {
+		result.Stats.UniqueStates = max(result.Stats.UniqueStates, w.Processor.GetUniqueYieldCount())
+	}
+
+	w := s.Winner()
+	if w == nil {
+		if reason := budget.Exceeded(); reason != "" {
+			fmt.Println("Stopped:", reason)
+		}
+		if s.Stopped() {
+			fmt.Println("Model checker stopped")
+			result.stop(nil)
+			return nil
+		}
+		fmt.Println("PASSED: Swarm found no violation")
+		result.pass()
+		return s.Workers[0].Root
+	}
+
+	fmt.Printf("Found by a %s search with seed %d and max_actions %d. Rerun with --swarm=%d --seed=%d to repeat the swarm.\n",
+		w.Strategy, w.Seed, w.MaxActions, swarm, masterSeed)
+	if w.Err != nil {
+		result.setRunError(w.Err)
+		printTrace(w.Err)
+		return nil
+	}
+	failedNode := w.Failed
+	var deadlock []*modelchecker.DisabledAction
+	if failedNode == nil {
+		failedNode = w.Deadlock
+		deadlock = w.Processor.ExplainDeadlock(failedNode)
+		fmt.Println("DEADLOCK detected")
+		fmt.Println("FAILED: Model checker failed")
+		result.fail(failureDeadlock, nil, linkNames(modelchecker.ExtractFailurePath(failedNode, w.Root)))
+	} else {
+		trace := linkNames(modelchecker.ExtractFailurePath(failedNode, w.Root))
+		if len(failedNode.FailedInvariants) > 0 && len(failedNode.FailedInvariants[0]) > 0 {
+			fmt.Println("FAILED: Model checker failed. Invariant: ", f.Invariants[failedNode.FailedInvariants[0][0]].Name)
+			result.failInvariant(f.Invariants[failedNode.FailedInvariants[0][0]], trace)
+		} else if len(failedNode.Inbound) > 0 && len(failedNode.Inbound[0].FailedInvariants) > 0 && len(failedNode.Inbound[0].FailedInvariants[0]) > 0 {
+			fmt.Println("FAILED: Model checker failed. Transition Invariant:", f.Invariants[failedNode.Inbound[0].FailedInvariants[0][0]].Name)
+			result.fail(failureTransition, f.Invariants[failedNode.Inbound[0].FailedInvariants[0][0]], trace)
+		} else {
+			fmt.Println("FAILED: Model checker failed")
+			result.failInvariant(nil, trace)
+		}
+	}
+	result.Failure.Seed = masterSeed
+	dumpFailedNode(sourceFileName, failedNode, w.Root, deadlock, outDir)
+	return nil
+}